@@ -8,6 +8,7 @@ import (
 	"github.com/hefeiyu25/pan-client/internal"
 	"github.com/hefeiyu25/pan-client/pan"
 	"github.com/hefeiyu25/pan-client/pan/driver/cloudreve"
+	"github.com/hefeiyu25/pan-client/pan/driver/local"
 	"github.com/hefeiyu25/pan-client/pan/driver/quark"
 	"github.com/hefeiyu25/pan-client/pan/driver/thunder_browser"
 )
@@ -18,6 +19,7 @@ type clientOptions struct {
 	ctx            context.Context
 	downloadConfig pan.DownloadConfig
 	proxyConfig    pan.ProxyConfig
+	journal        pan.Journal
 }
 
 // ClientOption configures a client.
@@ -68,6 +70,22 @@ func WithProxy(proxyURL string) ClientOption {
 	}
 }
 
+// WithJournal sets the journal that records resumable uploads and chunked
+// downloads. Defaults to an in-memory journal.
+func WithJournal(j pan.Journal) ClientOption {
+	return func(o *clientOptions) {
+		o.journal = j
+	}
+}
+
+// WithJournalPath keeps the journal in dir, so interrupted transfers resume
+// after a restart when the same request is issued again.
+func WithJournalPath(dir string) ClientOption {
+	return func(o *clientOptions) {
+		o.journal = pan.NewFileJournal(dir)
+	}
+}
+
 func applyOpts(opts []ClientOption) (*clientOptions, context.CancelFunc) {
 	o := &clientOptions{ctx: context.Background()}
 	for _, opt := range opts {
@@ -149,8 +167,33 @@ func NewCloudreveClient(props cloudreve.CloudreveProperties, opts ...ClientOptio
 	return d, nil
 }
 
+// NewLocalClient creates a new Local driver backed by a directory on disk.
+func NewLocalClient(props local.LocalProperties, opts ...ClientOption) (pan.Driver, error) {
+	o, cancel := applyOpts(opts)
+	d := &local.Local{
+		PropertiesOperate: pan.PropertiesOperate[*local.LocalProperties]{
+			Properties: &props,
+			DriverType: pan.Local,
+			OnChange:   o.onChange,
+		},
+		CacheOperate:  pan.NewCacheOperate(),
+		CommonOperate: pan.CommonOperate{},
+	}
+	d.BaseOperate = newBaseOperate(o, cancel)
+	internal.SetDefaultByTag(d.Properties)
+	id, err := d.Init()
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	pan.StoreDriver(id, d)
+	return d, nil
+}
+
 func newBaseOperate(o *clientOptions, cancel context.CancelFunc) pan.BaseOperate {
-	return pan.NewBaseOperate(o.downloadConfig, o.proxyConfig, o.ctx, cancel)
+	b := pan.NewBaseOperate(o.downloadConfig, o.proxyConfig, o.ctx, cancel)
+	b.Journal = o.journal
+	return b
 }
 
 // RemoveDriver removes a cached driver by id.
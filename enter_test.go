@@ -1,16 +1,36 @@
 package pan_client
 
 import (
+	"bytes"
 	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
 	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/hefeiyu25/pan-client/internal"
 	"github.com/hefeiyu25/pan-client/pan"
+	"github.com/hefeiyu25/pan-client/pan/driver/cloudreve"
+	"github.com/hefeiyu25/pan-client/pan/driver/local"
 	"github.com/hefeiyu25/pan-client/pan/driver/quark"
+	"github.com/hefeiyu25/pan-client/pan/driver/thunder_browser"
+	"github.com/hefeiyu25/pan-client/pan/pantest"
+	pansync "github.com/hefeiyu25/pan-client/pan/sync"
 )
 
 // ==========================================================
@@ -562,3 +582,1625 @@ func TestUploadFile(t *testing.T) {
 	}
 	t.Log("上传的文件未在列表中找到（可能服务端延迟）")
 }
+
+// ==========================================================
+// 本地驱动测试（不依赖网络）
+// ==========================================================
+
+func getLocalClient(t *testing.T, opts ...ClientOption) pan.Driver {
+	t.Helper()
+	Init()
+	client, err := NewLocalClient(local.LocalProperties{
+		RootPath: t.TempDir(),
+	}, opts...)
+	if err != nil {
+		t.Fatalf("create local client: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = client.Close()
+		RemoveDriver(client.GetId())
+	})
+	return client
+}
+
+// TestLocalContextOperate 调用方 ctx 与客户端 ctx 任一取消都会中断操作
+func TestLocalContextOperate(t *testing.T) {
+	clientCtx, clientCancel := context.WithCancel(context.Background())
+	client := getLocalClient(t, WithContext(clientCtx))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	if _, err := client.MkdirCtx(ctx, pan.MkdirReq{NewPath: testRoot}); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	cancel()
+	if _, err := client.ListCtx(ctx, pan.ListReq{Dir: testRootDir(), Reload: true}); err == nil {
+		t.Fatal("list with cancelled ctx succeeded")
+	}
+	if _, err := client.List(pan.ListReq{Dir: testRootDir(), Reload: true}); err != nil {
+		t.Fatalf("list after caller cancel: %v", err)
+	}
+
+	clientCancel()
+	if _, err := client.ListCtx(context.Background(), pan.ListReq{Dir: testRootDir(), Reload: true}); err == nil {
+		t.Fatal("list after client cancel succeeded")
+	}
+}
+
+// TestLocalUploadShareDownload 上传 -> 分享 -> 转存 -> 下载
+func TestLocalUploadShareDownload(t *testing.T) {
+	client := getLocalClient(t)
+	localFile := filepath.Join(t.TempDir(), "hello.txt")
+	if err := os.WriteFile(localFile, []byte("hello pan"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.UploadFile(pan.UploadFileReq{LocalFile: localFile, RemotePath: "/a/b"}); err != nil {
+		t.Fatalf("upload: %v", err)
+	}
+	if _, err := client.UploadFile(pan.UploadFileReq{LocalFile: localFile, RemotePath: "/a/b"}); err == nil {
+		t.Fatal("expected exist error on second upload")
+	}
+	list, err := client.List(pan.ListReq{Dir: &pan.PanObj{Path: "/a", Name: "b", Type: "dir"}})
+	if err != nil || len(list) != 1 || list[0].Name != "hello.txt" || list[0].Size != 9 {
+		t.Fatalf("list: %v %v", list, err)
+	}
+
+	share, err := client.NewShare(pan.NewShareReq{Fids: []string{list[0].Id}, NeedPassCode: true})
+	if err != nil {
+		t.Fatalf("new share: %v", err)
+	}
+	if err = client.ShareRestore(pan.ShareRestoreReq{ShareId: share.ShareId, TargetDir: "/restore"}); err == nil {
+		t.Fatal("expected pass code error")
+	}
+	if err = client.ShareRestore(pan.ShareRestoreReq{ShareUrl: share.ShareUrl, TargetDir: "/restore"}); err != nil {
+		t.Fatalf("share restore: %v", err)
+	}
+	if err = client.DeleteShare(pan.DelShareReq{ShareIds: []string{share.ShareId}}); err != nil {
+		t.Fatalf("delete share: %v", err)
+	}
+	shares, _ := client.ShareList(pan.ShareListReq{})
+	if len(shares) != 0 {
+		t.Fatalf("expected no share, got %d", len(shares))
+	}
+
+	restored, err := client.List(pan.ListReq{Dir: &pan.PanObj{Path: "/", Name: "restore", Type: "dir"}})
+	if err != nil || len(restored) != 1 {
+		t.Fatalf("list restore: %v %v", restored, err)
+	}
+	links, err := client.DirectLink(pan.DirectLinkReq{List: []*pan.DirectLink{{FileId: restored[0].Id}}})
+	if err != nil || len(links) != 1 || !strings.HasPrefix(links[0].Link, "file://") {
+		t.Fatalf("direct link: %v %v", links, err)
+	}
+	downloadDir := t.TempDir()
+	if _, err = client.DownloadFile(pan.DownloadFileReq{RemoteFile: restored[0], LocalPath: downloadDir}); err != nil {
+		t.Fatalf("download: %v", err)
+	}
+	content, err := os.ReadFile(filepath.Join(downloadDir, "hello.txt"))
+	if err != nil || string(content) != "hello pan" {
+		t.Fatalf("download content: %q %v", content, err)
+	}
+}
+
+// TestLocalMkdirRenameMoveDelete 创建 -> 重命名 -> 移动 -> 删除
+func TestLocalMkdirRenameMoveDelete(t *testing.T) {
+	client := getLocalClient(t)
+	dir, err := client.Mkdir(pan.MkdirReq{NewPath: "/src/dir"})
+	if err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	if err = client.ObjRename(pan.ObjRenameReq{Obj: dir, NewName: "renamed"}); err != nil {
+		t.Fatalf("rename: %v", err)
+	}
+	renamed := &pan.PanObj{Path: "/src", Name: "renamed", Type: "dir"}
+	target := &pan.PanObj{Path: "/", Name: "dst", Type: "dir"}
+	if err = client.Move(pan.MovieReq{Items: []*pan.PanObj{renamed}, TargetObj: target}); err != nil {
+		t.Fatalf("move: %v", err)
+	}
+	list, err := client.List(pan.ListReq{Dir: target})
+	if err != nil || len(list) != 1 || list[0].Name != "renamed" {
+		t.Fatalf("list dst: %v %v", list, err)
+	}
+	if err = client.Delete(pan.DeleteReq{Items: []*pan.PanObj{list[0]}}); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	list, err = client.List(pan.ListReq{Dir: target})
+	if err != nil || len(list) != 0 {
+		t.Fatalf("expected empty dst: %v %v", list, err)
+	}
+}
+
+// ==========================================================
+// 基于 pantest fake 服务的驱动测试（不依赖网络）
+// ==========================================================
+
+func getCloudreveClient(t *testing.T, server *pantest.CloudreveServer, typ string, opts ...ClientOption) pan.Driver {
+	t.Helper()
+	Init()
+	client, err := NewCloudreveClient(cloudreve.CloudreveProperties{
+		Url:     server.URL,
+		Session: server.Session,
+		Type:    typ,
+	}, opts...)
+	if err != nil {
+		t.Fatalf("create cloudreve client: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = client.Close()
+		RemoveDriver(client.GetId())
+	})
+	return client
+}
+
+// TestCloudreveFakeUploadDownload 分片上传（两种上传模式）-> 列表 -> 下载 -> 重命名 -> 删除
+func TestCloudreveFakeUploadDownload(t *testing.T) {
+	for _, tc := range []struct{ mode, typ string }{
+		{pantest.CloudreveModeChunk, cloudreve.Now61},
+		{pantest.CloudreveModeOneDrive, cloudreve.Huang1111},
+	} {
+		t.Run(tc.mode, func(t *testing.T) {
+			server := pantest.NewCloudreveServer()
+			defer server.Close()
+			server.Mode = tc.mode
+			server.ChunkSize = 4
+			client := getCloudreveClient(t, server, tc.typ)
+
+			localFile := filepath.Join(t.TempDir(), "hello.txt")
+			if err := os.WriteFile(localFile, []byte("hello cloudreve"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			// 首次创建上传会话时模拟同名文件上传中，驱动应清理会话后重试
+			server.FailNext("PUT", "/api/v3/file/upload", 1, pantest.CloudreveCodeConflictUploadOngoing, "Conflict upload ongoing")
+			if _, err := client.UploadFile(pan.UploadFileReq{LocalFile: localFile, RemotePath: "/a/b"}); err != nil {
+				t.Fatalf("upload: %v", err)
+			}
+			if server.Calls("DELETE", "/api/v3/file/upload") != 1 || server.Sessions() != 0 {
+				t.Fatalf("expected upload sessions cleared, sessions %d", server.Sessions())
+			}
+			content, err := server.Tree.ReadFile("/a/b/hello.txt")
+			if err != nil || string(content) != "hello cloudreve" {
+				t.Fatalf("server content: %q %v", content, err)
+			}
+
+			list, err := client.List(pan.ListReq{Dir: &pan.PanObj{Path: "/a", Name: "b", Type: "dir"}, Reload: true})
+			if err != nil || len(list) != 1 || list[0].Size != 15 {
+				t.Fatalf("list: %v %v", list, err)
+			}
+			downloadDir := t.TempDir()
+			if _, err = client.DownloadFile(pan.DownloadFileReq{RemoteFile: list[0], LocalPath: downloadDir}); err != nil {
+				t.Fatalf("download: %v", err)
+			}
+			content, err = os.ReadFile(filepath.Join(downloadDir, "hello.txt"))
+			if err != nil || string(content) != "hello cloudreve" {
+				t.Fatalf("download content: %q %v", content, err)
+			}
+
+			if err = client.ObjRename(pan.ObjRenameReq{Obj: list[0], NewName: "renamed.txt"}); err != nil {
+				t.Fatalf("rename: %v", err)
+			}
+			list, err = client.List(pan.ListReq{Dir: &pan.PanObj{Path: "/a", Name: "b", Type: "dir"}, Reload: true})
+			if err != nil || len(list) != 1 || list[0].Name != "renamed.txt" {
+				t.Fatalf("list after rename: %v %v", list, err)
+			}
+			if err = client.Delete(pan.DeleteReq{Items: list}); err != nil {
+				t.Fatalf("delete: %v", err)
+			}
+			if _, ok := server.Tree.Lookup("/a/b/renamed.txt"); ok {
+				t.Fatal("file still exists after delete")
+			}
+		})
+	}
+}
+
+// TestCloudreveFakeResumeUpload 上传中断后用同一个记录目录创建新客户端，模拟进程重启后续传
+func TestCloudreveFakeResumeUpload(t *testing.T) {
+	server := pantest.NewCloudreveServer()
+	defer server.Close()
+	server.ChunkSize = 4
+	journalDir := t.TempDir()
+	data := []byte("resumable upload across restart")
+	localFile := filepath.Join(t.TempDir(), "resume.txt")
+	if err := os.WriteFile(localFile, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	client := getCloudreveClient(t, server, cloudreve.Now61, WithJournalPath(journalDir))
+	ctx, cancel := context.WithCancel(context.Background())
+	_, err := client.UploadFile(pan.UploadFileReq{
+		LocalFile:  localFile,
+		RemotePath: "/resume",
+		Resumable:  true,
+		Ctx:        ctx,
+		ProgressCallback: func(event pan.ProgressEvent) {
+			if event.Operated >= 12 {
+				cancel()
+			}
+		},
+	})
+	if err == nil {
+		t.Fatal("expected interrupted upload")
+	}
+	if server.Sessions() != 1 {
+		t.Fatalf("expected upload session kept, sessions %d", server.Sessions())
+	}
+
+	client = getCloudreveClient(t, server, cloudreve.Now61, WithJournalPath(journalDir))
+	var first int64 = -1
+	_, err = client.UploadFile(pan.UploadFileReq{
+		LocalFile:  localFile,
+		RemotePath: "/resume",
+		Resumable:  true,
+		ProgressCallback: func(event pan.ProgressEvent) {
+			if first < 0 {
+				first = event.Operated
+			}
+		},
+	})
+	if err != nil {
+		t.Fatalf("resume upload: %v", err)
+	}
+	if first <= 8 {
+		t.Fatalf("expected upload resumed after the completed chunks, first progress %d", first)
+	}
+	content, err := server.Tree.ReadFile("/resume/resume.txt")
+	if err != nil || string(content) != string(data) {
+		t.Fatalf("server content: %q %v", content, err)
+	}
+	if entries, _ := os.ReadDir(journalDir); len(entries) != 0 {
+		t.Fatalf("expected journal removed after success, got %d entries", len(entries))
+	}
+
+	// 记录中的网盘文件已变化时，丢弃下载了一半的本地文件重新下载
+	list, err := client.List(pan.ListReq{Dir: &pan.PanObj{Path: "/", Name: "resume", Type: "dir"}, Reload: true})
+	if err != nil || len(list) != 1 {
+		t.Fatalf("list: %v %v", list, err)
+	}
+	obj := list[0]
+	downloadDir := t.TempDir()
+	output := filepath.Join(downloadDir, obj.Name)
+	if err = os.WriteFile(output, []byte("stale"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	abs, _ := filepath.Abs(output)
+	err = pan.NewFileJournal(journalDir).Save(pan.JournalKey("download", abs), &pan.DownloadRecord{
+		RemoteId: "stale", Size: obj.Size, LocalFile: abs, Merged: 5,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = client.DownloadFile(pan.DownloadFileReq{RemoteFile: obj, LocalPath: downloadDir}); err != nil {
+		t.Fatalf("download: %v", err)
+	}
+	content, err = os.ReadFile(output)
+	if err != nil || string(content) != string(data) {
+		t.Fatalf("download content: %q %v", content, err)
+	}
+}
+
+// ==========================================================
+// 夸克 / 迅雷 fake 服务端测试：通过 ApiUrl 等配置将请求重定向到本地
+// ==========================================================
+
+func getQuarkFakeClient(t *testing.T, server *pantest.QuarkServer) pan.Driver {
+	t.Helper()
+	cookieFile, err := server.WriteCookieFile(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return newQuarkFakeClient(t, server, cookieFile)
+}
+
+func newQuarkFakeClient(t *testing.T, server *pantest.QuarkServer, cookieFile string, opts ...ClientOption) pan.Driver {
+	t.Helper()
+	Init()
+	client, err := NewQuarkClient(quark.QuarkProperties{
+		CookieFile: cookieFile,
+		ApiUrl:     server.ApiUrl(),
+		UploadUrl:  server.UploadUrl(),
+	}, opts...)
+	if err != nil {
+		t.Fatalf("create quark client: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = client.Close()
+		RemoveDriver(client.GetId())
+	})
+	return client
+}
+
+// TestQuarkCopyStreams 夸克没有复制接口，复制时先读一遍计算哈希再上传，不写临时文件
+func TestQuarkCopyStreams(t *testing.T) {
+	server := pantest.NewQuarkServer()
+	defer server.Close()
+	cookieFile, err := server.WriteCookieFile(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 临时目录是一个文件，写临时文件即失败
+	notDir := filepath.Join(t.TempDir(), "not-dir")
+	if err = os.WriteFile(notDir, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	client := newQuarkFakeClient(t, server, cookieFile, WithDownloadTmpPath(notDir))
+	data := []byte(strings.Repeat("stream copy ", 100))
+	if _, err = server.Tree.WriteFile("/src/sub/a.bin", data); err != nil {
+		t.Fatal(err)
+	}
+	src, err := client.Stat(pan.StatReq{Path: "/src"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = client.Copy(pan.CopyReq{Items: []*pan.PanObj{src}, TargetObj: &pan.PanObj{Path: "/", Name: "dst", Type: "dir"}}); err != nil {
+		t.Fatalf("copy: %v", err)
+	}
+	if copied, err := server.Tree.ReadFile("/dst/src/sub/a.bin"); err != nil || !bytes.Equal(copied, data) {
+		t.Fatalf("copied content: %q %v", copied, err)
+	}
+}
+
+// TestQuarkFakeResumeUpload 分片上传中断后用新客户端重试，跳过 OSS 上已有的分片
+func TestQuarkFakeResumeUpload(t *testing.T) {
+	server := pantest.NewQuarkServer()
+	defer server.Close()
+	server.PartSize = 4
+	cookieFile, err := server.WriteCookieFile(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	journalDir := t.TempDir()
+	data := []byte("quark multipart upload resumed")
+	localFile := filepath.Join(t.TempDir(), "resume.txt")
+	if err = os.WriteFile(localFile, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	client := newQuarkFakeClient(t, server, cookieFile, WithJournalPath(journalDir))
+	ctx, cancel := context.WithCancel(context.Background())
+	_, err = client.UploadFile(pan.UploadFileReq{
+		LocalFile:  localFile,
+		RemotePath: "/resume",
+		Resumable:  true,
+		Ctx:        ctx,
+		ProgressCallback: func(event pan.ProgressEvent) {
+			if event.Operated >= 12 {
+				cancel()
+			}
+		},
+	})
+	if err == nil {
+		t.Fatal("expected interrupted upload")
+	}
+
+	client = newQuarkFakeClient(t, server, cookieFile, WithJournalPath(journalDir))
+	var first int64 = -1
+	_, err = client.UploadFile(pan.UploadFileReq{
+		LocalFile:  localFile,
+		RemotePath: "/resume",
+		Resumable:  true,
+		ProgressCallback: func(event pan.ProgressEvent) {
+			if first < 0 {
+				first = event.Operated
+			}
+		},
+	})
+	if err != nil {
+		t.Fatalf("resume upload: %v", err)
+	}
+	if first <= 8 {
+		t.Fatalf("expected upload resumed after the completed parts, first progress %d", first)
+	}
+	if server.Calls("POST", "/1/clouddrive/file/upload/pre") != 1 {
+		t.Fatalf("expected one upload/pre, got %d", server.Calls("POST", "/1/clouddrive/file/upload/pre"))
+	}
+	content, err := server.Tree.ReadFile("/resume/resume.txt")
+	if err != nil || string(content) != string(data) {
+		t.Fatalf("server content: %q %v", content, err)
+	}
+	if entries, _ := os.ReadDir(journalDir); len(entries) != 0 {
+		t.Fatalf("expected journal removed after success, got %d entries", len(entries))
+	}
+}
+
+// TestThunderFakeResumeUpload S3 分片上传中断后用新客户端重试，跳过已上传的分片
+func TestThunderFakeResumeUpload(t *testing.T) {
+	server := pantest.NewThunderServer()
+	defer server.Close()
+	journalDir := t.TempDir()
+	data := []byte("thunder multipart upload resumed")
+	localFile := filepath.Join(t.TempDir(), "resume.txt")
+	if err := os.WriteFile(localFile, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	client := newThunderFakeClient(t, server, 4, WithJournalPath(journalDir))
+	ctx, cancel := context.WithCancel(context.Background())
+	_, err := client.UploadFile(pan.UploadFileReq{
+		LocalFile:   localFile,
+		RemotePath:  "/resume",
+		Resumable:   true,
+		Concurrency: 1,
+		Ctx:         ctx,
+		ProgressCallback: func(event pan.ProgressEvent) {
+			if event.Operated >= 12 {
+				cancel()
+			}
+		},
+	})
+	if err == nil {
+		t.Fatal("expected interrupted upload")
+	}
+
+	created := server.Calls("POST", "/drive/v1/files")
+	client = newThunderFakeClient(t, server, 4, WithJournalPath(journalDir))
+	var first int64 = -1
+	_, err = client.UploadFile(pan.UploadFileReq{
+		LocalFile:  localFile,
+		RemotePath: "/resume",
+		Resumable:  true,
+		ProgressCallback: func(event pan.ProgressEvent) {
+			if first < 0 {
+				first = event.Operated
+			}
+		},
+	})
+	if err != nil {
+		t.Fatalf("resume upload: %v", err)
+	}
+	if first <= 8 {
+		t.Fatalf("expected upload resumed after the completed parts, first progress %d", first)
+	}
+	if calls := server.Calls("POST", "/drive/v1/files") - created; calls != 0 {
+		t.Fatalf("expected the upload task reused, got %d new", calls)
+	}
+	content, err := server.Tree.ReadFile("/resume/resume.txt")
+	if err != nil || string(content) != string(data) {
+		t.Fatalf("server content: %q %v", content, err)
+	}
+	if entries, _ := os.ReadDir(journalDir); len(entries) != 0 {
+		t.Fatalf("expected journal removed after success, got %d entries", len(entries))
+	}
+}
+
+// TestParallelPartUpload 多个分片同时上传，进度汇总且单调，服务端按序合并
+func TestParallelPartUpload(t *testing.T) {
+	data := make([]byte, 64)
+	for i := range data {
+		data[i] = byte('a' + i%26)
+	}
+	localFile := filepath.Join(t.TempDir(), "parallel.txt")
+	if err := os.WriteFile(localFile, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		name   string
+		client func(t *testing.T) (pan.Driver, func(string) ([]byte, error))
+	}{
+		{"quark", func(t *testing.T) (pan.Driver, func(string) ([]byte, error)) {
+			server := pantest.NewQuarkServer()
+			t.Cleanup(server.Close)
+			server.PartSize = 4
+			return getQuarkFakeClient(t, server), server.Tree.ReadFile
+		}},
+		{"cloudreve", func(t *testing.T) (pan.Driver, func(string) ([]byte, error)) {
+			server := pantest.NewCloudreveServer()
+			t.Cleanup(server.Close)
+			server.ChunkSize = 4
+			return getCloudreveClient(t, server, cloudreve.Now61), server.Tree.ReadFile
+		}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			client, readFile := tc.client(t)
+			var mu sync.Mutex
+			var last pan.ProgressEvent
+			monotonic := true
+			_, err := client.UploadFile(pan.UploadFileReq{
+				LocalFile:   localFile,
+				RemotePath:  "/parallel",
+				Concurrency: 4,
+				ProgressCallback: func(event pan.ProgressEvent) {
+					mu.Lock()
+					defer mu.Unlock()
+					if event.Operated < last.Operated {
+						monotonic = false
+					}
+					last = event
+				},
+			})
+			if err != nil {
+				t.Fatalf("upload: %v", err)
+			}
+			if !monotonic || !last.Done || last.Operated != int64(len(data)) {
+				t.Fatalf("progress: monotonic %v, last %+v", monotonic, last)
+			}
+			content, err := readFile("/parallel/parallel.txt")
+			if err != nil || string(content) != string(data) {
+				t.Fatalf("server content: %q %v", content, err)
+			}
+		})
+	}
+}
+
+func TestQuarkFakeUploadShareRestore(t *testing.T) {
+	server := pantest.NewQuarkServer()
+	defer server.Close()
+	server.PartSize = 4
+	client := getQuarkFakeClient(t, server)
+
+	localFile := filepath.Join(t.TempDir(), "hello.txt")
+	if err := os.WriteFile(localFile, []byte("hello quark"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.UploadFile(pan.UploadFileReq{LocalFile: localFile, RemotePath: "/a/b"}); err != nil {
+		t.Fatalf("upload: %v", err)
+	}
+	content, err := server.Tree.ReadFile("/a/b/hello.txt")
+	if err != nil || string(content) != "hello quark" {
+		t.Fatalf("server content: %q %v", content, err)
+	}
+
+	list, err := client.List(pan.ListReq{Dir: &pan.PanObj{Path: "/a", Name: "b", Type: "dir"}, Reload: true})
+	if err != nil || len(list) != 1 || list[0].Size != 11 {
+		t.Fatalf("list: %v %v", list, err)
+	}
+	downloadDir := t.TempDir()
+	if _, err = client.DownloadFile(pan.DownloadFileReq{RemoteFile: list[0], LocalPath: downloadDir}); err != nil {
+		t.Fatalf("download: %v", err)
+	}
+	content, err = os.ReadFile(filepath.Join(downloadDir, "hello.txt"))
+	if err != nil || string(content) != "hello quark" {
+		t.Fatalf("download content: %q %v", content, err)
+	}
+
+	share, err := client.NewShare(pan.NewShareReq{Fids: []string{list[0].Id}, Title: "pantest", NeedPassCode: true})
+	if err != nil {
+		t.Fatalf("share: %v", err)
+	}
+	if err = client.ShareRestore(pan.ShareRestoreReq{ShareUrl: share.ShareUrl, PassCode: share.PassCode, TargetDir: "/restore"}); err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+	content, err = server.Tree.ReadFile("/restore/hello.txt")
+	if err != nil || string(content) != "hello quark" {
+		t.Fatalf("restored content: %q %v", content, err)
+	}
+	if err = client.DeleteShare(pan.DelShareReq{ShareIds: []string{share.ShareId}}); err != nil {
+		t.Fatalf("delete share: %v", err)
+	}
+}
+
+// TestErrorKinds 错误类型可通过 errors.Is 判断，经过包装后不丢失
+func TestErrorKinds(t *testing.T) {
+	err := pan.MsgError("upload error", pan.KindCodeMsg(pan.ErrAlreadyExists, quark.CodeObjectExist, "a.txt is exist"))
+	if !errors.Is(err, pan.ErrAlreadyExists) || err.GetCode() != quark.CodeObjectExist || pan.IsRetryable(err) {
+		t.Fatalf("wrapped kind lost: %v", err)
+	}
+	if busy := pan.StatusCodeMsg(503, 503, "busy"); !pan.IsRetryable(busy) {
+		t.Fatalf("5xx should be retryable: %v", busy)
+	}
+	if limited := pan.StatusCodeMsg(429, 429, "slow down"); !errors.Is(limited, pan.ErrRateLimited) || !pan.IsRetryable(limited) {
+		t.Fatalf("429 should be rate limited: %v", limited)
+	}
+	if cancelled := pan.OnlyError(context.Canceled); !errors.Is(cancelled, context.Canceled) || pan.IsRetryable(cancelled) {
+		t.Fatalf("cancel should unwrap and not retry: %v", cancelled)
+	}
+	// 包装后保留原错误链和调用方的消息
+	inner := pan.KindCodeMsg(pan.ErrNotFound, local.CodeObjectNotExist, "a.txt not found")
+	outer := pan.MsgError("transfer a.txt error", fmt.Errorf("stat: %w", inner))
+	var driverErr *pan.DriverError
+	if !errors.As(outer.Unwrap(), &driverErr) || driverErr != inner || !errors.Is(outer, pan.ErrNotFound) || outer.GetMsg() != "transfer a.txt error" {
+		t.Fatalf("wrapped chain lost: %v", outer)
+	}
+	if wrapped := pan.OnlyError(inner); wrapped.GetMsg() != "" || wrapped.GetCode() != local.CodeObjectNotExist {
+		t.Fatalf("only error: %v", wrapped)
+	}
+
+	server := pantest.NewQuarkServer()
+	defer server.Close()
+	client := getQuarkFakeClient(t, server)
+	server.Cookie = "expired"
+	if _, err := client.Disk(); !errors.Is(err, pan.ErrAuthExpired) {
+		t.Fatalf("expired cookie: %v", err)
+	}
+}
+
+// TestPropertiesDefaults 默认值只填充未赋值的属性
+func TestPropertiesDefaults(t *testing.T) {
+	props := &cloudreve.CloudreveProperties{ChunkSize: 1 << 20}
+	internal.SetDefaultByTag(props)
+	if props.ChunkSize != 1<<20 || props.Type != "now61" {
+		t.Fatalf("defaults: chunk size %d, type %q", props.ChunkSize, props.Type)
+	}
+	props = &cloudreve.CloudreveProperties{}
+	internal.SetDefaultByTag(props)
+	if props.ChunkSize != 104857600 {
+		t.Fatalf("default chunk size: %d", props.ChunkSize)
+	}
+}
+
+func TestCapabilities(t *testing.T) {
+	server := pantest.NewCloudreveServer()
+	defer server.Close()
+	server.MaxSize = 1 << 20
+	caps := getCloudreveClient(t, server, cloudreve.Now61).Capabilities()
+	if caps.MaxFileSize != server.MaxSize || !caps.DirectLink || caps.Share {
+		t.Fatalf("cloudreve capabilities: %+v", caps)
+	}
+
+	quarkServer := pantest.NewQuarkServer()
+	defer quarkServer.Close()
+	caps = getQuarkFakeClient(t, quarkServer).Capabilities()
+	if !caps.FastUpload || caps.OfflineDownload || caps.MaxFileSize != 0 {
+		t.Fatalf("quark capabilities: %+v", caps)
+	}
+}
+
+func getThunderFakeClient(t *testing.T, server *pantest.ThunderServer) pan.Driver {
+	t.Helper()
+	return newThunderFakeClient(t, server, 0)
+}
+
+// newThunderFakeClient 创建连接 fake 服务的客户端，chunkSize 为 0 时使用默认分片大小
+func newThunderFakeClient(t *testing.T, server *pantest.ThunderServer, chunkSize int64, opts ...ClientOption) pan.Driver {
+	t.Helper()
+	Init()
+	client, err := NewThunderClient(thunder_browser.ThunderBrowserProperties{
+		Username:   server.Username,
+		Password:   server.Password,
+		ApiUrl:     server.ApiUrl(),
+		UserApiUrl: server.UserApiUrl(),
+		ChunkSize:  chunkSize,
+	}, opts...)
+	if err != nil {
+		t.Fatalf("create thunder client: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = client.Close()
+		RemoveDriver(client.GetId())
+	})
+	return client
+}
+
+// TestThunderCaptchaActionBehindProxy 接口地址带代理前缀时验证码 action 仍使用官方路径
+func TestThunderCaptchaActionBehindProxy(t *testing.T) {
+	server := pantest.NewThunderServer()
+	defer server.Close()
+	target, _ := url.Parse(server.URL)
+	proxy := httputil.NewSingleHostReverseProxy(target)
+	proxyServer := httptest.NewServer(http.StripPrefix("/proxy", proxy))
+	defer proxyServer.Close()
+
+	Init()
+	client, err := NewThunderClient(thunder_browser.ThunderBrowserProperties{
+		Username:   server.Username,
+		Password:   server.Password,
+		ApiUrl:     proxyServer.URL + "/proxy/drive/v1",
+		UserApiUrl: proxyServer.URL + "/proxy/v1",
+	})
+	if err != nil {
+		t.Fatalf("create thunder client: %v", err)
+	}
+	defer RemoveDriver(client.GetId())
+	server.InvalidateCaptcha()
+	if _, err = client.List(pan.ListReq{Dir: &pan.PanObj{Id: "0", Path: "/", Type: "dir"}, Reload: true}); err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if actions := server.CaptchaActions(); !slices.Contains(actions, "POST:/v1/auth/signin") || !slices.Contains(actions, "GET:/drive/v1/files") {
+		t.Fatalf("captcha actions: %v", actions)
+	}
+
+	// 没有 scheme 的地址在创建客户端时报错
+	_, err = NewThunderClient(thunder_browser.ThunderBrowserProperties{
+		Username: server.Username,
+		Password: server.Password,
+		ApiUrl:   "x-api-pan.xunlei.com/drive/v1",
+	})
+	if err == nil || !strings.Contains(err.Error(), "api_url") {
+		t.Fatalf("schemeless api url: %v", err)
+	}
+}
+
+func TestThunderFakeUploadDownload(t *testing.T) {
+	server := pantest.NewThunderServer()
+	defer server.Close()
+	client := getThunderFakeClient(t, server)
+
+	localFile := filepath.Join(t.TempDir(), "hello.txt")
+	if err := os.WriteFile(localFile, []byte("hello thunder"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// 令牌过期、验证码失效时驱动应自动刷新后重试
+	server.ExpireTokens()
+	server.InvalidateCaptcha()
+	if _, err := client.UploadFile(pan.UploadFileReq{LocalFile: localFile, RemotePath: "/a/b"}); err != nil {
+		t.Fatalf("upload: %v", err)
+	}
+	content, err := server.Tree.ReadFile("/a/b/hello.txt")
+	if err != nil || string(content) != "hello thunder" {
+		t.Fatalf("server content: %q %v", content, err)
+	}
+
+	list, err := client.List(pan.ListReq{Dir: &pan.PanObj{Path: "/a", Name: "b", Type: "dir"}, Reload: true})
+	if err != nil || len(list) != 1 || list[0].Size != 13 {
+		t.Fatalf("list: %v %v", list, err)
+	}
+	downloadDir := t.TempDir()
+	if _, err = client.DownloadFile(pan.DownloadFileReq{RemoteFile: list[0], LocalPath: downloadDir}); err != nil {
+		t.Fatalf("download: %v", err)
+	}
+	content, err = os.ReadFile(filepath.Join(downloadDir, "hello.txt"))
+	if err != nil || string(content) != "hello thunder" {
+		t.Fatalf("download content: %q %v", content, err)
+	}
+	if err = client.Delete(pan.DeleteReq{Items: list}); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if _, ok := server.Tree.Lookup("/a/b/hello.txt"); ok {
+		t.Fatal("file still exists after delete")
+	}
+}
+
+// ==========================================================
+// 驱动一致性测试：所有驱动运行同一套 pantest.RunConformance
+// ==========================================================
+
+func TestStatMetadata(t *testing.T) {
+	server := pantest.NewThunderServer()
+	defer server.Close()
+	client := getThunderFakeClient(t, server)
+
+	localFile := filepath.Join(t.TempDir(), "meta.txt")
+	if err := os.WriteFile(localFile, []byte("metadata"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.UploadFile(pan.UploadFileReq{LocalFile: localFile, RemotePath: "/meta"}); err != nil {
+		t.Fatalf("upload: %v", err)
+	}
+	obj, err := client.Stat(pan.StatReq{Path: "/meta/meta.txt"})
+	if err != nil || obj.Hashes[pan.HashGcid] == "" || obj.ModTime.IsZero() || obj.CreatedTime.IsZero() {
+		t.Fatalf("stat: %+v %v", obj, err)
+	}
+	byId, err := client.Stat(pan.StatReq{Id: obj.Id, Path: "/meta/meta.txt"})
+	if err != nil || byId.Path != "/meta" || byId.Hashes[pan.HashGcid] != obj.Hashes[pan.HashGcid] {
+		t.Fatalf("stat by id: %+v %v", byId, err)
+	}
+}
+
+// TestStatNative Quark 和 Cloudreve 的 Stat 直接查询对象，不列出父目录
+func TestStatNative(t *testing.T) {
+	t.Run("quark", func(t *testing.T) {
+		server := pantest.NewQuarkServer()
+		defer server.Close()
+		client := getQuarkFakeClient(t, server)
+		if _, err := server.Tree.WriteFile("/a/b/c.txt", []byte("quark")); err != nil {
+			t.Fatal(err)
+		}
+		obj, err := client.Stat(pan.StatReq{Path: "/a/b/c.txt"})
+		if err != nil || obj.Name != "c.txt" || obj.Path != "/a/b" || obj.Size != 5 || obj.Type != "file" || obj.ModTime.IsZero() {
+			t.Fatalf("stat: %+v %v", obj, err)
+		}
+		dir, err := client.Stat(pan.StatReq{Path: "/a/b"})
+		if err != nil || dir.Name != "b" || dir.Path != "/a" || dir.Type != "dir" {
+			t.Fatalf("stat dir: %+v %v", dir, err)
+		}
+		byId, err := client.Stat(pan.StatReq{Id: obj.Id})
+		if err != nil || byId.Name != "c.txt" || byId.Path != "/a/b" {
+			t.Fatalf("stat by id: %+v %v", byId, err)
+		}
+		if _, err = client.Stat(pan.StatReq{Path: "/a/missing.txt"}); !errors.Is(err, pan.ErrNotFound) {
+			t.Fatalf("stat missing: %v", err)
+		}
+		if calls := server.Calls("GET", "/1/clouddrive/file/sort"); calls != 1 {
+			t.Fatalf("file/sort called %d times", calls)
+		}
+	})
+	t.Run("cloudreve", func(t *testing.T) {
+		server := pantest.NewCloudreveServer()
+		defer server.Close()
+		client := getCloudreveClient(t, server, cloudreve.Now61)
+		if _, err := server.Tree.WriteFile("/a/b/c.txt", []byte("cloudreve")); err != nil {
+			t.Fatal(err)
+		}
+		obj, err := client.Stat(pan.StatReq{Path: "/a/b/c.txt"})
+		if err != nil || obj.Name != "c.txt" || obj.Path != "/a/b" || obj.Size != 9 || obj.Type != "file" || obj.ModTime.IsZero() {
+			t.Fatalf("stat: %+v %v", obj, err)
+		}
+		dir, err := client.Stat(pan.StatReq{Path: "/a/b"})
+		if err != nil || dir.Name != "b" || dir.Path != "/a" || dir.Type != "dir" || dir.ModTime.IsZero() {
+			t.Fatalf("stat dir: %+v %v", dir, err)
+		}
+		byId, err := client.Stat(pan.StatReq{Id: obj.Id, Path: "/a/b/c.txt"})
+		if err != nil || byId.Id != obj.Id || byId.Type != "file" || byId.Size != 9 {
+			t.Fatalf("stat by id: %+v %v", byId, err)
+		}
+		if _, err = client.Stat(pan.StatReq{Path: "/a/missing.txt"}); !errors.Is(err, pan.ErrNotFound) {
+			t.Fatalf("stat missing: %v", err)
+		}
+		for _, dir := range []string{"/api/v3/directory/", "/api/v3/directory/a"} {
+			if calls := server.Calls("GET", dir); calls != 0 {
+				t.Fatalf("parent %s listed %d times", dir, calls)
+			}
+		}
+	})
+	t.Run("thunder", func(t *testing.T) {
+		server := pantest.NewThunderServer()
+		defer server.Close()
+		client := getThunderFakeClient(t, server)
+		file, err := server.Tree.WriteFile("/a/b/c.txt", []byte("thunder"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		byId, err := client.Stat(pan.StatReq{Id: file.Id})
+		if err != nil || byId.Name != "c.txt" || byId.Path != "/a/b" || byId.Parent == nil || byId.Parent.Name != "b" || byId.Parent.Path != "/a" {
+			t.Fatalf("stat by id: %+v %v", byId, err)
+		}
+		withPath, err := client.Stat(pan.StatReq{Id: file.Id, Path: "/a/b/c.txt"})
+		if err != nil || withPath.Path != "/a/b" || withPath.Parent == nil || withPath.Parent.Id != file.ParentId || withPath.Parent.Path != "/a" {
+			t.Fatalf("stat by id and path: %+v %v", withPath, err)
+		}
+		if calls := server.Calls("GET", "/drive/v1/files"); calls != 0 {
+			t.Fatalf("listed %d times", calls)
+		}
+	})
+}
+
+// TestQuarkSearchNative 关键字搜索走搜索接口，只为结果的父目录查询路径，不遍历目录
+func TestQuarkSearchNative(t *testing.T) {
+	server := pantest.NewQuarkServer()
+	defer server.Close()
+	client := getQuarkFakeClient(t, server)
+
+	for i := 0; i < 20; i++ {
+		if _, err := server.Tree.WriteFile(fmt.Sprintf("/d%d/e/f.txt", i), []byte("x")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := server.Tree.WriteFile("/d7/e/needle.txt", []byte("needle")); err != nil {
+		t.Fatal(err)
+	}
+	objs, err := client.Search(pan.SearchReq{Keyword: "needle"})
+	if err != nil || len(objs) != 1 || objs[0].Path != "/d7/e" || objs[0].Size != 6 || objs[0].Parent.Name != "e" {
+		t.Fatalf("search: %v %v", objs, err)
+	}
+	if calls := server.Calls("GET", "/1/clouddrive/file/sort"); calls != 1 {
+		t.Fatalf("file/sort called %d times", calls)
+	}
+}
+
+// TestOpenRelinksExpiredURL 下载链接过期时 Open 的读取器重新获取链接
+func TestOpenRelinksExpiredURL(t *testing.T) {
+	server := pantest.NewQuarkServer()
+	defer server.Close()
+	client := getQuarkFakeClient(t, server)
+
+	content := bytes.Repeat([]byte("0123456789"), 1000)
+	node, err := server.Tree.WriteFile("/video/a.mkv", content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file, err := client.Stat(pan.StatReq{Path: "/video/a.mkv"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader, err := client.Open(context.Background(), file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	buf := make([]byte, 10)
+	if _, err = io.ReadFull(reader, buf); err != nil || !bytes.Equal(buf, content[:10]) {
+		t.Fatalf("read: %q %v", buf, err)
+	}
+	server.FailNextStatus("GET", "/quark-file/"+node.Id, 1, http.StatusForbidden)
+	if _, err = reader.Seek(5000, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = io.ReadFull(reader, buf); err != nil || !bytes.Equal(buf, content[5000:5010]) {
+		t.Fatalf("read after expiry: %q %v", buf, err)
+	}
+	if calls := server.Calls("POST", "/1/clouddrive/file/download"); calls != 2 {
+		t.Fatalf("file/download called %d times", calls)
+	}
+}
+
+// TestOpenReusesDefaultClient 链接未指定客户端时，同一个读取器的多次 Range 请求复用连接
+func TestOpenReusesDefaultClient(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789"), 1000)
+	var mu sync.Mutex
+	conns := 0
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "a.bin", time.Time{}, bytes.NewReader(content))
+	}))
+	server.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			mu.Lock()
+			conns++
+			mu.Unlock()
+		}
+	}
+	server.Start()
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	base := pan.NewBaseOperate(pan.DownloadConfig{}, pan.ProxyConfig{}, ctx, cancel)
+	defer base.Cancel()
+	file := &pan.PanObj{Id: "a", Name: "a.bin", Type: "file", Size: int64(len(content))}
+	reader, err := base.BaseOpen(context.Background(), file, func(ctx context.Context, file *pan.PanObj) (*pan.DownloadLink, error) {
+		return &pan.DownloadLink{Url: server.URL + "/a.bin"}, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	for _, offset := range []int64{0, 5000, 9990} {
+		if _, err = reader.Seek(offset, io.SeekStart); err != nil {
+			t.Fatal(err)
+		}
+		data, err := io.ReadAll(reader)
+		if err != nil || !bytes.Equal(data, content[offset:]) {
+			t.Fatalf("read from %d: %d bytes %v", offset, len(data), err)
+		}
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if conns != 1 {
+		t.Fatalf("opened %d connections, want 1", conns)
+	}
+}
+
+// unreadable 被读取时报错，用于确认数据流未被读取
+type unreadable struct {
+	t *testing.T
+}
+
+func (r unreadable) Read([]byte) (int, error) {
+	r.t.Error("stream should not be read")
+	return 0, io.ErrUnexpectedEOF
+}
+
+// TestUploadStreamKnownHashes 哈希齐全时直接提交哈希，秒传成功则不读取数据流
+func TestUploadStreamKnownHashes(t *testing.T) {
+	server := pantest.NewQuarkServer()
+	defer server.Close()
+	client := getQuarkFakeClient(t, server)
+
+	content := []byte("stream content")
+	if _, err := server.Tree.WriteFile("/orig/a.txt", content); err != nil {
+		t.Fatal(err)
+	}
+	md5Sum := md5.Sum(content)
+	sha1Sum := sha1.Sum(content)
+	_, err := client.UploadStream(pan.UploadStreamReq{
+		Reader:     unreadable{t: t},
+		Size:       int64(len(content)),
+		Name:       "b.txt",
+		RemotePath: "/copy",
+		KnownHashes: map[string]string{
+			pan.HashMd5:  hex.EncodeToString(md5Sum[:]),
+			pan.HashSha1: hex.EncodeToString(sha1Sum[:]),
+		},
+	})
+	if err != nil {
+		t.Fatalf("upload stream: %v", err)
+	}
+	obj, err := client.Stat(pan.StatReq{Path: "/copy/b.txt"})
+	if err != nil || obj.Size != int64(len(content)) {
+		t.Fatalf("stat: %v %v", obj, err)
+	}
+}
+
+// TestTransferCrossDriver 跨驱动传输目录树，目标已有相同内容时秒传，重复执行时跳过已传输的文件
+func TestTransferCrossDriver(t *testing.T) {
+	srcServer := pantest.NewThunderServer()
+	defer srcServer.Close()
+	dstServer := pantest.NewThunderServer()
+	defer dstServer.Close()
+	src := getThunderFakeClient(t, srcServer)
+	dst := getThunderFakeClient(t, dstServer)
+
+	small := []byte("already there")
+	big := bytes.Repeat([]byte("abcdefgh"), 4096)
+	for p, data := range map[string][]byte{"/src/a.txt": small, "/src/sub/b.bin": big, "/other/a.txt": small} {
+		server := srcServer
+		if p == "/other/a.txt" {
+			server = dstServer
+		}
+		if _, err := server.Tree.WriteFile(p, data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := src.Mkdir(pan.MkdirReq{NewPath: "src/empty"}); err != nil {
+		t.Fatal(err)
+	}
+	srcDir, err := src.Stat(pan.StatReq{Path: "/src"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var last pan.ProgressEvent
+	summary, err := pan.Transfer(context.Background(), src, srcDir, dst, "/backup", pan.TransferOptions{
+		Concurrency: 2,
+		TaskId:      "migrate",
+		ProgressCallback: func(event pan.ProgressEvent) {
+			last = event
+		},
+	})
+	if err != nil {
+		t.Fatalf("transfer: %v", err)
+	}
+	if summary.Files != 2 || summary.Fast != 1 || summary.Bytes != int64(len(big)) {
+		t.Fatalf("summary: %+v", summary)
+	}
+	total := int64(len(small) + len(big))
+	if !last.Done || last.TaskId != "migrate" || last.Operated != total || last.TotalSize != total {
+		t.Fatalf("last progress: %+v", last)
+	}
+	for p, data := range map[string][]byte{"/backup/src/a.txt": small, "/backup/src/sub/b.bin": big} {
+		n, ok := dstServer.Tree.Lookup(p)
+		if !ok || !bytes.Equal(n.Data, data) {
+			t.Fatalf("%s not transferred", p)
+		}
+	}
+	if _, err = dst.Stat(pan.StatReq{Path: "/backup/src/empty", Reload: true}); err != nil {
+		t.Fatalf("empty dir: %v", err)
+	}
+
+	// 再次执行时跳过大小一致的文件
+	summary, err = pan.Transfer(context.Background(), src, srcDir, dst, "/backup", pan.TransferOptions{})
+	if err != nil || summary.Skipped != 2 || summary.Files != 0 || summary.Bytes != 0 {
+		t.Fatalf("resume: %+v %v", summary, err)
+	}
+
+	// 大小一致但哈希不同的文件重新传输并替换
+	stale, _ := dstServer.Tree.Lookup("/backup/src/a.txt")
+	if err = dstServer.Tree.Remove(stale.Id); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = dstServer.Tree.WriteFile("/backup/src/a.txt", []byte("already THERE")); err != nil {
+		t.Fatal(err)
+	}
+	dst = getThunderFakeClient(t, dstServer)
+	summary, err = pan.Transfer(context.Background(), src, srcDir, dst, "/backup", pan.TransferOptions{})
+	if err != nil || summary.Skipped != 1 || summary.Files != 1 {
+		t.Fatalf("stale file: %+v %v", summary, err)
+	}
+	children, _ := dstServer.Tree.Children(stale.ParentId)
+	if n, ok := dstServer.Tree.Lookup("/backup/src/a.txt"); !ok || !bytes.Equal(n.Data, small) || len(children) != 3 {
+		t.Fatalf("stale file not replaced: %v", children)
+	}
+
+	// 迅雷 -> 本地，单个文件
+	local := getLocalClient(t)
+	file, err := src.Stat(pan.StatReq{Path: "/src/sub/b.bin"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary, err = pan.Transfer(context.Background(), src, file, local, "/", pan.TransferOptions{}); err != nil || summary.Files != 1 {
+		t.Fatalf("transfer to local: %+v %v", summary, err)
+	}
+	obj, err := local.Stat(pan.StatReq{Path: "/b.bin"})
+	if err != nil || obj.Size != int64(len(big)) {
+		t.Fatalf("local file: %v %v", obj, err)
+	}
+}
+
+// TestSyncOneWay 单向同步：新增、修改、过滤、dry-run、删除和反向下载
+func TestSyncOneWay(t *testing.T) {
+	server := pantest.NewThunderServer()
+	defer server.Close()
+	client := getThunderFakeClient(t, server)
+	ctx := context.Background()
+
+	src := t.TempDir()
+	files := map[string]string{"a.txt": "hello", "sub/b.txt": "world", "sub/deep/c.txt": "deep", "big.bin": strings.Repeat("x", 100)}
+	for name, data := range files {
+		p := filepath.Join(src, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	opts := pansync.Options{Direction: pansync.Upload, LocalPath: src, RemotePath: "/backup", Concurrency: 2, MaxSize: 50}
+	summary, err := pansync.Sync(ctx, client, opts)
+	if err != nil {
+		t.Fatalf("sync: %v", err)
+	}
+	if summary.Uploaded != 3 || summary.Skipped != 1 || summary.Failed != 0 {
+		t.Fatalf("first sync: %+v", summary)
+	}
+	if _, ok := server.Tree.Lookup("/backup/big.bin"); ok {
+		t.Fatal("filtered file uploaded")
+	}
+	n, ok := server.Tree.Lookup("/backup/sub/deep/c.txt")
+	if !ok || string(n.Data) != "deep" {
+		t.Fatal("nested file not uploaded")
+	}
+
+	// 大小相同但内容修改且更新的文件通过 gcid 识别
+	changed := filepath.Join(src, "a.txt")
+	if err = os.WriteFile(changed, []byte("HELLO"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	future := time.Now().Add(time.Hour)
+	if err = os.Chtimes(changed, future, future); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.RemoveAll(filepath.Join(src, "sub", "deep")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = server.Tree.WriteFile("/backup/big.bin", []byte("remote only, filtered")); err != nil {
+		t.Fatal(err)
+	}
+	opts.Delete = true
+	opts.DryRun = true
+	if summary, err = pansync.Sync(ctx, client, opts); err != nil || summary.Uploaded != 1 || summary.Deleted != 1 {
+		t.Fatalf("dry run: %+v %v", summary, err)
+	}
+	if n, ok = server.Tree.Lookup("/backup/a.txt"); !ok || string(n.Data) != "hello" {
+		t.Fatal("dry run changed remote")
+	}
+	opts.DryRun = false
+	if summary, err = pansync.Sync(ctx, client, opts); err != nil || summary.Uploaded != 1 || summary.Deleted != 1 {
+		t.Fatalf("sync with delete: %+v %v", summary, err)
+	}
+	if n, ok = server.Tree.Lookup("/backup/a.txt"); !ok || string(n.Data) != "HELLO" {
+		t.Fatal("changed file not uploaded")
+	}
+	if _, ok = server.Tree.Lookup("/backup/.pan-sync-a.txt"); ok {
+		t.Fatal("temporary upload left behind")
+	}
+	// 替换上传失败时网盘上的旧版本保持不变
+	if err = os.WriteFile(changed, []byte("Hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	future = future.Add(time.Hour)
+	if err = os.Chtimes(changed, future, future); err != nil {
+		t.Fatal(err)
+	}
+	server.FailNext("POST", "/drive/v1/files", 1, pantest.ThunderCodeInvalidArgument, "upload failed")
+	if summary, err = pansync.Sync(ctx, client, opts); err == nil || summary.Failed != 1 {
+		t.Fatalf("failed replacement: %+v %v", summary, err)
+	}
+	if n, ok = server.Tree.Lookup("/backup/a.txt"); !ok || string(n.Data) != "HELLO" {
+		t.Fatal("remote file lost after failed replacement")
+	}
+	if summary, err = pansync.Sync(ctx, client, opts); err != nil || summary.Uploaded != 1 {
+		t.Fatalf("retry replacement: %+v %v", summary, err)
+	}
+	if n, ok = server.Tree.Lookup("/backup/a.txt"); !ok || string(n.Data) != "Hello" {
+		t.Fatal("replacement not uploaded on retry")
+	}
+	if _, ok = server.Tree.Lookup("/backup/sub/deep"); ok {
+		t.Fatal("extraneous dir not deleted")
+	}
+	if _, ok = server.Tree.Lookup("/backup/big.bin"); !ok {
+		t.Fatal("filtered remote file deleted")
+	}
+
+	// 反向下载后再次同步没有需要传输的文件
+	dst := t.TempDir()
+	opts = pansync.Options{Direction: pansync.Download, LocalPath: dst, RemotePath: "/backup", Delete: true}
+	if summary, err = pansync.Sync(ctx, client, opts); err != nil || summary.Downloaded != 3 {
+		t.Fatalf("download: %+v %v", summary, err)
+	}
+	data, err := os.ReadFile(filepath.Join(dst, "sub", "b.txt"))
+	if err != nil || string(data) != "world" {
+		t.Fatalf("downloaded file: %q %v", data, err)
+	}
+	plan, err := pansync.NewPlan(ctx, client, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary = plan.Summary(); summary.Downloaded != 0 || summary.Deleted != 0 || summary.Skipped != 3 {
+		t.Fatalf("second download plan: %+v", summary)
+	}
+}
+
+// TestBisync 双向同步：首次合并、两侧修改与删除、冲突策略和状态保留
+func TestBisync(t *testing.T) {
+	server := pantest.NewThunderServer()
+	defer server.Close()
+	client := getThunderFakeClient(t, server)
+	ctx := context.Background()
+
+	dir := t.TempDir()
+	writeLocal := func(name, data string) {
+		t.Helper()
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		future := time.Now().Add(time.Hour)
+		if err := os.Chtimes(p, future, future); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeRemote := func(name, data string) {
+		t.Helper()
+		if n, ok := server.Tree.Lookup("/shared/" + name); ok {
+			if err := server.Tree.Remove(n.Id); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if _, err := server.Tree.WriteFile("/shared/"+name, []byte(data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	readLocal := func(name string) string {
+		t.Helper()
+		data, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(name)))
+		if err != nil {
+			t.Fatalf("read %s: %v", name, err)
+		}
+		return string(data)
+	}
+	readRemote := func(name string) string {
+		t.Helper()
+		data, err := server.Tree.ReadFile("/shared/" + name)
+		if err != nil {
+			t.Fatalf("read remote %s: %v", name, err)
+		}
+		return string(data)
+	}
+
+	writeLocal("a.txt", "local a")
+	writeLocal("docs/b.txt", "local b")
+	writeRemote("r.txt", "remote r")
+	opts := pansync.BisyncOptions{LocalPath: dir, RemotePath: "/shared", Conflict: pansync.ConflictKeepBoth}
+
+	// 首次同步合并两侧
+	result, err := pansync.Bisync(ctx, client, opts)
+	if err != nil {
+		t.Fatalf("first bisync: %v", err)
+	}
+	if result.Upload.Uploaded != 2 || result.Upload.Mkdirs != 1 || result.Download.Downloaded != 1 {
+		t.Fatalf("first bisync: %+v %+v", result.Upload, result.Download)
+	}
+	if readRemote("docs/b.txt") != "local b" || readLocal("r.txt") != "remote r" {
+		t.Fatal("first bisync content")
+	}
+	if _, err = os.Stat(filepath.Join(dir, pansync.DefaultStateFile)); err != nil {
+		t.Fatalf("state file: %v", err)
+	}
+	if result, err = pansync.Bisync(ctx, client, opts); err != nil || result.Upload.Uploaded+result.Download.Downloaded != 0 {
+		t.Fatalf("unchanged bisync: %+v %+v %v", result.Upload, result.Download, err)
+	}
+
+	// 远程修改、本地删除、两侧同时修改
+	writeRemote("r.txt", "remote r v2")
+	if err = os.Remove(filepath.Join(dir, "docs", "b.txt")); err != nil {
+		t.Fatal(err)
+	}
+	writeLocal("a.txt", "local a v2")
+	writeRemote("a.txt", "remote a v2!")
+	dry := opts
+	dry.DryRun = true
+	if result, err = pansync.Bisync(ctx, client, dry); err != nil || len(result.Conflicts) != 1 || result.Upload.Deleted != 1 {
+		t.Fatalf("dry run: %+v %v", result, err)
+	}
+	if readLocal("a.txt") != "local a v2" || readRemote("docs/b.txt") != "local b" {
+		t.Fatal("dry run changed files")
+	}
+	if result, err = pansync.Bisync(ctx, client, opts); err != nil {
+		t.Fatalf("bisync: %v", err)
+	}
+	if readLocal("r.txt") != "remote r v2" {
+		t.Fatal("remote change not downloaded")
+	}
+	if _, ok := server.Tree.Lookup("/shared/docs/b.txt"); ok {
+		t.Fatal("local delete not applied")
+	}
+	if readLocal("a.txt") != "remote a v2!" || readLocal("a.conflict.txt") != "local a v2" || readRemote("a.conflict.txt") != "local a v2" {
+		t.Fatal("keep both conflict")
+	}
+	if len(result.Conflicts) != 1 || result.Conflicts[0].Resolution != "kept both as a.conflict.txt" {
+		t.Fatalf("conflicts: %+v", result.Conflicts)
+	}
+
+	// manual 冲突不处理，下次同步仍然报告
+	writeLocal("a.txt", "local a v3")
+	writeRemote("a.txt", "remote a v3!")
+	opts.Conflict = pansync.ConflictManual
+	for i := 0; i < 2; i++ {
+		result, err = pansync.Bisync(ctx, client, opts)
+		if err != nil || len(result.Conflicts) != 1 || result.Conflicts[0].Resolution != "manual" {
+			t.Fatalf("manual conflict %d: %+v %v", i, result, err)
+		}
+	}
+	if readLocal("a.txt") != "local a v3" || readRemote("a.txt") != "remote a v3!" {
+		t.Fatal("manual conflict changed files")
+	}
+
+	// newer：本地较新时覆盖网盘
+	opts.Conflict = pansync.ConflictNewer
+	if result, err = pansync.Bisync(ctx, client, opts); err != nil || result.Upload.Uploaded != 1 {
+		t.Fatalf("newer conflict: %+v %v", result, err)
+	}
+	if readRemote("a.txt") != "local a v3" {
+		t.Fatal("newer conflict not resolved")
+	}
+}
+
+// TestTransferManager 任务按优先级排队，支持暂停、恢复和取消
+func TestTransferManager(t *testing.T) {
+	server := pantest.NewThunderServer()
+	defer server.Close()
+	client := getThunderFakeClient(t, server)
+	ctx := context.Background()
+
+	content := bytes.Repeat([]byte("0123456789"), 1000)
+	var files []*pan.PanObj
+	for _, name := range []string{"a.bin", "b.bin", "c.bin"} {
+		if _, err := server.Tree.WriteFile("/m/"+name, content); err != nil {
+			t.Fatal(err)
+		}
+		file, err := client.Stat(pan.StatReq{Path: "/m/" + name})
+		if err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, file)
+	}
+	release := server.Hold("GET", "/thunder-file/"+files[0].Id)
+	defer release()
+
+	var mu sync.Mutex
+	var started []string
+	manager := pan.NewTransferManager(ctx, pan.TransferManagerOptions{
+		Concurrency: 1,
+		OnChange: func(job pan.JobInfo) {
+			if job.State == pan.JobRunning && job.Operated == 0 {
+				mu.Lock()
+				if len(started) == 0 || started[len(started)-1] != job.Name {
+					started = append(started, job.Name)
+				}
+				mu.Unlock()
+			}
+		},
+	})
+	defer manager.Close()
+	download := func(file *pan.PanObj, priority int) string {
+		t.Helper()
+		id, err := manager.Add(pan.JobSpec{
+			Driver:   client,
+			Priority: priority,
+			Download: &pan.DownloadFileReq{RemoteFile: file, LocalPath: t.TempDir()},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return id
+	}
+	waitState := func(id string, state pan.JobState) {
+		t.Helper()
+		for i := 0; i < 200; i++ {
+			if job, _ := manager.Get(id); job.State == state {
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		job, _ := manager.Get(id)
+		t.Fatalf("job %s is %s, want %s", job.Name, job.State, state)
+	}
+
+	a := download(files[0], 0)
+	waitState(a, pan.JobRunning)
+	b := download(files[1], 0)
+	c := download(files[2], 5)
+	if jobs := manager.List(); len(jobs) != 3 || jobs[1].State != pan.JobQueued || jobs[2].State != pan.JobQueued {
+		t.Fatalf("list: %+v", jobs)
+	}
+	if err := manager.Pause(a); err != nil {
+		t.Fatal(err)
+	}
+	if job, err := manager.Wait(ctx, a); err != nil || job.State != pan.JobPaused {
+		t.Fatalf("paused: %+v %v", job, err)
+	}
+	for _, id := range []string{b, c} {
+		if job, err := manager.Wait(ctx, id); err != nil || job.State != pan.JobDone || job.Percent != 100 {
+			t.Fatalf("done: %+v %v", job, err)
+		}
+	}
+	// OnChange 异步回调，等待事件送达
+	for i := 0; i < 200; i++ {
+		mu.Lock()
+		n := len(started)
+		mu.Unlock()
+		if n >= 3 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	mu.Lock()
+	if strings.Join(started, ",") != "a.bin,c.bin,b.bin" {
+		t.Fatalf("start order: %v", started)
+	}
+	mu.Unlock()
+
+	// 恢复后仍被阻塞，取消后不能再恢复
+	if err := manager.Resume(a); err != nil {
+		t.Fatal(err)
+	}
+	waitState(a, pan.JobRunning)
+	if err := manager.Cancel(a); err != nil {
+		t.Fatal(err)
+	}
+	if job, _ := manager.Wait(ctx, a); job.State != pan.JobCanceled {
+		t.Fatalf("canceled: %+v", job)
+	}
+	if err := manager.Resume(a); err == nil {
+		t.Fatal("resume canceled job")
+	}
+	if _, err := manager.Get("missing"); !errors.Is(err, pan.ErrNotFound) {
+		t.Fatalf("missing job: %v", err)
+	}
+
+	release()
+	dir := t.TempDir()
+	id, err := manager.Add(pan.JobSpec{Driver: client, Download: &pan.DownloadFileReq{RemoteFile: files[0], LocalPath: dir}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job, err := manager.Wait(ctx, id); err != nil || job.State != pan.JobDone {
+		t.Fatalf("download: %+v %v", job, err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "a.bin"))
+	if err != nil || !bytes.Equal(data, content) {
+		t.Fatalf("downloaded content: %v", err)
+	}
+
+	// 关闭后被中断的任务保持暂停，不能再恢复
+	releaseB := server.Hold("GET", "/thunder-file/"+files[1].Id)
+	defer releaseB()
+	b = download(files[1], 0)
+	waitState(b, pan.JobRunning)
+	manager.Close()
+	if err := manager.Resume(b); err == nil {
+		t.Fatal("resume after close")
+	}
+	if job, _ := manager.Get(b); job.State != pan.JobPaused {
+		t.Fatalf("job after close: %+v", job)
+	}
+}
+
+// TestTransferManagerReentrant OnChange 中可以调用管理器的方法
+func TestTransferManagerReentrant(t *testing.T) {
+	server := pantest.NewThunderServer()
+	defer server.Close()
+	client := getThunderFakeClient(t, server)
+	ctx := context.Background()
+	var files []*pan.PanObj
+	for _, name := range []string{"a.bin", "b.bin"} {
+		if _, err := server.Tree.WriteFile("/r/"+name, []byte(name)); err != nil {
+			t.Fatal(err)
+		}
+		file, err := client.Stat(pan.StatReq{Path: "/r/" + name})
+		if err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, file)
+	}
+
+	var manager *pan.TransferManager
+	next := make(chan string, 1)
+	manager = pan.NewTransferManager(ctx, pan.TransferManagerOptions{
+		OnChange: func(job pan.JobInfo) {
+			// 第一个任务完成后在回调中加入下一个任务
+			if job.Name != "a.bin" || job.State != pan.JobDone {
+				return
+			}
+			if _, err := manager.Get(job.Id); err != nil {
+				t.Error(err)
+			}
+			id, err := manager.Add(pan.JobSpec{Driver: client, Download: &pan.DownloadFileReq{RemoteFile: files[1], LocalPath: t.TempDir()}})
+			if err != nil {
+				t.Error(err)
+			}
+			next <- id
+		},
+	})
+	defer manager.Close()
+	if _, err := manager.Add(pan.JobSpec{Driver: client, Download: &pan.DownloadFileReq{RemoteFile: files[0], LocalPath: t.TempDir()}}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case id := <-next:
+		waitCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		defer cancel()
+		if job, err := manager.Wait(waitCtx, id); err != nil || job.State != pan.JobDone {
+			t.Fatalf("job added in OnChange: %+v %v", job, err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("OnChange blocked")
+	}
+}
+
+// TestListIterPages ListIter 逐页请求，提前结束时不再拉取后续页
+func TestListIterPages(t *testing.T) {
+	server := pantest.NewThunderServer()
+	defer server.Close()
+	server.PageSize = 2
+	client := getThunderFakeClient(t, server)
+
+	for i := 0; i < 7; i++ {
+		if _, err := server.Tree.WriteFile(fmt.Sprintf("/big/f%d.txt", i), []byte("x")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	dir := &pan.PanObj{Path: "/", Name: "big", Type: "dir"}
+	count := 0
+	for obj, err := range client.ListIter(context.Background(), dir) {
+		if err != nil || obj.Path != "/big" {
+			t.Fatalf("list iter: %v %v", obj, err)
+		}
+		count++
+	}
+	if count != 7 {
+		t.Fatalf("list iter: %d entries", count)
+	}
+
+	before := server.Calls("GET", "/drive/v1/files")
+	for range client.ListIter(context.Background(), dir) {
+		break
+	}
+	if calls := server.Calls("GET", "/drive/v1/files") - before; calls != 1 {
+		t.Fatalf("list iter break fetched %d pages", calls)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	count = 0
+	for _, err := range client.ListIter(ctx, dir) {
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("list iter cancelled: %v", err)
+		}
+		count++
+	}
+	if count != 1 {
+		t.Fatalf("list iter cancelled: %d results", count)
+	}
+}
+
+func TestConformance(t *testing.T) {
+	t.Run("local", func(t *testing.T) {
+		root := t.TempDir()
+		pantest.RunConformance(t, func() pan.Driver {
+			Init()
+			client, err := NewLocalClient(local.LocalProperties{RootPath: root})
+			if err != nil {
+				t.Fatalf("create local client: %v", err)
+			}
+			t.Cleanup(func() { RemoveDriver(client.GetId()) })
+			return client
+		})
+	})
+	t.Run("quark", func(t *testing.T) {
+		server := pantest.NewQuarkServer()
+		defer server.Close()
+		server.PartSize = 4096
+		pantest.RunConformance(t, func() pan.Driver {
+			return getQuarkFakeClient(t, server)
+		})
+	})
+	t.Run("thunder_browser", func(t *testing.T) {
+		server := pantest.NewThunderServer()
+		defer server.Close()
+		pantest.RunConformance(t, func() pan.Driver {
+			return getThunderFakeClient(t, server)
+		})
+	})
+	for _, tc := range []struct{ mode, typ string }{
+		{pantest.CloudreveModeChunk, cloudreve.Now61},
+		{pantest.CloudreveModeOneDrive, cloudreve.Huang1111},
+	} {
+		t.Run("cloudreve/"+tc.mode, func(t *testing.T) {
+			server := pantest.NewCloudreveServer()
+			defer server.Close()
+			server.Mode = tc.mode
+			server.ChunkSize = 4096
+			pantest.RunConformance(t, func() pan.Driver {
+				return getCloudreveClient(t, server, tc.typ)
+			})
+		})
+	}
+}
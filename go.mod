@@ -11,7 +11,7 @@ require (
 	github.com/imroc/req/v3 v3.48.0
 	github.com/vanym/golang-netscape-cookiejar v1.0.0
 	golang.org/x/sync v0.8.0
-
+	golang.org/x/sys v0.25.0
 )
 
 require (
@@ -42,7 +42,6 @@ require (
 	golang.org/x/exp v0.0.0-20240909161429-701f63a606c0 // indirect
 	golang.org/x/mod v0.21.0 // indirect
 	golang.org/x/net v0.29.0 // indirect
-	golang.org/x/sys v0.25.0 // indirect
 	golang.org/x/text v0.18.0 // indirect
 	golang.org/x/tools v0.25.0 // indirect
 )
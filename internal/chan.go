@@ -3,6 +3,7 @@ package internal
 import (
 	"context"
 	"sync"
+	"time"
 )
 
 var (
@@ -34,3 +35,15 @@ func Shutdown() {
 		shutdownWg.Wait()
 	})
 }
+
+// SleepCtx waits for d, returning ctx.Err() early if ctx is done first.
+func SleepCtx(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
@@ -53,6 +53,8 @@ type ChunkDownload struct {
 	lastIndex       int
 	pw              *progressWriter
 	progressFunc    ProgressFunc
+	rangeFunc       func(start, end int64)
+	mergeFunc       func(merged int64)
 }
 
 func NewChunkDownload(url string, client *req.Client) *ChunkDownload {
@@ -68,6 +70,30 @@ func (pd *ChunkDownload) SetProgressFunc(fn ProgressFunc) *ChunkDownload {
 	return pd
 }
 
+// SetRangeFunc 设置分片下载到临时文件后的回调，参数为分片的闭区间
+func (pd *ChunkDownload) SetRangeFunc(fn func(start, end int64)) *ChunkDownload {
+	pd.rangeFunc = fn
+	return pd
+}
+
+// SetMergeFunc 设置分片合并到输出文件后的回调，参数为输出文件已合并的字节数
+func (pd *ChunkDownload) SetMergeFunc(fn func(merged int64)) *ChunkDownload {
+	pd.mergeFunc = fn
+	return pd
+}
+
+// ChunkTempDir 返回 filename 分片下载使用的临时目录
+func ChunkTempDir(tempRootDir, filename string) (string, error) {
+	if tempRootDir == "" {
+		tempRootDir = os.TempDir()
+	}
+	fullPath, err := filepath.Abs(filename)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(tempRootDir, Md5HashStr(fullPath)), nil
+}
+
 func (pd *ChunkDownload) completeTask(task *downloadTask) {
 	pd.mu.Lock()
 	pd.taskMap[task.index] = task
@@ -117,9 +143,6 @@ func (pd *ChunkDownload) ensure() error {
 	if pd.chunkSize <= 0 {
 		pd.chunkSize = 1024 * 1024 * 10 // 10MB
 	}
-	if pd.tempRootDir == "" {
-		pd.tempRootDir = os.TempDir()
-	}
 	if pd.maxRetry <= 0 {
 		pd.maxRetry = 3
 	}
@@ -128,11 +151,11 @@ func (pd *ChunkDownload) ensure() error {
 	}
 	pd.semaphore = make(chan struct{}, pd.maxThread)
 
-	fullPath, err := filepath.Abs(pd.filename)
+	tempDir, err := ChunkTempDir(pd.tempRootDir, pd.filename)
 	if err != nil {
 		return err
 	}
-	pd.tempDir = filepath.Join(pd.tempRootDir, Md5HashStr(fullPath))
+	pd.tempDir = tempDir
 
 	err = os.MkdirAll(pd.tempDir, os.ModePerm)
 	if err != nil {
@@ -253,9 +276,9 @@ func (pd *ChunkDownload) handleTask(t *downloadTask, ctx ...context.Context) {
 		return
 	}
 	cpr := &chunkProgressWriter{
-		startTime:    time.Now(),
-		fileName:     t.tempFilename,
-		progressFunc: pd.progressFunc,
+		startTime: time.Now(),
+		fileName:  t.tempFilename,
+		pw:        pd.pw,
 	}
 	r := pd.client.R().
 		SetHeader("Range", fmt.Sprintf("bytes=%d-%d", t.rangeStart, t.rangeEnd)).
@@ -267,16 +290,21 @@ func (pd *ChunkDownload) handleTask(t *downloadTask, ctx ...context.Context) {
 	resp, er := r.Get(pd.url)
 	if er != nil {
 		file.Close()
+		pd.pw.updateChunk(-cpr.downloaded)
 		go pd.retry(t, er)
 		return
 	}
 	if resp.IsErrorState() {
 		file.Close()
+		pd.pw.updateChunk(-cpr.downloaded)
 		go pd.retry(t, fmt.Errorf("request error: %s", resp.String()))
 		return
 	}
 	t.tempFile = file
-	pd.pw.updateDownloading(t.totalSize)
+	pd.pw.updateDownloading(t.totalSize, cpr.downloaded)
+	if pd.rangeFunc != nil {
+		pd.rangeFunc(t.rangeStart, t.rangeEnd)
+	}
 	pd.completeTask(t)
 }
 
@@ -343,6 +371,9 @@ func (pd *ChunkDownload) mergeFile() {
 			return
 		}
 		_ = os.Remove(task.tempFilename)
+		if pd.mergeFunc != nil {
+			pd.mergeFunc(task.rangeEnd + 1)
+		}
 		if i >= pd.lastIndex {
 			break
 		}
@@ -505,10 +536,8 @@ func (pd *ChunkDownload) addRange(start int64, maxEnd int64, ranges []Range) (in
 		if end > maxEnd {
 			end = maxEnd
 		}
-		if end != start {
-			ranges = append(ranges, Range{start: start, end: end, completed: false, fileName: getRangeTempFile(start, end, pd.tempDir)})
-			start = end + 1
-		}
+		ranges = append(ranges, Range{start: start, end: end, completed: false, fileName: getRangeTempFile(start, end, pd.tempDir)})
+		start = end + 1
 		if end >= maxEnd {
 			break
 		}
@@ -556,16 +585,22 @@ func calFileName(filename, outputDirectory, url string) string {
 type progressWriter struct {
 	downloaded     int64
 	thisDownloaded int64
-	totalSize      int64
-	fileName       string
-	startTime      time.Time
-	m              sync.Mutex
-	progressFunc   ProgressFunc
+	// 进行中分片已下载的字节
+	downloading int64
+	// 已回调的字节，保证回调进度单调不减
+	reported     int64
+	totalSize    int64
+	fileName     string
+	startTime    time.Time
+	m            sync.Mutex
+	progressFunc ProgressFunc
 }
 
-func (p *progressWriter) updateDownloading(downloaded int64) {
+// updateDownloading 分片下载完成，inflight 为该分片此前通过 updateChunk 累计的字节
+func (p *progressWriter) updateDownloading(downloaded, inflight int64) {
 	p.m.Lock()
 	defer p.m.Unlock()
+	p.downloading -= inflight
 	p.thisDownloaded += downloaded
 	p.downloaded += downloaded
 	p.log()
@@ -578,46 +613,54 @@ func (p *progressWriter) updateDownloaded(downloaded int64) {
 	p.log()
 }
 
+// updateChunk 累加进行中分片的下载字节，分片失败重试时传入负数回退
+func (p *progressWriter) updateChunk(delta int64) {
+	p.m.Lock()
+	defer p.m.Unlock()
+	p.downloading += delta
+	p.notify()
+}
+
 func (p *progressWriter) log() {
 	LogProgress("downloading", p.fileName, p.startTime, p.thisDownloaded, p.downloaded, p.totalSize, true)
-	if p.progressFunc != nil {
-		elapsed := time.Since(p.startTime).Seconds()
-		var speed float64
-		if elapsed > 0 {
-			speed = float64(p.thisDownloaded) / 1024 / elapsed
-		}
-		percent := float64(p.downloaded) / float64(p.totalSize) * 100
-		done := p.downloaded >= p.totalSize
-		p.progressFunc(p.fileName, p.downloaded, p.totalSize, percent, speed, done)
+	p.notify()
+}
+
+// notify 回调整个文件的下载进度，仅在所有分片完成后 done 为 true
+func (p *progressWriter) notify() {
+	if p.progressFunc == nil {
+		return
+	}
+	operated := max(min(p.downloaded+p.downloading, p.totalSize), p.reported)
+	p.reported = operated
+	elapsed := time.Since(p.startTime).Seconds()
+	var speed float64
+	if elapsed > 0 {
+		speed = float64(p.thisDownloaded+p.downloading) / 1024 / elapsed
 	}
+	percent := float64(operated) / float64(p.totalSize) * 100
+	done := p.downloaded >= p.totalSize
+	p.progressFunc(p.fileName, operated, p.totalSize, percent, speed, done)
 }
 
 type chunkProgressWriter struct {
-	downloaded   int64
-	totalSize    int64
-	startTime    time.Time
-	fileName     string
-	progressFunc ProgressFunc
+	downloaded int64
+	totalSize  int64
+	startTime  time.Time
+	fileName   string
+	pw         *progressWriter
 }
 
 func (c *chunkProgressWriter) log() {
 	LogProgress("downloading", c.fileName, c.startTime, c.downloaded, c.downloaded, c.totalSize, false)
-	if c.progressFunc != nil {
-		elapsed := time.Since(c.startTime).Seconds()
-		var speed float64
-		if elapsed > 0 {
-			speed = float64(c.downloaded) / 1024 / elapsed
-		}
-		percent := float64(c.downloaded) / float64(c.totalSize) * 100
-		done := c.downloaded >= c.totalSize
-		c.progressFunc(c.fileName, c.downloaded, c.totalSize, percent, speed, done)
-	}
 }
 
 func (c *chunkProgressWriter) downloadCallback(info req.DownloadInfo) {
 	if info.Response.Response != nil {
 		c.totalSize = info.Response.ContentLength
+		delta := info.DownloadedSize - c.downloaded
 		c.downloaded = info.DownloadedSize
 		c.log()
+		c.pw.updateChunk(delta)
 	}
 }
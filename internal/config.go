@@ -6,7 +6,9 @@ import (
 	"strconv"
 )
 
-// SetDefaultByTag 根据结构体字段的tag设置默认值，包括嵌套对象和指针
+// SetDefaultByTag 根据结构体字段的tag设置默认值，包括嵌套对象和指针。
+// 只填充零值字段，调用方已赋值的字段（如自定义的 ChunkSize、ApiUrl）保持不变；
+// 因此 bool 字段不能使用 default:"true"，否则无法设置为 false
 func SetDefaultByTag(obj interface{}) {
 	// 获取对象的反射值
 	v := reflect.ValueOf(obj)
@@ -28,15 +30,14 @@ func setDefaults(v reflect.Value) {
 			continue // 如果字段不可设置，则跳过
 		}
 		if field.Kind() == reflect.Ptr {
-			// 如果字段是指针类型，需要特别处理
-			// 尝试创建一个新的实例
-			ptrValue := reflect.New(field.Type().Elem())
-			if ptrValue.Type() == field.Type() {
-				// 递归设置指针指向的值
-				setDefaults(ptrValue.Elem())
-				// 将指针指向新的实例
-				field.Set(ptrValue)
+			// 指针指向结构体时递归设置，已有实例时保留调用方的值，为空时创建新实例
+			if field.Type().Elem().Kind() != reflect.Struct {
+				continue
 			}
+			if field.IsNil() {
+				field.Set(reflect.New(field.Type().Elem()))
+			}
+			setDefaults(field.Elem())
 			continue
 		} else if field.Kind() == reflect.Struct {
 			// 如果是结构体，则递归调用setDefaults
@@ -48,8 +49,8 @@ func setDefaults(v reflect.Value) {
 		tag := v.Type().Field(i).Tag
 		defaultValue := tag.Get("default") // 从tag中获取默认值
 
-		// 如果有默认值，则设置
-		if defaultValue != "" {
+		// 如果有默认值且字段未被赋值，则设置
+		if defaultValue != "" && field.IsZero() {
 			switch field.Kind() {
 			case reflect.String:
 				field.SetString(defaultValue)
@@ -1,11 +1,15 @@
 package pan
 
 import (
+	"cmp"
 	"context"
 	"fmt"
 	"io"
+	"iter"
 	"os"
+	"path"
 	"path/filepath"
+	"slices"
 	"strings"
 	"time"
 
@@ -25,6 +29,7 @@ const (
 	Cloudreve      DriverType = "cloudreve"
 	Quark          DriverType = "quark"
 	ThunderBrowser DriverType = "thunder_browser"
+	Local          DriverType = "local"
 )
 
 type Properties interface {
@@ -37,7 +42,11 @@ type Properties interface {
 type Driver interface {
 	Meta
 	Operate
+	OperateContext
 	Share
+	ShareContext
+	Trash
+	TrashContext
 }
 
 type Meta interface {
@@ -46,6 +55,8 @@ type Meta interface {
 	// Close releases all resources held by the driver (cache, goroutines, etc.).
 	Close() error
 	GetProperties() Properties
+	// Capabilities reports which optional operations the driver supports.
+	Capabilities() Capabilities
 	Get(key string) (interface{}, bool)
 	GetOrLoad(key string, loader func() (interface{}, error)) (interface{}, error)
 	Set(key string, value interface{})
@@ -56,13 +67,17 @@ type Meta interface {
 type Operate interface {
 	Disk() (*DiskResp, error)
 	List(req ListReq) ([]*PanObj, error)
+	Stat(req StatReq) (*PanObj, error)
+	Search(req SearchReq) ([]*PanObj, error)
 	ObjRename(req ObjRenameReq) error
 	BatchRename(req BatchRenameReq) error
 	Mkdir(req MkdirReq) (*PanObj, error)
 	Move(req MovieReq) error
+	Copy(req CopyReq) error
 	Delete(req DeleteReq) error
 	UploadPath(req UploadPathReq) (*TransferResult, error)
 	UploadFile(req UploadFileReq) (*TransferResult, error)
+	UploadStream(req UploadStreamReq) (*TransferResult, error)
 	DownloadPath(req DownloadPathReq) (*TransferResult, error)
 	DownloadFile(req DownloadFileReq) (*TransferResult, error)
 	OfflineDownload(req OfflineDownloadReq) (*Task, error)
@@ -70,6 +85,65 @@ type Operate interface {
 	DirectLink(req DirectLinkReq) ([]*DirectLink, error)
 }
 
+// OperateContext is the context-aware variant of Operate. Every method aborts
+// its HTTP calls and polling loops once ctx or the client context is done;
+// the plain Operate methods are equivalent to passing the client context.
+type OperateContext interface {
+	DiskCtx(ctx context.Context) (*DiskResp, error)
+	ListCtx(ctx context.Context, req ListReq) ([]*PanObj, error)
+	// ListIter yields the entries of dir page by page as the service returns
+	// them, so the first entries arrive before the listing is complete and
+	// breaking out of the loop stops fetching. A cached listing is replayed
+	// without requests; pages read by the iterator are not cached.
+	ListIter(ctx context.Context, dir *PanObj) iter.Seq2[*PanObj, error]
+	StatCtx(ctx context.Context, req StatReq) (*PanObj, error)
+	SearchCtx(ctx context.Context, req SearchReq) ([]*PanObj, error)
+	ObjRenameCtx(ctx context.Context, req ObjRenameReq) error
+	BatchRenameCtx(ctx context.Context, req BatchRenameReq) error
+	MkdirCtx(ctx context.Context, req MkdirReq) (*PanObj, error)
+	MoveCtx(ctx context.Context, req MovieReq) error
+	CopyCtx(ctx context.Context, req CopyReq) error
+	DeleteCtx(ctx context.Context, req DeleteReq) error
+	UploadPathCtx(ctx context.Context, req UploadPathReq) (*TransferResult, error)
+	UploadFileCtx(ctx context.Context, req UploadFileReq) (*TransferResult, error)
+	// UploadStreamCtx uploads a stream without a local file. Drivers whose
+	// service needs hashes before the upload (Quark md5/sha1, Thunder gcid)
+	// write the stream to a temporary file first unless req.Size and those
+	// hashes are given in req.KnownHashes; Cloudreve only needs req.Size and
+	// Local writes the stream directly.
+	UploadStreamCtx(ctx context.Context, req UploadStreamReq) (*TransferResult, error)
+	DownloadPathCtx(ctx context.Context, req DownloadPathReq) (*TransferResult, error)
+	DownloadFileCtx(ctx context.Context, req DownloadFileReq) (*TransferResult, error)
+	OfflineDownloadCtx(ctx context.Context, req OfflineDownloadReq) (*Task, error)
+	TaskListCtx(ctx context.Context, req TaskListReq) ([]*Task, error)
+	DirectLinkCtx(ctx context.Context, req DirectLinkReq) ([]*DirectLink, error)
+	// DownloadLinkCtx resolves the short-lived address DownloadFile reads
+	// file from. The link must be fetched with its Client, which carries the
+	// cookies and headers the service expects, and honours Range requests.
+	DownloadLinkCtx(ctx context.Context, file *PanObj) (*DownloadLink, error)
+	// Open returns a seekable reader over the content of file without
+	// downloading it first. Remote drivers read with HTTP Range requests and
+	// resolve the download link again when it expires; the reader stops when
+	// ctx or the client context is done and must be closed.
+	Open(ctx context.Context, file *PanObj) (io.ReadSeekCloser, error)
+}
+
+// Capabilities describes the optional operations a driver supports, so callers
+// can enable or disable actions without calling them and parsing errors.
+// Operations reported as unsupported fail with ErrUnsupported.
+type Capabilities struct {
+	OfflineDownload bool  `json:"offlineDownload"` // OfflineDownload
+	TaskList        bool  `json:"taskList"`        // TaskList
+	DirectLink      bool  `json:"directLink"`      // DirectLink
+	Share           bool  `json:"share"`           // ShareList、NewShare、DeleteShare
+	ShareRestore    bool  `json:"shareRestore"`    // ShareRestore
+	FastUpload      bool  `json:"fastUpload"`      // 秒传，UploadFileReq.OnlyFast
+	ResumableUpload bool  `json:"resumableUpload"` // 断点续传，UploadFileReq.Resumable
+	Copy            bool  `json:"copy"`            // 服务端复制，否则 Copy 通过下载再上传实现
+	Trash           bool  `json:"trash"`           // TrashList、TrashRestore、TrashDelete、TrashEmpty
+	MaxFileSize     int64 `json:"maxFileSize"`     // 单文件大小上限（字节），0 表示不限制或未知
+}
+
 // ProxyConfig holds proxy settings for a driver instance.
 type ProxyConfig struct {
 	ProxyURL string // 支持 http://host:port 或 socks5://host:port
@@ -79,7 +153,9 @@ type BaseOperate struct {
 	DownloadConfig DownloadConfig
 	ProxyConfig    ProxyConfig
 	Ctx            context.Context
-	cancelFunc     context.CancelFunc
+	// 记录可续传的上传会话和下载进度，为空时使用进程内的默认记录
+	Journal    Journal
+	cancelFunc context.CancelFunc
 }
 
 // NewBaseOperate creates a BaseOperate with the given config, context, and cancel function.
@@ -99,6 +175,44 @@ func (b *BaseOperate) Cancel() {
 	}
 }
 
+// Context returns the client context, or context.Background() when none is set.
+func (b *BaseOperate) Context() context.Context {
+	if b.Ctx != nil {
+		return b.Ctx
+	}
+	return context.Background()
+}
+
+// JoinContext returns a context that is done when either ctx or the client
+// context is done, so Cancel also aborts calls made with a caller context.
+// The returned cancel function must be called to release resources.
+func (b *BaseOperate) JoinContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if ctx == nil || ctx == b.Ctx {
+		return b.Context(), func() {}
+	}
+	if b.Ctx == nil {
+		return ctx, func() {}
+	}
+	// AfterFunc 异步触发，客户端已取消时直接返回其 ctx
+	if b.Ctx.Err() != nil {
+		return b.Ctx, func() {}
+	}
+	joined, cancel := context.WithCancel(ctx)
+	stop := context.AfterFunc(b.Ctx, cancel)
+	return joined, func() {
+		stop()
+		cancel()
+	}
+}
+
+// WithCtx binds ctx to a context-aware method so it can be passed to helpers
+// that take the plain Operate signature, such as BaseUploadPath.
+func WithCtx[Req, Resp any](ctx context.Context, fn func(context.Context, Req) (Resp, error)) func(Req) (Resp, error) {
+	return func(req Req) (Resp, error) {
+		return fn(ctx, req)
+	}
+}
+
 func (b *BaseOperate) BaseUploadPath(req UploadPathReq, UploadFile func(req UploadFileReq) (*TransferResult, error)) error {
 	localPath := req.LocalPath
 	if localPath != "" {
@@ -114,6 +228,7 @@ func (b *BaseOperate) BaseUploadPath(req UploadPathReq, UploadFile func(req Uplo
 				Resumable:          req.Resumable,
 				OnlyFast:           req.OnlyFast,
 				SuccessDel:         req.SuccessDel,
+				Concurrency:        req.Concurrency,
 				RemotePathTransfer: req.RemotePathTransfer,
 				RemoteNameTransfer: req.RemotePathTransfer,
 				ProgressCallback:   req.ProgressCallback,
@@ -164,6 +279,7 @@ func (b *BaseOperate) BaseUploadPath(req UploadPathReq, UploadFile func(req Uplo
 						OnlyFast:           req.OnlyFast,
 						Resumable:          req.Resumable,
 						SuccessDel:         req.SuccessDel,
+						Concurrency:        req.Concurrency,
 						RemotePathTransfer: req.RemotePathTransfer,
 						RemoteNameTransfer: req.RemotePathTransfer,
 						ProgressCallback:   req.ProgressCallback,
@@ -206,7 +322,10 @@ func (b *BaseOperate) BaseUploadPath(req UploadPathReq, UploadFile func(req Uplo
 	return OnlyMsg("path is empty")
 }
 
-func (b *BaseOperate) BaseDownloadPath(req DownloadPathReq,
+// BaseDownloadPath downloads the tree below req.RemotePath. The tree is
+// walked first with concurrent listings bound to ctx, then the selected
+// files are downloaded one by one into the matching local directories.
+func (b *BaseOperate) BaseDownloadPath(ctx context.Context, req DownloadPathReq,
 	List func(req ListReq) ([]*PanObj, error),
 	DownloadFile func(req DownloadFileReq) (*TransferResult, error)) error {
 	dir := req.RemotePath
@@ -215,91 +334,87 @@ func (b *BaseOperate) BaseDownloadPath(req DownloadPathReq,
 	if dir.Type != "dir" {
 		return OnlyMsg("only support download dir")
 	}
-	objs, err := List(ListReq{
-		Reload: true,
-		Dir:    req.RemotePath,
-	})
-	if err != nil {
-		return err
+	type downloadItem struct {
+		object    *PanObj
+		localPath string
 	}
-	for _, object := range objs {
-		NotDownload := false
+	items := make([]downloadItem, 0)
+	// 远程目录完整路径到本地目录的映射，子目录名经过 RemoteNameTransfer 转换
+	localDirs := map[string]string{path.Join(dir.Path, dir.Name): req.LocalPath}
+	opts := WalkOptions{Reload: true, Concurrency: DefaultWalkConcurrency}
+	if req.NotTraverse {
+		opts.MaxDepth = 1
+	}
+	err := walkList(ctx, List, dir, func(object *PanObj, err error) error {
+		if err != nil {
+			if req.SkipFileErr && object != dir {
+				internal.GetLogger().Error("download error", "object", object.Name, "error", err)
+				return nil
+			}
+			return err
+		}
+		localPath := localDirs[path.Clean(object.Path)]
 		objectName := object.Name
 		if req.RemoteNameTransfer != nil {
 			objectName = req.RemoteNameTransfer(objectName)
 		}
 		if object.Type == "dir" {
-			for _, ignorePath := range req.IgnorePaths {
-				if objectName == ignorePath {
-					NotDownload = true
-					break
-				}
-			}
-			if !NotDownload && req.NotTraverse == false {
-				err = b.BaseDownloadPath(DownloadPathReq{
-					RemotePath:         object,
-					LocalPath:          strings.Trim(req.LocalPath, "/") + "/" + objectName,
-					Concurrency:        req.Concurrency,
-					ChunkSize:          req.ChunkSize,
-					OverCover:          req.OverCover,
-					DownloadCallback:   req.DownloadCallback,
-					ProgressCallback:   req.ProgressCallback,
-					Extensions:         req.Extensions,
-					IgnorePaths:        req.IgnorePaths,
-					IgnoreExtensions:   req.IgnoreExtensions,
-					IgnoreFiles:        req.IgnoreFiles,
-					RemoteNameTransfer: req.RemoteNameTransfer,
-					SkipFileErr:        req.SkipFileErr,
-				}, List, DownloadFile)
-				if err != nil {
-					if req.SkipFileErr {
-						internal.GetLogger().Error("download error", "object", objectName, "error", err)
-					} else {
-						return err
-					}
-				}
-			} else {
+			if slices.Contains(req.IgnorePaths, objectName) {
 				internal.GetLogger().Info("dir will skip", "object", objectName)
+				return SkipDir
 			}
-		} else {
-			for _, extension := range req.Extensions {
-				if strings.HasSuffix(objectName, extension) {
-					NotDownload = false
-					break
-				}
-				NotDownload = true
+			localDirs[path.Join(object.Path, object.Name)] = strings.TrimRight(localPath, "/") + "/" + objectName
+			return nil
+		}
+		NotDownload := false
+		for _, extension := range req.Extensions {
+			if strings.HasSuffix(objectName, extension) {
+				NotDownload = false
+				break
 			}
-			for _, ignoreFile := range req.IgnoreFiles {
-				if objectName == ignoreFile {
-					NotDownload = true
-					break
-				}
+			NotDownload = true
+		}
+		for _, ignoreFile := range req.IgnoreFiles {
+			if objectName == ignoreFile {
+				NotDownload = true
+				break
 			}
-			for _, extension := range req.IgnoreExtensions {
-				if strings.HasSuffix(objectName, extension) {
-					NotDownload = true
-					break
-				}
+		}
+		for _, extension := range req.IgnoreExtensions {
+			if strings.HasSuffix(objectName, extension) {
+				NotDownload = true
+				break
 			}
-			if !NotDownload {
-				_, err = DownloadFile(DownloadFileReq{
-					RemoteFile:       object,
-					LocalPath:        req.LocalPath,
-					Concurrency:      req.Concurrency,
-					ChunkSize:        req.ChunkSize,
-					OverCover:        req.OverCover,
-					DownloadCallback: req.DownloadCallback,
-					ProgressCallback: req.ProgressCallback,
-				})
-				if err != nil {
-					if req.SkipFileErr {
-						internal.GetLogger().Error("download error", "object", objectName, "error", err)
-					} else {
-						return err
-					}
-				}
+		}
+		if NotDownload {
+			internal.GetLogger().Info("file will skip", "object", objectName)
+			return nil
+		}
+		items = append(items, downloadItem{object: object, localPath: localPath})
+		return nil
+	}, opts)
+	if err != nil {
+		return err
+	}
+	for _, item := range items {
+		// 取消后不再逐个文件报错
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+		_, err = DownloadFile(DownloadFileReq{
+			RemoteFile:       item.object,
+			LocalPath:        item.localPath,
+			Concurrency:      req.Concurrency,
+			ChunkSize:        req.ChunkSize,
+			OverCover:        req.OverCover,
+			DownloadCallback: req.DownloadCallback,
+			ProgressCallback: req.ProgressCallback,
+		})
+		if err != nil {
+			if req.SkipFileErr {
+				internal.GetLogger().Error("download error", "object", item.object.Name, "error", err)
 			} else {
-				internal.GetLogger().Info("file will skip", "object", objectName)
+				return err
 			}
 		}
 	}
@@ -309,6 +424,12 @@ func (b *BaseOperate) BaseDownloadPath(req DownloadPathReq,
 
 type DownloadUrl func(req DownloadFileReq) (string, error)
 
+// DownloadLink is a resolved download address for a file.
+type DownloadLink struct {
+	Url    string      // file:// 表示本地文件
+	Client *req.Client // 下载使用的客户端，为空时使用默认客户端
+}
+
 func (b *BaseOperate) BaseDownloadFile(req DownloadFileReq,
 	client *req.Client,
 	downloadUrl DownloadUrl) error {
@@ -319,10 +440,16 @@ func (b *BaseOperate) BaseDownloadFile(req DownloadFileReq,
 	remoteFileName := strings.Trim(object.Path, "/") + "/" + object.Name
 	internal.GetLogger().Info("start download file", "file", remoteFileName)
 	outputFile := req.LocalPath + "/" + object.Name
+	tmpDir, err := internal.ChunkTempDir(b.DownloadConfig.TmpPath, outputFile)
+	if err != nil {
+		return OnlyError(err)
+	}
+	journal := b.loadDownloadJournal(object, outputFile, tmpDir)
 	fileInfo, err := internal.IsExistFile(outputFile)
 	if fileInfo != nil && err == nil {
 		if fileInfo.Size() == object.Size {
 			if !req.OverCover {
+				journal.done()
 				if req.DownloadCallback != nil {
 					abs, _ := filepath.Abs(outputFile)
 					req.DownloadCallback("", "", filepath.Dir(abs), abs)
@@ -351,7 +478,9 @@ func (b *BaseOperate) BaseDownloadFile(req DownloadFileReq,
 		SetOutputFile(outputFile).
 		SetTempRootDir(b.DownloadConfig.TmpPath).
 		SetMaxRetry(b.DownloadConfig.MaxRetry).
-		SetMaxThread(b.DownloadConfig.MaxThread)
+		SetMaxThread(b.DownloadConfig.MaxThread).
+		SetRangeFunc(journal.addRange).
+		SetMergeFunc(journal.merged)
 	if req.ProgressCallback != nil {
 		fileId := ""
 		if object != nil {
@@ -375,6 +504,7 @@ func (b *BaseOperate) BaseDownloadFile(req DownloadFileReq,
 		internal.GetLogger().Error("error download file", "file", remoteFileName, "error", e)
 		return e
 	}
+	journal.done()
 
 	internal.GetLogger().Info("end download file", "file", remoteFileName, "output", outputFile)
 	if req.DownloadCallback != nil {
@@ -391,6 +521,33 @@ type Share interface {
 	ShareRestore(req ShareRestoreReq) error
 }
 
+// ShareContext is the context-aware variant of Share.
+type ShareContext interface {
+	ShareListCtx(ctx context.Context, req ShareListReq) ([]*ShareData, error)
+	NewShareCtx(ctx context.Context, req NewShareReq) (*ShareData, error)
+	DeleteShareCtx(ctx context.Context, req DelShareReq) error
+	ShareRestoreCtx(ctx context.Context, req ShareRestoreReq) error
+}
+
+// Trash manages the recycle bin that Delete moves objects into. Objects
+// returned by TrashList carry the recycle-bin record id in Id, which is what
+// TrashRestore and TrashDelete expect, and the deletion time in unix
+// milliseconds in Ext["deletedAt"] when the service reports it.
+type Trash interface {
+	TrashList() ([]*PanObj, error)
+	TrashRestore(req TrashReq) error
+	TrashDelete(req TrashReq) error
+	TrashEmpty() error
+}
+
+// TrashContext is the context-aware variant of Trash.
+type TrashContext interface {
+	TrashListCtx(ctx context.Context) ([]*PanObj, error)
+	TrashRestoreCtx(ctx context.Context, req TrashReq) error
+	TrashDeleteCtx(ctx context.Context, req TrashReq) error
+	TrashEmptyCtx(ctx context.Context) error
+}
+
 // OnChangeFunc is a callback invoked when driver properties change.
 type OnChangeFunc func(props Properties)
 
@@ -460,26 +617,30 @@ func (c *CacheOperate) Del(key string) {
 
 // BaseBatchRename provides a default BatchRename implementation.
 // Drivers can call this with their own List and ObjRename methods.
-func (b *BaseOperate) BaseBatchRename(req BatchRenameReq,
+// BaseBatchRename renames every object below req.Path whose name req.Func
+// changes. The tree is walked first, with listings bound to ctx, and objects
+// are renamed deepest first, so renaming a directory never invalidates the
+// objects inside it.
+func (b *BaseOperate) BaseBatchRename(ctx context.Context, req BatchRenameReq,
 	List func(req ListReq) ([]*PanObj, error),
-	ObjRename func(req ObjRenameReq) error,
-	BatchRename func(req BatchRenameReq) error) error {
-	objs, err := List(ListReq{
-		Reload: true,
-		Dir:    req.Path,
-	})
+	ObjRename func(req ObjRenameReq) error) error {
+	objs := make([]*PanObj, 0)
+	err := walkList(ctx, List, req.Path, func(obj *PanObj, err error) error {
+		if err != nil {
+			return err
+		}
+		objs = append(objs, obj)
+		return nil
+	}, WalkOptions{Reload: true, Concurrency: DefaultWalkConcurrency})
 	if err != nil {
 		return err
 	}
+	slices.SortStableFunc(objs, func(x, y *PanObj) int {
+		return cmp.Compare(strings.Count(path.Join(y.Path, y.Name), "/"), strings.Count(path.Join(x.Path, x.Name), "/"))
+	})
 	for _, object := range objs {
-		if object.Type == "dir" {
-			err = BatchRename(BatchRenameReq{
-				Path: object,
-				Func: req.Func,
-			})
-			if err != nil {
-				return err
-			}
+		if err = ctx.Err(); err != nil {
+			return err
 		}
 		newName := req.Func(object)
 		if newName != object.Name {
@@ -495,39 +656,119 @@ func (b *BaseOperate) BaseBatchRename(req BatchRenameReq,
 	return nil
 }
 
-// CollectItemIds collects IDs from PanObj items, resolving paths when needed.
-// Used by Move/Delete operations in quark and thunder_browser drivers.
+// BaseCopy copies items into req.TargetObj by reading every file with Open
+// and uploading it again with UploadStream under the same relative path. It
+// is the fallback for drivers without a server-side copy. Files are streamed
+// and never staged on disk: the hashes in needHashes that the listing did not
+// return are computed by reading the file once before the upload reads it
+// again.
+func (c *CommonOperate) BaseCopy(req CopyReq, needHashes []string,
+	List func(req ListReq) ([]*PanObj, error),
+	Mkdir func(req MkdirReq) (*PanObj, error),
+	Open func(file *PanObj) (io.ReadSeekCloser, error),
+	UploadStream func(req UploadStreamReq) (*TransferResult, error)) error {
+	if req.TargetObj.Type == "file" {
+		return OnlyMsg("target is a file")
+	}
+
+	var copyItems func(items []*PanObj, targetPath string) error
+	copyItems = func(items []*PanObj, targetPath string) error {
+		if _, err := Mkdir(MkdirReq{NewPath: strings.Trim(targetPath, "/")}); err != nil {
+			return err
+		}
+		for _, item := range items {
+			obj := item
+			if obj.Id == "" {
+				resolved, err := c.GetPanObj(strings.TrimRight(obj.Path, "/")+"/"+obj.Name, true, List)
+				if err != nil {
+					return err
+				}
+				obj = resolved
+			}
+			if obj.Id == "0" {
+				return KindMsg(ErrUnsupported, "not support copy root path")
+			}
+			if obj.Type == "dir" {
+				children, err := List(ListReq{Dir: obj, Reload: true})
+				if err != nil {
+					return err
+				}
+				if err = copyItems(children, path.Join(targetPath, obj.Name)); err != nil {
+					return err
+				}
+				continue
+			}
+			reader, err := Open(obj)
+			if err != nil {
+				return err
+			}
+			hashes, err := streamHashes(reader, obj, needHashes)
+			if err == nil {
+				_, err = UploadStream(UploadStreamReq{
+					Reader:      reader,
+					Size:        obj.Size,
+					Name:        obj.Name,
+					RemotePath:  targetPath,
+					KnownHashes: hashes,
+				})
+			}
+			_ = reader.Close()
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	targetPath := path.Clean("/" + strings.Trim(req.TargetObj.Path, "/") + "/" + req.TargetObj.Name)
+	// 目标在源目录内时，新建的目标目录会出现在源目录的列表中，导致无限递归
+	for _, item := range req.Items {
+		itemPath := path.Clean("/" + strings.Trim(item.Path, "/") + "/" + item.Name)
+		if itemPath != "/" && strings.HasPrefix(targetPath+"/", itemPath+"/") {
+			return OnlyMsg("can not copy " + itemPath + " into itself")
+		}
+	}
+	return copyItems(req.Items, targetPath)
+}
+
+// CollectResult holds the object IDs and stale directory IDs gathered by CollectItemIds.
 type CollectResult struct {
 	ObjIds       []string
 	ReloadDirIds map[string]bool
 }
 
-func CollectItemIds(items []*PanObj, getPanObj func(path string, mustExist bool, list func(req ListReq) ([]*PanObj, error)) (*PanObj, error), list func(req ListReq) ([]*PanObj, error), forDelete bool) *CollectResult {
+// CollectItemIds collects IDs from PanObj items, resolving items without an Id by
+// Path and Name. It also records the directories whose cached listing becomes
+// stale: each item's parent, plus the item itself when it is a directory.
+// An item that can not be resolved fails the whole call, with ErrNotFound
+// when its path does not exist, so the operation never partly applies.
+// Used by Move/Delete operations in quark and thunder_browser drivers.
+func CollectItemIds(items []*PanObj, getPanObj func(path string, mustExist bool, list func(req ListReq) ([]*PanObj, error)) (*PanObj, error), list func(req ListReq) ([]*PanObj, error)) (*CollectResult, error) {
 	result := &CollectResult{
 		ObjIds:       make([]string, 0),
 		ReloadDirIds: make(map[string]bool),
 	}
 	for _, item := range items {
-		if item.Id != "0" && item.Id != "" {
-			result.ObjIds = append(result.ObjIds, item.Id)
-			if item.Type == "dir" {
-				result.ReloadDirIds[item.Id] = true
-			} else if forDelete && item.Parent != nil && item.Parent.Id != "" {
-				result.ReloadDirIds[item.Parent.Id] = true
+		obj := item
+		if item.Id == "0" || item.Id == "" {
+			if strings.Trim(item.Path+"/"+item.Name, "/") == "" {
+				continue
 			}
-		} else if item.Path != "" && item.Path != "/" {
-			obj, err := getPanObj(item.Path, true, list)
-			if err == nil {
-				result.ObjIds = append(result.ObjIds, obj.Id)
-				if obj.Type == "dir" {
-					result.ReloadDirIds[obj.Id] = true
-				} else if forDelete && item.Parent != nil && item.Parent.Id != "" {
-					result.ReloadDirIds[item.Parent.Id] = true
-				}
+			itemPath := strings.TrimRight(item.Path, "/") + "/" + item.Name
+			resolved, err := getPanObj(itemPath, true, list)
+			if err != nil {
+				return nil, MsgError("resolve "+itemPath+" error", err)
 			}
+			obj = resolved
+		}
+		result.ObjIds = append(result.ObjIds, obj.Id)
+		if obj.Type == "dir" {
+			result.ReloadDirIds[obj.Id] = true
+		}
+		if obj.Parent != nil && obj.Parent.Id != "" {
+			result.ReloadDirIds[obj.Parent.Id] = true
 		}
 	}
-	return result
+	return result, nil
 }
 
 // DownloadConfig holds per-client download settings.
@@ -552,6 +793,166 @@ func (dc *DownloadConfig) ApplyDefaults() {
 type CommonOperate struct {
 }
 
+// BaseStat resolves a single object by path through its ancestors' listings,
+// reusing the directory cache. Drivers that can look objects up directly
+// should prefer that and fall back to BaseStat.
+func (c *CommonOperate) BaseStat(req StatReq, list func(req ListReq) ([]*PanObj, error)) (*PanObj, error) {
+	if req.Path == "" {
+		return nil, KindMsg(ErrUnsupported, "not support stat by id, please set path")
+	}
+	target := path.Clean("/" + strings.Trim(req.Path, "/"))
+	if target == "/" {
+		return &PanObj{Id: "0", Name: "", Path: "/", Size: 0, Type: "dir"}, nil
+	}
+	parent, err := c.GetPanObj(path.Dir(target), true, list)
+	if err != nil {
+		return nil, err
+	}
+	name := path.Base(target)
+	if parent.Type == "dir" {
+		// 缓存中找不到时重新加载一次父目录
+		for _, reload := range []bool{req.Reload, true} {
+			children, err := list(ListReq{Dir: parent, Reload: reload})
+			if err != nil {
+				return nil, err
+			}
+			for _, child := range children {
+				if child.Name == name {
+					return child, nil
+				}
+			}
+			if reload {
+				break
+			}
+		}
+	}
+	return nil, KindMsg(ErrNotFound, fmt.Sprintf("%s not found", target))
+}
+
+// Apply sorts, filters and pages a complete directory listing according to
+// the options of req. objs is usually the cached listing and is never
+// modified; ties in the sort order are broken by name.
+func (req ListReq) Apply(objs []*PanObj) ([]*PanObj, error) {
+	if req.SortBy == "" && req.TypeFilter == "" && req.NameGlob == "" && req.Offset <= 0 && req.Limit <= 0 {
+		return objs, nil
+	}
+	if _, err := path.Match(req.NameGlob, ""); err != nil {
+		return nil, MsgError("bad name glob "+req.NameGlob, err)
+	}
+	result := make([]*PanObj, 0, len(objs))
+	for _, obj := range objs {
+		if req.TypeFilter != "" && obj.Type != req.TypeFilter {
+			continue
+		}
+		if req.NameGlob != "" {
+			if ok, _ := path.Match(req.NameGlob, obj.Name); !ok {
+				continue
+			}
+		}
+		result = append(result, obj)
+	}
+	if req.SortBy != "" {
+		var compare func(a, b *PanObj) int
+		switch req.SortBy {
+		case SortByName:
+			compare = func(a, b *PanObj) int { return 0 }
+		case SortBySize:
+			compare = func(a, b *PanObj) int { return cmp.Compare(a.Size, b.Size) }
+		case SortByModTime:
+			compare = func(a, b *PanObj) int { return a.ModTime.Compare(b.ModTime) }
+		default:
+			return nil, OnlyMsg("unknown sort by " + string(req.SortBy))
+		}
+		slices.SortStableFunc(result, func(a, b *PanObj) int {
+			c := compare(a, b)
+			if c == 0 {
+				c = strings.Compare(a.Name, b.Name)
+			}
+			if req.Order == OrderDesc {
+				return -c
+			}
+			return c
+		})
+	}
+	offset := min(max(req.Offset, 0), len(result))
+	result = result[offset:]
+	if req.Limit > 0 && req.Limit < len(result) {
+		result = result[:req.Limit]
+	}
+	return result, nil
+}
+
+// Match reports whether obj lies under req.Root and satisfies every filter of
+// req. Drivers with a native search use it to apply the conditions the
+// service can not express.
+func (req SearchReq) Match(obj *PanObj) bool {
+	if req.Keyword != "" && !strings.Contains(strings.ToLower(obj.Name), strings.ToLower(req.Keyword)) {
+		return false
+	}
+	if len(req.Types) > 0 && !slices.Contains(req.Types, obj.Type) {
+		return false
+	}
+	if (req.MinSize > 0 && obj.Size < req.MinSize) || (req.MaxSize > 0 && obj.Size > req.MaxSize) {
+		return false
+	}
+	root := "/"
+	if req.Root != nil {
+		root = path.Clean("/" + strings.Trim(req.Root.Path, "/") + "/" + req.Root.Name)
+	}
+	full := path.Clean("/" + strings.Trim(obj.Path, "/") + "/" + obj.Name)
+	return full != root && (root == "/" || strings.HasPrefix(full, root+"/"))
+}
+
+// SearchRoot resolves req.Root to an existing directory, defaulting to the
+// drive root when it is unset.
+func (c *CommonOperate) SearchRoot(req SearchReq, list func(req ListReq) ([]*PanObj, error)) (*PanObj, error) {
+	if req.Root == nil || req.Root.Id == "0" || strings.Trim(req.Root.Path+"/"+req.Root.Name, "/") == "" {
+		return &PanObj{Id: "0", Name: "", Path: "/", Size: 0, Type: "dir"}, nil
+	}
+	root := req.Root
+	if root.Id == "" {
+		obj, err := c.GetPanObj(strings.TrimRight(root.Path, "/")+"/"+root.Name, true, list)
+		if err != nil {
+			return nil, err
+		}
+		root = obj
+	}
+	if root.Type != "dir" {
+		return nil, OnlyMsg("search root is not a dir")
+	}
+	return root, nil
+}
+
+// BaseSearch walks req.Root breadth-first through the directory cache and
+// returns every object matching req. It is the fallback for drivers without a
+// native search, and for searches without a keyword.
+func (c *CommonOperate) BaseSearch(req SearchReq, list func(req ListReq) ([]*PanObj, error)) ([]*PanObj, error) {
+	root, err := c.SearchRoot(req, list)
+	if err != nil {
+		return nil, err
+	}
+	req.Root = root
+	result := make([]*PanObj, 0)
+	dirs := []*PanObj{root}
+	for len(dirs) > 0 {
+		dir := dirs[0]
+		dirs = dirs[1:]
+		children, err := list(ListReq{Dir: dir})
+		if err != nil {
+			return nil, err
+		}
+		for _, child := range children {
+			if req.Match(child) {
+				result = append(result, child)
+			}
+			if child.Type == "dir" {
+				dirs = append(dirs, child)
+			}
+		}
+	}
+	return result, nil
+}
+
 func (c *CommonOperate) GetPanObj(path string, mustExist bool, list func(req ListReq) ([]*PanObj, error)) (*PanObj, error) {
 	truePath := strings.Trim(path, "/")
 	paths := strings.Split(truePath, "/")
@@ -602,7 +1003,7 @@ func (c *CommonOperate) GetPanObj(path string, mustExist bool, list func(req Lis
 				}
 			}
 			if !exist {
-				return nil, OnlyMsg(fmt.Sprintf("%s not found", path))
+				return nil, KindMsg(ErrNotFound, fmt.Sprintf("%s not found", path))
 			}
 		}
 
@@ -617,6 +1018,8 @@ func (c *CommonOperate) GetPanObj(path string, mustExist bool, list func(req Lis
 type ProgressReader struct {
 	readCloser       io.ReadCloser
 	file             *os.File
+	source           io.Reader // 分片读取的数据源，本地文件或数据流
+	name             string
 	uploaded         int64
 	chunkSize        int64
 	totalSize        int64
@@ -653,7 +1056,7 @@ func (pr *ProgressReader) Read(p []byte) (n int, err error) {
 		if pr.finish {
 			startTime = pr.startTime
 		}
-		internal.LogProgress("uploading", pr.file.Name(), startTime, pr.currentUploaded, uploaded, pr.totalSize, false)
+		internal.LogProgress("uploading", pr.name, startTime, pr.currentUploaded, uploaded, pr.totalSize, false)
 		if pr.progressCallback != nil {
 			elapsed := time.Since(startTime).Seconds()
 			var speed float64
@@ -664,7 +1067,7 @@ func (pr *ProgressReader) Read(p []byte) (n int, err error) {
 			pr.progressCallback(ProgressEvent{
 				TaskId:    pr.taskId,
 				FileId:    pr.fileId,
-				FileName:  pr.file.Name(),
+				FileName:  pr.name,
 				Operated:  uploaded,
 				TotalSize: pr.totalSize,
 				Percent:   percent,
@@ -677,7 +1080,7 @@ func (pr *ProgressReader) Read(p []byte) (n int, err error) {
 }
 func (pr *ProgressReader) NextChunk() (int64, int64) {
 	pr.readCloser = io.NopCloser(&io.LimitedReader{
-		R: pr.file,
+		R: pr.source,
 		N: pr.chunkSize,
 	})
 	startSize := pr.uploaded
@@ -685,7 +1088,7 @@ func (pr *ProgressReader) NextChunk() (int64, int64) {
 	pr.currentSize = endSize - startSize
 	pr.currentUploaded = 0
 	pr.chunkStartTime = time.Now()
-	internal.LogProgress("uploading", pr.file.Name(), pr.startTime, pr.uploaded, pr.uploaded, pr.totalSize, true)
+	internal.LogProgress("uploading", pr.name, pr.startTime, pr.uploaded, pr.uploaded, pr.totalSize, true)
 	return startSize, endSize
 }
 
@@ -737,6 +1140,8 @@ func NewProcessReader(localFile string, chunkSize, uploaded int64, progressCb ..
 	}
 	return &ProgressReader{
 		file:             file,
+		source:           file,
+		name:             file.Name(),
 		uploaded:         uploaded,
 		chunkSize:        chunkSize,
 		totalSize:        totalSize,
@@ -747,6 +1152,26 @@ func NewProcessReader(localFile string, chunkSize, uploaded int64, progressCb ..
 	}, nil
 }
 
+// NewStreamProgressReader reads size bytes from r in chunks of chunkSize,
+// like NewProcessReader does for a local file. name is only used in progress
+// logs and events.
+func NewStreamProgressReader(r io.Reader, name string, size, chunkSize int64, progressCb ...ProgressCallback) *ProgressReader {
+	var cb ProgressCallback
+	if len(progressCb) > 0 {
+		cb = progressCb[0]
+	}
+	return &ProgressReader{
+		source:           r,
+		name:             name,
+		chunkSize:        chunkSize,
+		totalSize:        size,
+		currentChunkNum:  size/chunkSize + 1,
+		startTime:        time.Now(),
+		chunkStartTime:   time.Now(),
+		progressCallback: cb,
+	}
+}
+
 // SetCtx sets a context for cancellation support on the reader.
 func (pr *ProgressReader) SetCtx(ctx context.Context) {
 	pr.ctx = ctx
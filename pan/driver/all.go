@@ -2,6 +2,7 @@ package driver
 
 import (
 	_ "github.com/hefeiyu25/pan-client/pan/driver/cloudreve"
+	_ "github.com/hefeiyu25/pan-client/pan/driver/local"
 	_ "github.com/hefeiyu25/pan-client/pan/driver/quark"
 	_ "github.com/hefeiyu25/pan-client/pan/driver/thunder_browser"
 )
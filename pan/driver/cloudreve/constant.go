@@ -3,8 +3,6 @@ package cloudreve
 const (
 	cacheDirectoryPrefix  = "directory_"
 	cachePolicy           = "policy"
-	cacheSessionPrefix    = "session_"
-	cacheChunkPrefix      = "chunk_"
 	cacheSessionErrPrefix = "session_err_"
 )
 
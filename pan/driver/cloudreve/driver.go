@@ -1,13 +1,20 @@
 package cloudreve
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/google/uuid"
 	"github.com/hefeiyu25/pan-client/internal"
 	"github.com/hefeiyu25/pan-client/pan"
 	"github.com/imroc/req/v3"
+	"io"
+	"iter"
+	"mime"
 	"net/http"
 	"os"
+	"path"
 	"path/filepath"
 	"strconv"
 	"strings"
@@ -87,7 +94,7 @@ func (c *Cloudreve) Init() (string, error) {
 	}
 	// 若一小时内更新过，则不重新刷session
 	if c.Properties.RefreshTime == 0 || time.Now().UnixMilli()-c.Properties.RefreshTime > 60*60*1000 {
-		_, configErr := c.config()
+		_, configErr := c.config(c.Context())
 		if configErr != nil {
 			return driverId, configErr
 		}
@@ -103,8 +110,32 @@ func (c *Cloudreve) Close() error {
 	return nil
 }
 
+func (c *Cloudreve) Capabilities() pan.Capabilities {
+	caps := pan.Capabilities{
+		DirectLink:      true,
+		ResumableUpload: true,
+		Copy:            true,
+	}
+	// 存储策略随目录列表返回，未加载时先列一次根目录
+	if _, exist := c.Get(cachePolicy); !exist {
+		_, _ = c.List(pan.ListReq{Dir: &pan.PanObj{Id: "0", Path: "/", Type: "dir"}})
+	}
+	if policy, exist := c.Get(cachePolicy); exist {
+		if summary, ok := policy.(*PolicySummary); ok && summary != nil {
+			caps.MaxFileSize = int64(summary.MaxSize)
+		}
+	}
+	return caps
+}
+
 func (c *Cloudreve) Disk() (*pan.DiskResp, error) {
-	storageResp, err := c.userStorage()
+	return c.DiskCtx(c.Context())
+}
+
+func (c *Cloudreve) DiskCtx(ctx context.Context) (*pan.DiskResp, error) {
+	ctx, cancel := c.JoinContext(ctx)
+	defer cancel()
+	storageResp, err := c.userStorage(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -115,29 +146,36 @@ func (c *Cloudreve) Disk() (*pan.DiskResp, error) {
 	}, nil
 }
 func (c *Cloudreve) List(req pan.ListReq) ([]*pan.PanObj, error) {
-	if req.Dir.Path == "/" && req.Dir.Name == "" {
-		req.Dir.Id = "0"
+	return c.ListCtx(c.Context(), req)
+}
+
+func (c *Cloudreve) ListCtx(ctx context.Context, req pan.ListReq) ([]*pan.PanObj, error) {
+	ctx, cancel := c.JoinContext(ctx)
+	defer cancel()
+	queryDir := req.Dir
+	if queryDir.Path == "/" && queryDir.Name == "" {
+		queryDir.Id = "0"
+	}
+	if queryDir.Id == "" {
+		obj, err := c.GetPanObj(strings.TrimRight(queryDir.Path, "/")+"/"+queryDir.Name, true, pan.WithCtx(ctx, c.ListCtx))
+		if err != nil {
+			return nil, err
+		}
+		queryDir = obj
 	}
-	cacheKey := cacheDirectoryPrefix + req.Dir.Id
+	cacheKey := cacheDirectoryPrefix + queryDir.Id
 	if req.Reload {
 		c.Del(cacheKey)
 	}
 	result, err := c.GetOrLoad(cacheKey, func() (interface{}, error) {
-		directory, e := c.listDirectory(strings.TrimRight(req.Dir.Path, "/") + "/" + req.Dir.Name)
+		directory, e := c.listDirectory(ctx, strings.TrimRight(queryDir.Path, "/")+"/"+queryDir.Name)
 		if e != nil {
 			internal.GetLogger().Error("list directory error", "error", e)
 			return nil, e
 		}
 		panObjs := make([]*pan.PanObj, 0)
 		for _, item := range directory.Data.Objects {
-			panObjs = append(panObjs, &pan.PanObj{
-				Id:     item.ID,
-				Name:   item.Name,
-				Path:   item.Path,
-				Size:   int64(item.Size),
-				Type:   item.Type,
-				Parent: req.Dir,
-			})
+			panObjs = append(panObjs, c.toPanObj(item, queryDir))
 		}
 		c.Set(cachePolicy, directory.Data.Policy)
 		return panObjs, nil
@@ -146,18 +184,179 @@ func (c *Cloudreve) List(req pan.ListReq) ([]*pan.PanObj, error) {
 		return make([]*pan.PanObj, 0), err
 	}
 	if objs, ok := result.([]*pan.PanObj); ok {
-		return objs, nil
+		return req.Apply(objs)
 	}
 	return make([]*pan.PanObj, 0), nil
 }
+
+func (c *Cloudreve) ListIter(ctx context.Context, dir *pan.PanObj) iter.Seq2[*pan.PanObj, error] {
+	return func(yield func(*pan.PanObj, error) bool) {
+		ctx, cancel := c.JoinContext(ctx)
+		defer cancel()
+		queryDir, err := c.ResolveDir(dir, pan.WithCtx(ctx, c.ListCtx))
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+		cached, _ := c.Get(cacheDirectoryPrefix + queryDir.Id)
+		// cloudreve 的目录接口不分页，一次返回全部对象
+		pan.PageIter(ctx, cached, func(ctx context.Context, token string) ([]*pan.PanObj, string, error) {
+			directory, e := c.listDirectory(ctx, path.Join(queryDir.Path, queryDir.Name))
+			if e != nil {
+				return nil, "", e
+			}
+			c.Set(cachePolicy, directory.Data.Policy)
+			objs := make([]*pan.PanObj, 0, len(directory.Data.Objects))
+			for _, item := range directory.Data.Objects {
+				objs = append(objs, c.toPanObj(item, queryDir))
+			}
+			return objs, "", nil
+		})(yield)
+	}
+}
+
+// toPanObj 转换 cloudreve 对象，item.Path 即父目录路径
+func (c *Cloudreve) toPanObj(item Object, parent *pan.PanObj) *pan.PanObj {
+	obj := &pan.PanObj{
+		Id:          item.ID,
+		Name:        item.Name,
+		Path:        item.Path,
+		Size:        int64(item.Size),
+		Type:        item.Type,
+		ModTime:     item.Date,
+		CreatedTime: item.CreateDate,
+		Parent:      parent,
+	}
+	if item.Type == "file" {
+		obj.MimeType = mime.TypeByExtension(filepath.Ext(item.Name))
+	}
+	if item.Thumb {
+		obj.ThumbnailURL = c.Properties.Url + "/api/v3/file/thumb/" + item.ID
+	}
+	return obj
+}
+
+func (c *Cloudreve) Stat(req pan.StatReq) (*pan.PanObj, error) {
+	return c.StatCtx(c.Context(), req)
+}
+
+func (c *Cloudreve) StatCtx(ctx context.Context, req pan.StatReq) (*pan.PanObj, error) {
+	ctx, cancel := c.JoinContext(ctx)
+	defer cancel()
+	obj, err := c.stat(ctx, req)
+	if err == nil || errors.Is(err, pan.ErrNotFound) || ctx.Err() != nil {
+		return obj, err
+	}
+	// 站点关闭搜索等原因查询失败时退回逐级列出父目录
+	internal.GetLogger().Warn("cloudreve stat fail, fall back to list", "path", req.Path, "id", req.Id, "error", err)
+	return c.BaseStat(req, pan.WithCtx(ctx, c.ListCtx))
+}
+
+// stat 不列出父目录查询单个对象。cloudreve 没有按路径查询对象的接口：文件在父目录
+// 下按文件名搜索，目录通过目录接口得到 ID，再通过属性接口获取时间；按 ID 查询时对象
+// 名称取自 req.Path
+func (c *Cloudreve) stat(ctx context.Context, req pan.StatReq) (*pan.PanObj, error) {
+	if req.Path == "" {
+		return nil, pan.KindMsg(pan.ErrUnsupported, "not support stat by id, please set path")
+	}
+	target := path.Clean("/" + strings.Trim(req.Path, "/"))
+	if target == "/" {
+		return &pan.PanObj{Id: "0", Name: "", Path: "/", Size: 0, Type: "dir"}, nil
+	}
+	dir, name := path.Dir(target), path.Base(target)
+	if req.Id != "" && req.Id != "0" {
+		return c.statById(ctx, req.Id, dir, name)
+	}
+	found, e := c.fileSearch(ctx, name, dir)
+	if e != nil {
+		return nil, e
+	}
+	for _, item := range found.Data.Objects {
+		if item.Type == "file" && item.Name == name && path.Clean(item.Path) == dir {
+			return c.toPanObj(item, nil), nil
+		}
+	}
+	// 搜索接口只返回文件
+	directory, e := c.listDirectory(ctx, target)
+	if e != nil {
+		return nil, e
+	}
+	c.Set(cachePolicy, directory.Data.Policy)
+	return c.statById(ctx, directory.Data.Parent, dir, name)
+}
+
+// statById 通过属性接口查询对象，先按文件查询，不存在时再按目录查询
+func (c *Cloudreve) statById(ctx context.Context, id, dir, name string) (*pan.PanObj, error) {
+	item := Object{ID: id, Name: name, Path: dir, Type: "file"}
+	props, e := c.objectGetProperty(ctx, ItemPropertyReq{Id: id})
+	if e != nil && errors.Is(e, pan.ErrNotFound) {
+		item.Type = "dir"
+		props, e = c.objectGetProperty(ctx, ItemPropertyReq{Id: id, IsFolder: true})
+	}
+	if e != nil {
+		return nil, e
+	}
+	item.Size = props.Data.Size
+	item.Date = props.Data.UpdatedAt
+	item.CreateDate = props.Data.CreatedAt
+	return c.toPanObj(item, nil), nil
+}
+
+func (c *Cloudreve) Search(req pan.SearchReq) ([]*pan.PanObj, error) {
+	return c.SearchCtx(c.Context(), req)
+}
+
+func (c *Cloudreve) SearchCtx(ctx context.Context, req pan.SearchReq) ([]*pan.PanObj, error) {
+	ctx, cancel := c.JoinContext(ctx)
+	defer cancel()
+	list := pan.WithCtx(ctx, c.ListCtx)
+	// 搜索接口必须带关键字，否则只能遍历
+	if req.Keyword == "" {
+		return c.BaseSearch(req, list)
+	}
+	root, err := c.SearchRoot(req, list)
+	if err != nil {
+		return nil, err
+	}
+	req.Root = root
+	resp, e := c.fileSearch(ctx, req.Keyword, path.Join(root.Path, root.Name))
+	if e != nil {
+		return nil, e
+	}
+	// 搜索结果只带父目录路径，父目录 ID 通过目录缓存解析，后续操作依赖它刷新缓存
+	parents := make(map[string]*pan.PanObj)
+	result := make([]*pan.PanObj, 0)
+	for _, item := range resp.Data.Objects {
+		parent, ok := parents[item.Path]
+		if !ok {
+			parent, err = c.GetPanObj(item.Path, true, list)
+			if err != nil {
+				return nil, err
+			}
+			parents[item.Path] = parent
+		}
+		obj := c.toPanObj(item, parent)
+		if req.Match(obj) {
+			result = append(result, obj)
+		}
+	}
+	return result, nil
+}
+
 func (c *Cloudreve) ObjRename(req pan.ObjRenameReq) error {
+	return c.ObjRenameCtx(c.Context(), req)
+}
+
+func (c *Cloudreve) ObjRenameCtx(ctx context.Context, req pan.ObjRenameReq) error {
+	ctx, cancel := c.JoinContext(ctx)
+	defer cancel()
 	if req.Obj.Id == "0" || (req.Obj.Path == "/" && req.Obj.Name == "") {
-		return pan.OnlyMsg("not support rename root path")
+		return pan.KindMsg(pan.ErrUnsupported, "not support rename root path")
 	}
 	object := req.Obj
 	if object.Id == "" {
 		path := strings.Trim(req.Obj.Path, "/") + "/" + req.Obj.Name
-		obj, err := c.GetPanObj(path, true, c.List)
+		obj, err := c.GetPanObj(path, true, pan.WithCtx(ctx, c.ListCtx))
 		if err != nil {
 			return err
 		}
@@ -169,7 +368,7 @@ func (c *Cloudreve) ObjRename(req pan.ObjRenameReq) error {
 	} else {
 		item.Items = []string{object.Id}
 	}
-	_, err := c.objectRename(ItemRenameReq{Src: item,
+	_, err := c.objectRename(ctx, ItemRenameReq{Src: item,
 		NewName: req.NewName})
 	if err != nil {
 		return err
@@ -178,9 +377,21 @@ func (c *Cloudreve) ObjRename(req pan.ObjRenameReq) error {
 	return nil
 }
 func (c *Cloudreve) BatchRename(req pan.BatchRenameReq) error {
-	return c.BaseBatchRename(req, c.List, c.ObjRename, c.BatchRename)
+	return c.BatchRenameCtx(c.Context(), req)
+}
+
+func (c *Cloudreve) BatchRenameCtx(ctx context.Context, req pan.BatchRenameReq) error {
+	return c.BaseBatchRename(ctx, req, pan.WithCtx(ctx, c.ListCtx), func(req pan.ObjRenameReq) error {
+		return c.ObjRenameCtx(ctx, req)
+	})
 }
 func (c *Cloudreve) Mkdir(req pan.MkdirReq) (*pan.PanObj, error) {
+	return c.MkdirCtx(c.Context(), req)
+}
+
+func (c *Cloudreve) MkdirCtx(ctx context.Context, req pan.MkdirReq) (*pan.PanObj, error) {
+	ctx, cancel := c.JoinContext(ctx)
+	defer cancel()
 	if req.NewPath == "" {
 		// 不处理，直接返回
 		return &pan.PanObj{
@@ -195,10 +406,13 @@ func (c *Cloudreve) Mkdir(req pan.MkdirReq) (*pan.PanObj, error) {
 		return nil, pan.OnlyMsg("please set a dir")
 	}
 	targetPath := "/" + strings.Trim(req.NewPath, "/")
-	if req.Parent != nil && (req.Parent.Id == "0" || req.Parent.Path == "/") {
-		targetPath = req.Parent.Path + "/" + strings.Trim(req.NewPath, "/")
+	if req.Parent != nil {
+		// NewPath 相对于 Parent
+		if parentPath := strings.Trim(strings.Trim(req.Parent.Path, "/")+"/"+req.Parent.Name, "/"); parentPath != "" {
+			targetPath = "/" + parentPath + targetPath
+		}
 	}
-	obj, err := c.GetPanObj(targetPath, false, c.List)
+	obj, err := c.GetPanObj(targetPath, false, pan.WithCtx(ctx, c.ListCtx))
 	if err != nil {
 		return nil, err
 	}
@@ -216,32 +430,28 @@ func (c *Cloudreve) Mkdir(req pan.MkdirReq) (*pan.PanObj, error) {
 		}
 		split := strings.Split(rel, "/")
 
-		_, err = c.createDirectory(existPath + "/" + split[0])
+		_, err = c.createDirectory(ctx, existPath+"/"+split[0])
 		if err != nil {
 			return nil, pan.OnlyError(err)
 		}
 		c.Del(cacheDirectoryPrefix + obj.Id)
-		return c.Mkdir(req)
+		return c.MkdirCtx(ctx, req)
 	}
 }
 func (c *Cloudreve) Move(req pan.MovieReq) error {
-	sameSrc := make(map[string][]*pan.PanObj)
-	for _, item := range req.Items {
-		objs, ok := sameSrc[item.Path]
-		if ok {
-			objs = append(objs, item)
-			sameSrc[item.Path] = objs
-		} else {
-			sameSrc[item.Path] = []*pan.PanObj{item}
-		}
-	}
+	return c.MoveCtx(c.Context(), req)
+}
+
+func (c *Cloudreve) MoveCtx(ctx context.Context, req pan.MovieReq) error {
+	ctx, cancel := c.JoinContext(ctx)
+	defer cancel()
 	targetObj := req.TargetObj
 	if targetObj.Type == "file" {
 		return pan.OnlyMsg("target is a file")
 	}
 	// 重新直接创建目标目录
 	if targetObj.Id == "" {
-		create, err := c.Mkdir(pan.MkdirReq{
+		create, err := c.MkdirCtx(ctx, pan.MkdirReq{
 			NewPath: strings.Trim(targetObj.Path, "/") + "/" + targetObj.Name,
 		})
 		if err != nil {
@@ -249,93 +459,98 @@ func (c *Cloudreve) Move(req pan.MovieReq) error {
 		}
 		targetObj = create
 	}
-	for src, items := range sameSrc {
-		reloadDirId := make(map[string]any)
-		itemIds := make([]string, 0)
-		dirIds := make([]string, 0)
-		for _, item := range items {
-			if item.Id != "0" && item.Id != "" {
-				if item.Type == "dir" {
-					dirIds = append(dirIds, item.Id)
-					reloadDirId[item.Id] = true
-				} else {
-					itemIds = append(itemIds, item.Id)
-				}
-			} else if item.Path != "" && item.Path != "/" {
-				obj, err := c.GetPanObj(strings.Trim(item.Path, "/")+"/"+item.Name, true, c.List)
-				if err == nil {
-					if obj.Type == "dir" {
-						dirIds = append(dirIds, obj.Id)
-						reloadDirId[obj.Id] = true
-					} else {
-						itemIds = append(itemIds, obj.Id)
-						reloadDirId[obj.Parent.Id] = true
-					}
-				}
-			}
-		}
-		_, err := c.objectMove(ItemMoveReq{
+	// 接口按源目录移动，先按父目录分组
+	objs, err := c.resolveItems(ctx, req.Items)
+	if err != nil {
+		return err
+	}
+	sameSrc := make(map[string][]*pan.PanObj)
+	for _, obj := range objs {
+		sameSrc[obj.Path] = append(sameSrc[obj.Path], obj)
+	}
+	for src, objs := range sameSrc {
+		item, reloadDirId := collectItem(objs)
+		_, err := c.objectMove(ctx, ItemMoveReq{
 			SrcDir: src,
 			Dst:    strings.Trim(targetObj.Path, "/") + "/" + targetObj.Name,
-			Src: Item{
-				Items: itemIds,
-				Dirs:  dirIds,
-			},
+			Src:    item,
 		})
 		if err != nil {
 			return pan.OnlyError(err)
 		}
 		reloadDirId[targetObj.Id] = true
-		for key, _ := range reloadDirId {
+		for key := range reloadDirId {
 			c.Del(cacheDirectoryPrefix + key)
 		}
 	}
 	return nil
 }
+func (c *Cloudreve) Copy(req pan.CopyReq) error {
+	return c.CopyCtx(c.Context(), req)
+}
+
+func (c *Cloudreve) CopyCtx(ctx context.Context, req pan.CopyReq) error {
+	ctx, cancel := c.JoinContext(ctx)
+	defer cancel()
+	targetObj := req.TargetObj
+	if targetObj.Type == "file" {
+		return pan.OnlyMsg("target is a file")
+	}
+	// 重新直接创建目标目录
+	if targetObj.Id == "" {
+		create, err := c.MkdirCtx(ctx, pan.MkdirReq{
+			NewPath: strings.Trim(targetObj.Path, "/") + "/" + targetObj.Name,
+		})
+		if err != nil {
+			return err
+		}
+		targetObj = create
+	}
+	objs, err := c.resolveItems(ctx, req.Items)
+	if err != nil {
+		return err
+	}
+	// 接口每次只能复制一个对象
+	for _, obj := range objs {
+		item, _ := collectItem([]*pan.PanObj{obj})
+		_, err := c.objectCopy(ctx, ItemMoveReq{
+			SrcDir: obj.Path,
+			Dst:    strings.Trim(targetObj.Path, "/") + "/" + targetObj.Name,
+			Src:    item,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	c.Del(cacheDirectoryPrefix + targetObj.Id)
+	return nil
+}
 func (c *Cloudreve) Delete(req pan.DeleteReq) error {
+	return c.DeleteCtx(c.Context(), req)
+}
+
+func (c *Cloudreve) DeleteCtx(ctx context.Context, req pan.DeleteReq) error {
+	ctx, cancel := c.JoinContext(ctx)
+	defer cancel()
 	if len(req.Items) == 0 {
 		return nil
 	}
-	reloadDirId := make(map[string]any)
-	itemIds := make([]string, 0)
-	dirIds := make([]string, 0)
-	for _, item := range req.Items {
-		if item.Id != "0" && item.Id != "" {
-			if item.Type == "dir" {
-				dirIds = append(dirIds, item.Id)
-				reloadDirId[item.Id] = true
-			} else {
-				itemIds = append(itemIds, item.Id)
-				if item.Parent.Id != "" {
-					reloadDirId[item.Parent.Id] = true
-				}
-			}
-		} else if item.Path != "" && item.Path != "/" {
-			obj, err := c.GetPanObj(item.Path, true, c.List)
-			if err == nil {
-				if obj.Type == "dir" {
-					dirIds = append(dirIds, obj.Id)
-					reloadDirId[obj.Id] = true
-				} else {
-					itemIds = append(itemIds, obj.Id)
-					reloadDirId[obj.Parent.Id] = true
-				}
-			}
-		}
+	// cloudreve 没有回收站，删除总是彻底删除
+	objs, err := c.resolveItems(ctx, req.Items)
+	if err != nil {
+		return err
 	}
-	if len(itemIds) > 0 || len(dirIds) > 0 {
-		_, err := c.objectDelete(ItemReq{
-			Item: Item{
-				Items: itemIds,
-				Dirs:  dirIds,
-			},
+	item, reloadDirId := collectItem(objs)
+	if len(item.Items) > 0 || len(item.Dirs) > 0 {
+		_, err := c.objectDelete(ctx, ItemReq{
+			Item:       item,
 			Force:      true,
 			UnlinkOnly: false,
 		})
 		if err != nil {
 			return err
 		}
-		for key, _ := range reloadDirId {
+		for key := range reloadDirId {
 			c.Del(cacheDirectoryPrefix + key)
 		}
 	}
@@ -343,17 +558,56 @@ func (c *Cloudreve) Delete(req pan.DeleteReq) error {
 	return nil
 }
 
+func (c *Cloudreve) TrashList() ([]*pan.PanObj, error) {
+	return c.TrashListCtx(c.Context())
+}
+
+func (c *Cloudreve) TrashListCtx(ctx context.Context) ([]*pan.PanObj, error) {
+	return nil, pan.KindMsg(pan.ErrUnsupported, "trash not support")
+}
+
+func (c *Cloudreve) TrashRestore(req pan.TrashReq) error {
+	return c.TrashRestoreCtx(c.Context(), req)
+}
+
+func (c *Cloudreve) TrashRestoreCtx(ctx context.Context, req pan.TrashReq) error {
+	return pan.KindMsg(pan.ErrUnsupported, "trash not support")
+}
+
+func (c *Cloudreve) TrashDelete(req pan.TrashReq) error {
+	return c.TrashDeleteCtx(c.Context(), req)
+}
+
+func (c *Cloudreve) TrashDeleteCtx(ctx context.Context, req pan.TrashReq) error {
+	return pan.KindMsg(pan.ErrUnsupported, "trash not support")
+}
+
+func (c *Cloudreve) TrashEmpty() error {
+	return c.TrashEmptyCtx(c.Context())
+}
+
+func (c *Cloudreve) TrashEmptyCtx(ctx context.Context) error {
+	return pan.KindMsg(pan.ErrUnsupported, "trash not support")
+}
+
 func (c *Cloudreve) UploadPath(req pan.UploadPathReq) (*pan.TransferResult, error) {
+	return c.UploadPathCtx(c.Context(), req)
+}
+
+func (c *Cloudreve) UploadPathCtx(ctx context.Context, req pan.UploadPathReq) (*pan.TransferResult, error) {
+	ctx, cancel := c.JoinContext(ctx)
+	defer cancel()
 	if req.OnlyFast {
-		return nil, pan.OnlyMsg("cloudreve is not support fast upload")
+		return nil, pan.KindMsg(pan.ErrUnsupported, "cloudreve is not support fast upload")
 	}
-	err := c.BaseUploadPath(req, c.UploadFile)
+	err := c.BaseUploadPath(req, pan.WithCtx(ctx, c.UploadFileCtx))
 	return nil, err
 }
 
-func (c *Cloudreve) uploadErrAfter(md5Key string, uploadedSize int64, session UploadCredential) {
-	c.Set(cacheChunkPrefix+md5Key, uploadedSize)
-	errorTimesVal, err := c.GetOrLoad(cacheSessionErrPrefix+md5Key, func() (interface{}, error) {
+// uploadErrAfter 记录上传失败次数，超过 3 次时删除上传会话，下次重新上传
+func (c *Cloudreve) uploadErrAfter(key string, session UploadCredential) {
+	errKey := cacheSessionErrPrefix + internal.Md5HashStr(key)
+	errorTimesVal, err := c.GetOrLoad(errKey, func() (interface{}, error) {
 		return 0, nil
 	})
 	if err != nil {
@@ -362,26 +616,93 @@ func (c *Cloudreve) uploadErrAfter(md5Key string, uploadedSize int64, session Up
 	i := errorTimesVal.(int)
 	if i > 3 {
 		if session.SessionID != "" {
-			_, _ = c.fileUploadDeleteUploadSession(session.SessionID)
+			_, _ = c.fileUploadDeleteUploadSession(c.Context(), session.SessionID)
 		} else {
-			_, _ = c.fileUploadDeleteAllUploadSession()
+			_, _ = c.fileUploadDeleteAllUploadSession(c.Context())
 		}
-		c.Del(cacheSessionPrefix + md5Key)
-		c.Del(cacheChunkPrefix + md5Key)
-		c.Del(cacheSessionErrPrefix + md5Key)
+		c.DeleteRecord(key)
+		c.Del(errKey)
+		return
 	}
-	c.Set(cacheSessionErrPrefix+md5Key, i+1)
+	c.Set(errKey, i+1)
 }
 
-func (c *Cloudreve) UploadFile(req pan.UploadFileReq) (*pan.TransferResult, error) {
-	if req.OnlyFast {
-		return nil, pan.OnlyMsg("cloudreve is not support fast upload")
+// loadUploadSession 从记录中恢复未过期的上传会话
+func (c *Cloudreve) loadUploadSession(key string, content *pan.UploadContent) (*pan.UploadRecord, UploadCredential, bool) {
+	var session UploadCredential
+	record, ok := c.LoadUploadRecord(key, content)
+	if !ok {
+		return nil, session, false
+	}
+	if err := json.Unmarshal(record.Session, &session); err != nil || session.SessionID == "" || len(session.UploadURLs) == 0 ||
+		(session.Expires > 0 && time.Now().Unix() >= session.Expires) {
+		internal.GetLogger().Info("upload session expired", "file", content.Source(), "sessionId", session.SessionID)
+		c.DeleteRecord(key)
+		return nil, session, false
 	}
-	stat, err := os.Stat(req.LocalFile)
+	return record, session, true
+}
+
+// createUploadSession 创建上传会话，已有同名文件的上传会话时清空所有会话后重试
+func (c *Cloudreve) createUploadSession(ctx context.Context, remotePath, remoteName string, content *pan.UploadContent) (UploadCredential, error) {
+	policy, exist := c.Get(cachePolicy)
+	if !exist {
+		return UploadCredential{}, pan.OnlyMsg(cachePolicy + " is not exist")
+	}
+	summary := policy.(*PolicySummary)
+	sessionReq := CreateUploadSessionReq{
+		Path:         "/" + remotePath,
+		Size:         uint64(content.Size),
+		Name:         remoteName,
+		PolicyID:     summary.ID,
+		LastModified: content.ModTime.UnixMilli(),
+	}
+	resp, e := c.fileUploadGetUploadSession(ctx, sessionReq)
+	if e != nil && e.GetCode() == CodeConflictUploadOngoing {
+		_, _ = c.fileUploadDeleteAllUploadSession(c.Context())
+		resp, e = c.fileUploadGetUploadSession(ctx, sessionReq)
+	}
+	if e != nil {
+		return UploadCredential{}, e
+	}
+	return resp.Data, nil
+}
+
+func (c *Cloudreve) UploadFile(req pan.UploadFileReq) (*pan.TransferResult, error) {
+	return c.UploadFileCtx(req.Ctx, req)
+}
+
+func (c *Cloudreve) UploadFileCtx(ctx context.Context, req pan.UploadFileReq) (*pan.TransferResult, error) {
+	ctx, cancel := c.JoinContext(ctx)
+	defer cancel()
+	content, err := pan.FileContent(req.LocalFile)
 	if err != nil {
 		return nil, err
 	}
-	remoteName := stat.Name()
+	return c.upload(ctx, req, content)
+}
+
+func (c *Cloudreve) UploadStream(req pan.UploadStreamReq) (*pan.TransferResult, error) {
+	return c.UploadStreamCtx(c.Context(), req)
+}
+
+func (c *Cloudreve) UploadStreamCtx(ctx context.Context, req pan.UploadStreamReq) (*pan.TransferResult, error) {
+	ctx, cancel := c.JoinContext(ctx)
+	defer cancel()
+	// 分片上传不需要哈希，大小已知时直接读取数据流。创建上传会话时必须给出
+	// CreateUploadSessionReq.Size：服务端据此检查存储策略的单文件上限和剩余容量、
+	// 计算分片数，并在收到最后一个分片时合并文件，所以大小未知的数据流仍需先落盘
+	return c.BaseUploadStream(ctx, req, nil, func(req pan.UploadFileReq, content *pan.UploadContent) (*pan.TransferResult, error) {
+		return c.upload(ctx, req, content)
+	})
+}
+
+// upload 上传本地文件或数据流
+func (c *Cloudreve) upload(ctx context.Context, req pan.UploadFileReq, content *pan.UploadContent) (*pan.TransferResult, error) {
+	if req.OnlyFast {
+		return nil, pan.KindMsg(pan.ErrUnsupported, "cloudreve is not support fast upload")
+	}
+	remoteName := content.Name
 	remotePath := strings.TrimRight(req.RemotePath, "/")
 	if req.RemotePathTransfer != nil {
 		remotePath = req.RemotePathTransfer(remotePath)
@@ -390,65 +711,58 @@ func (c *Cloudreve) UploadFile(req pan.UploadFileReq) (*pan.TransferResult, erro
 		remoteName = req.RemoteNameTransfer(remoteName)
 	}
 	remoteAllPath := remotePath + "/" + remoteName
-	_, err = c.GetPanObj(remoteAllPath, true, c.List)
+	_, err := c.GetPanObj(remoteAllPath, true, pan.WithCtx(ctx, c.ListCtx))
 	// 没有报错证明文件已经存在
 	if err == nil {
-		return nil, pan.CodeMsg(CodeObjectExist, remoteAllPath+" is exist")
+		return nil, pan.KindCodeMsg(pan.ErrAlreadyExists, CodeObjectExist, remoteAllPath+" is exist")
 	}
-	_, err = c.Mkdir(pan.MkdirReq{
+	if !errors.Is(err, pan.ErrNotFound) {
+		return nil, err
+	}
+	dir, err := c.MkdirCtx(ctx, pan.MkdirReq{
 		NewPath: remotePath,
 	})
 	if err != nil {
 		return nil, pan.MsgError(remotePath+" create error", err)
 	}
-	md5Key := internal.Md5HashStr(remoteAllPath)
-	if !req.Resumable {
-		c.Del(cacheSessionPrefix + md5Key)
-		c.Del(cacheChunkPrefix + md5Key)
-		c.Del(cacheSessionErrPrefix + md5Key)
+	key := pan.JournalKey("upload", string(c.DriverType), c.Properties.Url, remoteAllPath, content.Source())
+	// 只有本地文件可以续传，数据流无法重新读取已上传的部分
+	resumable := req.Resumable && content.LocalFile != ""
+	var record *pan.UploadRecord
+	var session UploadCredential
+	resumed := false
+	if resumable {
+		record, session, resumed = c.loadUploadSession(key, content)
+	} else {
+		c.DeleteRecord(key)
+		c.Del(cacheSessionErrPrefix + internal.Md5HashStr(key))
 	}
-	var uploadedSize int64 = 0
-	if obj, exist := c.Get(cacheChunkPrefix + md5Key); exist {
-		uploadedSize = obj.(int64)
+	if resumed {
+		internal.GetLogger().Info("resume upload", "file", content.Source(), "sessionId", session.SessionID, "uploaded", record.Uploaded)
+	} else {
+		session, err = c.createUploadSession(ctx, remotePath, remoteName, content)
+		if err != nil {
+			return nil, err
+		}
+		record = pan.NewUploadRecord(content, remoteAllPath)
+		record.SessionId = session.SessionID
+		record.Session, _ = json.Marshal(session)
+		if resumable {
+			c.SaveRecord(key, record)
+		}
 	}
-	var session UploadCredential
-	data, e := c.GetOrLoad(cacheSessionPrefix+md5Key, func() (interface{}, error) {
-		policy, exist := c.Get(cachePolicy)
-		if !exist {
-			return nil, pan.OnlyMsg(cachePolicy + " is not exist")
-		}
-		summary := policy.(*PolicySummary)
-		resp, e := c.fileUploadGetUploadSession(CreateUploadSessionReq{
-			Path:         "/" + remotePath,
-			Size:         uint64(stat.Size()),
-			Name:         remoteName,
-			PolicyID:     summary.ID,
-			LastModified: stat.ModTime().UnixMilli(),
-		})
-		if e != nil {
-			if e.GetCode() == CodeConflictUploadOngoing {
-				_, _ = c.fileUploadDeleteAllUploadSession()
-				sResp, secE := c.fileUploadGetUploadSession(CreateUploadSessionReq{
-					Path:         "/" + remotePath,
-					Size:         uint64(stat.Size()),
-					Name:         remoteName,
-					PolicyID:     summary.ID,
-					LastModified: stat.ModTime().UnixMilli(),
-				})
-				if secE != nil {
-					return nil, secE
-				}
-				return sResp.Data, nil
-			}
-			return nil, e
+	// 分片上传成功后记录已上传的分片或字节数
+	partDone := func(part pan.UploadPart) {
+		if resumable {
+			record.AddPart(part)
+			c.SaveRecord(key, record)
 		}
-		return resp.Data, nil
-	})
-	if e != nil {
-		return nil, e
 	}
-	if data != nil {
-		session = data.(UploadCredential)
+	chunkDone := func(uploaded int64) {
+		if resumable {
+			record.Uploaded = uploaded
+			c.SaveRecord(key, record)
+		}
 	}
 
 	// 使用 SessionID 作为文件任务 ID（Cloudreve 无预创建文件 ID）
@@ -457,52 +771,54 @@ func (c *Cloudreve) UploadFile(req pan.UploadFileReq) (*pan.TransferResult, erro
 
 	switch c.Properties.Type {
 	case Now61, Yiandrive, Wuaipan:
-		uploadedSize, err = c.notKnowUpload(NotKnowUploadReq{
+		_, err = c.notKnowUpload(ctx, NotKnowUploadReq{
 			UploadUrl:        session.UploadURLs[0],
 			Credential:       session.Credential,
-			LocalFile:        req.LocalFile,
-			UploadedSize:     uploadedSize,
+			Content:          content,
 			ChunkSize:        int64(session.ChunkSize),
+			Concurrency:      req.Concurrency,
+			Done:             record.Parts,
 			TaskId:           req.TaskId,
 			FileId:           fileTaskId,
-			Ctx:              req.Ctx,
 			ProgressCallback: req.ProgressCallback,
+			PartDone:         partDone,
 		})
 		if err != nil {
-			c.uploadErrAfter(md5Key, uploadedSize, session)
+			c.uploadErrAfter(key, session)
 			return result, err
 		}
 	case Huang1111, Hefamily, Hucl:
-		uploadedSize, err = c.oneDriveUpload(OneDriveUploadReq{
+		// OneDrive 按 Content-Range 顺序上传，不能并行
+		_, err = c.oneDriveUpload(ctx, OneDriveUploadReq{
 			UploadUrl:        session.UploadURLs[0],
-			LocalFile:        req.LocalFile,
-			UploadedSize:     uploadedSize,
+			Content:          content,
+			UploadedSize:     record.Uploaded,
 			ChunkSize:        min(int64(session.ChunkSize), c.Properties.ChunkSize),
 			TaskId:           req.TaskId,
 			FileId:           fileTaskId,
-			Ctx:              req.Ctx,
 			ProgressCallback: req.ProgressCallback,
+			ChunkDone:        chunkDone,
 		})
 		if err != nil {
-			c.uploadErrAfter(md5Key, uploadedSize, session)
+			c.uploadErrAfter(key, session)
 			return result, err
 		}
 
-		_, err = c.oneDriveCallback(session.SessionID)
+		_, err = c.oneDriveCallback(ctx, session.SessionID)
 		if err != nil {
-			c.uploadErrAfter(md5Key, uploadedSize, session)
+			c.uploadErrAfter(key, session)
 			return result, err
 		}
 	default:
-		return result, pan.OnlyMsg("not support Type")
+		return result, pan.KindMsg(pan.ErrUnsupported, "not support Type")
 	}
 
-	if req.Resumable {
-		c.Del(cacheSessionPrefix + md5Key)
-		c.Del(cacheChunkPrefix + md5Key)
-		c.Del(cacheSessionErrPrefix + md5Key)
+	if resumable {
+		c.DeleteRecord(key)
+		c.Del(cacheSessionErrPrefix + internal.Md5HashStr(key))
 	}
-	internal.GetLogger().Info("upload success", "file", req.LocalFile, "sessionId", fileTaskId)
+	c.Del(cacheDirectoryPrefix + dir.Id)
+	internal.GetLogger().Info("upload success", "file", content.Source(), "sessionId", fileTaskId)
 	if req.SuccessDel {
 		err = os.Remove(req.LocalFile)
 		if err != nil {
@@ -515,48 +831,105 @@ func (c *Cloudreve) UploadFile(req pan.UploadFileReq) (*pan.TransferResult, erro
 }
 
 func (c *Cloudreve) DownloadPath(req pan.DownloadPathReq) (*pan.TransferResult, error) {
-	err := c.BaseDownloadPath(req, c.List, c.DownloadFile)
+	return c.DownloadPathCtx(c.Context(), req)
+}
+
+func (c *Cloudreve) DownloadPathCtx(ctx context.Context, req pan.DownloadPathReq) (*pan.TransferResult, error) {
+	ctx, cancel := c.JoinContext(ctx)
+	defer cancel()
+	err := c.BaseDownloadPath(ctx, req, pan.WithCtx(ctx, c.ListCtx), pan.WithCtx(ctx, c.DownloadFileCtx))
 	return nil, err
 }
 func (c *Cloudreve) DownloadFile(req pan.DownloadFileReq) (*pan.TransferResult, error) {
+	return c.DownloadFileCtx(req.Ctx, req)
+}
+
+func (c *Cloudreve) DownloadFileCtx(ctx context.Context, req pan.DownloadFileReq) (*pan.TransferResult, error) {
+	ctx, cancel := c.JoinContext(ctx)
+	defer cancel()
+	req.Ctx = ctx
 	err := c.BaseDownloadFile(req, c.defaultClient, func(req pan.DownloadFileReq) (string, error) {
-		resp, err := c.fileCreateDownloadSession(req.RemoteFile.Id)
+		link, err := c.DownloadLinkCtx(ctx, req.RemoteFile)
 		if err != nil {
 			return "", err
 		}
-		return resp.Data, nil
+		return link.Url, nil
 	})
 	return nil, err
 }
 
+func (c *Cloudreve) DownloadLinkCtx(ctx context.Context, file *pan.PanObj) (*pan.DownloadLink, error) {
+	ctx, cancel := c.JoinContext(ctx)
+	defer cancel()
+	resp, err := c.fileCreateDownloadSession(ctx, file.Id)
+	if err != nil {
+		return nil, err
+	}
+	return &pan.DownloadLink{Url: resp.Data, Client: c.defaultClient}, nil
+}
+
+func (c *Cloudreve) Open(ctx context.Context, file *pan.PanObj) (io.ReadSeekCloser, error) {
+	return c.BaseOpen(ctx, file, c.DownloadLinkCtx)
+}
+
 func (c *Cloudreve) OfflineDownload(req pan.OfflineDownloadReq) (*pan.Task, error) {
-	return nil, pan.OnlyMsg("offline download not support")
+	return c.OfflineDownloadCtx(c.Context(), req)
+}
+
+func (c *Cloudreve) OfflineDownloadCtx(ctx context.Context, req pan.OfflineDownloadReq) (*pan.Task, error) {
+	return nil, pan.KindMsg(pan.ErrUnsupported, "offline download not support")
 }
 
 func (c *Cloudreve) TaskList(req pan.TaskListReq) ([]*pan.Task, error) {
-	return nil, pan.OnlyMsg("task list not support")
+	return c.TaskListCtx(c.Context(), req)
+}
+
+func (c *Cloudreve) TaskListCtx(ctx context.Context, req pan.TaskListReq) ([]*pan.Task, error) {
+	return nil, pan.KindMsg(pan.ErrUnsupported, "task list not support")
 }
 
 func (c *Cloudreve) ShareList(req pan.ShareListReq) ([]*pan.ShareData, error) {
-	return nil, pan.OnlyMsg("share list not support")
+	return c.ShareListCtx(c.Context(), req)
+}
+
+func (c *Cloudreve) ShareListCtx(ctx context.Context, req pan.ShareListReq) ([]*pan.ShareData, error) {
+	return nil, pan.KindMsg(pan.ErrUnsupported, "share list not support")
 }
 func (c *Cloudreve) NewShare(req pan.NewShareReq) (*pan.ShareData, error) {
-	return nil, pan.OnlyMsg("new share not support")
+	return c.NewShareCtx(c.Context(), req)
+}
+
+func (c *Cloudreve) NewShareCtx(ctx context.Context, req pan.NewShareReq) (*pan.ShareData, error) {
+	return nil, pan.KindMsg(pan.ErrUnsupported, "new share not support")
 }
 func (c *Cloudreve) DeleteShare(req pan.DelShareReq) error {
-	return pan.OnlyMsg("delete share not support")
+	return c.DeleteShareCtx(c.Context(), req)
+}
+
+func (c *Cloudreve) DeleteShareCtx(ctx context.Context, req pan.DelShareReq) error {
+	return pan.KindMsg(pan.ErrUnsupported, "delete share not support")
 }
 func (c *Cloudreve) ShareRestore(req pan.ShareRestoreReq) error {
-	return pan.OnlyMsg("share restore not support ")
+	return c.ShareRestoreCtx(c.Context(), req)
+}
+
+func (c *Cloudreve) ShareRestoreCtx(ctx context.Context, req pan.ShareRestoreReq) error {
+	return pan.KindMsg(pan.ErrUnsupported, "share restore not support ")
 }
 
 func (c *Cloudreve) DirectLink(req pan.DirectLinkReq) ([]*pan.DirectLink, error) {
+	return c.DirectLinkCtx(c.Context(), req)
+}
+
+func (c *Cloudreve) DirectLinkCtx(ctx context.Context, req pan.DirectLinkReq) ([]*pan.DirectLink, error) {
+	ctx, cancel := c.JoinContext(ctx)
+	defer cancel()
 	fileList := req.List
 	fids := make([]string, 0)
 	for _, file := range fileList {
 		fids = append(fids, file.FileId)
 	}
-	resp, err := c.fileGetSource(ItemReq{
+	resp, err := c.fileGetSource(ctx, ItemReq{
 		Item: Item{Items: fids},
 	})
 	if err != nil {
@@ -1,5 +1,11 @@
 package cloudreve
 
+import (
+	"strings"
+
+	"github.com/hefeiyu25/pan-client/pan"
+)
+
 // 定义异常编码和异常信息
 const (
 	// CodeObjectExist 对象已存在
@@ -7,3 +13,34 @@ const (
 	// CodeConflictUploadOngoing 当前目录下已经有同名文件正在上传中
 	CodeConflictUploadOngoing = 40054
 )
+
+// Cloudreve 接口返回的错误码
+const (
+	// codeCheckLogin 未登录或会话失效
+	codeCheckLogin = 401
+	// codeNotFound 对象不存在
+	codeNotFound = 404
+	// codeParentNotExist 父目录不存在
+	codeParentNotExist = 40016
+	// codeFeatureNotEnabled 站点未开启该功能
+	codeFeatureNotEnabled = 40019
+)
+
+// codeError 将 Cloudreve 错误码映射为 pan 的错误类型，未识别的错误码按 HTTP 状态判断
+func codeError(status, code int, msg string) pan.DriverErrorInterface {
+	switch {
+	case code == codeCheckLogin:
+		return pan.KindCodeMsg(pan.ErrAuthExpired, code, msg)
+	case code == codeNotFound || code == codeParentNotExist:
+		return pan.KindCodeMsg(pan.ErrNotFound, code, msg)
+	case code == CodeObjectExist:
+		return pan.KindCodeMsg(pan.ErrAlreadyExists, code, msg)
+	case code == codeFeatureNotEnabled:
+		return pan.KindCodeMsg(pan.ErrUnsupported, code, msg)
+	case code == CodeConflictUploadOngoing:
+		return pan.RetryCodeMsg(code, msg)
+	case strings.Contains(strings.ToLower(msg), "capacity"):
+		return pan.KindCodeMsg(pan.ErrQuotaExceeded, code, msg)
+	}
+	return pan.StatusCodeMsg(status, code, msg)
+}
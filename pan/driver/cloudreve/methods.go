@@ -1,11 +1,14 @@
 package cloudreve
 
 import (
+	"context"
 	"github.com/hefeiyu25/pan-client/pan"
 	"github.com/imroc/req/v3"
+	"io"
 	"net/http"
 	"net/url"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -13,8 +16,12 @@ func funReturn(err error, response *req.Response, result Resp) (*Resp, pan.Drive
 	if err != nil {
 		return nil, pan.OnlyError(err)
 	}
-	if response.IsErrorState() && result.Code != 0 {
-		return nil, pan.CodeMsg(result.Code, result.Msg)
+	// Cloudreve v3 的业务错误以 HTTP 200 返回，需同时判断 code
+	if result.Code != 0 {
+		return nil, codeError(response.StatusCode, result.Code, result.Msg)
+	}
+	if response.IsErrorState() {
+		return nil, pan.StatusCodeMsg(response.StatusCode, response.StatusCode, response.String())
 	}
 	return &result, pan.NoError()
 }
@@ -23,16 +30,16 @@ func funReturnBySuccess[T any](err error, response *req.Response, errorResult Re
 		return nil, pan.OnlyError(err)
 	}
 	if response.IsErrorState() {
-		return nil, pan.CodeMsg(errorResult.Code, errorResult.Msg)
+		return nil, codeError(response.StatusCode, errorResult.Code, errorResult.Msg)
 	}
 	if successResult.Code != 0 {
-		return nil, pan.CodeMsg(successResult.Code, successResult.Msg)
+		return nil, codeError(response.StatusCode, successResult.Code, successResult.Msg)
 	}
 	return &successResult, pan.NoError()
 }
 
-func (c *Cloudreve) config() (*RespData[SiteConfig], pan.DriverErrorInterface) {
-	r := c.sessionClient.R()
+func (c *Cloudreve) config(ctx context.Context) (*RespData[SiteConfig], pan.DriverErrorInterface) {
+	r := c.sessionClient.R().SetContext(ctx)
 	var successResult RespData[SiteConfig]
 	var errorResult Resp
 	r.SetSuccessResult(&successResult)
@@ -43,10 +50,10 @@ func (c *Cloudreve) config() (*RespData[SiteConfig], pan.DriverErrorInterface) {
 		return nil, pan.OnlyError(err)
 	}
 	if response.IsErrorState() {
-		return nil, pan.CodeMsg(errorResult.Code, errorResult.Msg)
+		return nil, codeError(response.StatusCode, errorResult.Code, errorResult.Msg)
 	}
 	if successResult.Code != 0 {
-		return nil, pan.CodeMsg(successResult.Code, successResult.Msg)
+		return nil, codeError(response.StatusCode, successResult.Code, successResult.Msg)
 	}
 	if !successResult.Data.User.Anonymous {
 		for _, cookie := range response.Cookies() {
@@ -57,13 +64,13 @@ func (c *Cloudreve) config() (*RespData[SiteConfig], pan.DriverErrorInterface) {
 			}
 		}
 	} else {
-		return nil, pan.OnlyMsg("session is expired")
+		return nil, pan.KindMsg(pan.ErrAuthExpired, "session is expired")
 	}
 	return &successResult, pan.NoError()
 }
 
-func (c *Cloudreve) userStorage() (*RespData[Storage], pan.DriverErrorInterface) {
-	r := c.sessionClient.R()
+func (c *Cloudreve) userStorage(ctx context.Context) (*RespData[Storage], pan.DriverErrorInterface) {
+	r := c.sessionClient.R().SetContext(ctx)
 	var successResult RespData[Storage]
 	var errorResult Resp
 	r.SetSuccessResult(&successResult)
@@ -73,8 +80,8 @@ func (c *Cloudreve) userStorage() (*RespData[Storage], pan.DriverErrorInterface)
 	return funReturnBySuccess(err, response, errorResult, successResult)
 }
 
-func (c *Cloudreve) fileUploadGetUploadSession(req CreateUploadSessionReq) (*RespData[UploadCredential], pan.DriverErrorInterface) {
-	r := c.sessionClient.R()
+func (c *Cloudreve) fileUploadGetUploadSession(ctx context.Context, req CreateUploadSessionReq) (*RespData[UploadCredential], pan.DriverErrorInterface) {
+	r := c.sessionClient.R().SetContext(ctx)
 	var successResult RespData[UploadCredential]
 	var errorResult Resp
 	r.SetSuccessResult(&successResult)
@@ -85,8 +92,8 @@ func (c *Cloudreve) fileUploadGetUploadSession(req CreateUploadSessionReq) (*Res
 	return funReturnBySuccess(err, response, errorResult, successResult)
 }
 
-func (c *Cloudreve) fileUploadDeleteUploadSession(sessionId string) (*Resp, pan.DriverErrorInterface) {
-	r := c.sessionClient.R()
+func (c *Cloudreve) fileUploadDeleteUploadSession(ctx context.Context, sessionId string) (*Resp, pan.DriverErrorInterface) {
+	r := c.sessionClient.R().SetContext(ctx)
 	var result Resp
 	r.SetSuccessResult(&result)
 	r.SetErrorResult(&result)
@@ -95,8 +102,8 @@ func (c *Cloudreve) fileUploadDeleteUploadSession(sessionId string) (*Resp, pan.
 	return funReturn(err, response, result)
 }
 
-func (c *Cloudreve) fileUploadDeleteAllUploadSession() (*Resp, pan.DriverErrorInterface) {
-	r := c.sessionClient.R()
+func (c *Cloudreve) fileUploadDeleteAllUploadSession(ctx context.Context) (*Resp, pan.DriverErrorInterface) {
+	r := c.sessionClient.R().SetContext(ctx)
 	var result Resp
 	r.SetSuccessResult(&result)
 	r.SetErrorResult(&result)
@@ -109,8 +116,8 @@ func (c *Cloudreve) fileUploadDeleteAllUploadSession() (*Resp, pan.DriverErrorIn
 //
 //}
 
-func (c *Cloudreve) fileCreateFile(path string) (*Resp, pan.DriverErrorInterface) {
-	r := c.sessionClient.R()
+func (c *Cloudreve) fileCreateFile(ctx context.Context, path string) (*Resp, pan.DriverErrorInterface) {
+	r := c.sessionClient.R().SetContext(ctx)
 	var result Resp
 	r.SetSuccessResult(&result)
 	r.SetErrorResult(&result)
@@ -122,8 +129,8 @@ func (c *Cloudreve) fileCreateFile(path string) (*Resp, pan.DriverErrorInterface
 	return funReturn(err, response, result)
 }
 
-func (c *Cloudreve) fileCreateDownloadSession(id string) (*RespData[string], pan.DriverErrorInterface) {
-	r := c.sessionClient.R()
+func (c *Cloudreve) fileCreateDownloadSession(ctx context.Context, id string) (*RespData[string], pan.DriverErrorInterface) {
+	r := c.sessionClient.R().SetContext(ctx)
 	var successResult RespData[string]
 	var errorResult Resp
 	r.SetSuccessResult(&successResult)
@@ -134,7 +141,7 @@ func (c *Cloudreve) fileCreateDownloadSession(id string) (*RespData[string], pan
 }
 
 //func (c *Cloudreve) FilePreview(id string) (string,pan.DriverErrorInterface) {
-//	r := c.sessionClient.R()
+//	r := c.sessionClient.R().SetContext(ctx)
 //
 //
 //	// /file/preview
@@ -150,8 +157,8 @@ func (c *Cloudreve) fileCreateDownloadSession(id string) (*RespData[string], pan
 //
 //}
 
-func (c *Cloudreve) fileGetSource(req ItemReq) (*RespData[[]Sources], pan.DriverErrorInterface) {
-	r := c.sessionClient.R()
+func (c *Cloudreve) fileGetSource(ctx context.Context, req ItemReq) (*RespData[[]Sources], pan.DriverErrorInterface) {
+	r := c.sessionClient.R().SetContext(ctx)
 	var successResult RespData[[]Sources]
 	var errorResult Resp
 	r.SetSuccessResult(&successResult)
@@ -162,8 +169,8 @@ func (c *Cloudreve) fileGetSource(req ItemReq) (*RespData[[]Sources], pan.Driver
 	return funReturnBySuccess(err, response, errorResult, successResult)
 }
 
-func (c *Cloudreve) fileArchive(req ItemReq) (*RespData[string], pan.DriverErrorInterface) {
-	r := c.sessionClient.R()
+func (c *Cloudreve) fileArchive(ctx context.Context, req ItemReq) (*RespData[string], pan.DriverErrorInterface) {
+	r := c.sessionClient.R().SetContext(ctx)
 	var successResult RespData[string]
 	var errorResult Resp
 	r.SetSuccessResult(&successResult)
@@ -173,8 +180,8 @@ func (c *Cloudreve) fileArchive(req ItemReq) (*RespData[string], pan.DriverError
 	response, err := r.Post("/file/archive")
 	return funReturnBySuccess(err, response, errorResult, successResult)
 }
-func (c *Cloudreve) createDirectory(path string) (*Resp, pan.DriverErrorInterface) {
-	r := c.sessionClient.R()
+func (c *Cloudreve) createDirectory(ctx context.Context, path string) (*Resp, pan.DriverErrorInterface) {
+	r := c.sessionClient.R().SetContext(ctx)
 	var result Resp
 	r.SetSuccessResult(&result)
 	r.SetErrorResult(&result)
@@ -186,8 +193,8 @@ func (c *Cloudreve) createDirectory(path string) (*Resp, pan.DriverErrorInterfac
 	return funReturn(err, response, result)
 }
 
-func (c *Cloudreve) listDirectory(path string) (*RespData[ObjectList], pan.DriverErrorInterface) {
-	r := c.sessionClient.R()
+func (c *Cloudreve) listDirectory(ctx context.Context, path string) (*RespData[ObjectList], pan.DriverErrorInterface) {
+	r := c.sessionClient.R().SetContext(ctx)
 	var successResult RespData[ObjectList]
 	var errorResult Resp
 	r.SetSuccessResult(&successResult)
@@ -197,8 +204,21 @@ func (c *Cloudreve) listDirectory(path string) (*RespData[ObjectList], pan.Drive
 	return funReturnBySuccess(err, response, errorResult, successResult)
 }
 
-func (c *Cloudreve) objectDelete(req ItemReq) (*Resp, pan.DriverErrorInterface) {
-	r := c.sessionClient.R()
+// fileSearch 在 path 目录下按文件名关键字搜索
+func (c *Cloudreve) fileSearch(ctx context.Context, keyword, path string) (*RespData[ObjectList], pan.DriverErrorInterface) {
+	r := c.sessionClient.R().SetContext(ctx)
+	var successResult RespData[ObjectList]
+	var errorResult Resp
+	r.SetSuccessResult(&successResult)
+	r.SetErrorResult(&errorResult)
+	r.SetQueryParam("path", path)
+	// /file/search/:type/:keywords
+	response, err := r.Get("/file/search/" + string(KEYWORDS) + "/" + url.PathEscape(keyword))
+	return funReturnBySuccess(err, response, errorResult, successResult)
+}
+
+func (c *Cloudreve) objectDelete(ctx context.Context, req ItemReq) (*Resp, pan.DriverErrorInterface) {
+	r := c.sessionClient.R().SetContext(ctx)
 	var result Resp
 	r.SetSuccessResult(&result)
 	r.SetErrorResult(&result)
@@ -208,8 +228,8 @@ func (c *Cloudreve) objectDelete(req ItemReq) (*Resp, pan.DriverErrorInterface)
 	return funReturn(err, response, result)
 }
 
-func (c *Cloudreve) objectMove(req ItemMoveReq) (*Resp, pan.DriverErrorInterface) {
-	r := c.sessionClient.R()
+func (c *Cloudreve) objectMove(ctx context.Context, req ItemMoveReq) (*Resp, pan.DriverErrorInterface) {
+	r := c.sessionClient.R().SetContext(ctx)
 	var result Resp
 	r.SetSuccessResult(&result)
 	r.SetErrorResult(&result)
@@ -219,8 +239,8 @@ func (c *Cloudreve) objectMove(req ItemMoveReq) (*Resp, pan.DriverErrorInterface
 	return funReturn(err, response, result)
 }
 
-func (c *Cloudreve) objectCopy(req ItemMoveReq) (*Resp, pan.DriverErrorInterface) {
-	r := c.sessionClient.R()
+func (c *Cloudreve) objectCopy(ctx context.Context, req ItemMoveReq) (*Resp, pan.DriverErrorInterface) {
+	r := c.sessionClient.R().SetContext(ctx)
 	var result Resp
 	r.SetSuccessResult(&result)
 	r.SetErrorResult(&result)
@@ -230,8 +250,8 @@ func (c *Cloudreve) objectCopy(req ItemMoveReq) (*Resp, pan.DriverErrorInterface
 	return funReturn(err, response, result)
 }
 
-func (c *Cloudreve) objectRename(req ItemRenameReq) (*Resp, pan.DriverErrorInterface) {
-	r := c.sessionClient.R()
+func (c *Cloudreve) objectRename(ctx context.Context, req ItemRenameReq) (*Resp, pan.DriverErrorInterface) {
+	r := c.sessionClient.R().SetContext(ctx)
 	var result Resp
 	r.SetSuccessResult(&result)
 	r.SetErrorResult(&result)
@@ -241,8 +261,8 @@ func (c *Cloudreve) objectRename(req ItemRenameReq) (*Resp, pan.DriverErrorInter
 	return funReturn(err, response, result)
 }
 
-func (c *Cloudreve) objectGetProperty(req ItemPropertyReq) (*RespData[ObjectProps], pan.DriverErrorInterface) {
-	r := c.sessionClient.R()
+func (c *Cloudreve) objectGetProperty(ctx context.Context, req ItemPropertyReq) (*RespData[ObjectProps], pan.DriverErrorInterface) {
+	r := c.sessionClient.R().SetContext(ctx)
 	var errorResult Resp
 	var successResult RespData[ObjectProps]
 	r.SetSuccessResult(&successResult)
@@ -256,8 +276,8 @@ func (c *Cloudreve) objectGetProperty(req ItemPropertyReq) (*RespData[ObjectProp
 	return funReturnBySuccess(err, response, errorResult, successResult)
 }
 
-func (c *Cloudreve) shareCreateShare(req ShareCreateReq) (*RespData[string], pan.DriverErrorInterface) {
-	r := c.sessionClient.R()
+func (c *Cloudreve) shareCreateShare(ctx context.Context, req ShareCreateReq) (*RespData[string], pan.DriverErrorInterface) {
+	r := c.sessionClient.R().SetContext(ctx)
 	var successResult RespData[string]
 	var errorResult Resp
 	r.SetSuccessResult(&successResult)
@@ -268,8 +288,8 @@ func (c *Cloudreve) shareCreateShare(req ShareCreateReq) (*RespData[string], pan
 	return funReturnBySuccess(err, response, errorResult, successResult)
 }
 
-func (c *Cloudreve) shareListShare() (*RespData[ShareList], pan.DriverErrorInterface) {
-	r := c.sessionClient.R()
+func (c *Cloudreve) shareListShare(ctx context.Context) (*RespData[ShareList], pan.DriverErrorInterface) {
+	r := c.sessionClient.R().SetContext(ctx)
 	var successResult RespData[ShareList]
 	var errorResult Resp
 	r.SetSuccessResult(&successResult)
@@ -279,8 +299,8 @@ func (c *Cloudreve) shareListShare() (*RespData[ShareList], pan.DriverErrorInter
 	return funReturnBySuccess(err, response, errorResult, successResult)
 }
 
-func (c *Cloudreve) shareUpdateShare(req ShareUpdateReq) (*RespData[string], pan.DriverErrorInterface) {
-	r := c.sessionClient.R()
+func (c *Cloudreve) shareUpdateShare(ctx context.Context, req ShareUpdateReq) (*RespData[string], pan.DriverErrorInterface) {
+	r := c.sessionClient.R().SetContext(ctx)
 	var successResult RespData[string]
 	var errorResult Resp
 	r.SetSuccessResult(&successResult)
@@ -294,8 +314,8 @@ func (c *Cloudreve) shareUpdateShare(req ShareUpdateReq) (*RespData[string], pan
 	return funReturnBySuccess(err, response, errorResult, successResult)
 }
 
-func (c *Cloudreve) shareDeleteShare(id string) (*Resp, pan.DriverErrorInterface) {
-	r := c.sessionClient.R()
+func (c *Cloudreve) shareDeleteShare(ctx context.Context, id string) (*Resp, pan.DriverErrorInterface) {
+	r := c.sessionClient.R().SetContext(ctx)
 	var result Resp
 	r.SetSuccessResult(&result)
 	r.SetErrorResult(&result)
@@ -304,8 +324,8 @@ func (c *Cloudreve) shareDeleteShare(id string) (*Resp, pan.DriverErrorInterface
 	return funReturn(err, response, result)
 }
 
-func (c *Cloudreve) shareGetShare(id, password string) (*RespData[Share], pan.DriverErrorInterface) {
-	r := c.defaultClient.R()
+func (c *Cloudreve) shareGetShare(ctx context.Context, id, password string) (*RespData[Share], pan.DriverErrorInterface) {
+	r := c.defaultClient.R().SetContext(ctx)
 	var successResult RespData[Share]
 	var errorResult Resp
 	r.SetSuccessResult(&successResult)
@@ -318,8 +338,8 @@ func (c *Cloudreve) shareGetShare(id, password string) (*RespData[Share], pan.Dr
 	return funReturnBySuccess(err, response, errorResult, successResult)
 }
 
-func (c *Cloudreve) shareGetShareDownload(id, path string) (*RespData[string], pan.DriverErrorInterface) {
-	r := c.defaultClient.R()
+func (c *Cloudreve) shareGetShareDownload(ctx context.Context, id, path string) (*RespData[string], pan.DriverErrorInterface) {
+	r := c.defaultClient.R().SetContext(ctx)
 	var successResult RespData[string]
 	var errorResult Resp
 	r.SetSuccessResult(&successResult)
@@ -332,8 +352,8 @@ func (c *Cloudreve) shareGetShareDownload(id, path string) (*RespData[string], p
 	return funReturnBySuccess(err, response, errorResult, successResult)
 }
 
-func (c *Cloudreve) shareListSharedFolder(id, path string) (*RespData[ObjectList], pan.DriverErrorInterface) {
-	r := c.defaultClient.R()
+func (c *Cloudreve) shareListSharedFolder(ctx context.Context, id, path string) (*RespData[ObjectList], pan.DriverErrorInterface) {
+	r := c.defaultClient.R().SetContext(ctx)
 	var successResult RespData[ObjectList]
 	var errorResult Resp
 	r.SetSuccessResult(&successResult)
@@ -344,8 +364,8 @@ func (c *Cloudreve) shareListSharedFolder(id, path string) (*RespData[ObjectList
 	return funReturnBySuccess(err, response, errorResult, successResult)
 }
 
-func (c *Cloudreve) ShareSearchSharedFolder(id, keyword, path string, searchType SearchType) (*RespData[ObjectList], pan.DriverErrorInterface) {
-	r := c.defaultClient.R()
+func (c *Cloudreve) ShareSearchSharedFolder(ctx context.Context, id, keyword, path string, searchType SearchType) (*RespData[ObjectList], pan.DriverErrorInterface) {
+	r := c.defaultClient.R().SetContext(ctx)
 	var successResult RespData[ObjectList]
 	var errorResult Resp
 	r.SetSuccessResult(&successResult)
@@ -358,8 +378,8 @@ func (c *Cloudreve) ShareSearchSharedFolder(id, keyword, path string, searchType
 	return funReturnBySuccess(err, response, errorResult, successResult)
 }
 
-func (c *Cloudreve) shareSearchShare(req ShareListReq) (*RespData[ShareList], pan.DriverErrorInterface) {
-	r := c.defaultClient.R()
+func (c *Cloudreve) shareSearchShare(ctx context.Context, req ShareListReq) (*RespData[ShareList], pan.DriverErrorInterface) {
+	r := c.defaultClient.R().SetContext(ctx)
 	var successResult RespData[ShareList]
 	var errorResult Resp
 	r.SetSuccessResult(&successResult)
@@ -375,8 +395,8 @@ func (c *Cloudreve) shareSearchShare(req ShareListReq) (*RespData[ShareList], pa
 	return funReturnBySuccess(err, response, errorResult, successResult)
 }
 
-func (c *Cloudreve) oneDriveCallback(sessionId string) (*Resp, pan.DriverErrorInterface) {
-	r := c.sessionClient.R()
+func (c *Cloudreve) oneDriveCallback(ctx context.Context, sessionId string) (*Resp, pan.DriverErrorInterface) {
+	r := c.sessionClient.R().SetContext(ctx)
 	var result Resp
 	r.SetSuccessResult(&result)
 	r.SetErrorResult(&result)
@@ -388,16 +408,14 @@ func (c *Cloudreve) oneDriveCallback(sessionId string) (*Resp, pan.DriverErrorIn
 }
 
 // OneDriveUpload 分片上传 返回已上传的字节数和错误信息
-func (c *Cloudreve) oneDriveUpload(req OneDriveUploadReq) (int64, pan.DriverErrorInterface) {
+func (c *Cloudreve) oneDriveUpload(ctx context.Context, req OneDriveUploadReq) (int64, pan.DriverErrorInterface) {
 	uploadedSize := req.UploadedSize
 
-	pr, err := pan.NewProcessReader(req.LocalFile, req.ChunkSize, uploadedSize, req.ProgressCallback)
+	pr, err := req.Content.NewProgressReader(req.ChunkSize, uploadedSize, req.ProgressCallback)
 	if err != nil {
 		return uploadedSize, err
 	}
-	if req.Ctx != nil {
-		pr.SetCtx(req.Ctx)
-	}
+	pr.SetCtx(ctx)
 	if req.TaskId != "" {
 		pr.SetTaskId(req.TaskId)
 	}
@@ -406,7 +424,7 @@ func (c *Cloudreve) oneDriveUpload(req OneDriveUploadReq) (int64, pan.DriverErro
 	}
 	for {
 		startSize, endSize := pr.NextChunk()
-		response, reqErr := c.defaultClient.R().SetBody(pr).
+		response, reqErr := c.defaultClient.R().SetContext(ctx).SetBody(pr).
 			SetContentType("application/octet-stream").
 			SetHeader("Content-Length", strconv.FormatInt(endSize-startSize, 10)).
 			SetHeader("Content-Range", "bytes "+strconv.FormatInt(startSize, 10)+"-"+strconv.FormatInt(endSize-1, 10)+"/"+strconv.FormatInt(pr.GetTotal(), 10)).
@@ -415,7 +433,10 @@ func (c *Cloudreve) oneDriveUpload(req OneDriveUploadReq) (int64, pan.DriverErro
 			return pr.GetUploaded(), pan.OnlyError(reqErr)
 		}
 		if response.IsErrorState() {
-			return pr.GetUploaded(), pan.OnlyMsg(response.String())
+			return pr.GetUploaded(), pan.StatusCodeMsg(response.StatusCode, response.StatusCode, response.String())
+		}
+		if req.ChunkDone != nil {
+			req.ChunkDone(endSize)
 		}
 
 		if pr.IsFinish() {
@@ -426,41 +447,75 @@ func (c *Cloudreve) oneDriveUpload(req OneDriveUploadReq) (int64, pan.DriverErro
 	return pr.GetUploaded(), pan.NoError()
 }
 
-func (c *Cloudreve) notKnowUpload(req NotKnowUploadReq) (int64, pan.DriverErrorInterface) {
-	uploadedSize := req.UploadedSize
-	pr, err := pan.NewProcessReader(req.LocalFile, req.ChunkSize, uploadedSize, req.ProgressCallback)
-	if err != nil {
-		return uploadedSize, err
-	}
-	if req.Ctx != nil {
-		pr.SetCtx(req.Ctx)
-	}
-	if req.TaskId != "" {
-		pr.SetTaskId(req.TaskId)
-	}
-	if req.FileId != "" {
-		pr.SetFileId(req.FileId)
-	}
-	for {
-		startSize, endSize := pr.NextChunk()
-		response, reqErr := c.defaultClient.R().SetBody(pr).
+// notKnowUpload 按分片序号上传，分片可以并行上传。服务端收到最后一个分片时合并文件，
+// 所以最后一个分片在其余分片都成功后再上传。返回已上传的分片和错误信息
+func (c *Cloudreve) notKnowUpload(ctx context.Context, req NotKnowUploadReq) ([]pan.UploadPart, pan.DriverErrorInterface) {
+	parts, err := c.BaseUploadParts(ctx, pan.UploadPartsReq{
+		Content:          req.Content,
+		PartSize:         req.ChunkSize,
+		Concurrency:      req.Concurrency,
+		Done:             req.Done,
+		LastAfterAll:     true,
+		PartDone:         req.PartDone,
+		TaskId:           req.TaskId,
+		FileId:           req.FileId,
+		ProgressCallback: req.ProgressCallback,
+	}, func(ctx context.Context, part pan.UploadPart, r io.Reader) (string, error) {
+		response, reqErr := c.defaultClient.R().SetContext(ctx).SetBody(r).
 			SetContentType("application/octet-stream").
-			SetHeader("Content-Length", strconv.FormatInt(endSize-startSize, 10)).
+			SetHeader("Content-Length", strconv.FormatInt(part.Size, 10)).
 			SetHeader("Authorization", req.Credential).
-			SetQueryParam("chunk", strconv.FormatInt(startSize/req.ChunkSize, 10)).
-			//SetHeader("Content-Range", "bytes "+strconv.FormatInt(startSize, 10)+"-"+strconv.FormatInt(endSize-1, 10)+"/"+strconv.FormatInt(pr.GetTotal(), 10)).
+			SetQueryParam("chunk", strconv.Itoa(part.Number-1)).
 			Post(req.UploadUrl)
 		if reqErr != nil {
-			return pr.GetUploaded(), pan.OnlyError(reqErr)
+			return "", pan.OnlyError(reqErr)
 		}
 		if response.IsErrorState() {
-			return pr.GetUploaded(), pan.OnlyMsg(response.String())
+			return "", pan.StatusCodeMsg(response.StatusCode, response.StatusCode, response.String())
 		}
+		return "", nil
+	})
+	if err != nil {
+		return parts, pan.OnlyError(err)
+	}
+	return parts, pan.NoError()
+}
 
-		if pr.IsFinish() {
-			break
+// resolveItems 将仅有路径的对象解析为带 ID 的对象，任一对象无法解析时返回错误（不存在时为 ErrNotFound）
+func (c *Cloudreve) resolveItems(ctx context.Context, items []*pan.PanObj) ([]*pan.PanObj, error) {
+	result := make([]*pan.PanObj, 0, len(items))
+	for _, item := range items {
+		if item.Id != "0" && item.Id != "" {
+			result = append(result, item)
+		} else if strings.Trim(item.Path+"/"+item.Name, "/") != "" {
+			itemPath := strings.TrimRight(item.Path, "/") + "/" + item.Name
+			obj, err := c.GetPanObj(itemPath, true, pan.WithCtx(ctx, c.ListCtx))
+			if err != nil {
+				return nil, pan.MsgError("resolve "+itemPath+" error", err)
+			}
+			result = append(result, obj)
 		}
 	}
-	pr.Close()
-	return pr.GetUploaded(), pan.NoError()
+	return result, nil
+}
+
+// collectItem 按类型拆分文件与目录 ID，并返回需要刷新缓存的目录 ID
+func collectItem(objs []*pan.PanObj) (Item, map[string]any) {
+	item := Item{
+		Items: make([]string, 0),
+		Dirs:  make([]string, 0),
+	}
+	reloadDirId := make(map[string]any)
+	for _, obj := range objs {
+		if obj.Type == "dir" {
+			item.Dirs = append(item.Dirs, obj.Id)
+			reloadDirId[obj.Id] = true
+		} else {
+			item.Items = append(item.Items, obj.Id)
+		}
+		if obj.Parent != nil && obj.Parent.Id != "" {
+			reloadDirId[obj.Parent.Id] = true
+		}
+	}
+	return item, reloadDirId
 }
@@ -1,7 +1,6 @@
 package cloudreve
 
 import (
-	"context"
 	"github.com/hefeiyu25/pan-client/pan"
 	"time"
 )
@@ -306,23 +305,24 @@ type ShareListReq struct {
 
 type OneDriveUploadReq struct {
 	UploadUrl        string
-	LocalFile        string
+	Content          *pan.UploadContent
 	UploadedSize     int64
 	ChunkSize        int64
 	TaskId           string // 调用方传入的任务 ID（可选）
 	FileId           string // 网盘返回的文件 ID
-	Ctx              context.Context
 	ProgressCallback pan.ProgressCallback
+	ChunkDone        func(uploaded int64) // 分片上传成功后回调，参数为已上传的字节数
 }
 
 type NotKnowUploadReq struct {
 	UploadUrl        string
 	Credential       string
-	LocalFile        string
-	UploadedSize     int64
+	Content          *pan.UploadContent
 	ChunkSize        int64
-	TaskId           string // 调用方传入的任务 ID（可选）
-	FileId           string // 网盘返回的文件 ID
-	Ctx              context.Context
+	Concurrency      int              // 同时上传的分片数
+	Done             []pan.UploadPart // 已上传的分片
+	TaskId           string           // 调用方传入的任务 ID（可选）
+	FileId           string           // 网盘返回的文件 ID
 	ProgressCallback pan.ProgressCallback
+	PartDone         func(part pan.UploadPart) // 分片上传成功后回调
 }
@@ -0,0 +1,20 @@
+package local
+
+const (
+	cacheDirectoryPrefix = "directory_"
+	// readDirBatch ListIter 每次从磁盘读取的目录项数
+	readDirBatch = 100
+)
+
+const (
+	// sidecarPrefix 以此前缀开头的文件为驱动自身的元数据，不会出现在 List 结果中
+	sidecarPrefix = ".pan_"
+	// shareFileName 分享记录的 sidecar 文件
+	shareFileName = sidecarPrefix + "shares.json"
+	// trashDirName 回收站目录，被删除的对象以记录 ID 为名存放其中
+	trashDirName = sidecarPrefix + "trash"
+	// trashFileName 回收站记录的 sidecar 文件
+	trashFileName = sidecarPrefix + "trash.json"
+	// shareUrlScheme 本地分享链接的 scheme
+	shareUrlScheme = "local"
+)
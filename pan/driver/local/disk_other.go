@@ -0,0 +1,10 @@
+//go:build !linux && !darwin && !freebsd && !windows
+
+package local
+
+import "github.com/hefeiyu25/pan-client/pan"
+
+// diskUsage 其他系统不支持查询容量
+func diskUsage(string) (total, free int64, err error) {
+	return 0, 0, pan.KindMsg(pan.ErrUnsupported, "disk usage is not supported on this system")
+}
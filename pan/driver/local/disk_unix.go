@@ -0,0 +1,14 @@
+//go:build linux || darwin || freebsd
+
+package local
+
+import "syscall"
+
+// diskUsage 返回 root 所在文件系统的总容量和可用容量，单位字节
+func diskUsage(root string) (total, free int64, err error) {
+	var stat syscall.Statfs_t
+	if err = syscall.Statfs(root, &stat); err != nil {
+		return 0, 0, osError(err)
+	}
+	return int64(stat.Blocks) * int64(stat.Bsize), int64(stat.Bavail) * int64(stat.Bsize), nil
+}
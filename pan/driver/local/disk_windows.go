@@ -0,0 +1,18 @@
+//go:build windows
+
+package local
+
+import "golang.org/x/sys/windows"
+
+// diskUsage 返回 root 所在卷的总容量和当前用户可用的容量，单位字节
+func diskUsage(root string) (total, free int64, err error) {
+	dir, err := windows.UTF16PtrFromString(root)
+	if err != nil {
+		return 0, 0, osError(err)
+	}
+	var available, totalBytes, totalFree uint64
+	if err = windows.GetDiskFreeSpaceEx(dir, &available, &totalBytes, &totalFree); err != nil {
+		return 0, 0, osError(err)
+	}
+	return int64(totalBytes), int64(available), nil
+}
@@ -0,0 +1,1158 @@
+package local
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"iter"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hefeiyu25/pan-client/internal"
+	"github.com/hefeiyu25/pan-client/pan"
+)
+
+// Local 基于本地目录实现的驱动，对象 ID 为相对根目录的 slash 路径，根目录为 "0"
+type Local struct {
+	shareMu sync.Mutex
+	trashMu sync.Mutex
+	pan.PropertiesOperate[*LocalProperties]
+	pan.CacheOperate
+	pan.CommonOperate
+	pan.BaseOperate
+}
+
+type LocalProperties struct {
+	Id       string `mapstructure:"id" json:"id" yaml:"id"`
+	RootPath string `mapstructure:"root_path" json:"root_path" yaml:"root_path"` // 作为网盘根目录的本地目录
+}
+
+func (cp *LocalProperties) OnlyImportProperties() {
+	// do nothing
+}
+
+func (cp *LocalProperties) GetId() string {
+	if cp.Id == "" {
+		cp.Id = uuid.NewString()
+	}
+	return cp.Id
+}
+
+func (cp *LocalProperties) GetDriverType() pan.DriverType {
+	return pan.Local
+}
+
+func (l *Local) Init() (string, error) {
+	driverId := l.GetId()
+	if l.Properties.RootPath == "" {
+		return driverId, fmt.Errorf("please set root_path to a local directory")
+	}
+	root, err := filepath.Abs(l.Properties.RootPath)
+	if err != nil {
+		return driverId, fmt.Errorf("failed to resolve root_path: %w", err)
+	}
+	if err = os.MkdirAll(root, os.ModePerm); err != nil {
+		return driverId, fmt.Errorf("failed to create root_path: %w", err)
+	}
+	l.Properties.RootPath = root
+	return driverId, nil
+}
+
+func (l *Local) Close() error {
+	l.Cancel()
+	l.StopCache()
+	return nil
+}
+
+func (l *Local) Capabilities() pan.Capabilities {
+	return pan.Capabilities{
+		DirectLink:   true,
+		Share:        true,
+		ShareRestore: true,
+		Copy:         true,
+		Trash:        true,
+	}
+}
+
+func (l *Local) Disk() (*pan.DiskResp, error) {
+	return l.DiskCtx(l.Context())
+}
+
+func (l *Local) DiskCtx(ctx context.Context) (*pan.DiskResp, error) {
+	ctx, cancel := l.JoinContext(ctx)
+	defer cancel()
+	if err := checkCtx(ctx); err != nil {
+		return nil, err
+	}
+	total, free, err := diskUsage(l.Properties.RootPath)
+	if err != nil {
+		return nil, err
+	}
+	return &pan.DiskResp{
+		Total: total / 1024 / 1024,
+		Free:  free / 1024 / 1024,
+		Used:  (total - free) / 1024 / 1024,
+	}, nil
+}
+
+func (l *Local) List(req pan.ListReq) ([]*pan.PanObj, error) {
+	return l.ListCtx(l.Context(), req)
+}
+
+func (l *Local) ListCtx(ctx context.Context, req pan.ListReq) ([]*pan.PanObj, error) {
+	ctx, cancel := l.JoinContext(ctx)
+	defer cancel()
+	if err := checkCtx(ctx); err != nil {
+		return nil, err
+	}
+	queryDir := req.Dir
+	if queryDir.Path == "/" && queryDir.Name == "" {
+		queryDir.Id = "0"
+	}
+	rel := relPath(queryDir)
+	cacheKey := cacheDirectoryPrefix + objId(rel)
+	if req.Reload {
+		l.Del(cacheKey)
+	}
+	result, err := l.GetOrLoad(cacheKey, func() (interface{}, error) {
+		infos, e := l.readDir(rel)
+		if e != nil {
+			internal.GetLogger().Error("read dir error", "error", e)
+			if os.IsNotExist(e) {
+				return nil, pan.KindCodeMsg(pan.ErrNotFound, CodeObjectNotExist, rel+" not found")
+			}
+			return nil, osError(e)
+		}
+		panObjs := make([]*pan.PanObj, 0, len(infos))
+		for _, info := range infos {
+			panObjs = append(panObjs, l.toPanObj(path.Join(rel, info.Name()), info, req.Dir))
+		}
+		return panObjs, nil
+	})
+	if err != nil {
+		return make([]*pan.PanObj, 0), err
+	}
+	if objs, ok := result.([]*pan.PanObj); ok {
+		return req.Apply(objs)
+	}
+	return make([]*pan.PanObj, 0), nil
+}
+
+func (l *Local) ListIter(ctx context.Context, dir *pan.PanObj) iter.Seq2[*pan.PanObj, error] {
+	return func(yield func(*pan.PanObj, error) bool) {
+		ctx, cancel := l.JoinContext(ctx)
+		defer cancel()
+		if err := checkCtx(ctx); err != nil {
+			yield(nil, err)
+			return
+		}
+		queryDir := dir
+		if queryDir == nil || (queryDir.Path == "/" && queryDir.Name == "") {
+			queryDir = &pan.PanObj{Id: "0", Name: "", Path: "/", Type: "dir"}
+		}
+		rel := relPath(queryDir)
+		if cached, ok := l.Get(cacheDirectoryPrefix + objId(rel)); ok {
+			for _, obj := range cached.([]*pan.PanObj) {
+				if !yield(obj, nil) {
+					return
+				}
+			}
+			return
+		}
+		// 分批读取目录项，顺序为磁盘上的原始顺序
+		f, err := os.Open(l.absPath(rel))
+		if err != nil {
+			if os.IsNotExist(err) {
+				err = pan.KindCodeMsg(pan.ErrNotFound, CodeObjectNotExist, rel+" not found")
+			} else {
+				err = osError(err)
+			}
+			yield(nil, err)
+			return
+		}
+		defer f.Close()
+		for {
+			if err = checkCtx(ctx); err != nil {
+				yield(nil, err)
+				return
+			}
+			entries, readErr := f.ReadDir(readDirBatch)
+			for _, entry := range entries {
+				if strings.HasPrefix(entry.Name(), sidecarPrefix) {
+					continue
+				}
+				info, err := entry.Info()
+				if err != nil {
+					yield(nil, osError(err))
+					return
+				}
+				if !yield(l.toPanObj(path.Join(rel, info.Name()), info, queryDir), nil) {
+					return
+				}
+			}
+			if readErr == io.EOF {
+				return
+			}
+			if readErr != nil {
+				yield(nil, osError(readErr))
+				return
+			}
+		}
+	}
+}
+
+func (l *Local) Stat(req pan.StatReq) (*pan.PanObj, error) {
+	return l.StatCtx(l.Context(), req)
+}
+
+func (l *Local) StatCtx(ctx context.Context, req pan.StatReq) (*pan.PanObj, error) {
+	ctx, cancel := l.JoinContext(ctx)
+	defer cancel()
+	if err := checkCtx(ctx); err != nil {
+		return nil, err
+	}
+	// ID 即相对路径，两者都可直接 stat
+	rel := path.Clean("/" + strings.Trim(req.Path, "/"))
+	if req.Id != "" {
+		rel = relPath(&pan.PanObj{Id: req.Id})
+	}
+	if strings.HasPrefix(path.Base(rel), sidecarPrefix) {
+		return nil, pan.KindCodeMsg(pan.ErrNotFound, CodeObjectNotExist, rel+" not found")
+	}
+	info, err := l.stat(rel)
+	if err != nil {
+		return nil, err
+	}
+	var parent *pan.PanObj
+	if rel != "/" {
+		parentRel := path.Dir(rel)
+		parent = &pan.PanObj{
+			Id:   objId(parentRel),
+			Name: path.Base(parentRel),
+			Path: path.Dir(parentRel),
+			Type: "dir",
+		}
+	}
+	return l.toPanObj(rel, info, parent), nil
+}
+
+func (l *Local) Search(req pan.SearchReq) ([]*pan.PanObj, error) {
+	return l.SearchCtx(l.Context(), req)
+}
+
+func (l *Local) SearchCtx(ctx context.Context, req pan.SearchReq) ([]*pan.PanObj, error) {
+	ctx, cancel := l.JoinContext(ctx)
+	defer cancel()
+	if err := checkCtx(ctx); err != nil {
+		return nil, err
+	}
+	root, err := l.SearchRoot(req, pan.WithCtx(ctx, l.ListCtx))
+	if err != nil {
+		return nil, err
+	}
+	req.Root = root
+	// 直接遍历磁盘，dirs 记录已遍历的目录作为子对象的 Parent
+	rootRel := relPath(root)
+	dirs := map[string]*pan.PanObj{rootRel: root}
+	result := make([]*pan.PanObj, 0)
+	walkErr := filepath.WalkDir(l.absPath(rootRel), func(p string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(l.Properties.RootPath, p)
+		if err != nil {
+			return err
+		}
+		rel = path.Clean("/" + filepath.ToSlash(rel))
+		if rel == rootRel {
+			return nil
+		}
+		if strings.HasPrefix(d.Name(), sidecarPrefix) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		obj := l.toPanObj(rel, info, dirs[path.Dir(rel)])
+		if d.IsDir() {
+			dirs[rel] = obj
+		}
+		if req.Match(obj) {
+			result = append(result, obj)
+		}
+		return nil
+	})
+	if walkErr != nil {
+		return nil, osError(walkErr)
+	}
+	return result, nil
+}
+
+func (l *Local) ObjRename(req pan.ObjRenameReq) error {
+	return l.ObjRenameCtx(l.Context(), req)
+}
+
+func (l *Local) ObjRenameCtx(ctx context.Context, req pan.ObjRenameReq) error {
+	ctx, cancel := l.JoinContext(ctx)
+	defer cancel()
+	if err := checkCtx(ctx); err != nil {
+		return err
+	}
+	if req.Obj.Id == "0" || (req.Obj.Path == "/" && req.Obj.Name == "") {
+		return pan.KindMsg(pan.ErrUnsupported, "not support rename root path")
+	}
+	if req.NewName == "" || strings.ContainsAny(req.NewName, `/\`) {
+		return pan.OnlyMsg("invalid new name: " + req.NewName)
+	}
+	rel := relPath(req.Obj)
+	if _, err := l.stat(rel); err != nil {
+		return err
+	}
+	target := path.Join(path.Dir(rel), req.NewName)
+	if _, err := os.Lstat(l.absPath(target)); err == nil {
+		return pan.KindCodeMsg(pan.ErrAlreadyExists, CodeObjectExist, target+" is exist")
+	}
+	if err := os.Rename(l.absPath(rel), l.absPath(target)); err != nil {
+		return osError(err)
+	}
+	l.Del(cacheDirectoryPrefix + objId(path.Dir(rel)))
+	l.Del(cacheDirectoryPrefix + objId(rel))
+	return nil
+}
+
+func (l *Local) BatchRename(req pan.BatchRenameReq) error {
+	return l.BatchRenameCtx(l.Context(), req)
+}
+
+func (l *Local) BatchRenameCtx(ctx context.Context, req pan.BatchRenameReq) error {
+	return l.BaseBatchRename(ctx, req, pan.WithCtx(ctx, l.ListCtx), func(req pan.ObjRenameReq) error {
+		return l.ObjRenameCtx(ctx, req)
+	})
+}
+
+func (l *Local) Mkdir(req pan.MkdirReq) (*pan.PanObj, error) {
+	return l.MkdirCtx(l.Context(), req)
+}
+
+func (l *Local) MkdirCtx(ctx context.Context, req pan.MkdirReq) (*pan.PanObj, error) {
+	ctx, cancel := l.JoinContext(ctx)
+	defer cancel()
+	if err := checkCtx(ctx); err != nil {
+		return nil, err
+	}
+	if req.NewPath == "" {
+		// 不处理，直接返回
+		return &pan.PanObj{
+			Id:   "0",
+			Name: "",
+			Path: "/",
+			Size: 0,
+			Type: "dir",
+		}, nil
+	}
+	if filepath.Ext(req.NewPath) != "" {
+		return nil, pan.OnlyMsg("please set a dir")
+	}
+	targetPath := path.Clean("/" + strings.Trim(req.NewPath, "/"))
+	if req.Parent != nil {
+		targetPath = path.Join(relPath(req.Parent), targetPath)
+	}
+	abs := l.absPath(targetPath)
+	if info, err := os.Stat(abs); err == nil && !info.IsDir() {
+		return nil, pan.KindCodeMsg(pan.ErrAlreadyExists, CodeObjectExist, targetPath+" is a file")
+	}
+	if err := os.MkdirAll(abs, os.ModePerm); err != nil {
+		return nil, osError(err)
+	}
+	info, err := os.Stat(abs)
+	if err != nil {
+		return nil, osError(err)
+	}
+	// 清除所有祖先目录缓存以便后续 List 可见
+	for p := targetPath; ; p = path.Dir(p) {
+		l.Del(cacheDirectoryPrefix + objId(path.Dir(p)))
+		if p == "/" {
+			break
+		}
+	}
+	parentRel := path.Dir(targetPath)
+	return l.toPanObj(targetPath, info, &pan.PanObj{
+		Id:   objId(parentRel),
+		Name: path.Base(parentRel),
+		Path: path.Dir(parentRel),
+		Type: "dir",
+	}), nil
+}
+
+func (l *Local) Move(req pan.MovieReq) error {
+	return l.MoveCtx(l.Context(), req)
+}
+
+func (l *Local) MoveCtx(ctx context.Context, req pan.MovieReq) error {
+	ctx, cancel := l.JoinContext(ctx)
+	defer cancel()
+	targetObj := req.TargetObj
+	if targetObj.Type == "file" {
+		return pan.OnlyMsg("target is a file")
+	}
+	// 重新直接创建目标目录
+	if targetObj.Id == "" {
+		create, err := l.MkdirCtx(ctx, pan.MkdirReq{
+			NewPath: strings.Trim(targetObj.Path, "/") + "/" + targetObj.Name,
+		})
+		if err != nil {
+			return err
+		}
+		targetObj = create
+	}
+	targetRel := relPath(targetObj)
+	for _, item := range req.Items {
+		if err := checkCtx(ctx); err != nil {
+			return err
+		}
+		rel := relPath(item)
+		if rel == "/" {
+			return pan.KindMsg(pan.ErrUnsupported, "not support move root path")
+		}
+		if _, err := l.stat(rel); err != nil {
+			return err
+		}
+		dst := path.Join(targetRel, path.Base(rel))
+		if dst == rel {
+			continue
+		}
+		if strings.HasPrefix(targetRel+"/", rel+"/") {
+			return pan.OnlyMsg("can not move " + rel + " into itself")
+		}
+		if _, err := os.Lstat(l.absPath(dst)); err == nil {
+			return pan.KindCodeMsg(pan.ErrAlreadyExists, CodeObjectExist, dst+" is exist")
+		}
+		if err := os.Rename(l.absPath(rel), l.absPath(dst)); err != nil {
+			return osError(err)
+		}
+		l.Del(cacheDirectoryPrefix + objId(path.Dir(rel)))
+		l.Del(cacheDirectoryPrefix + objId(rel))
+	}
+	l.Del(cacheDirectoryPrefix + objId(targetRel))
+	return nil
+}
+
+func (l *Local) Copy(req pan.CopyReq) error {
+	return l.CopyCtx(l.Context(), req)
+}
+
+func (l *Local) CopyCtx(ctx context.Context, req pan.CopyReq) error {
+	ctx, cancel := l.JoinContext(ctx)
+	defer cancel()
+	targetObj := req.TargetObj
+	if targetObj.Type == "file" {
+		return pan.OnlyMsg("target is a file")
+	}
+	// 重新直接创建目标目录
+	if targetObj.Id == "" {
+		create, err := l.MkdirCtx(ctx, pan.MkdirReq{
+			NewPath: strings.Trim(targetObj.Path, "/") + "/" + targetObj.Name,
+		})
+		if err != nil {
+			return err
+		}
+		targetObj = create
+	}
+	targetRel := relPath(targetObj)
+	for _, item := range req.Items {
+		if err := checkCtx(ctx); err != nil {
+			return err
+		}
+		rel := relPath(item)
+		if rel == "/" {
+			return pan.KindMsg(pan.ErrUnsupported, "not support copy root path")
+		}
+		if _, err := l.stat(rel); err != nil {
+			return err
+		}
+		if strings.HasPrefix(targetRel+"/", rel+"/") {
+			return pan.OnlyMsg("can not copy " + rel + " into itself")
+		}
+		dst := path.Join(targetRel, path.Base(rel))
+		if _, err := os.Lstat(l.absPath(dst)); err == nil {
+			return pan.KindCodeMsg(pan.ErrAlreadyExists, CodeObjectExist, dst+" is exist")
+		}
+		if err := copyTree(ctx, l.absPath(rel), l.absPath(dst)); err != nil {
+			_ = os.RemoveAll(l.absPath(dst))
+			return osError(err)
+		}
+	}
+	l.Del(cacheDirectoryPrefix + objId(targetRel))
+	return nil
+}
+
+func (l *Local) Delete(req pan.DeleteReq) error {
+	return l.DeleteCtx(l.Context(), req)
+}
+
+func (l *Local) DeleteCtx(ctx context.Context, req pan.DeleteReq) error {
+	ctx, cancel := l.JoinContext(ctx)
+	defer cancel()
+	l.trashMu.Lock()
+	defer l.trashMu.Unlock()
+	// 先确认所有对象都存在，不存在时整个删除失败
+	for _, item := range req.Items {
+		if _, err := os.Lstat(l.absPath(relPath(item))); err != nil {
+			return osError(err)
+		}
+	}
+	trash, err := l.loadTrash()
+	if err != nil {
+		return osError(err)
+	}
+	for _, item := range req.Items {
+		if err = l.deleteItem(ctx, trash, relPath(item), req.Permanent); err != nil {
+			break
+		}
+	}
+	// 已移入回收站的对象需要写入记录，出错时也要保存
+	if saveErr := l.saveTrash(trash); saveErr != nil && err == nil {
+		err = osError(saveErr)
+	}
+	return err
+}
+
+// deleteItem 删除单个对象，permanent 为 false 时移入回收站，调用方需持有 trashMu
+func (l *Local) deleteItem(ctx context.Context, trash *trashFile, rel string, permanent bool) error {
+	if err := checkCtx(ctx); err != nil {
+		return err
+	}
+	if rel == "/" {
+		return pan.KindMsg(pan.ErrUnsupported, "not support delete root path")
+	}
+	if permanent {
+		if err := os.RemoveAll(l.absPath(rel)); err != nil {
+			return osError(err)
+		}
+	} else {
+		info, err := os.Lstat(l.absPath(rel))
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err == nil {
+			err = l.moveToTrash(trash, rel, info)
+		}
+		if err != nil {
+			return osError(err)
+		}
+	}
+	l.Del(cacheDirectoryPrefix + objId(path.Dir(rel)))
+	l.Del(cacheDirectoryPrefix + objId(rel))
+	return nil
+}
+
+func (l *Local) TrashList() ([]*pan.PanObj, error) {
+	return l.TrashListCtx(l.Context())
+}
+
+func (l *Local) TrashListCtx(ctx context.Context) ([]*pan.PanObj, error) {
+	ctx, cancel := l.JoinContext(ctx)
+	defer cancel()
+	if err := checkCtx(ctx); err != nil {
+		return nil, err
+	}
+	l.trashMu.Lock()
+	defer l.trashMu.Unlock()
+	trash, err := l.loadTrash()
+	if err != nil {
+		return nil, osError(err)
+	}
+	objs := make([]*pan.PanObj, 0, len(trash.Records))
+	for _, record := range trash.Records {
+		parentRel := path.Dir(record.Path)
+		objs = append(objs, &pan.PanObj{
+			Id:   record.RecordId,
+			Name: path.Base(record.Path),
+			Path: parentRel,
+			Size: record.Size,
+			Type: record.Type,
+			Ext: pan.Json{
+				"deletedAt": record.DeletedAt.UnixMilli(),
+			},
+			Parent: &pan.PanObj{Id: objId(parentRel), Type: "dir"},
+		})
+	}
+	return objs, nil
+}
+
+func (l *Local) TrashRestore(req pan.TrashReq) error {
+	return l.TrashRestoreCtx(l.Context(), req)
+}
+
+func (l *Local) TrashRestoreCtx(ctx context.Context, req pan.TrashReq) error {
+	return l.trashOperate(ctx, req.Items, func(record *TrashRecord) error {
+		// 原目录已被删除时重新创建
+		if err := os.MkdirAll(l.absPath(path.Dir(record.Path)), os.ModePerm); err != nil {
+			return osError(err)
+		}
+		if _, err := os.Lstat(l.absPath(record.Path)); err == nil {
+			return pan.KindCodeMsg(pan.ErrAlreadyExists, CodeObjectExist, record.Path+" is exist")
+		}
+		if err := os.Rename(l.trashPath(record.RecordId), l.absPath(record.Path)); err != nil {
+			return osError(err)
+		}
+		for p := record.Path; p != "/"; p = path.Dir(p) {
+			l.Del(cacheDirectoryPrefix + objId(path.Dir(p)))
+		}
+		return nil
+	})
+}
+
+func (l *Local) TrashDelete(req pan.TrashReq) error {
+	return l.TrashDeleteCtx(l.Context(), req)
+}
+
+func (l *Local) TrashDeleteCtx(ctx context.Context, req pan.TrashReq) error {
+	return l.trashOperate(ctx, req.Items, l.purge)
+}
+
+func (l *Local) TrashEmpty() error {
+	return l.TrashEmptyCtx(l.Context())
+}
+
+func (l *Local) TrashEmptyCtx(ctx context.Context) error {
+	return l.trashOperate(ctx, nil, l.purge)
+}
+
+// purge 彻底删除回收站记录对应的内容
+func (l *Local) purge(record *TrashRecord) error {
+	if err := os.RemoveAll(l.trashPath(record.RecordId)); err != nil {
+		return osError(err)
+	}
+	return nil
+}
+
+// trashOperate 对回收站记录执行 operate，成功的记录从回收站移除；items 为 nil 时作用于全部记录
+func (l *Local) trashOperate(ctx context.Context, items []*pan.PanObj, operate func(record *TrashRecord) error) error {
+	ctx, cancel := l.JoinContext(ctx)
+	defer cancel()
+	l.trashMu.Lock()
+	defer l.trashMu.Unlock()
+	trash, err := l.loadTrash()
+	if err != nil {
+		return osError(err)
+	}
+	selected := make(map[string]bool, len(items))
+	for _, item := range items {
+		selected[item.Id] = false
+	}
+	kept := make([]*TrashRecord, 0, len(trash.Records))
+	for _, record := range trash.Records {
+		if _, ok := selected[record.RecordId]; !ok && items != nil {
+			kept = append(kept, record)
+			continue
+		}
+		if err == nil {
+			err = checkCtx(ctx)
+		}
+		if err == nil {
+			err = operate(record)
+		}
+		if err != nil {
+			kept = append(kept, record)
+			continue
+		}
+		selected[record.RecordId] = true
+	}
+	trash.Records = kept
+	if saveErr := l.saveTrash(trash); saveErr != nil && err == nil {
+		err = osError(saveErr)
+	}
+	if err != nil {
+		return err
+	}
+	for recordId, found := range selected {
+		if !found {
+			return pan.KindCodeMsg(pan.ErrNotFound, CodeObjectNotExist, "trash record "+recordId+" not found")
+		}
+	}
+	return nil
+}
+
+func (l *Local) UploadPath(req pan.UploadPathReq) (*pan.TransferResult, error) {
+	return l.UploadPathCtx(l.Context(), req)
+}
+
+func (l *Local) UploadPathCtx(ctx context.Context, req pan.UploadPathReq) (*pan.TransferResult, error) {
+	ctx, cancel := l.JoinContext(ctx)
+	defer cancel()
+	if err := checkCtx(ctx); err != nil {
+		return nil, err
+	}
+	if req.OnlyFast {
+		return nil, pan.KindMsg(pan.ErrUnsupported, "local is not support fast upload")
+	}
+	err := l.BaseUploadPath(req, pan.WithCtx(ctx, l.UploadFileCtx))
+	return nil, err
+}
+
+func (l *Local) UploadFile(req pan.UploadFileReq) (*pan.TransferResult, error) {
+	return l.UploadFileCtx(req.Ctx, req)
+}
+
+func (l *Local) UploadFileCtx(ctx context.Context, req pan.UploadFileReq) (*pan.TransferResult, error) {
+	ctx, cancel := l.JoinContext(ctx)
+	defer cancel()
+	if err := checkCtx(ctx); err != nil {
+		return nil, err
+	}
+	content, err := pan.FileContent(req.LocalFile)
+	if err != nil {
+		return nil, err
+	}
+	return l.upload(ctx, req, content)
+}
+
+func (l *Local) UploadStream(req pan.UploadStreamReq) (*pan.TransferResult, error) {
+	return l.UploadStreamCtx(l.Context(), req)
+}
+
+func (l *Local) UploadStreamCtx(ctx context.Context, req pan.UploadStreamReq) (*pan.TransferResult, error) {
+	ctx, cancel := l.JoinContext(ctx)
+	defer cancel()
+	if err := checkCtx(ctx); err != nil {
+		return nil, err
+	}
+	if req.Reader == nil || req.Name == "" {
+		return nil, pan.OnlyMsg("upload stream without reader or name")
+	}
+	// 直接写入目标文件，无需知道大小
+	return l.upload(ctx, pan.UploadFileReq{
+		RemotePath:       req.RemotePath,
+		OnlyFast:         req.OnlyFast,
+		TaskId:           req.TaskId,
+		ProgressCallback: req.ProgressCallback,
+	}, &pan.UploadContent{Name: req.Name, Size: req.Size, Reader: req.Reader})
+}
+
+// upload 上传本地文件或数据流
+func (l *Local) upload(ctx context.Context, req pan.UploadFileReq, content *pan.UploadContent) (*pan.TransferResult, error) {
+	if req.OnlyFast {
+		return nil, pan.KindMsg(pan.ErrUnsupported, "local is not support fast upload")
+	}
+	if req.Resumable {
+		internal.GetLogger().Warn("local is not support resumeable")
+	}
+	remoteName := content.Name
+	remotePath := strings.TrimRight(req.RemotePath, "/")
+	if req.RemotePathTransfer != nil {
+		remotePath = req.RemotePathTransfer(remotePath)
+	}
+	if req.RemoteNameTransfer != nil {
+		remoteName = req.RemoteNameTransfer(remoteName)
+	}
+	remoteAllPath := remotePath + "/" + remoteName
+	if _, err := os.Lstat(l.absPath(remoteAllPath)); err == nil {
+		return nil, pan.KindCodeMsg(pan.ErrAlreadyExists, CodeObjectExist, remoteAllPath+" is exist")
+	}
+	dir, err := l.MkdirCtx(ctx, pan.MkdirReq{
+		NewPath: remotePath,
+	})
+	if err != nil {
+		return nil, pan.MsgError(remotePath+" create error", err)
+	}
+	rel := path.Join(relPath(dir), remoteName)
+	result := &pan.TransferResult{TaskId: objId(rel)}
+
+	pw := pan.NewProgressWriter(content.Source(), content.Size, req.ProgressCallback)
+	if req.TaskId != "" {
+		pw.SetTaskId(req.TaskId)
+	}
+	pw.SetFileId(result.TaskId)
+	if content.LocalFile != "" {
+		err = copyFile(ctx, content.LocalFile, l.absPath(rel), pw)
+	} else {
+		err = writeFile(ctx, content.Reader, l.absPath(rel), 0644, pw)
+	}
+	if err != nil {
+		return result, osError(err)
+	}
+	l.Del(cacheDirectoryPrefix + dir.Id)
+	internal.GetLogger().Info("upload success", "file", content.Source(), "fid", result.TaskId)
+	if req.SuccessDel {
+		err = os.Remove(req.LocalFile)
+		if err != nil {
+			internal.GetLogger().Error("delete fail", "file", req.LocalFile, "error", err)
+		} else {
+			internal.GetLogger().Info("delete success", "file", req.LocalFile)
+		}
+	}
+	return result, nil
+}
+
+func (l *Local) DownloadPath(req pan.DownloadPathReq) (*pan.TransferResult, error) {
+	return l.DownloadPathCtx(l.Context(), req)
+}
+
+func (l *Local) DownloadPathCtx(ctx context.Context, req pan.DownloadPathReq) (*pan.TransferResult, error) {
+	ctx, cancel := l.JoinContext(ctx)
+	defer cancel()
+	if err := checkCtx(ctx); err != nil {
+		return nil, err
+	}
+	err := l.BaseDownloadPath(ctx, req, pan.WithCtx(ctx, l.ListCtx), pan.WithCtx(ctx, l.DownloadFileCtx))
+	return nil, err
+}
+
+func (l *Local) DownloadFile(req pan.DownloadFileReq) (*pan.TransferResult, error) {
+	return l.DownloadFileCtx(req.Ctx, req)
+}
+
+func (l *Local) DownloadFileCtx(ctx context.Context, req pan.DownloadFileReq) (*pan.TransferResult, error) {
+	ctx, cancel := l.JoinContext(ctx)
+	defer cancel()
+	if err := checkCtx(ctx); err != nil {
+		return nil, err
+	}
+	object := req.RemoteFile
+	if object.Type != "file" {
+		return nil, pan.OnlyMsg("only support download file")
+	}
+	rel := relPath(object)
+	internal.GetLogger().Info("start download file", "file", rel)
+	outputFile := req.LocalPath + "/" + object.Name
+	fileInfo, err := internal.IsExistFile(outputFile)
+	if fileInfo != nil && err == nil && fileInfo.Size() == object.Size {
+		if !req.OverCover {
+			if req.DownloadCallback != nil {
+				abs, _ := filepath.Abs(outputFile)
+				req.DownloadCallback("", "", filepath.Dir(abs), abs)
+			}
+			internal.GetLogger().Info("end download file", "file", rel, "output", outputFile)
+			return nil, nil
+		}
+		_ = os.Remove(outputFile)
+	}
+	info, e := l.stat(rel)
+	if e != nil {
+		return nil, e
+	}
+	if err = os.MkdirAll(req.LocalPath, os.ModePerm); err != nil {
+		return nil, osError(err)
+	}
+	pw := pan.NewProgressWriter(outputFile, info.Size(), req.ProgressCallback)
+	if req.TaskId != "" {
+		pw.SetTaskId(req.TaskId)
+	}
+	pw.SetFileId(object.Id)
+	if err = copyFile(ctx, l.absPath(rel), outputFile, pw); err != nil {
+		internal.GetLogger().Error("error download file", "file", rel, "error", err)
+		return nil, osError(err)
+	}
+	internal.GetLogger().Info("end download file", "file", rel, "output", outputFile)
+	if req.DownloadCallback != nil {
+		abs, _ := filepath.Abs(outputFile)
+		req.DownloadCallback("", "", filepath.Dir(abs), abs)
+	}
+	return nil, nil
+}
+
+func (l *Local) OfflineDownload(req pan.OfflineDownloadReq) (*pan.Task, error) {
+	return l.OfflineDownloadCtx(l.Context(), req)
+}
+
+func (l *Local) OfflineDownloadCtx(ctx context.Context, req pan.OfflineDownloadReq) (*pan.Task, error) {
+	return nil, pan.KindMsg(pan.ErrUnsupported, "offline download not support")
+}
+
+func (l *Local) TaskList(req pan.TaskListReq) ([]*pan.Task, error) {
+	return l.TaskListCtx(l.Context(), req)
+}
+
+func (l *Local) TaskListCtx(ctx context.Context, req pan.TaskListReq) ([]*pan.Task, error) {
+	return nil, pan.KindMsg(pan.ErrUnsupported, "task list not support")
+}
+
+func (l *Local) DirectLink(req pan.DirectLinkReq) ([]*pan.DirectLink, error) {
+	return l.DirectLinkCtx(l.Context(), req)
+}
+
+func (l *Local) DirectLinkCtx(ctx context.Context, req pan.DirectLinkReq) ([]*pan.DirectLink, error) {
+	ctx, cancel := l.JoinContext(ctx)
+	defer cancel()
+	if err := checkCtx(ctx); err != nil {
+		return nil, err
+	}
+	for _, link := range req.List {
+		rel := relPath(&pan.PanObj{Id: link.FileId})
+		if _, err := l.stat(rel); err != nil {
+			return nil, err
+		}
+		link.Link = (&url.URL{Scheme: "file", Path: filepath.ToSlash(l.absPath(rel))}).String()
+	}
+	return req.List, nil
+}
+
+func (l *Local) DownloadLinkCtx(ctx context.Context, file *pan.PanObj) (*pan.DownloadLink, error) {
+	ctx, cancel := l.JoinContext(ctx)
+	defer cancel()
+	if err := checkCtx(ctx); err != nil {
+		return nil, err
+	}
+	rel := relPath(file)
+	info, err := l.stat(rel)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return nil, pan.OnlyMsg("only support download file")
+	}
+	return &pan.DownloadLink{Url: (&url.URL{Scheme: "file", Path: filepath.ToSlash(l.absPath(rel))}).String()}, nil
+}
+
+func (l *Local) Open(ctx context.Context, file *pan.PanObj) (io.ReadSeekCloser, error) {
+	ctx, cancel := l.JoinContext(ctx)
+	defer cancel()
+	if err := checkCtx(ctx); err != nil {
+		return nil, err
+	}
+	rel := relPath(file)
+	info, err := l.stat(rel)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return nil, pan.OnlyMsg("only support open file")
+	}
+	f, e := os.Open(l.absPath(rel))
+	if e != nil {
+		return nil, osError(e)
+	}
+	return f, nil
+}
+
+func (l *Local) ShareList(req pan.ShareListReq) ([]*pan.ShareData, error) {
+	return l.ShareListCtx(l.Context(), req)
+}
+
+func (l *Local) ShareListCtx(ctx context.Context, req pan.ShareListReq) ([]*pan.ShareData, error) {
+	ctx, cancel := l.JoinContext(ctx)
+	defer cancel()
+	if err := checkCtx(ctx); err != nil {
+		return nil, err
+	}
+	l.shareMu.Lock()
+	defer l.shareMu.Unlock()
+	data, err := l.loadShares()
+	if err != nil {
+		return nil, osError(err)
+	}
+	needFilter := len(req.ShareIds) > 0
+	result := make([]*pan.ShareData, 0)
+	for _, share := range data.Shares {
+		if needFilter {
+			exist := false
+			for _, shareId := range req.ShareIds {
+				if shareId == share.ShareId {
+					exist = true
+					break
+				}
+			}
+			if !exist {
+				continue
+			}
+		}
+		result = append(result, l.toShareData(share))
+	}
+	return result, nil
+}
+
+func (l *Local) NewShare(req pan.NewShareReq) (*pan.ShareData, error) {
+	return l.NewShareCtx(l.Context(), req)
+}
+
+func (l *Local) NewShareCtx(ctx context.Context, req pan.NewShareReq) (*pan.ShareData, error) {
+	ctx, cancel := l.JoinContext(ctx)
+	defer cancel()
+	if err := checkCtx(ctx); err != nil {
+		return nil, err
+	}
+	if len(req.Fids) == 0 {
+		return nil, pan.OnlyMsg("fids must not empty")
+	}
+	for _, fid := range req.Fids {
+		if _, err := l.stat(relPath(&pan.PanObj{Id: fid})); err != nil {
+			return nil, err
+		}
+	}
+	share := &ShareRecord{
+		ShareId:   strings.ReplaceAll(uuid.NewString(), "-", "")[:16],
+		Title:     req.Title,
+		Fids:      req.Fids,
+		CreatedAt: time.Now(),
+	}
+	if req.NeedPassCode {
+		share.PassCode = internal.GenRandomWord()
+	}
+	// 与 thunder 一致：-1 或 0 不限，n 表示 n 天
+	if req.ExpiredType > 0 {
+		share.ExpiredAt = share.CreatedAt.Add(time.Duration(req.ExpiredType) * 24 * time.Hour)
+	}
+	l.shareMu.Lock()
+	defer l.shareMu.Unlock()
+	data, err := l.loadShares()
+	if err != nil {
+		return nil, osError(err)
+	}
+	data.Shares = append(data.Shares, share)
+	if err = l.saveShares(data); err != nil {
+		return nil, osError(err)
+	}
+	return l.toShareData(share), nil
+}
+
+func (l *Local) DeleteShare(req pan.DelShareReq) error {
+	return l.DeleteShareCtx(l.Context(), req)
+}
+
+func (l *Local) DeleteShareCtx(ctx context.Context, req pan.DelShareReq) error {
+	ctx, cancel := l.JoinContext(ctx)
+	defer cancel()
+	if err := checkCtx(ctx); err != nil {
+		return err
+	}
+	l.shareMu.Lock()
+	defer l.shareMu.Unlock()
+	data, err := l.loadShares()
+	if err != nil {
+		return osError(err)
+	}
+	remain := make([]*ShareRecord, 0, len(data.Shares))
+	for _, share := range data.Shares {
+		deleted := false
+		for _, shareId := range req.ShareIds {
+			if shareId == share.ShareId {
+				deleted = true
+				break
+			}
+		}
+		if !deleted {
+			remain = append(remain, share)
+		}
+	}
+	data.Shares = remain
+	if err = l.saveShares(data); err != nil {
+		return osError(err)
+	}
+	return nil
+}
+
+func (l *Local) ShareRestore(req pan.ShareRestoreReq) error {
+	return l.ShareRestoreCtx(l.Context(), req)
+}
+
+func (l *Local) ShareRestoreCtx(ctx context.Context, req pan.ShareRestoreReq) error {
+	ctx, cancel := l.JoinContext(ctx)
+	defer cancel()
+	if err := checkCtx(ctx); err != nil {
+		return err
+	}
+	passCode := req.PassCode
+	shareId := req.ShareId
+	if shareId == "" {
+		if req.ShareUrl == "" {
+			return pan.OnlyMsg("share url is null")
+		}
+		parsedURL, err := url.Parse(req.ShareUrl)
+		if err != nil {
+			return err
+		}
+		shareId = strings.TrimPrefix(parsedURL.Path, "/s/")
+		if passCode == "" {
+			passCode = parsedURL.Query().Get("pwd")
+		}
+	}
+	l.shareMu.Lock()
+	data, err := l.loadShares()
+	l.shareMu.Unlock()
+	if err != nil {
+		return osError(err)
+	}
+	var share *ShareRecord
+	for _, s := range data.Shares {
+		if s.ShareId == shareId {
+			share = s
+			break
+		}
+	}
+	if share == nil {
+		return pan.KindCodeMsg(pan.ErrNotFound, CodeObjectNotExist, "share "+shareId+" not found")
+	}
+	if share.expired() {
+		return pan.OnlyMsg("share " + shareId + " is expired")
+	}
+	if share.PassCode != "" && share.PassCode != passCode {
+		return pan.OnlyMsg("share " + shareId + " pass code error")
+	}
+	targetDir, err := l.MkdirCtx(ctx, pan.MkdirReq{
+		NewPath: req.TargetDir,
+	})
+	if err != nil {
+		return err
+	}
+	targetRel := relPath(targetDir)
+	for _, fid := range share.Fids {
+		src := relPath(&pan.PanObj{Id: fid})
+		dst := path.Join(targetRel, path.Base(src))
+		if _, err = os.Lstat(l.absPath(dst)); err == nil {
+			return pan.KindCodeMsg(pan.ErrAlreadyExists, CodeObjectExist, dst+" is exist")
+		}
+		if err = copyTree(ctx, l.absPath(src), l.absPath(dst)); err != nil {
+			return osError(err)
+		}
+	}
+	l.Del(cacheDirectoryPrefix + targetDir.Id)
+	return nil
+}
+
+func (l *Local) toShareData(share *ShareRecord) *pan.ShareData {
+	shareUrl := url.URL{
+		Scheme: shareUrlScheme,
+		Host:   l.GetId(),
+		Path:   "/s/" + share.ShareId,
+	}
+	if share.PassCode != "" {
+		shareUrl.RawQuery = url.Values{"pwd": []string{share.PassCode}}.Encode()
+	}
+	return &pan.ShareData{
+		ShareId:  share.ShareId,
+		ShareUrl: shareUrl.String(),
+		PassCode: share.PassCode,
+		Title:    share.Title,
+		Ext: pan.Json{
+			"fids":      share.Fids,
+			"createdAt": strconv.FormatInt(share.CreatedAt.UnixMilli(), 10),
+		},
+	}
+}
+
+func init() {
+	pan.RegisterDriver(pan.Local, func() pan.Driver {
+		return &Local{
+			PropertiesOperate: pan.PropertiesOperate[*LocalProperties]{
+				DriverType: pan.Local,
+			},
+			CacheOperate:  pan.NewCacheOperate(),
+			CommonOperate: pan.CommonOperate{},
+		}
+	})
+}
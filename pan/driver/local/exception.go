@@ -0,0 +1,37 @@
+package local
+
+import (
+	"errors"
+	"io/fs"
+	"syscall"
+
+	"github.com/hefeiyu25/pan-client/pan"
+)
+
+// 定义异常编码和异常信息
+const (
+	// CodeObjectExist 对象已存在
+	CodeObjectExist = 40004
+	// CodeObjectNotExist 对象不存在
+	CodeObjectNotExist = 40404
+)
+
+// osError 将文件系统错误映射为 pan 的错误类型，保留原始错误供 errors.Is 判断
+func osError(err error) pan.DriverErrorInterface {
+	var kind error
+	switch {
+	case errors.Is(err, fs.ErrNotExist), errors.Is(err, syscall.ENOTDIR):
+		kind = pan.ErrNotFound
+	case errors.Is(err, fs.ErrExist):
+		kind = pan.ErrAlreadyExists
+	case errors.Is(err, syscall.ENOSPC):
+		kind = pan.ErrQuotaExceeded
+	default:
+		return pan.OnlyError(err)
+	}
+	return &pan.DriverError{
+		Code: pan.UNKNOWN,
+		Err:  err,
+		Kind: kind,
+	}
+}
@@ -0,0 +1,285 @@
+package local
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hefeiyu25/pan-client/pan"
+)
+
+// relPath 返回对象相对于根目录的 slash 路径，根目录为 "/"
+func relPath(obj *pan.PanObj) string {
+	if obj == nil || obj.Id == "0" {
+		return "/"
+	}
+	if obj.Id != "" {
+		return path.Clean("/" + obj.Id)
+	}
+	return path.Clean("/" + strings.Trim(obj.Path, "/") + "/" + obj.Name)
+}
+
+// objId 根据相对路径生成对象 ID，根目录固定为 "0"
+func objId(rel string) string {
+	rel = path.Clean("/" + rel)
+	if rel == "/" {
+		return "0"
+	}
+	return rel
+}
+
+// absPath 将相对路径转换为磁盘上的绝对路径
+func (l *Local) absPath(rel string) string {
+	return filepath.Join(l.Properties.RootPath, filepath.FromSlash(path.Clean("/"+rel)))
+}
+
+func (l *Local) toPanObj(rel string, info fs.FileInfo, parent *pan.PanObj) *pan.PanObj {
+	rel = path.Clean("/" + rel)
+	fileType := "file"
+	var size int64
+	if info.IsDir() {
+		fileType = "dir"
+	} else {
+		size = info.Size()
+	}
+	name := path.Base(rel)
+	if rel == "/" {
+		name = ""
+	}
+	obj := &pan.PanObj{
+		Id:      objId(rel),
+		Name:    name,
+		Path:    path.Dir(rel),
+		Size:    size,
+		Type:    fileType,
+		ModTime: info.ModTime(),
+		Parent:  parent,
+	}
+	if !info.IsDir() {
+		obj.MimeType = mime.TypeByExtension(path.Ext(rel))
+	}
+	return obj
+}
+
+// readDir 读取目录内容，忽略 sidecar 文件
+func (l *Local) readDir(rel string) ([]fs.FileInfo, error) {
+	entries, err := os.ReadDir(l.absPath(rel))
+	if err != nil {
+		return nil, err
+	}
+	infos := make([]fs.FileInfo, 0, len(entries))
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), sidecarPrefix) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Name() < infos[j].Name()
+	})
+	return infos, nil
+}
+
+// stat 获取对象信息，不存在时返回 CodeObjectNotExist
+func (l *Local) stat(rel string) (fs.FileInfo, pan.DriverErrorInterface) {
+	info, err := os.Stat(l.absPath(rel))
+	if err != nil {
+		e := osError(err)
+		if errors.Is(e, pan.ErrNotFound) {
+			return nil, pan.KindCodeMsg(pan.ErrNotFound, CodeObjectNotExist, rel+" not found")
+		}
+		return nil, e
+	}
+	return info, nil
+}
+
+// checkCtx 在执行文件系统操作前检查 context 是否已取消
+func checkCtx(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return osError(err)
+	}
+	return nil
+}
+
+// ctxReader 在每次读取前检查 context 是否已取消
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (c *ctxReader) Read(p []byte) (int, error) {
+	if c.ctx != nil {
+		if err := c.ctx.Err(); err != nil {
+			return 0, err
+		}
+	}
+	return c.r.Read(p)
+}
+
+// copyFile 复制单个文件，progress 可为 nil
+func copyFile(ctx context.Context, src, dst string, progress io.Writer) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	if err = writeFile(ctx, in, dst, info.Mode().Perm(), progress); err != nil {
+		return err
+	}
+	return os.Chtimes(dst, info.ModTime(), info.ModTime())
+}
+
+// writeFile 把 r 的内容写入 dst，失败时删除已写入的部分
+func writeFile(ctx context.Context, r io.Reader, dst string, perm os.FileMode, progress io.Writer) error {
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	var reader io.Reader = &ctxReader{ctx: ctx, r: r}
+	if progress != nil {
+		reader = io.TeeReader(reader, progress)
+	}
+	_, err = io.Copy(out, reader)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(dst)
+		return err
+	}
+	return nil
+}
+
+// copyTree 递归复制文件或目录
+func copyTree(ctx context.Context, src, dst string) error {
+	info, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return copyFile(ctx, src, dst, nil)
+	}
+	if err = os.MkdirAll(dst, os.ModePerm); err != nil {
+		return err
+	}
+	entries, err := os.ReadDir(src)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), sidecarPrefix) {
+			continue
+		}
+		err = copyTree(ctx, filepath.Join(src, entry.Name()), filepath.Join(dst, entry.Name()))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadShares 读取分享记录，调用方需持有 shareMu
+func (l *Local) loadShares() (*shareFile, error) {
+	data := &shareFile{Shares: make([]*ShareRecord, 0)}
+	content, err := os.ReadFile(filepath.Join(l.Properties.RootPath, shareFileName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return data, nil
+		}
+		return nil, err
+	}
+	if err = json.Unmarshal(content, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// saveShares 原子写入分享记录，调用方需持有 shareMu
+func (l *Local) saveShares(data *shareFile) error {
+	content, err := json.MarshalIndent(data, "", "  ")
+	if err != nil {
+		return err
+	}
+	target := filepath.Join(l.Properties.RootPath, shareFileName)
+	tmp := target + ".tmp"
+	if err = os.WriteFile(tmp, content, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, target)
+}
+
+// loadTrash 读取回收站记录，调用方需持有 trashMu
+func (l *Local) loadTrash() (*trashFile, error) {
+	data := &trashFile{Records: make([]*TrashRecord, 0)}
+	content, err := os.ReadFile(filepath.Join(l.Properties.RootPath, trashFileName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return data, nil
+		}
+		return nil, err
+	}
+	if err = json.Unmarshal(content, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// saveTrash 原子写入回收站记录，调用方需持有 trashMu
+func (l *Local) saveTrash(data *trashFile) error {
+	content, err := json.MarshalIndent(data, "", "  ")
+	if err != nil {
+		return err
+	}
+	target := filepath.Join(l.Properties.RootPath, trashFileName)
+	tmp := target + ".tmp"
+	if err = os.WriteFile(tmp, content, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, target)
+}
+
+// trashPath 回收站记录对应内容在磁盘上的绝对路径
+func (l *Local) trashPath(recordId string) string {
+	return filepath.Join(l.Properties.RootPath, trashDirName, recordId)
+}
+
+// moveToTrash 将对象移入回收站，调用方需持有 trashMu
+func (l *Local) moveToTrash(data *trashFile, rel string, info fs.FileInfo) error {
+	if err := os.MkdirAll(filepath.Join(l.Properties.RootPath, trashDirName), os.ModePerm); err != nil {
+		return err
+	}
+	record := &TrashRecord{
+		RecordId:  strings.ReplaceAll(uuid.NewString(), "-", "")[:16],
+		Path:      rel,
+		Type:      "file",
+		DeletedAt: time.Now(),
+	}
+	if info.IsDir() {
+		record.Type = "dir"
+	} else {
+		record.Size = info.Size()
+	}
+	if err := os.Rename(l.absPath(rel), l.trashPath(record.RecordId)); err != nil {
+		return err
+	}
+	data.Records = append(data.Records, record)
+	return nil
+}
@@ -0,0 +1,37 @@
+package local
+
+import (
+	"time"
+)
+
+// ShareRecord 本地分享记录，持久化在根目录的 sidecar 文件中
+type ShareRecord struct {
+	ShareId   string    `json:"share_id"`
+	Title     string    `json:"title"`
+	PassCode  string    `json:"pass_code,omitempty"`
+	Fids      []string  `json:"fids"`
+	CreatedAt time.Time `json:"created_at"`
+	// ExpiredAt 为零值表示永不过期
+	ExpiredAt time.Time `json:"expired_at,omitempty"`
+}
+
+func (s *ShareRecord) expired() bool {
+	return !s.ExpiredAt.IsZero() && time.Now().After(s.ExpiredAt)
+}
+
+type shareFile struct {
+	Shares []*ShareRecord `json:"shares"`
+}
+
+// TrashRecord 回收站记录，持久化在根目录的 sidecar 文件中
+type TrashRecord struct {
+	RecordId  string    `json:"record_id"`
+	Path      string    `json:"path"` // 删除前的相对路径
+	Type      string    `json:"type"`
+	Size      int64     `json:"size"`
+	DeletedAt time.Time `json:"deleted_at"`
+}
+
+type trashFile struct {
+	Records []*TrashRecord `json:"records"`
+}
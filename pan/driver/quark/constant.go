@@ -2,6 +2,12 @@ package quark
 
 const (
 	cacheDirectoryPrefix = "directory_"
+	// filePageSize 文件列表每页条数
+	filePageSize = 100
+)
+
+const (
+	DefaultApiUrl = "https://drive.quark.cn/1/clouddrive"
 )
 
 const (
@@ -1,11 +1,18 @@
 package quark
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"iter"
 	"net/http/cookiejar"
 	"net/url"
 	"os"
+	"path"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
@@ -30,6 +37,10 @@ type QuarkProperties struct {
 	CookieFile  string `mapstructure:"cookie_file" json:"cookie_file" yaml:"cookie_file"` // cookies.txt 文件路径（Netscape 格式）
 	RefreshTime int64  `mapstructure:"refresh_time" json:"refresh_time" yaml:"refresh_time" default:"0"`
 	ChunkSize   int64  `mapstructure:"chunk_size" json:"chunk_size" yaml:"chunk_size" default:"314572800"` // 300M
+	// ApiUrl 接口地址，为空时使用 DefaultApiUrl，可指向反向代理或测试用的 fake 服务
+	ApiUrl string `mapstructure:"api_url" json:"api_url" yaml:"api_url"`
+	// UploadUrl 分片上传地址，为空时使用 upload/pre 返回的 OSS 地址
+	UploadUrl string `mapstructure:"upload_url" json:"upload_url" yaml:"upload_url"`
 }
 
 func (cp *QuarkProperties) OnlyImportProperties() {
@@ -89,7 +100,7 @@ func (q *Quark) Init() (string, error) {
 		SetCommonQueryParam("pr", "ucpro").
 		SetCommonQueryParam("fr", "pc").
 		SetCookieJar(jar).
-		SetTimeout(30 * time.Minute).SetBaseURL("https://drive.quark.cn/1/clouddrive")
+		SetTimeout(30 * time.Minute).SetBaseURL(q.apiUrl())
 	q.defaultClient = req.C().SetTimeout(30 * time.Minute)
 	// 应用代理配置
 	if q.ProxyConfig.ProxyURL != "" {
@@ -98,7 +109,7 @@ func (q *Quark) Init() (string, error) {
 	}
 	// 若一小时内更新过，则不重新刷session
 	if q.Properties.RefreshTime == 0 || time.Now().UnixMilli()-q.Properties.RefreshTime > 60*60*1000 {
-		_, err = q.config()
+		_, err = q.config(q.Context())
 		if err != nil {
 			return driverId, err
 		} else {
@@ -115,8 +126,24 @@ func (q *Quark) Close() error {
 	return nil
 }
 
+func (q *Quark) Capabilities() pan.Capabilities {
+	return pan.Capabilities{
+		Share:           true,
+		ShareRestore:    true,
+		FastUpload:      true,
+		ResumableUpload: true,
+		Trash:           true,
+	}
+}
+
 func (q *Quark) Disk() (*pan.DiskResp, error) {
-	memberResp, err := q.member()
+	return q.DiskCtx(q.Context())
+}
+
+func (q *Quark) DiskCtx(ctx context.Context) (*pan.DiskResp, error) {
+	ctx, cancel := q.JoinContext(ctx)
+	defer cancel()
+	memberResp, err := q.member(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -127,12 +154,18 @@ func (q *Quark) Disk() (*pan.DiskResp, error) {
 	}, nil
 }
 func (q *Quark) List(req pan.ListReq) ([]*pan.PanObj, error) {
+	return q.ListCtx(q.Context(), req)
+}
+
+func (q *Quark) ListCtx(ctx context.Context, req pan.ListReq) ([]*pan.PanObj, error) {
+	ctx, cancel := q.JoinContext(ctx)
+	defer cancel()
 	queryDir := req.Dir
 	if queryDir.Path == "/" && queryDir.Name == "" {
 		queryDir.Id = "0"
 	}
 	if queryDir.Id == "" {
-		obj, err := q.GetPanObj(strings.TrimRight(queryDir.Path, "/")+"/"+queryDir.Name, true, q.List)
+		obj, err := q.GetPanObj(strings.TrimRight(queryDir.Path, "/")+"/"+queryDir.Name, true, pan.WithCtx(ctx, q.ListCtx))
 		if err != nil {
 			return nil, err
 		}
@@ -143,29 +176,18 @@ func (q *Quark) List(req pan.ListReq) ([]*pan.PanObj, error) {
 		q.Del(cacheKey)
 	}
 	result, err := q.GetOrLoad(cacheKey, func() (interface{}, error) {
-		files, e := q.fileSort(queryDir.Id)
+		files, e := q.fileSort(ctx, queryDir.Id)
 		if e != nil {
 			internal.GetLogger().Error("file sort error", "error", e)
 			return nil, e
 		}
+		dirPath := strings.TrimRight(queryDir.Path, "/") + "/" + queryDir.Name
+		if queryDir.Id == "0" {
+			dirPath = "/"
+		}
 		panObjs := make([]*pan.PanObj, 0)
 		for _, item := range files {
-			fileType := "file"
-			if item.FileType == 0 {
-				fileType = "dir"
-			}
-			path := strings.TrimRight(queryDir.Path, "/") + "/" + queryDir.Name
-			if queryDir.Id == "0" {
-				path = "/"
-			}
-			panObjs = append(panObjs, &pan.PanObj{
-				Id:     item.Fid,
-				Name:   item.FileName,
-				Path:   path,
-				Size:   int64(item.Size),
-				Type:   fileType,
-				Parent: req.Dir,
-			})
+			panObjs = append(panObjs, toPanObj(item, dirPath, queryDir))
 		}
 		return panObjs, nil
 	})
@@ -173,24 +195,187 @@ func (q *Quark) List(req pan.ListReq) ([]*pan.PanObj, error) {
 		return make([]*pan.PanObj, 0), err
 	}
 	if objs, ok := result.([]*pan.PanObj); ok {
-		return objs, nil
+		return req.Apply(objs)
 	}
 	return make([]*pan.PanObj, 0), nil
 }
+
+func (q *Quark) ListIter(ctx context.Context, dir *pan.PanObj) iter.Seq2[*pan.PanObj, error] {
+	return func(yield func(*pan.PanObj, error) bool) {
+		ctx, cancel := q.JoinContext(ctx)
+		defer cancel()
+		queryDir, err := q.ResolveDir(dir, pan.WithCtx(ctx, q.ListCtx))
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+		dirPath := path.Join(queryDir.Path, queryDir.Name)
+		cached, _ := q.Get(cacheDirectoryPrefix + queryDir.Id)
+		pan.PageIter(ctx, cached, func(ctx context.Context, token string) ([]*pan.PanObj, string, error) {
+			page := 1
+			if token != "" {
+				page, _ = strconv.Atoi(token)
+			}
+			files, more, e := q.filePage(ctx, "/file/sort", map[string]string{"pdir_fid": queryDir.Id}, page)
+			if e != nil {
+				return nil, "", e
+			}
+			objs := make([]*pan.PanObj, 0, len(files))
+			for _, item := range files {
+				objs = append(objs, toPanObj(item, dirPath, queryDir))
+			}
+			if !more {
+				return objs, "", nil
+			}
+			return objs, strconv.Itoa(page + 1), nil
+		})(yield)
+	}
+}
+
+// toPanObj 转换夸克文件信息，dirPath 为父目录路径
+func toPanObj(item File, dirPath string, parent *pan.PanObj) *pan.PanObj {
+	fileType := "file"
+	if item.FileType == 0 {
+		fileType = "dir"
+	}
+	return &pan.PanObj{
+		Id:           item.Fid,
+		Name:         item.FileName,
+		Path:         dirPath,
+		Size:         int64(item.Size),
+		Type:         fileType,
+		ModTime:      time.UnixMilli(item.UpdatedAt),
+		CreatedTime:  time.UnixMilli(item.CreatedAt),
+		MimeType:     item.FormatType,
+		ThumbnailURL: item.Thumbnail,
+		Parent:       parent,
+	}
+}
+
+func (q *Quark) Stat(req pan.StatReq) (*pan.PanObj, error) {
+	return q.StatCtx(q.Context(), req)
+}
+
+func (q *Quark) StatCtx(ctx context.Context, req pan.StatReq) (*pan.PanObj, error) {
+	ctx, cancel := q.JoinContext(ctx)
+	defer cancel()
+	obj, err := q.stat(ctx, req)
+	if err == nil || errors.Is(err, pan.ErrNotFound) || ctx.Err() != nil {
+		return obj, err
+	}
+	// 查询接口不可用时退回逐级列出父目录
+	internal.GetLogger().Warn("quark stat fail, fall back to list", "path", req.Path, "id", req.Id, "error", err)
+	return q.BaseStat(req, pan.WithCtx(ctx, q.ListCtx))
+}
+
+// stat 按路径查询 fid，再按 fid 查询对象，不需要列出父目录
+func (q *Quark) stat(ctx context.Context, req pan.StatReq) (*pan.PanObj, error) {
+	target := ""
+	if req.Path != "" {
+		target = path.Clean("/" + strings.Trim(req.Path, "/"))
+	}
+	fid := req.Id
+	if fid == "" {
+		if target == "" {
+			return nil, pan.KindMsg(pan.ErrUnsupported, "not support stat without path or id")
+		}
+		if target == "/" {
+			return &pan.PanObj{Id: "0", Name: "", Path: "/", Size: 0, Type: "dir"}, nil
+		}
+		paths, e := q.fileInfoPathList(ctx, []string{target})
+		if e != nil {
+			return nil, e
+		}
+		for _, item := range paths {
+			if path.Clean("/"+strings.Trim(item.FilePath, "/")) == target {
+				fid = item.Fid
+			}
+		}
+		if fid == "" {
+			return nil, pan.KindMsg(pan.ErrNotFound, target+" not found")
+		}
+	}
+	if fid == "0" {
+		return &pan.PanObj{Id: "0", Name: "", Path: "/", Size: 0, Type: "dir"}, nil
+	}
+	file, e := q.fileInfo(ctx, fid)
+	if e != nil {
+		return nil, e
+	}
+	dirPath := path.Dir(target)
+	if target == "" {
+		if dirPath, e = q.dirFullPath(ctx, file.PdirFid); e != nil {
+			return nil, e
+		}
+	}
+	return toPanObj(*file, dirPath, nil), nil
+}
+
+func (q *Quark) Search(req pan.SearchReq) ([]*pan.PanObj, error) {
+	return q.SearchCtx(q.Context(), req)
+}
+
+func (q *Quark) SearchCtx(ctx context.Context, req pan.SearchReq) ([]*pan.PanObj, error) {
+	ctx, cancel := q.JoinContext(ctx)
+	defer cancel()
+	list := pan.WithCtx(ctx, q.ListCtx)
+	// 搜索接口必须带关键字，否则只能遍历
+	if req.Keyword == "" {
+		return q.BaseSearch(req, list)
+	}
+	root, err := q.SearchRoot(req, list)
+	if err != nil {
+		return nil, err
+	}
+	req.Root = root
+	files, e := q.fileSearch(ctx, req.Keyword)
+	if e != nil {
+		return nil, e
+	}
+	parents := map[string]*pan.PanObj{"0": {Id: "0", Name: "", Path: "/", Type: "dir"}}
+	result := make([]*pan.PanObj, 0)
+	for _, item := range files {
+		parent, ok := parents[item.PdirFid]
+		if !ok {
+			dirPath, e := q.dirFullPath(ctx, item.PdirFid)
+			if e != nil {
+				// 父目录已被删除的搜索结果直接忽略
+				if errors.Is(e, pan.ErrNotFound) {
+					continue
+				}
+				return nil, e
+			}
+			parent = &pan.PanObj{Id: item.PdirFid, Name: path.Base(dirPath), Path: path.Dir(dirPath), Type: "dir"}
+			parents[item.PdirFid] = parent
+		}
+		obj := toPanObj(item, path.Join(parent.Path, parent.Name), parent)
+		if req.Match(obj) {
+			result = append(result, obj)
+		}
+	}
+	return result, nil
+}
+
 func (q *Quark) ObjRename(req pan.ObjRenameReq) error {
+	return q.ObjRenameCtx(q.Context(), req)
+}
+
+func (q *Quark) ObjRenameCtx(ctx context.Context, req pan.ObjRenameReq) error {
+	ctx, cancel := q.JoinContext(ctx)
+	defer cancel()
 	if req.Obj.Id == "0" || (req.Obj.Path == "/" && req.Obj.Name == "") {
-		return pan.OnlyMsg("not support rename root path")
+		return pan.KindMsg(pan.ErrUnsupported, "not support rename root path")
 	}
 	object := req.Obj
 	if object.Id == "" {
 		path := strings.Trim(req.Obj.Path, "/") + "/" + req.Obj.Name
-		obj, err := q.GetPanObj(path, true, q.List)
+		obj, err := q.GetPanObj(path, true, pan.WithCtx(ctx, q.ListCtx))
 		if err != nil {
 			return err
 		}
 		object = obj
 	}
-	err := q.objectRename(object.Id, req.NewName)
+	err := q.objectRename(ctx, object.Id, req.NewName)
 	if err != nil {
 		return err
 	}
@@ -198,9 +383,21 @@ func (q *Quark) ObjRename(req pan.ObjRenameReq) error {
 	return nil
 }
 func (q *Quark) BatchRename(req pan.BatchRenameReq) error {
-	return q.BaseBatchRename(req, q.List, q.ObjRename, q.BatchRename)
+	return q.BatchRenameCtx(q.Context(), req)
+}
+
+func (q *Quark) BatchRenameCtx(ctx context.Context, req pan.BatchRenameReq) error {
+	return q.BaseBatchRename(ctx, req, pan.WithCtx(ctx, q.ListCtx), func(req pan.ObjRenameReq) error {
+		return q.ObjRenameCtx(ctx, req)
+	})
 }
 func (q *Quark) Mkdir(req pan.MkdirReq) (*pan.PanObj, error) {
+	return q.MkdirCtx(q.Context(), req)
+}
+
+func (q *Quark) MkdirCtx(ctx context.Context, req pan.MkdirReq) (*pan.PanObj, error) {
+	ctx, cancel := q.JoinContext(ctx)
+	defer cancel()
 	if req.NewPath == "" {
 		// 不处理，直接返回
 		return &pan.PanObj{
@@ -215,10 +412,13 @@ func (q *Quark) Mkdir(req pan.MkdirReq) (*pan.PanObj, error) {
 		return nil, pan.OnlyMsg("please set a dir")
 	}
 	targetPath := "/" + strings.Trim(req.NewPath, "/")
-	if req.Parent != nil && (req.Parent.Id == "0" || req.Parent.Path == "/") {
-		targetPath = req.Parent.Path + "/" + strings.Trim(req.NewPath, "/")
+	if req.Parent != nil {
+		// NewPath 相对于 Parent
+		if parentPath := strings.Trim(strings.Trim(req.Parent.Path, "/")+"/"+req.Parent.Name, "/"); parentPath != "" {
+			targetPath = "/" + parentPath + targetPath
+		}
 	}
-	obj, err := q.GetPanObj(targetPath, false, q.List)
+	obj, err := q.GetPanObj(targetPath, false, pan.WithCtx(ctx, q.ListCtx))
 	if err != nil {
 		return nil, err
 	}
@@ -239,7 +439,7 @@ func (q *Quark) Mkdir(req pan.MkdirReq) (*pan.PanObj, error) {
 		var lastDirName string
 		for _, s := range split {
 			// 先查已有子目录，避免不必要的创建请求（防止 file is doloading）
-			existFid := q.findChildDirId(targetDirId, s)
+			existFid := q.findChildDirId(ctx, targetDirId, s)
 			if existFid != "" {
 				targetDirId = existFid
 				lastDirName = s
@@ -248,25 +448,27 @@ func (q *Quark) Mkdir(req pan.MkdirReq) (*pan.PanObj, error) {
 
 			var resp *RespData[Dir]
 			var err pan.DriverErrorInterface
-			// 重试逻辑：file is doloading 时递增等待重试（最多3次）
+			// 重试逻辑：file is doloading 等可重试错误时递增等待重试（最多3次）
 			for attempt := 0; attempt <= 3; attempt++ {
-				resp, err = q.createDirectory(s, targetDirId)
+				resp, err = q.createDirectory(ctx, s, targetDirId)
 				if err == nil {
 					break
 				}
-				if !strings.Contains(err.GetMsg(), "file is doloading") {
+				if !err.Retryable() {
 					break
 				}
 				if attempt < 3 {
 					wait := time.Duration(attempt+1) * time.Second
-					internal.GetLogger().Warn("file is doloading, retrying", "name", s, "attempt", attempt+1, "wait", wait)
-					time.Sleep(wait)
+					internal.GetLogger().Warn("create directory failed, retrying", "name", s, "attempt", attempt+1, "wait", wait)
+					if e := internal.SleepCtx(ctx, wait); e != nil {
+						return nil, pan.OnlyError(e)
+					}
 				}
 			}
 			if err != nil {
 				// 冲突时刷新缓存再查一次
 				q.Del(cacheDirectoryPrefix + targetDirId)
-				existFid = q.findChildDirId(targetDirId, s)
+				existFid = q.findChildDirId(ctx, targetDirId, s)
 				if existFid != "" {
 					targetDirId = existFid
 					lastDirName = s
@@ -299,8 +501,8 @@ func (q *Quark) Mkdir(req pan.MkdirReq) (*pan.PanObj, error) {
 }
 
 // findChildDirId 在指定父目录下查找名为 name 的子目录，返回其 fid
-func (q *Quark) findChildDirId(parentId, name string) string {
-	files, err := q.fileSort(parentId)
+func (q *Quark) findChildDirId(ctx context.Context, parentId, name string) string {
+	files, err := q.fileSort(ctx, parentId)
 	if err != nil {
 		return ""
 	}
@@ -313,13 +515,19 @@ func (q *Quark) findChildDirId(parentId, name string) string {
 }
 
 func (q *Quark) Move(req pan.MovieReq) error {
+	return q.MoveCtx(q.Context(), req)
+}
+
+func (q *Quark) MoveCtx(ctx context.Context, req pan.MovieReq) error {
+	ctx, cancel := q.JoinContext(ctx)
+	defer cancel()
 	targetObj := req.TargetObj
 	if targetObj.Type == "file" {
 		return pan.OnlyMsg("target is a file")
 	}
 	// 重新直接创建目标目录
 	if targetObj.Id == "" {
-		create, err := q.Mkdir(pan.MkdirReq{
+		create, err := q.MkdirCtx(ctx, pan.MkdirReq{
 			NewPath: strings.Trim(targetObj.Path, "/") + "/" + targetObj.Name,
 		})
 		if err != nil {
@@ -327,47 +535,214 @@ func (q *Quark) Move(req pan.MovieReq) error {
 		}
 		targetObj = create
 	}
-	collected := pan.CollectItemIds(req.Items, q.GetPanObj, q.List, false)
-	err := q.objectMove(collected.ObjIds, targetObj.Id)
+	collected, err := pan.CollectItemIds(req.Items, q.GetPanObj, pan.WithCtx(ctx, q.ListCtx))
+	if err != nil {
+		return err
+	}
+	err = q.objectMove(ctx, collected.ObjIds, targetObj.Id)
 	if err != nil {
 		return pan.OnlyError(err)
 	}
 	for key := range collected.ReloadDirIds {
 		q.Del(cacheDirectoryPrefix + key)
 	}
+	q.Del(cacheDirectoryPrefix + targetObj.Id)
 	return nil
 }
+func (q *Quark) Copy(req pan.CopyReq) error {
+	return q.CopyCtx(q.Context(), req)
+}
+
+func (q *Quark) CopyCtx(ctx context.Context, req pan.CopyReq) error {
+	ctx, cancel := q.JoinContext(ctx)
+	defer cancel()
+	// 夸克网页版没有复制接口，通过下载再上传实现
+	return q.BaseCopy(req, []string{pan.HashMd5, pan.HashSha1}, pan.WithCtx(ctx, q.ListCtx), pan.WithCtx(ctx, q.MkdirCtx),
+		pan.WithCtx(ctx, q.Open), pan.WithCtx(ctx, q.UploadStreamCtx))
+}
 func (q *Quark) Delete(req pan.DeleteReq) error {
+	return q.DeleteCtx(q.Context(), req)
+}
+
+func (q *Quark) DeleteCtx(ctx context.Context, req pan.DeleteReq) error {
+	ctx, cancel := q.JoinContext(ctx)
+	defer cancel()
 	if len(req.Items) == 0 {
 		return nil
 	}
-	collected := pan.CollectItemIds(req.Items, q.GetPanObj, q.List, true)
+	collected, err := pan.CollectItemIds(req.Items, q.GetPanObj, pan.WithCtx(ctx, q.ListCtx))
+	if err != nil {
+		return err
+	}
 	if len(collected.ObjIds) > 0 {
-		err := q.objectDelete(collected.ObjIds)
+		err := q.objectDelete(ctx, collected.ObjIds)
 		if err != nil {
 			return err
 		}
 		for key := range collected.ReloadDirIds {
 			q.Del(cacheDirectoryPrefix + key)
 		}
+		if req.Permanent {
+			return q.purge(ctx, collected.ObjIds)
+		}
+	}
+	return nil
+}
+
+// purge 彻底删除已移入回收站的对象
+func (q *Quark) purge(ctx context.Context, fids []string) error {
+	deleted := make(map[string]bool, len(fids))
+	for _, fid := range fids {
+		deleted[fid] = true
+	}
+	items, err := q.recycleList(ctx)
+	if err != nil {
+		return err
+	}
+	recordIds := make([]string, 0, len(fids))
+	for _, item := range items {
+		if deleted[item.Fid] {
+			recordIds = append(recordIds, item.RecordId)
+		}
+	}
+	if len(recordIds) == 0 {
+		return nil
+	}
+	return q.recycleOperate(ctx, "remove", recordIds)
+}
+
+func (q *Quark) TrashList() ([]*pan.PanObj, error) {
+	return q.TrashListCtx(q.Context())
+}
+
+func (q *Quark) TrashListCtx(ctx context.Context) ([]*pan.PanObj, error) {
+	ctx, cancel := q.JoinContext(ctx)
+	defer cancel()
+	items, err := q.recycleList(ctx)
+	if err != nil {
+		return nil, err
+	}
+	objs := make([]*pan.PanObj, 0, len(items))
+	for _, item := range items {
+		fileType := "file"
+		if item.FileType == 0 {
+			fileType = "dir"
+		}
+		obj := &pan.PanObj{
+			Id:      item.RecordId,
+			Name:    item.FileName,
+			Size:    item.Size,
+			Type:    fileType,
+			ModTime: time.UnixMilli(item.UpdatedAt),
+			Ext: pan.Json{
+				"fid":       item.Fid,
+				"deletedAt": item.DeletedAt,
+			},
+		}
+		if item.PdirFid != "" {
+			obj.Parent = &pan.PanObj{Id: item.PdirFid, Type: "dir"}
+		}
+		objs = append(objs, obj)
+	}
+	return objs, nil
+}
+
+func (q *Quark) TrashRestore(req pan.TrashReq) error {
+	return q.TrashRestoreCtx(q.Context(), req)
+}
+
+func (q *Quark) TrashRestoreCtx(ctx context.Context, req pan.TrashReq) error {
+	ctx, cancel := q.JoinContext(ctx)
+	defer cancel()
+	if len(req.Items) == 0 {
+		return nil
+	}
+	recordIds := make([]string, 0, len(req.Items))
+	for _, item := range req.Items {
+		recordIds = append(recordIds, item.Id)
+	}
+	if err := q.recycleOperate(ctx, "restore", recordIds); err != nil {
+		return err
+	}
+	// 清除原目录缓存，未知原目录时清空全部目录缓存
+	for _, item := range req.Items {
+		if item.Parent == nil || item.Parent.Id == "" {
+			q.DirCache.Clear()
+			break
+		}
+		q.Del(cacheDirectoryPrefix + item.Parent.Id)
 	}
 	return nil
 }
 
+func (q *Quark) TrashDelete(req pan.TrashReq) error {
+	return q.TrashDeleteCtx(q.Context(), req)
+}
+
+func (q *Quark) TrashDeleteCtx(ctx context.Context, req pan.TrashReq) error {
+	ctx, cancel := q.JoinContext(ctx)
+	defer cancel()
+	if len(req.Items) == 0 {
+		return nil
+	}
+	recordIds := make([]string, 0, len(req.Items))
+	for _, item := range req.Items {
+		recordIds = append(recordIds, item.Id)
+	}
+	return q.recycleOperate(ctx, "remove", recordIds)
+}
+
+func (q *Quark) TrashEmpty() error {
+	return q.TrashEmptyCtx(q.Context())
+}
+
+func (q *Quark) TrashEmptyCtx(ctx context.Context) error {
+	ctx, cancel := q.JoinContext(ctx)
+	defer cancel()
+	return q.recycleOperate(ctx, "remove", nil)
+}
+
 func (q *Quark) UploadPath(req pan.UploadPathReq) (*pan.TransferResult, error) {
-	err := q.BaseUploadPath(req, q.UploadFile)
+	return q.UploadPathCtx(q.Context(), req)
+}
+
+func (q *Quark) UploadPathCtx(ctx context.Context, req pan.UploadPathReq) (*pan.TransferResult, error) {
+	ctx, cancel := q.JoinContext(ctx)
+	defer cancel()
+	err := q.BaseUploadPath(req, pan.WithCtx(ctx, q.UploadFileCtx))
 	return nil, err
 }
 
 func (q *Quark) UploadFile(req pan.UploadFileReq) (*pan.TransferResult, error) {
-	if req.Resumable {
-		internal.GetLogger().Warn("quark is not support resumeable")
-	}
-	stat, err := os.Stat(req.LocalFile)
+	return q.UploadFileCtx(req.Ctx, req)
+}
+
+func (q *Quark) UploadFileCtx(ctx context.Context, req pan.UploadFileReq) (*pan.TransferResult, error) {
+	ctx, cancel := q.JoinContext(ctx)
+	defer cancel()
+	content, err := pan.FileContent(req.LocalFile)
 	if err != nil {
 		return nil, err
 	}
-	remoteName := stat.Name()
+	return q.upload(ctx, req, content)
+}
+
+func (q *Quark) UploadStream(req pan.UploadStreamReq) (*pan.TransferResult, error) {
+	return q.UploadStreamCtx(q.Context(), req)
+}
+
+func (q *Quark) UploadStreamCtx(ctx context.Context, req pan.UploadStreamReq) (*pan.TransferResult, error) {
+	ctx, cancel := q.JoinContext(ctx)
+	defer cancel()
+	// 预上传后需要先提交 md5 与 sha1
+	return q.BaseUploadStream(ctx, req, []string{pan.HashMd5, pan.HashSha1}, func(req pan.UploadFileReq, content *pan.UploadContent) (*pan.TransferResult, error) {
+		return q.upload(ctx, req, content)
+	})
+}
+
+// upload 上传本地文件或数据流
+func (q *Quark) upload(ctx context.Context, req pan.UploadFileReq, content *pan.UploadContent) (*pan.TransferResult, error) {
+	remoteName := content.Name
 	remotePath := strings.TrimRight(req.RemotePath, "/")
 	if req.RemotePathTransfer != nil {
 		remotePath = req.RemotePathTransfer(remotePath)
@@ -376,179 +751,285 @@ func (q *Quark) UploadFile(req pan.UploadFileReq) (*pan.TransferResult, error) {
 		remoteName = req.RemoteNameTransfer(remoteName)
 	}
 	remoteAllPath := remotePath + "/" + remoteName
-	_, err = q.GetPanObj(remoteAllPath, true, q.List)
+	_, err := q.GetPanObj(remoteAllPath, true, pan.WithCtx(ctx, q.ListCtx))
 	// 没有报错证明文件已经存在
 	if err == nil {
-		return nil, pan.CodeMsg(CodeObjectExist, remoteAllPath+" is exist")
+		return nil, pan.KindCodeMsg(pan.ErrAlreadyExists, CodeObjectExist, remoteAllPath+" is exist")
+	}
+	if !errors.Is(err, pan.ErrNotFound) {
+		return nil, err
 	}
-	dir, err := q.Mkdir(pan.MkdirReq{
+	dir, err := q.MkdirCtx(ctx, pan.MkdirReq{
 		NewPath: remotePath,
 	})
 	if err != nil {
 		return nil, pan.MsgError(remotePath+" create error", err)
 	}
 
-	md5Str, err := internal.GetFileMd5(req.LocalFile)
-	if err != nil {
-		return nil, err
-	}
-	sha1Str, err := internal.GetFileSha1(req.LocalFile)
-	if err != nil {
-		return nil, err
+	mimeType := internal.GetMimeType(content.Name)
+	key := pan.JournalKey("upload", string(q.DriverType), q.Properties.CookieFile, remoteAllPath, content.Source())
+	// 只有本地文件可以续传，数据流无法重新读取已上传的部分
+	resumable := req.Resumable && content.LocalFile != ""
+	var record *pan.UploadRecord
+	var pre FileUpPre
+	if resumable && !req.OnlyFast {
+		record, pre, err = q.resumeUpload(ctx, key, content)
+		if err != nil {
+			return nil, err
+		}
+	} else if !resumable {
+		q.DeleteRecord(key)
 	}
 
-	mimeType := internal.GetMimeType(req.LocalFile)
+	if record == nil {
+		md5Str, err := content.Hash(pan.HashMd5)
+		if err != nil {
+			return nil, err
+		}
+		sha1Str, err := content.Hash(pan.HashSha1)
+		if err != nil {
+			return nil, err
+		}
+		preResp, err := q.FileUploadPre(ctx, FileUpPreReq{
+			ParentId: dir.Id,
+			FileName: remoteName,
+			FileSize: content.Size,
+			MimeType: mimeType,
+		})
+		if err != nil {
+			return nil, err
+		}
+		pre = preResp.Data
+		result := &pan.TransferResult{TaskId: pre.Fid}
 
-	pre, err := q.FileUploadPre(FileUpPreReq{
-		ParentId: dir.Id,
-		FileName: remoteName,
-		FileSize: stat.Size(),
-		MimeType: mimeType,
-	})
-	if err != nil {
-		return nil, err
+		// hash
+		finish, err := q.FileUploadHash(ctx, FileUpHashReq{
+			Md5:    md5Str,
+			Sha1:   sha1Str,
+			TaskId: pre.TaskId,
+		})
+		if err != nil {
+			return result, err
+		}
+		if finish.Data.Finish {
+			q.Del(cacheDirectoryPrefix + dir.Id)
+			internal.GetLogger().Info("upload fast success", "file", content.Source(), "fid", pre.Fid)
+			q.uploadSuccessDel(req)
+			return result, nil
+		}
+
+		if req.OnlyFast {
+			internal.GetLogger().Info("upload fast error", "file", content.Source())
+			return result, pan.OnlyMsg("only support fast error:" + content.Source())
+		}
+		record = pan.NewUploadRecord(content, remoteAllPath)
+		record.SessionId = pre.TaskId
+		record.Session, _ = json.Marshal(pre)
+		record.PartSize = min(int64(preResp.Metadata.PartSize), q.Properties.ChunkSize)
+		if resumable {
+			q.SaveRecord(key, record)
+		}
 	}
 
 	// 使用网盘返回的文件 ID
-	fileTaskId := pre.Data.Fid
+	fileTaskId := pre.Fid
 	result := &pan.TransferResult{TaskId: fileTaskId}
 
-	// hash
-	finish, err := q.FileUploadHash(FileUpHashReq{
-		Md5:    md5Str,
-		Sha1:   sha1Str,
-		TaskId: pre.Data.TaskId,
+	// part up，跳过已完成的分片
+	parts, err := q.BaseUploadParts(ctx, pan.UploadPartsReq{
+		Content:     content,
+		PartSize:    record.PartSize,
+		Concurrency: req.Concurrency,
+		Done:        record.Parts,
+		PartDone: func(part pan.UploadPart) {
+			record.AddPart(part)
+			if resumable {
+				q.SaveRecord(key, record)
+			}
+		},
+		TaskId:           req.TaskId,
+		FileId:           fileTaskId,
+		ProgressCallback: req.ProgressCallback,
+	}, func(ctx context.Context, part pan.UploadPart, r io.Reader) (string, error) {
+		return q.FileUpPart(ctx, FileUpPartReq{
+			ObjKey:     pre.ObjKey,
+			Bucket:     pre.Bucket,
+			UploadId:   pre.UploadId,
+			AuthInfo:   pre.AuthInfo,
+			UploadUrl:  pre.UploadUrl,
+			MineType:   mimeType,
+			PartNumber: part.Number,
+			TaskId:     pre.TaskId,
+			Reader:     r,
+		})
 	})
 	if err != nil {
 		return result, err
 	}
-	if finish.Data.Finish {
-		internal.GetLogger().Info("upload fast success", "file", req.LocalFile, "fid", fileTaskId)
-		if req.SuccessDel {
-			err = os.Remove(req.LocalFile)
-			if err != nil {
-				internal.GetLogger().Error("delete fail", "file", req.LocalFile, "error", err)
-			} else {
-				internal.GetLogger().Info("delete success", "file", req.LocalFile)
-			}
-		}
-		return result, nil
+	md5s := make([]string, 0, len(parts))
+	for _, part := range parts {
+		md5s = append(md5s, part.ETag)
 	}
-
-	if req.OnlyFast {
-		internal.GetLogger().Info("upload fast error", "file", req.LocalFile)
-		return result, pan.OnlyMsg("only support fast error:" + req.LocalFile)
+	err = q.FileUpCommit(ctx, FileUpCommitReq{
+		ObjKey:    pre.ObjKey,
+		Bucket:    pre.Bucket,
+		UploadId:  pre.UploadId,
+		AuthInfo:  pre.AuthInfo,
+		UploadUrl: pre.UploadUrl,
+		MineType:  mimeType,
+		TaskId:    pre.TaskId,
+		Callback:  pre.Callback,
+	}, md5s)
+	if err != nil {
+		return result, err
 	}
-
-	// part up
-	partSize := min(int64(pre.Metadata.PartSize), q.Properties.ChunkSize)
-	total := stat.Size()
-	left := total
-	partNumber := 1
-	pr, err := pan.NewProcessReader(req.LocalFile, partSize, 0, req.ProgressCallback)
+	// 提交后分片上传已完成，无法再续传
+	q.DeleteRecord(key)
+	_, err = q.FileUpFinish(ctx, FileUpFinishReq{
+		ObjKey: pre.ObjKey,
+		TaskId: pre.TaskId,
+	})
 	if err != nil {
 		return result, err
 	}
-	if req.Ctx != nil {
-		pr.SetCtx(req.Ctx)
-	}
-	// Set IDs for progress events
-	if req.TaskId != "" {
-		pr.SetTaskId(req.TaskId)
-	}
-	pr.SetFileId(fileTaskId)
-	md5s := make([]string, 0)
-	for left > 0 {
-		start, end := pr.NextChunk()
-		chunkUploadSize := end - start
-		left -= chunkUploadSize
-		m, e := q.FileUpPart(FileUpPartReq{
-			ObjKey:     pre.Data.ObjKey,
-			Bucket:     pre.Data.Bucket,
-			UploadId:   pre.Data.UploadId,
-			AuthInfo:   pre.Data.AuthInfo,
-			UploadUrl:  pre.Data.UploadUrl,
-			MineType:   mimeType,
-			PartNumber: partNumber,
-			TaskId:     pre.Data.TaskId,
-			Reader:     pr,
-		})
-		if e != nil {
-			return result, e
-		}
-		if m == "finish" {
-			internal.GetLogger().Info("upload success", "file", req.LocalFile, "fid", fileTaskId)
-			if req.SuccessDel {
-				err = os.Remove(req.LocalFile)
-				if err != nil {
-					internal.GetLogger().Error("delete fail", "file", req.LocalFile, "error", err)
-				} else {
-					internal.GetLogger().Info("delete success", "file", req.LocalFile)
-				}
-			}
-			return result, nil
-		}
-		md5s = append(md5s, m)
-		partNumber++
+	q.Del(cacheDirectoryPrefix + dir.Id)
+	internal.GetLogger().Info("upload success", "file", content.Source(), "fid", fileTaskId)
+	q.uploadSuccessDel(req)
+	return result, nil
+}
+
+// uploadSuccessDel 上传成功后按需删除本地文件
+func (q *Quark) uploadSuccessDel(req pan.UploadFileReq) {
+	if !req.SuccessDel {
+		return
 	}
-	err = q.FileUpCommit(FileUpCommitReq{
-		ObjKey:    pre.Data.ObjKey,
-		Bucket:    pre.Data.Bucket,
-		UploadId:  pre.Data.UploadId,
-		AuthInfo:  pre.Data.AuthInfo,
-		UploadUrl: pre.Data.UploadUrl,
-		MineType:  mimeType,
-		TaskId:    pre.Data.TaskId,
-		Callback:  pre.Data.Callback,
-	}, md5s)
+	err := os.Remove(req.LocalFile)
 	if err != nil {
-		return result, err
+		internal.GetLogger().Error("delete fail", "file", req.LocalFile, "error", err)
+	} else {
+		internal.GetLogger().Info("delete success", "file", req.LocalFile)
 	}
-	_, err = q.FileUpFinish(FileUpFinishReq{
-		ObjKey: pre.Data.ObjKey,
-		TaskId: pre.Data.TaskId,
+}
+
+// resumeUpload 读取上传记录，并以 OSS 上已上传的分片为准确定可跳过的分片。
+// 没有记录或分片上传已失效时返回 nil，调用方重新上传
+func (q *Quark) resumeUpload(ctx context.Context, key string, content *pan.UploadContent) (*pan.UploadRecord, FileUpPre, error) {
+	var pre FileUpPre
+	record, ok := q.LoadUploadRecord(key, content)
+	if !ok {
+		return nil, pre, nil
+	}
+	if err := json.Unmarshal(record.Session, &pre); err != nil || pre.UploadId == "" || record.PartSize <= 0 {
+		q.DeleteRecord(key)
+		return nil, pre, nil
+	}
+	listed, err := q.FileUpListParts(ctx, FileUpListPartsReq{
+		ObjKey:    pre.ObjKey,
+		Bucket:    pre.Bucket,
+		UploadId:  pre.UploadId,
+		AuthInfo:  pre.AuthInfo,
+		UploadUrl: pre.UploadUrl,
+		TaskId:    pre.TaskId,
 	})
+	if errors.Is(err, pan.ErrNotFound) {
+		internal.GetLogger().Info("upload session expired", "file", content.Source(), "uploadId", pre.UploadId)
+		q.DeleteRecord(key)
+		return nil, pre, nil
+	}
 	if err != nil {
-		return result, err
+		return nil, pre, err
 	}
-	internal.GetLogger().Info("upload success", "file", req.LocalFile, "fid", fileTaskId)
-	if req.SuccessDel {
-		err = os.Remove(req.LocalFile)
-		if err != nil {
-			internal.GetLogger().Error("delete fail", "file", req.LocalFile, "error", err)
-		} else {
-			internal.GetLogger().Info("delete success", "file", req.LocalFile)
+	recorded := make(map[int]string, len(record.Parts))
+	for _, part := range record.Parts {
+		recorded[part.Number] = part.ETag
+	}
+	// 跳过 OSS 上大小与 ETag 都与记录一致的分片，其余分片重新上传
+	parts := make([]pan.UploadPart, 0, len(listed))
+	for _, part := range listed {
+		offset := int64(part.PartNumber-1) * record.PartSize
+		if part.PartNumber <= 0 || offset >= content.Size || part.Size != min(record.PartSize, content.Size-offset) {
+			continue
+		}
+		if etag, ok := recorded[part.PartNumber]; ok && !strings.EqualFold(strings.Trim(etag, `"`), strings.Trim(part.ETag, `"`)) {
+			continue
 		}
+		parts = append(parts, pan.UploadPart{Number: part.PartNumber, Size: part.Size, ETag: part.ETag})
 	}
-	return result, nil
+	record.Parts, record.Uploaded = nil, 0
+	for _, part := range parts {
+		record.AddPart(part)
+	}
+	internal.GetLogger().Info("resume upload", "file", content.Source(), "uploadId", pre.UploadId, "parts", len(record.Parts), "uploaded", record.Uploaded)
+	return record, pre, nil
 }
 
 func (q *Quark) DownloadPath(req pan.DownloadPathReq) (*pan.TransferResult, error) {
-	err := q.BaseDownloadPath(req, q.List, q.DownloadFile)
+	return q.DownloadPathCtx(q.Context(), req)
+}
+
+func (q *Quark) DownloadPathCtx(ctx context.Context, req pan.DownloadPathReq) (*pan.TransferResult, error) {
+	ctx, cancel := q.JoinContext(ctx)
+	defer cancel()
+	err := q.BaseDownloadPath(ctx, req, pan.WithCtx(ctx, q.ListCtx), pan.WithCtx(ctx, q.DownloadFileCtx))
 	return nil, err
 }
 func (q *Quark) DownloadFile(req pan.DownloadFileReq) (*pan.TransferResult, error) {
+	return q.DownloadFileCtx(req.Ctx, req)
+}
+
+func (q *Quark) DownloadFileCtx(ctx context.Context, req pan.DownloadFileReq) (*pan.TransferResult, error) {
+	ctx, cancel := q.JoinContext(ctx)
+	defer cancel()
+	req.Ctx = ctx
 	err := q.BaseDownloadFile(req, q.sessionClient, func(req pan.DownloadFileReq) (string, error) {
-		resp, err := q.fileDownload(req.RemoteFile.Id)
+		link, err := q.DownloadLinkCtx(ctx, req.RemoteFile)
 		if err != nil {
 			return "", err
 		}
-		return resp.Data[0].DownloadUrl, nil
+		return link.Url, nil
 	})
 	return nil, err
 }
 
+func (q *Quark) DownloadLinkCtx(ctx context.Context, file *pan.PanObj) (*pan.DownloadLink, error) {
+	ctx, cancel := q.JoinContext(ctx)
+	defer cancel()
+	resp, err := q.fileDownload(ctx, file.Id)
+	if err != nil {
+		return nil, err
+	}
+	return &pan.DownloadLink{Url: resp.Data[0].DownloadUrl, Client: q.sessionClient}, nil
+}
+
+func (q *Quark) Open(ctx context.Context, file *pan.PanObj) (io.ReadSeekCloser, error) {
+	return q.BaseOpen(ctx, file, q.DownloadLinkCtx)
+}
+
 func (q *Quark) OfflineDownload(req pan.OfflineDownloadReq) (*pan.Task, error) {
-	return nil, pan.OnlyMsg("offline download not support")
+	return q.OfflineDownloadCtx(q.Context(), req)
+}
+
+func (q *Quark) OfflineDownloadCtx(ctx context.Context, req pan.OfflineDownloadReq) (*pan.Task, error) {
+	return nil, pan.KindMsg(pan.ErrUnsupported, "offline download not support")
 }
 
 func (q *Quark) TaskList(req pan.TaskListReq) ([]*pan.Task, error) {
-	return nil, pan.OnlyMsg("task list not support")
+	return q.TaskListCtx(q.Context(), req)
+}
+
+func (q *Quark) TaskListCtx(ctx context.Context, req pan.TaskListReq) ([]*pan.Task, error) {
+	return nil, pan.KindMsg(pan.ErrUnsupported, "task list not support")
 }
 
 func (q *Quark) ShareList(req pan.ShareListReq) ([]*pan.ShareData, error) {
+	return q.ShareListCtx(q.Context(), req)
+}
+
+func (q *Quark) ShareListCtx(ctx context.Context, req pan.ShareListReq) ([]*pan.ShareData, error) {
+	ctx, cancel := q.JoinContext(ctx)
+	defer cancel()
 	needFilter := len(req.ShareIds) > 0
-	details, err := q.shareList()
+	details, err := q.shareList(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -576,11 +1057,17 @@ func (q *Quark) ShareList(req pan.ShareListReq) ([]*pan.ShareData, error) {
 	return result, nil
 }
 func (q *Quark) NewShare(req pan.NewShareReq) (*pan.ShareData, error) {
+	return q.NewShareCtx(q.Context(), req)
+}
+
+func (q *Quark) NewShareCtx(ctx context.Context, req pan.NewShareReq) (*pan.ShareData, error) {
+	ctx, cancel := q.JoinContext(ctx)
+	defer cancel()
 	urlType := 1
 	if req.NeedPassCode {
 		urlType = 2
 	}
-	shareId, err := q.share(ShareReq{
+	shareId, err := q.share(ctx, ShareReq{
 		FidList:     req.Fids,
 		Title:       req.Title,
 		UrlType:     urlType,
@@ -589,7 +1076,7 @@ func (q *Quark) NewShare(req pan.NewShareReq) (*pan.ShareData, error) {
 	if err != nil {
 		return nil, err
 	}
-	resp, err := q.sharePassword(shareId)
+	resp, err := q.sharePassword(ctx, shareId)
 	if err != nil {
 		return nil, err
 	}
@@ -601,11 +1088,23 @@ func (q *Quark) NewShare(req pan.NewShareReq) (*pan.ShareData, error) {
 	}, nil
 }
 func (q *Quark) DeleteShare(req pan.DelShareReq) error {
-	_, err := q.shareDelete(req.ShareIds)
+	return q.DeleteShareCtx(q.Context(), req)
+}
+
+func (q *Quark) DeleteShareCtx(ctx context.Context, req pan.DelShareReq) error {
+	ctx, cancel := q.JoinContext(ctx)
+	defer cancel()
+	_, err := q.shareDelete(ctx, req.ShareIds)
 	return err
 }
 
 func (q *Quark) ShareRestore(req pan.ShareRestoreReq) error {
+	return q.ShareRestoreCtx(q.Context(), req)
+}
+
+func (q *Quark) ShareRestoreCtx(ctx context.Context, req pan.ShareRestoreReq) error {
+	ctx, cancel := q.JoinContext(ctx)
+	defer cancel()
 	if req.ShareUrl == "" {
 		return pan.OnlyMsg("share url must not null")
 	}
@@ -615,13 +1114,13 @@ func (q *Quark) ShareRestore(req pan.ShareRestoreReq) error {
 		return err
 	}
 	pwdId := strings.TrimLeft(parsedURL.Path, "/s/")
-	targetDir, err := q.Mkdir(pan.MkdirReq{
+	targetDir, err := q.MkdirCtx(ctx, pan.MkdirReq{
 		NewPath: req.TargetDir,
 	})
 	if err != nil {
 		return err
 	}
-	token, err := q.shareToken(ShareTokenReq{
+	token, err := q.shareToken(ctx, ShareTokenReq{
 		PwdId:    pwdId,
 		Passcode: req.PassCode,
 	})
@@ -629,7 +1128,7 @@ func (q *Quark) ShareRestore(req pan.ShareRestoreReq) error {
 		return err
 	}
 	stoken := token.Data.Stoken
-	detail, err := q.shareDetail(ShareDetailReq{
+	detail, err := q.shareDetail(ctx, ShareDetailReq{
 		PwdId:  pwdId,
 		Stoken: stoken,
 	})
@@ -642,7 +1141,7 @@ func (q *Quark) ShareRestore(req pan.ShareRestoreReq) error {
 		fidList = append(fidList, file.Fid)
 		fidTokenList = append(fidTokenList, file.ShareFidToken)
 	}
-	err = q.shareRestore(RestoreReq{
+	err = q.shareRestore(ctx, RestoreReq{
 		FidList:      fidList,
 		FidTokenList: fidTokenList,
 		ToPdirFid:    targetDir.Id,
@@ -655,7 +1154,11 @@ func (q *Quark) ShareRestore(req pan.ShareRestoreReq) error {
 }
 
 func (q *Quark) DirectLink(req pan.DirectLinkReq) ([]*pan.DirectLink, error) {
-	return nil, pan.OnlyMsg("direct link not support")
+	return q.DirectLinkCtx(q.Context(), req)
+}
+
+func (q *Quark) DirectLinkCtx(ctx context.Context, req pan.DirectLinkReq) ([]*pan.DirectLink, error) {
+	return nil, pan.KindMsg(pan.ErrUnsupported, "direct link not support")
 }
 
 func init() {
@@ -1,7 +1,42 @@
 package quark
 
+import (
+	"strings"
+
+	"github.com/hefeiyu25/pan-client/pan"
+)
+
 // 定义异常编码和异常信息
 const (
 	// CodeObjectExist 对象已存在
 	CodeObjectExist = 40004
 )
+
+// 夸克接口返回的错误码
+const (
+	// codeNotLogin 未登录或 cookie 失效
+	codeNotLogin = 31001
+	// codeCapacityLimit 空间不足
+	codeCapacityLimit = 32003
+	// codeNotFound 对象不存在
+	codeNotFound = 41004
+	// codeNameConflict 同名对象已存在
+	codeNameConflict = 23008
+)
+
+// codeError 将夸克错误码映射为 pan 的错误类型，未识别的错误码按 HTTP 状态判断
+func codeError(status, code int, msg string) pan.DriverErrorInterface {
+	switch {
+	case code == codeNotLogin:
+		return pan.KindCodeMsg(pan.ErrAuthExpired, code, msg)
+	case code == codeCapacityLimit:
+		return pan.KindCodeMsg(pan.ErrQuotaExceeded, code, msg)
+	case code == codeNotFound:
+		return pan.KindCodeMsg(pan.ErrNotFound, code, msg)
+	case code == codeNameConflict:
+		return pan.KindCodeMsg(pan.ErrAlreadyExists, code, msg)
+	case strings.Contains(msg, "file is doloading"):
+		return pan.RetryCodeMsg(code, msg)
+	}
+	return pan.StatusCodeMsg(status, code, msg)
+}
@@ -1,9 +1,11 @@
 package quark
 
 import (
+	"context"
 	"crypto/md5"
 	"encoding/base64"
 	"encoding/json"
+	"encoding/xml"
 	"fmt"
 	"github.com/hefeiyu25/pan-client/internal"
 	"github.com/hefeiyu25/pan-client/pan"
@@ -14,12 +16,28 @@ import (
 	"time"
 )
 
+// apiUrl 返回接口地址，未配置时使用官方地址
+func (q *Quark) apiUrl() string {
+	if q.Properties.ApiUrl != "" {
+		return strings.TrimRight(q.Properties.ApiUrl, "/")
+	}
+	return DefaultApiUrl
+}
+
+// objectUrl 返回 OSS 对象地址，配置了 UploadUrl 时忽略 upload/pre 返回的地址
+func (q *Quark) objectUrl(bucket, uploadUrl, objKey string) string {
+	if q.Properties.UploadUrl != "" {
+		return strings.TrimRight(q.Properties.UploadUrl, "/") + "/" + objKey
+	}
+	return fmt.Sprintf("https://%s.%s/%s", bucket, uploadUrl[7:], objKey)
+}
+
 func funReturn(err error, response *req.Response, result Resp) (*Resp, pan.DriverErrorInterface) {
 	if err != nil {
 		return nil, pan.OnlyError(err)
 	}
 	if response.IsErrorState() && result.Code != 0 {
-		return nil, pan.CodeMsg(result.Code, result.Msg)
+		return nil, codeError(response.StatusCode, result.Code, result.Msg)
 	}
 	return &result, pan.NoError()
 }
@@ -28,10 +46,10 @@ func funReturnBySuccess[T any](err error, response *req.Response, errorResult Re
 		return nil, pan.OnlyError(err)
 	}
 	if response.IsErrorState() {
-		return nil, pan.CodeMsg(errorResult.Code, errorResult.Msg)
+		return nil, codeError(response.StatusCode, errorResult.Code, errorResult.Msg)
 	}
 	if successResult.Code != 0 {
-		return nil, pan.CodeMsg(successResult.Code, successResult.Msg)
+		return nil, codeError(response.StatusCode, successResult.Code, successResult.Msg)
 	}
 	return &successResult, pan.NoError()
 }
@@ -41,23 +59,25 @@ func funReturnBySuccessMeta[T any, R any](err error, response *req.Response, err
 		return nil, pan.OnlyError(err)
 	}
 	if response.IsErrorState() {
-		return nil, pan.CodeMsg(errorResult.Code, errorResult.Msg)
+		return nil, codeError(response.StatusCode, errorResult.Code, errorResult.Msg)
 	}
 	if successResult.Code != 0 {
-		return nil, pan.CodeMsg(successResult.Code, successResult.Msg)
+		return nil, codeError(response.StatusCode, successResult.Code, successResult.Msg)
 	}
 	return &successResult, pan.NoError()
 }
 
-func checkTaskSuccess(finish bool, successResult RespDataWithMeta[TaskDoing, TaskMeta], c *Quark) pan.DriverErrorInterface {
+func checkTaskSuccess(ctx context.Context, finish bool, successResult RespDataWithMeta[TaskDoing, TaskMeta], c *Quark) pan.DriverErrorInterface {
 	isFinish := finish
 	taskId := successResult.Data.TaskId
 	for {
 		if isFinish || taskId == "" {
 			break
 		}
-		time.Sleep(time.Duration(successResult.Metadata.TqGap) * time.Millisecond)
-		query, err := c.taskQuery(taskId)
+		if err := internal.SleepCtx(ctx, time.Duration(successResult.Metadata.TqGap)*time.Millisecond); err != nil {
+			return pan.OnlyError(err)
+		}
+		query, err := c.taskQuery(ctx, taskId)
 		if err != nil {
 			return err
 		}
@@ -67,8 +87,8 @@ func checkTaskSuccess(finish bool, successResult RespDataWithMeta[TaskDoing, Tas
 	return nil
 }
 
-func (q *Quark) taskQuery(taskId string) (*RespDataWithMeta[Task, TaskMeta], pan.DriverErrorInterface) {
-	r := q.sessionClient.R()
+func (q *Quark) taskQuery(ctx context.Context, taskId string) (*RespDataWithMeta[Task, TaskMeta], pan.DriverErrorInterface) {
+	r := q.sessionClient.R().SetContext(ctx)
 	var successResult RespDataWithMeta[Task, TaskMeta]
 	var errorResult Resp
 	r.SetSuccessResult(&successResult)
@@ -81,8 +101,8 @@ func (q *Quark) taskQuery(taskId string) (*RespDataWithMeta[Task, TaskMeta], pan
 	return funReturnBySuccessMeta(err, response, errorResult, successResult)
 }
 
-func (q *Quark) member() (*RespDataWithMeta[MemberData, MemberMeta], pan.DriverErrorInterface) {
-	r := q.sessionClient.R()
+func (q *Quark) member(ctx context.Context) (*RespDataWithMeta[MemberData, MemberMeta], pan.DriverErrorInterface) {
+	r := q.sessionClient.R().SetContext(ctx)
 	var successResult RespDataWithMeta[MemberData, MemberMeta]
 	var errorResult Resp
 	r.SetSuccessResult(&successResult)
@@ -91,8 +111,8 @@ func (q *Quark) member() (*RespDataWithMeta[MemberData, MemberMeta], pan.DriverE
 	return funReturnBySuccessMeta(err, response, errorResult, successResult)
 }
 
-func (q *Quark) config() (*RespData[Config], pan.DriverErrorInterface) {
-	r := q.sessionClient.R()
+func (q *Quark) config(ctx context.Context) (*RespData[Config], pan.DriverErrorInterface) {
+	r := q.sessionClient.R().SetContext(ctx)
 	var successResult RespData[Config]
 	var errorResult Resp
 	r.SetSuccessResult(&successResult)
@@ -102,17 +122,17 @@ func (q *Quark) config() (*RespData[Config], pan.DriverErrorInterface) {
 		return nil, pan.OnlyError(err)
 	}
 	if response.IsErrorState() {
-		return nil, pan.CodeMsg(errorResult.Code, errorResult.Msg)
+		return nil, codeError(response.StatusCode, errorResult.Code, errorResult.Msg)
 	}
 	if successResult.Code != 0 {
-		return nil, pan.CodeMsg(successResult.Code, successResult.Msg)
+		return nil, codeError(response.StatusCode, successResult.Code, successResult.Msg)
 	}
 	// cookies 由 CookieJar 自动管理和回写，无需手动处理
 	return &successResult, pan.NoError()
 }
 
-func (q *Quark) createDirectory(dirName, dstId string) (*RespData[Dir], pan.DriverErrorInterface) {
-	r := q.sessionClient.R()
+func (q *Quark) createDirectory(ctx context.Context, dirName, dstId string) (*RespData[Dir], pan.DriverErrorInterface) {
+	r := q.sessionClient.R().SetContext(ctx)
 	var successResult RespData[Dir]
 	var errorResult Resp
 	r.SetSuccessResult(&successResult)
@@ -128,67 +148,207 @@ func (q *Quark) createDirectory(dirName, dstId string) (*RespData[Dir], pan.Driv
 	return funReturnBySuccess(err, response, errorResult, successResult)
 }
 
-func (q *Quark) fileSort(parent string) ([]File, pan.DriverErrorInterface) {
+func (q *Quark) fileSort(ctx context.Context, parent string) ([]File, pan.DriverErrorInterface) {
+	return q.filePages(ctx, "/file/sort", map[string]string{"pdir_fid": parent})
+}
+
+// fileSearch 按文件名关键字搜索整个网盘
+func (q *Quark) fileSearch(ctx context.Context, keyword string) ([]File, pan.DriverErrorInterface) {
+	return q.filePages(ctx, "/file/search", map[string]string{"q": keyword})
+}
+
+// filePages 逐页拉取文件列表接口的全部结果
+func (q *Quark) filePages(ctx context.Context, uri string, params map[string]string) ([]File, pan.DriverErrorInterface) {
 	files := make([]File, 0)
-	r := q.sessionClient.R()
+	for page := 1; ; page++ {
+		list, more, err := q.filePage(ctx, uri, params, page)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, list...)
+		if !more {
+			break
+		}
+	}
+	return files, nil
+}
+
+// filePage 拉取文件列表接口的第 page 页，more 表示还有下一页
+func (q *Quark) filePage(ctx context.Context, uri string, params map[string]string, page int) ([]File, bool, pan.DriverErrorInterface) {
+	r := q.sessionClient.R().SetContext(ctx)
+	query := map[string]string{
+		"_page":        strconv.Itoa(page),
+		"_size":        strconv.Itoa(filePageSize),
+		"_fetch_total": "1",
+	}
+	for k, v := range params {
+		query[k] = v
+	}
+	var successResult RespDataWithMeta[FileList, SortMeta]
+	var errorResult Resp
+	r.SetSuccessResult(&successResult)
+	r.SetErrorResult(&errorResult)
+	r.SetQueryParams(query)
+	response, err := r.Get(uri)
+	if err != nil {
+		return nil, false, pan.OnlyError(err)
+	}
+	if response.IsErrorState() {
+		return nil, false, codeError(response.StatusCode, errorResult.Code, errorResult.Msg)
+	}
+	if successResult.Status >= 400 || successResult.Code != 0 {
+		return nil, false, codeError(response.StatusCode, successResult.Code, successResult.Msg)
+	}
+	return successResult.Data.List, page*filePageSize < successResult.Metadata.Total, nil
+}
+
+// dirFullPath 查询目录的完整路径，根目录为 "/"
+func (q *Quark) dirFullPath(ctx context.Context, fid string) (string, pan.DriverErrorInterface) {
+	if fid == "0" {
+		return "/", nil
+	}
+	r := q.sessionClient.R().SetContext(ctx)
+	var successResult RespDataWithMeta[FileList, SortMeta]
+	var errorResult Resp
+	r.SetSuccessResult(&successResult)
+	r.SetErrorResult(&errorResult)
+	r.SetQueryParams(map[string]string{
+		"pdir_fid":         fid,
+		"_page":            "1",
+		"_size":            "1",
+		"_fetch_full_path": "1",
+	})
+	response, err := r.Get("/file/sort")
+	result, e := funReturnBySuccessMeta(err, response, errorResult, successResult)
+	if e != nil {
+		return "", e
+	}
+	names := make([]string, 0, len(result.Data.FullPath))
+	for _, item := range result.Data.FullPath {
+		names = append(names, item.FileName)
+	}
+	return "/" + strings.Join(names, "/"), nil
+}
+
+// fileInfoPathList 按完整路径查询对象的 fid，不存在的路径不在结果中
+func (q *Quark) fileInfoPathList(ctx context.Context, paths []string) ([]FilePath, pan.DriverErrorInterface) {
+	r := q.sessionClient.R().SetContext(ctx)
+	var successResult RespData[[]FilePath]
+	var errorResult Resp
+	r.SetSuccessResult(&successResult)
+	r.SetErrorResult(&errorResult)
+	r.SetBody(map[string]any{
+		"file_path": paths,
+		"namespace": "0",
+	})
+	response, err := r.Post("/file/info/path_list")
+	result, e := funReturnBySuccess(err, response, errorResult, successResult)
+	if e != nil {
+		return nil, e
+	}
+	return result.Data, nil
+}
+
+// fileInfo 按 fid 查询单个对象
+func (q *Quark) fileInfo(ctx context.Context, fid string) (*File, pan.DriverErrorInterface) {
+	r := q.sessionClient.R().SetContext(ctx)
+	var successResult RespData[File]
+	var errorResult Resp
+	r.SetSuccessResult(&successResult)
+	r.SetErrorResult(&errorResult)
+	r.SetQueryParam("fid", fid)
+	response, err := r.Get("/file/info")
+	result, e := funReturnBySuccess(err, response, errorResult, successResult)
+	if e != nil {
+		return nil, e
+	}
+	return &result.Data, nil
+}
+
+func (q *Quark) objectDelete(ctx context.Context, objIds []string) pan.DriverErrorInterface {
+
+	r := q.sessionClient.R().SetContext(ctx)
+	var successResult RespDataWithMeta[TaskDoing, TaskMeta]
+	var errorResult Resp
+	r.SetSuccessResult(&successResult)
+	r.SetErrorResult(&errorResult)
+	r.SetBody(map[string]any{
+		"action_type":  2,
+		"exclude_fids": []string{},
+		"filelist":     objIds,
+	})
+	// object
+	response, err := r.Post("/file/delete")
+	result, e := funReturnBySuccessMeta(err, response, errorResult, successResult)
+	if e != nil {
+		return e
+	}
+	finish := result.Data.Finish
+	return checkTaskSuccess(ctx, finish, successResult, q)
+}
+
+func (q *Quark) recycleList(ctx context.Context) ([]RecycleItem, pan.DriverErrorInterface) {
+	items := make([]RecycleItem, 0)
+	r := q.sessionClient.R().SetContext(ctx)
 	page := 1
 	size := 100
 	query := map[string]string{
-		"pdir_fid":     parent,
 		"_size":        strconv.Itoa(size),
 		"_fetch_total": "1",
 	}
-	var successResult RespDataWithMeta[FileList, SortMeta]
+	var successResult RespDataWithMeta[RecycleList, SortMeta]
 	var errorResult Resp
 	r.SetSuccessResult(&successResult)
 	r.SetErrorResult(&errorResult)
 	for {
 		query["_page"] = strconv.Itoa(page)
 		r.SetQueryParams(query)
-		response, err := r.Get("/file/sort")
+		response, err := r.Get("/file/recycle/list")
 		if err != nil {
 			return nil, pan.OnlyError(err)
 		}
 		if response.IsErrorState() {
-			return nil, pan.CodeMsg(errorResult.Code, errorResult.Msg)
+			return nil, codeError(response.StatusCode, errorResult.Code, errorResult.Msg)
 		}
 		if successResult.Status >= 400 || successResult.Code != 0 {
-			return nil, pan.CodeMsg(successResult.Code, successResult.Msg)
+			return nil, codeError(response.StatusCode, successResult.Code, successResult.Msg)
 		}
-		files = append(files, successResult.Data.List...)
+		items = append(items, successResult.Data.List...)
 		if page*size >= successResult.Metadata.Total {
 			break
 		}
 		page++
 	}
-
-	return files, nil
+	return items, nil
 }
 
-func (q *Quark) objectDelete(objIds []string) pan.DriverErrorInterface {
-
-	r := q.sessionClient.R()
+// recycleOperate 还原（restore）或彻底删除（remove）回收站记录，recordIds 为空时作用于整个回收站
+func (q *Quark) recycleOperate(ctx context.Context, action string, recordIds []string) pan.DriverErrorInterface {
+	r := q.sessionClient.R().SetContext(ctx)
 	var successResult RespDataWithMeta[TaskDoing, TaskMeta]
 	var errorResult Resp
 	r.SetSuccessResult(&successResult)
 	r.SetErrorResult(&errorResult)
+	// select_mode 1 为全选，2 为按 record_list 选择
+	selectMode := 2
+	if len(recordIds) == 0 {
+		selectMode = 1
+		recordIds = []string{}
+	}
 	r.SetBody(map[string]any{
-		"action_type":  2,
-		"exclude_fids": []string{},
-		"filelist":     objIds,
+		"select_mode": selectMode,
+		"record_list": recordIds,
 	})
-	// object
-	response, err := r.Post("/file/delete")
+	response, err := r.Post("/file/recycle/" + action)
 	result, e := funReturnBySuccessMeta(err, response, errorResult, successResult)
 	if e != nil {
 		return e
 	}
-	finish := result.Data.Finish
-	return checkTaskSuccess(finish, successResult, q)
+	return checkTaskSuccess(ctx, result.Data.Finish, successResult, q)
 }
 
-func (q *Quark) objectMove(objIds []string, dstId string) pan.DriverErrorInterface {
-	r := q.sessionClient.R()
+func (q *Quark) objectMove(ctx context.Context, objIds []string, dstId string) pan.DriverErrorInterface {
+	r := q.sessionClient.R().SetContext(ctx)
 	var successResult RespDataWithMeta[TaskDoing, TaskMeta]
 	var errorResult Resp
 	r.SetSuccessResult(&successResult)
@@ -205,17 +365,17 @@ func (q *Quark) objectMove(objIds []string, dstId string) pan.DriverErrorInterfa
 		return pan.OnlyError(err)
 	}
 	if response.IsErrorState() {
-		return pan.CodeMsg(errorResult.Code, errorResult.Msg)
+		return codeError(response.StatusCode, errorResult.Code, errorResult.Msg)
 	}
 	if successResult.Status >= 400 || successResult.Code != 0 {
-		return pan.CodeMsg(successResult.Code, successResult.Msg)
+		return codeError(response.StatusCode, successResult.Code, successResult.Msg)
 	}
 	finish := successResult.Data.Finish
-	return checkTaskSuccess(finish, successResult, q)
+	return checkTaskSuccess(ctx, finish, successResult, q)
 }
 
-func (q *Quark) objectRename(objId, newName string) pan.DriverErrorInterface {
-	r := q.sessionClient.R()
+func (q *Quark) objectRename(ctx context.Context, objId, newName string) pan.DriverErrorInterface {
+	r := q.sessionClient.R().SetContext(ctx)
 	var successResult RespDataWithMeta[TaskDoing, TaskMeta]
 	var errorResult Resp
 	r.SetSuccessResult(&successResult)
@@ -230,17 +390,17 @@ func (q *Quark) objectRename(objId, newName string) pan.DriverErrorInterface {
 		return pan.OnlyError(err)
 	}
 	if response.IsErrorState() {
-		return pan.CodeMsg(errorResult.Code, errorResult.Msg)
+		return codeError(response.StatusCode, errorResult.Code, errorResult.Msg)
 	}
 	if successResult.Status >= 400 || successResult.Code != 0 {
-		return pan.CodeMsg(successResult.Code, successResult.Msg)
+		return codeError(response.StatusCode, successResult.Code, successResult.Msg)
 	}
 	finish := successResult.Data.Finish
-	return checkTaskSuccess(finish, successResult, q)
+	return checkTaskSuccess(ctx, finish, successResult, q)
 }
 
-func (q *Quark) FileUploadPre(req FileUpPreReq) (*RespDataWithMeta[FileUpPre, FileUpPreMeta], error) {
-	r := q.sessionClient.R()
+func (q *Quark) FileUploadPre(ctx context.Context, req FileUpPreReq) (*RespDataWithMeta[FileUpPre, FileUpPreMeta], error) {
+	r := q.sessionClient.R().SetContext(ctx)
 	var successResult RespDataWithMeta[FileUpPre, FileUpPreMeta]
 	var errorResult Resp
 	r.SetSuccessResult(&successResult)
@@ -260,17 +420,17 @@ func (q *Quark) FileUploadPre(req FileUpPreReq) (*RespDataWithMeta[FileUpPre, Fi
 		return nil, err
 	}
 	if response.IsErrorState() {
-		return nil, fmt.Errorf("code: %d, msg: %s", errorResult.Code, errorResult.Msg)
+		return nil, codeError(response.StatusCode, errorResult.Code, errorResult.Msg)
 	}
 	if successResult.Status >= 400 || successResult.Code != 0 {
-		return nil, fmt.Errorf("code: %d, msg: %s", successResult.Code, successResult.Msg)
+		return nil, codeError(response.StatusCode, successResult.Code, successResult.Msg)
 	}
 
 	return &successResult, nil
 }
 
-func (q *Quark) FileUploadHash(req FileUpHashReq) (*RespData[FileUpHash], error) {
-	r := q.sessionClient.R()
+func (q *Quark) FileUploadHash(ctx context.Context, req FileUpHashReq) (*RespData[FileUpHash], error) {
+	r := q.sessionClient.R().SetContext(ctx)
 	var successResult RespData[FileUpHash]
 	var errorResult Resp
 	r.SetSuccessResult(&successResult)
@@ -280,16 +440,16 @@ func (q *Quark) FileUploadHash(req FileUpHashReq) (*RespData[FileUpHash], error)
 		return nil, err
 	}
 	if response.IsErrorState() {
-		return nil, fmt.Errorf("code: %d, msg: %s", errorResult.Code, errorResult.Msg)
+		return nil, codeError(response.StatusCode, errorResult.Code, errorResult.Msg)
 	}
 	if successResult.Status >= 400 || successResult.Code != 0 {
-		return nil, fmt.Errorf("code: %d, msg: %s", successResult.Code, successResult.Msg)
+		return nil, codeError(response.StatusCode, successResult.Code, successResult.Msg)
 	}
 
 	return &successResult, nil
 }
 
-func (q *Quark) FileUpPart(req FileUpPartReq) (string, error) {
+func (q *Quark) FileUpPart(ctx context.Context, req FileUpPartReq) (string, error) {
 	timeStr := time.Now().UTC().Format(http.TimeFormat)
 	data := map[string]any{
 		"auth_info": req.AuthInfo,
@@ -302,7 +462,7 @@ x-oss-user-agent:aliyun-sdk-js/6.6.1 Chrome 98.0.4758.80 on Windows 10 64-bit
 /%s/%s?partNumber=%d&uploadId=%s`, req.MineType, timeStr, timeStr, req.Bucket, req.ObjKey, req.PartNumber, req.UploadId),
 		"task_id": req.TaskId,
 	}
-	r := q.sessionClient.R()
+	r := q.sessionClient.R().SetContext(ctx)
 	var resp RespData[FileUpAuth]
 	r.SetSuccessResult(&resp)
 	r.SetBody(data)
@@ -311,8 +471,8 @@ x-oss-user-agent:aliyun-sdk-js/6.6.1 Chrome 98.0.4758.80 on Windows 10 64-bit
 		return "", err
 	}
 
-	u := fmt.Sprintf("https://%s.%s/%s", req.Bucket, req.UploadUrl[7:], req.ObjKey)
-	r = q.defaultClient.R()
+	u := q.objectUrl(req.Bucket, req.UploadUrl, req.ObjKey)
+	r = q.defaultClient.R().SetContext(ctx)
 	r.SetHeaders(map[string]string{
 		"Authorization":    resp.Data.AuthKey,
 		"Content-Type":     req.MineType,
@@ -330,12 +490,79 @@ x-oss-user-agent:aliyun-sdk-js/6.6.1 Chrome 98.0.4758.80 on Windows 10 64-bit
 		return "", err
 	}
 	if res.StatusCode != 200 {
-		return "", fmt.Errorf("up status: %d, error: %s", res.StatusCode, res.String())
+		return "", pan.StatusCodeMsg(res.StatusCode, res.StatusCode, fmt.Sprintf("up status: %d, error: %s", res.StatusCode, res.String()))
 	}
 	return res.Header.Get("ETag"), nil
 }
 
-func (q *Quark) FileUpCommit(req FileUpCommitReq, md5s []string) error {
+// FileUpListParts 列出 OSS 上已上传的分片，分片上传已完成或失效时返回 ErrNotFound
+func (q *Quark) FileUpListParts(ctx context.Context, req FileUpListPartsReq) ([]FileUpPartInfo, error) {
+	parts := make([]FileUpPartInfo, 0)
+	marker := 0
+	for {
+		timeStr := time.Now().UTC().Format(http.TimeFormat)
+		data := map[string]any{
+			"auth_info": req.AuthInfo,
+			"auth_meta": fmt.Sprintf(`GET
+
+
+%s
+x-oss-date:%s
+x-oss-user-agent:aliyun-sdk-js/6.6.1 Chrome 98.0.4758.80 on Windows 10 64-bit
+/%s/%s?uploadId=%s`, timeStr, timeStr, req.Bucket, req.ObjKey, req.UploadId),
+			"task_id": req.TaskId,
+		}
+		r := q.sessionClient.R().SetContext(ctx)
+		var resp RespData[FileUpAuth]
+		var errorResult Resp
+		r.SetSuccessResult(&resp)
+		r.SetErrorResult(&errorResult)
+		response, err := r.SetBody(data).Post("/file/upload/auth")
+		if err != nil {
+			return nil, err
+		}
+		if response.IsErrorState() {
+			return nil, codeError(response.StatusCode, errorResult.Code, errorResult.Msg)
+		}
+		if resp.Status >= 400 || resp.Code != 0 {
+			return nil, codeError(response.StatusCode, resp.Code, resp.Msg)
+		}
+
+		params := map[string]string{
+			"uploadId":  req.UploadId,
+			"max-parts": "1000",
+		}
+		if marker > 0 {
+			params["part-number-marker"] = strconv.Itoa(marker)
+		}
+		res, err := q.defaultClient.R().SetContext(ctx).
+			SetHeaders(map[string]string{
+				"Authorization":    resp.Data.AuthKey,
+				"Referer":          "https://pan.quark.cn/",
+				"x-oss-date":       timeStr,
+				"x-oss-user-agent": "aliyun-sdk-js/6.6.1 Chrome 98.0.4758.80 on Windows 10 64-bit",
+			}).
+			SetQueryParams(params).
+			Get(q.objectUrl(req.Bucket, req.UploadUrl, req.ObjKey))
+		if err != nil {
+			return nil, err
+		}
+		if res.StatusCode != 200 {
+			return nil, pan.StatusCodeMsg(res.StatusCode, res.StatusCode, fmt.Sprintf("list parts status: %d, error: %s", res.StatusCode, res.String()))
+		}
+		var result listPartsResult
+		if err = xml.Unmarshal(res.Bytes(), &result); err != nil {
+			return nil, pan.MsgError("invalid list parts response", err)
+		}
+		parts = append(parts, result.Parts...)
+		if !result.IsTruncated || result.NextPartNumberMarker <= marker {
+			return parts, nil
+		}
+		marker = result.NextPartNumberMarker
+	}
+}
+
+func (q *Quark) FileUpCommit(ctx context.Context, req FileUpCommitReq, md5s []string) error {
 	timeStr := time.Now().UTC().Format(http.TimeFormat)
 	bodyBuilder := strings.Builder{}
 	bodyBuilder.WriteString(`<?xml version="1.0" encoding="UTF-8"?>
@@ -373,7 +600,7 @@ x-oss-user-agent:aliyun-sdk-js/6.6.1 Chrome 98.0.4758.80 on Windows 10 64-bit
 		"task_id": req.TaskId,
 	}
 	var resp RespData[FileUpAuth]
-	r := q.sessionClient.R()
+	r := q.sessionClient.R().SetContext(ctx)
 	r.SetSuccessResult(&resp)
 	r.SetBody(data)
 	_, err = r.Post("/file/upload/auth")
@@ -381,8 +608,8 @@ x-oss-user-agent:aliyun-sdk-js/6.6.1 Chrome 98.0.4758.80 on Windows 10 64-bit
 		return err
 	}
 
-	r = q.defaultClient.R()
-	u := fmt.Sprintf("https://%s.%s/%s", req.Bucket, req.UploadUrl[7:], req.ObjKey)
+	r = q.defaultClient.R().SetContext(ctx)
+	u := q.objectUrl(req.Bucket, req.UploadUrl, req.ObjKey)
 	res, err := r.
 		SetHeaders(map[string]string{
 			"Authorization":    resp.Data.AuthKey,
@@ -400,13 +627,13 @@ x-oss-user-agent:aliyun-sdk-js/6.6.1 Chrome 98.0.4758.80 on Windows 10 64-bit
 		return err
 	}
 	if res.StatusCode != 200 {
-		return fmt.Errorf("up status: %d, error: %s", res.StatusCode, res.String())
+		return pan.StatusCodeMsg(res.StatusCode, res.StatusCode, fmt.Sprintf("up status: %d, error: %s", res.StatusCode, res.String()))
 	}
 	return nil
 }
 
-func (q *Quark) FileUpFinish(req FileUpFinishReq) (*Resp, error) {
-	r := q.sessionClient.R()
+func (q *Quark) FileUpFinish(ctx context.Context, req FileUpFinishReq) (*Resp, error) {
+	r := q.sessionClient.R().SetContext(ctx)
 	var result Resp
 	r.SetSuccessResult(&result)
 	r.SetErrorResult(&result)
@@ -415,16 +642,16 @@ func (q *Quark) FileUpFinish(req FileUpFinishReq) (*Resp, error) {
 		return nil, err
 	}
 	if response.IsErrorState() {
-		return nil, fmt.Errorf("code: %d, msg: %s", result.Code, result.Msg)
+		return nil, codeError(response.StatusCode, result.Code, result.Msg)
 	}
 	if result.Status >= 400 || result.Code != 0 {
-		return nil, fmt.Errorf("code: %d, msg: %s", result.Code, result.Msg)
+		return nil, codeError(response.StatusCode, result.Code, result.Msg)
 	}
 	return &result, nil
 }
 
-func (q *Quark) fileDownload(fileId string) (*RespData[[]DownloadData], pan.DriverErrorInterface) {
-	r := q.sessionClient.R()
+func (q *Quark) fileDownload(ctx context.Context, fileId string) (*RespData[[]DownloadData], pan.DriverErrorInterface) {
+	r := q.sessionClient.R().SetContext(ctx)
 	data := map[string]any{
 		"fids": []string{fileId},
 	}
@@ -436,12 +663,12 @@ func (q *Quark) fileDownload(fileId string) (*RespData[[]DownloadData], pan.Driv
 	return funReturnBySuccess(err, response, errorResult, successResult)
 }
 
-func (q *Quark) share(req ShareReq) (string, pan.DriverErrorInterface) {
+func (q *Quark) share(ctx context.Context, req ShareReq) (string, pan.DriverErrorInterface) {
 	shareId := ""
 	if req.UrlType == 2 && req.Passcode == "" {
 		req.Passcode = internal.GenRandomWord()
 	}
-	r := q.sessionClient.R()
+	r := q.sessionClient.R().SetContext(ctx)
 	var successResult RespDataWithMeta[TaskDoing, TaskMeta]
 	var errorResult Resp
 	r.SetSuccessResult(&successResult)
@@ -459,8 +686,10 @@ func (q *Quark) share(req ShareReq) (string, pan.DriverErrorInterface) {
 		if isFinish {
 			break
 		}
-		time.Sleep(time.Duration(result.Metadata.TqGap) * time.Millisecond)
-		query, err := q.taskQuery(result.Data.TaskId)
+		if err := internal.SleepCtx(ctx, time.Duration(result.Metadata.TqGap)*time.Millisecond); err != nil {
+			return shareId, pan.OnlyError(err)
+		}
+		query, err := q.taskQuery(ctx, result.Data.TaskId)
 		if err != nil {
 			return shareId, err
 		}
@@ -472,8 +701,8 @@ func (q *Quark) share(req ShareReq) (string, pan.DriverErrorInterface) {
 	return shareId, nil
 }
 
-func (q *Quark) sharePassword(shareId string) (*RespData[SharePasswordData], pan.DriverErrorInterface) {
-	r := q.sessionClient.R()
+func (q *Quark) sharePassword(ctx context.Context, shareId string) (*RespData[SharePasswordData], pan.DriverErrorInterface) {
+	r := q.sessionClient.R().SetContext(ctx)
 	var successResult RespData[SharePasswordData]
 	var errorResult Resp
 	r.SetSuccessResult(&successResult)
@@ -486,9 +715,9 @@ func (q *Quark) sharePassword(shareId string) (*RespData[SharePasswordData], pan
 	return funReturnBySuccess(err, response, errorResult, successResult)
 }
 
-func (q *Quark) shareList() ([]*ShareList, pan.DriverErrorInterface) {
+func (q *Quark) shareList(ctx context.Context) ([]*ShareList, pan.DriverErrorInterface) {
 	shareList := make([]*ShareList, 0)
-	r := q.sessionClient.R()
+	r := q.sessionClient.R().SetContext(ctx)
 	page := 1
 	size := 100
 	query := map[string]string{
@@ -517,8 +746,8 @@ func (q *Quark) shareList() ([]*ShareList, pan.DriverErrorInterface) {
 	return shareList, nil
 }
 
-func (q *Quark) shareDelete(shareIds []string) (*Resp, error) {
-	r := q.sessionClient.R()
+func (q *Quark) shareDelete(ctx context.Context, shareIds []string) (*Resp, error) {
+	r := q.sessionClient.R().SetContext(ctx)
 	var result Resp
 	r.SetSuccessResult(&result)
 	r.SetErrorResult(&result)
@@ -530,8 +759,8 @@ func (q *Quark) shareDelete(shareIds []string) (*Resp, error) {
 	return funReturn(err, response, result)
 }
 
-func (q *Quark) shareToken(shareTokenReq ShareTokenReq) (*RespData[ShareTokenResp], error) {
-	r := q.sessionClient.R()
+func (q *Quark) shareToken(ctx context.Context, shareTokenReq ShareTokenReq) (*RespData[ShareTokenResp], error) {
+	r := q.sessionClient.R().SetContext(ctx)
 	var successResult RespData[ShareTokenResp]
 	var errorResult Resp
 	r.SetSuccessResult(&successResult)
@@ -541,8 +770,8 @@ func (q *Quark) shareToken(shareTokenReq ShareTokenReq) (*RespData[ShareTokenRes
 	return funReturnBySuccess(err, response, errorResult, successResult)
 }
 
-func (q *Quark) shareDetail(shareDetailReq ShareDetailReq) (*ShareDetailResp, error) {
-	r := q.sessionClient.R()
+func (q *Quark) shareDetail(ctx context.Context, shareDetailReq ShareDetailReq) (*ShareDetailResp, error) {
+	r := q.sessionClient.R().SetContext(ctx)
 	page := 1
 	size := 100
 	query := map[string]string{
@@ -582,8 +811,8 @@ func (q *Quark) shareDetail(shareDetailReq ShareDetailReq) (*ShareDetailResp, er
 	return returnResult, nil
 }
 
-func (q *Quark) shareRestore(restoreReq RestoreReq) pan.DriverErrorInterface {
-	r := q.sessionClient.R()
+func (q *Quark) shareRestore(ctx context.Context, restoreReq RestoreReq) pan.DriverErrorInterface {
+	r := q.sessionClient.R().SetContext(ctx)
 	var successResult RespDataWithMeta[TaskDoing, TaskMeta]
 	var errorResult Resp
 	r.SetSuccessResult(&successResult)
@@ -594,5 +823,5 @@ func (q *Quark) shareRestore(restoreReq RestoreReq) pan.DriverErrorInterface {
 	if e != nil {
 		return e
 	}
-	return checkTaskSuccess(false, *result, q)
+	return checkTaskSuccess(ctx, false, *result, q)
 }
@@ -101,6 +101,19 @@ type MemberData struct {
 
 type FileList struct {
 	List []File
+	// 请求 _fetch_full_path=1 时返回目录自根目录起的完整路径
+	FullPath []FullPathItem `json:"full_path,omitempty"`
+}
+
+type FullPathItem struct {
+	Fid      string `json:"fid"`
+	FileName string `json:"file_name"`
+}
+
+// FilePath 按路径查询 fid 的结果
+type FilePath struct {
+	Fid      string `json:"fid"`
+	FilePath string `json:"file_path"`
 }
 
 type File struct {
@@ -183,6 +196,24 @@ type File struct {
 	} `json:"pdf_info,omitempty"`
 	ShareFidToken string `json:"share_fid_token"`
 }
+
+// RecycleList 回收站列表
+type RecycleList struct {
+	List []RecycleItem `json:"list"`
+}
+
+// RecycleItem 回收站记录，RecordId 用于还原和彻底删除
+type RecycleItem struct {
+	RecordId  string `json:"record_id"`
+	Fid       string `json:"fid"`
+	FileName  string `json:"file_name"`
+	PdirFid   string `json:"pdir_fid"`
+	FileType  int    `json:"file_type"`
+	Size      int64  `json:"size"`
+	DeletedAt int64  `json:"deleted_at"`
+	UpdatedAt int64  `json:"updated_at"`
+}
+
 type Dir struct {
 	Finish bool   `json:"finish"`
 	Fid    string `json:"fid"`
@@ -264,6 +295,29 @@ type FileUpPartReq struct {
 	Reader     io.Reader
 }
 
+type FileUpListPartsReq struct {
+	ObjKey    string `json:"obj_key"`
+	Bucket    string `json:"bucket"`
+	UploadId  string `json:"upload_id"`
+	AuthInfo  string `json:"auth_info"`
+	UploadUrl string `json:"upload_url"`
+	TaskId    string `json:"task_id"`
+}
+
+// FileUpPartInfo OSS 上已上传的分片
+type FileUpPartInfo struct {
+	PartNumber int    `xml:"PartNumber"`
+	ETag       string `xml:"ETag"`
+	Size       int64  `xml:"Size"`
+}
+
+// listPartsResult OSS ListParts 的响应
+type listPartsResult struct {
+	IsTruncated          bool             `xml:"IsTruncated"`
+	NextPartNumberMarker int              `xml:"NextPartNumberMarker"`
+	Parts                []FileUpPartInfo `xml:"Part"`
+}
+
 type FileUpCommitReq struct {
 	ObjKey    string         `json:"obj_key"`
 	Bucket    string         `json:"bucket"`
@@ -1,19 +1,24 @@
 package thunder_browser
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
 	"github.com/google/uuid"
 	"github.com/hefeiyu25/pan-client/internal"
 	"github.com/hefeiyu25/pan-client/pan"
 	"github.com/imroc/req/v3"
 	"io"
+	"iter"
 	"net/url"
 	"os"
+	"path"
 	"path/filepath"
 	"strconv"
 	"strings"
@@ -49,6 +54,15 @@ type ThunderBrowserProperties struct {
 
 	Sub    string `mapstructure:"sub" json:"sub" yaml:"sub"`
 	UserID string `mapstructure:"user_id" json:"user_id" yaml:"user_id"`
+
+	// ApiUrl 网盘接口地址，为空时使用 API_URL，可指向反向代理或测试用的 fake 服务
+	ApiUrl string `mapstructure:"api_url" json:"api_url" yaml:"api_url"`
+	// UserApiUrl 用户接口（登录、验证码）地址，为空时使用 XLUSER_API_URL
+	UserApiUrl string `mapstructure:"user_api_url" json:"user_api_url" yaml:"user_api_url"`
+	// UploadUrl S3 上传地址，为空时使用创建上传任务时返回的 endpoint
+	UploadUrl string `mapstructure:"upload_url" json:"upload_url" yaml:"upload_url"`
+	// ChunkSize S3 分片大小，除最后一个分片外不能小于 5M
+	ChunkSize int64 `mapstructure:"chunk_size" json:"chunk_size" yaml:"chunk_size" default:"5242880"` // 5M
 }
 
 func (cp *ThunderBrowserProperties) OnlyImportProperties() {
@@ -69,6 +83,9 @@ func (tb *ThunderBrowser) Init() (string, error) {
 	if (tb.Properties.Username == "" || tb.Properties.Password == "") && tb.Properties.RefreshToken == "" {
 		return driverId, fmt.Errorf("please set login info ")
 	}
+	if err := tb.checkUrls(); err != nil {
+		return driverId, err
+	}
 	tb.Properties.DeviceID = internal.Md5HashStr(tb.Properties.Username + tb.Properties.Password)
 	commonHeaderMap := map[string]string{
 		HeaderUserAgent:    BuildCustomUserAgent(PackageName, SdkVersion, ClientVersion),
@@ -79,22 +96,23 @@ func (tb *ThunderBrowser) Init() (string, error) {
 	}
 	tb.sessionClient = req.C().SetCommonHeaders(commonHeaderMap)
 
-	_, userErr := tb.userMe()
+	ctx := tb.Context()
+	_, userErr := tb.userMe(ctx)
 	// 若能拿到用户信息，证明已经登录
 	if userErr != nil {
 
 		// refreshToken不为空，则先用token登录
 		if tb.Properties.RefreshToken != "" {
 			tb.Properties.DeviceID = internal.Md5HashStr(tb.Properties.RefreshToken)
-			_, loginErr := tb.refreshToken(tb.Properties.RefreshToken)
+			_, loginErr := tb.refreshToken(ctx, tb.Properties.RefreshToken)
 			if loginErr != nil {
-				_, loginErr = tb.login(tb.Properties.Username, tb.Properties.Password)
+				_, loginErr = tb.login(ctx, tb.Properties.Username, tb.Properties.Password)
 				if loginErr != nil {
 					return driverId, loginErr
 				}
 			}
 		} else {
-			_, loginErr := tb.login(tb.Properties.Username, tb.Properties.Password)
+			_, loginErr := tb.login(ctx, tb.Properties.Username, tb.Properties.Password)
 			if loginErr != nil {
 				return driverId, loginErr
 			}
@@ -118,8 +136,26 @@ func (tb *ThunderBrowser) Close() error {
 	return nil
 }
 
+func (tb *ThunderBrowser) Capabilities() pan.Capabilities {
+	return pan.Capabilities{
+		OfflineDownload: true,
+		TaskList:        true,
+		Share:           true,
+		ShareRestore:    true,
+		Copy:            true,
+		Trash:           true,
+		ResumableUpload: true,
+	}
+}
+
 func (tb *ThunderBrowser) Disk() (*pan.DiskResp, error) {
-	about, err := tb.about()
+	return tb.DiskCtx(tb.Context())
+}
+
+func (tb *ThunderBrowser) DiskCtx(ctx context.Context) (*pan.DiskResp, error) {
+	ctx, cancel := tb.JoinContext(ctx)
+	defer cancel()
+	about, err := tb.about(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -135,12 +171,18 @@ func (tb *ThunderBrowser) Disk() (*pan.DiskResp, error) {
 	}, nil
 }
 func (tb *ThunderBrowser) List(req pan.ListReq) ([]*pan.PanObj, error) {
+	return tb.ListCtx(tb.Context(), req)
+}
+
+func (tb *ThunderBrowser) ListCtx(ctx context.Context, req pan.ListReq) ([]*pan.PanObj, error) {
+	ctx, cancel := tb.JoinContext(ctx)
+	defer cancel()
 	queryDir := req.Dir
 	if queryDir.Path == "/" && queryDir.Name == "" {
 		queryDir.Id = "0"
 	}
 	if queryDir.Id == "" {
-		obj, err := tb.GetPanObj(strings.TrimRight(queryDir.Path, "/")+"/"+queryDir.Name, true, tb.List)
+		obj, err := tb.GetPanObj(strings.TrimRight(queryDir.Path, "/")+"/"+queryDir.Name, true, pan.WithCtx(ctx, tb.ListCtx))
 		if err != nil {
 			return nil, err
 		}
@@ -151,30 +193,18 @@ func (tb *ThunderBrowser) List(req pan.ListReq) ([]*pan.PanObj, error) {
 		tb.Del(cacheKey)
 	}
 	result, err := tb.GetOrLoad(cacheKey, func() (interface{}, error) {
-		files, e := tb.getFiles(queryDir.Id)
+		files, e := tb.getFiles(ctx, queryDir.Id)
 		if e != nil {
 			internal.GetLogger().Error("get files error", "error", e)
 			return nil, e
 		}
 		panObjs := make([]*pan.PanObj, 0)
 		for _, item := range files {
-			fileType := "file"
-			if item.Kind == "drive#folder" {
-				fileType = "dir"
-			}
 			path := strings.TrimRight(queryDir.Path, "/") + "/" + queryDir.Name
 			if queryDir.Id == "" {
 				path = "/"
 			}
-			size, _ := strconv.ParseInt(item.Size, 10, 64)
-			panObjs = append(panObjs, &pan.PanObj{
-				Id:     item.ID,
-				Name:   item.Name,
-				Path:   path,
-				Size:   size,
-				Type:   fileType,
-				Parent: req.Dir,
-			})
+			panObjs = append(panObjs, toPanObj(item, path, queryDir))
 		}
 		return panObjs, nil
 	})
@@ -182,34 +212,211 @@ func (tb *ThunderBrowser) List(req pan.ListReq) ([]*pan.PanObj, error) {
 		return make([]*pan.PanObj, 0), err
 	}
 	if objs, ok := result.([]*pan.PanObj); ok {
-		return objs, nil
+		return req.Apply(objs)
 	}
 	return make([]*pan.PanObj, 0), nil
 }
+
+func (tb *ThunderBrowser) ListIter(ctx context.Context, dir *pan.PanObj) iter.Seq2[*pan.PanObj, error] {
+	return func(yield func(*pan.PanObj, error) bool) {
+		ctx, cancel := tb.JoinContext(ctx)
+		defer cancel()
+		queryDir, err := tb.ResolveDir(dir, pan.WithCtx(ctx, tb.ListCtx))
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+		dirPath := path.Join(queryDir.Path, queryDir.Name)
+		cached, _ := tb.Get(cacheDirectoryPrefix + queryDir.Id)
+		pan.PageIter(ctx, cached, func(ctx context.Context, token string) ([]*pan.PanObj, string, error) {
+			files, next, e := tb.getFilesPage(ctx, queryDir.Id, token)
+			if e != nil {
+				return nil, "", e
+			}
+			objs := make([]*pan.PanObj, 0, len(files))
+			for _, item := range files {
+				objs = append(objs, toPanObj(item, dirPath, queryDir))
+			}
+			return objs, next, nil
+		})(yield)
+	}
+}
+
+// toPanObj 转换迅雷文件信息，path 为父目录路径
+func toPanObj(item *Files, path string, parent *pan.PanObj) *pan.PanObj {
+	fileType := "file"
+	if item.Kind == "drive#folder" {
+		fileType = "dir"
+	}
+	size, _ := strconv.ParseInt(item.Size, 10, 64)
+	obj := &pan.PanObj{
+		Id:           item.ID,
+		Name:         item.Name,
+		Path:         path,
+		Size:         size,
+		Type:         fileType,
+		ModTime:      item.ModifiedTime.Time,
+		CreatedTime:  item.CreatedTime.Time,
+		MimeType:     item.MimeType,
+		ThumbnailURL: item.ThumbnailLink,
+		Parent:       parent,
+	}
+	if item.Hash != "" || item.Md5Checksum != "" {
+		obj.Hashes = make(map[string]string)
+		if item.Hash != "" {
+			obj.Hashes[pan.HashGcid] = item.Hash
+		}
+		if item.Md5Checksum != "" {
+			obj.Hashes[pan.HashMd5] = item.Md5Checksum
+		}
+	}
+	return obj
+}
+
+func (tb *ThunderBrowser) Stat(req pan.StatReq) (*pan.PanObj, error) {
+	return tb.StatCtx(tb.Context(), req)
+}
+
+func (tb *ThunderBrowser) StatCtx(ctx context.Context, req pan.StatReq) (*pan.PanObj, error) {
+	ctx, cancel := tb.JoinContext(ctx)
+	defer cancel()
+	// 迅雷没有按路径查询的接口，只带路径时逐级列出父目录（复用目录缓存）
+	if req.Id == "" || req.Id == "0" {
+		return tb.BaseStat(req, pan.WithCtx(ctx, tb.ListCtx))
+	}
+	// 按 ID 直接查询，不需要列出父目录
+	file, err := tb.getLink(ctx, req.Id)
+	if err != nil {
+		return nil, err
+	}
+	if file.Trashed {
+		return nil, pan.KindMsg(pan.ErrNotFound, req.Id+" is trashed")
+	}
+	if req.Path == "" {
+		// 没有路径时按 ParentID 逐级查询祖先目录，补齐 Path 和 Parent
+		rootObj := &pan.PanObj{Id: "0", Name: "", Path: "/", Type: "dir"}
+		parent, err := tb.searchParent(ctx, file.ParentID, map[string]*pan.PanObj{"": rootObj, "0": rootObj})
+		if err != nil {
+			return nil, err
+		}
+		return toPanObj(file, path.Join(parent.Path, parent.Name), parent), nil
+	}
+	dir := path.Dir("/" + strings.Trim(req.Path, "/"))
+	parent := &pan.PanObj{Id: file.ParentID, Name: path.Base(dir), Path: path.Dir(dir), Type: "dir"}
+	if dir == "/" {
+		parent = &pan.PanObj{Id: "0", Name: "", Path: "/", Type: "dir"}
+	}
+	return toPanObj(file, dir, parent), nil
+}
+
+func (tb *ThunderBrowser) Search(req pan.SearchReq) ([]*pan.PanObj, error) {
+	return tb.SearchCtx(tb.Context(), req)
+}
+
+func (tb *ThunderBrowser) SearchCtx(ctx context.Context, req pan.SearchReq) ([]*pan.PanObj, error) {
+	ctx, cancel := tb.JoinContext(ctx)
+	defer cancel()
+	list := pan.WithCtx(ctx, tb.ListCtx)
+	// 搜索接口必须带关键字，否则只能遍历
+	if req.Keyword == "" {
+		return tb.BaseSearch(req, list)
+	}
+	root, err := tb.SearchRoot(req, list)
+	if err != nil {
+		return nil, err
+	}
+	req.Root = root
+	files, e := tb.searchFiles(ctx, req.Keyword)
+	if e != nil {
+		return nil, e
+	}
+	rootObj := &pan.PanObj{Id: "0", Name: "", Path: "/", Type: "dir"}
+	parents := map[string]*pan.PanObj{"": rootObj, "0": rootObj}
+	result := make([]*pan.PanObj, 0)
+	for _, item := range files {
+		parent, err := tb.searchParent(ctx, item.ParentID, parents)
+		if err != nil {
+			// 父目录已被删除的搜索结果直接忽略
+			if errors.Is(err, pan.ErrNotFound) {
+				continue
+			}
+			return nil, err
+		}
+		obj := toPanObj(item, path.Join(parent.Path, parent.Name), parent)
+		if req.Match(obj) {
+			result = append(result, obj)
+		}
+	}
+	return result, nil
+}
+
+// searchParent 逐级查询搜索结果的父目录，parents 缓存已查询过的目录
+func (tb *ThunderBrowser) searchParent(ctx context.Context, id string, parents map[string]*pan.PanObj) (*pan.PanObj, error) {
+	if parent, ok := parents[id]; ok {
+		return parent, nil
+	}
+	file, e := tb.getLink(ctx, id)
+	if e != nil {
+		return nil, e
+	}
+	if file.Trashed {
+		return nil, pan.KindMsg(pan.ErrNotFound, id+" is trashed")
+	}
+	grandParent, err := tb.searchParent(ctx, file.ParentID, parents)
+	if err != nil {
+		return nil, err
+	}
+	parent := toPanObj(file, path.Join(grandParent.Path, grandParent.Name), grandParent)
+	parents[id] = parent
+	return parent, nil
+}
+
 func (tb *ThunderBrowser) ObjRename(req pan.ObjRenameReq) error {
+	return tb.ObjRenameCtx(tb.Context(), req)
+}
+
+func (tb *ThunderBrowser) ObjRenameCtx(ctx context.Context, req pan.ObjRenameReq) error {
+	ctx, cancel := tb.JoinContext(ctx)
+	defer cancel()
 	if req.Obj.Id == "0" || (req.Obj.Path == "/" && req.Obj.Name == "") {
-		return pan.OnlyMsg("not support rename root path")
+		return pan.KindMsg(pan.ErrUnsupported, "not support rename root path")
 	}
 	object := req.Obj
 	if object.Id == "" {
 		path := strings.Trim(req.Obj.Path, "/") + "/" + req.Obj.Name
-		obj, err := tb.GetPanObj(path, true, tb.List)
+		obj, err := tb.GetPanObj(path, true, pan.WithCtx(ctx, tb.ListCtx))
 		if err != nil {
 			return err
 		}
 		object = obj
 	}
-	newFile, err := tb.rename(object.Id, req.NewName)
+	newFile, err := tb.rename(ctx, object.Id, req.NewName)
 	if err != nil {
 		return err
 	}
-	tb.Del(cacheDirectoryPrefix + newFile.ParentID)
+	parentId := newFile.ParentID
+	if parentId == "" {
+		parentId = "0"
+	}
+	tb.Del(cacheDirectoryPrefix + parentId)
 	return nil
 }
 func (tb *ThunderBrowser) BatchRename(req pan.BatchRenameReq) error {
-	return tb.BaseBatchRename(req, tb.List, tb.ObjRename, tb.BatchRename)
+	return tb.BatchRenameCtx(tb.Context(), req)
+}
+
+func (tb *ThunderBrowser) BatchRenameCtx(ctx context.Context, req pan.BatchRenameReq) error {
+	return tb.BaseBatchRename(ctx, req, pan.WithCtx(ctx, tb.ListCtx), func(req pan.ObjRenameReq) error {
+		return tb.ObjRenameCtx(ctx, req)
+	})
 }
 func (tb *ThunderBrowser) Mkdir(req pan.MkdirReq) (*pan.PanObj, error) {
+	return tb.MkdirCtx(tb.Context(), req)
+}
+
+func (tb *ThunderBrowser) MkdirCtx(ctx context.Context, req pan.MkdirReq) (*pan.PanObj, error) {
+	ctx, cancel := tb.JoinContext(ctx)
+	defer cancel()
 	if req.NewPath == "" {
 		// 不处理，直接返回
 		return &pan.PanObj{
@@ -224,10 +431,13 @@ func (tb *ThunderBrowser) Mkdir(req pan.MkdirReq) (*pan.PanObj, error) {
 		return nil, pan.OnlyMsg("please set a dir")
 	}
 	targetPath := "/" + strings.Trim(req.NewPath, "/")
-	if req.Parent != nil && (req.Parent.Id == "0" || req.Parent.Path == "/") {
-		targetPath = req.Parent.Path + "/" + strings.Trim(req.NewPath, "/")
+	if req.Parent != nil {
+		// NewPath 相对于 Parent
+		if parentPath := strings.Trim(strings.Trim(req.Parent.Path, "/")+"/"+req.Parent.Name, "/"); parentPath != "" {
+			targetPath = "/" + parentPath + targetPath
+		}
 	}
-	obj, err := tb.GetPanObj(targetPath, false, tb.List)
+	obj, err := tb.GetPanObj(targetPath, false, pan.WithCtx(ctx, tb.ListCtx))
 	if err != nil {
 		return nil, err
 	}
@@ -246,7 +456,7 @@ func (tb *ThunderBrowser) Mkdir(req pan.MkdirReq) (*pan.PanObj, error) {
 		split := strings.Split(rel, "/")
 		targetDirId := obj.Id
 		for _, s := range split {
-			resp, err := tb.makeDir(s, targetDirId)
+			resp, err := tb.makeDir(ctx, s, targetDirId)
 			if err != nil {
 				return nil, pan.OnlyError(err)
 			}
@@ -254,17 +464,23 @@ func (tb *ThunderBrowser) Mkdir(req pan.MkdirReq) (*pan.PanObj, error) {
 			targetDirId = resp.File.ID
 		}
 		tb.Del(cacheDirectoryPrefix + obj.Id)
-		return tb.Mkdir(req)
+		return tb.MkdirCtx(ctx, req)
 	}
 }
 func (tb *ThunderBrowser) Move(req pan.MovieReq) error {
+	return tb.MoveCtx(tb.Context(), req)
+}
+
+func (tb *ThunderBrowser) MoveCtx(ctx context.Context, req pan.MovieReq) error {
+	ctx, cancel := tb.JoinContext(ctx)
+	defer cancel()
 	targetObj := req.TargetObj
 	if targetObj.Type == "file" {
 		return pan.OnlyMsg("target is a file")
 	}
 	// 重新直接创建目标目录
 	if targetObj.Id == "" {
-		create, err := tb.Mkdir(pan.MkdirReq{
+		create, err := tb.MkdirCtx(ctx, pan.MkdirReq{
 			NewPath: strings.Trim(targetObj.Path, "/") + "/" + targetObj.Name,
 		})
 		if err != nil {
@@ -272,23 +488,81 @@ func (tb *ThunderBrowser) Move(req pan.MovieReq) error {
 		}
 		targetObj = create
 	}
-	collected := pan.CollectItemIds(req.Items, tb.GetPanObj, tb.List, false)
-	err := tb.move(collected.ObjIds, targetObj.Id)
+	collected, err := pan.CollectItemIds(req.Items, tb.GetPanObj, pan.WithCtx(ctx, tb.ListCtx))
+	if err != nil {
+		return err
+	}
+	targetId := targetObj.Id
+	if targetId == "0" {
+		targetId = ""
+	}
+	err = tb.move(ctx, collected.ObjIds, targetId)
 	if err != nil {
 		return pan.OnlyError(err)
 	}
 	for key := range collected.ReloadDirIds {
 		tb.Del(cacheDirectoryPrefix + key)
 	}
+	tb.Del(cacheDirectoryPrefix + targetObj.Id)
+	return nil
+}
+func (tb *ThunderBrowser) Copy(req pan.CopyReq) error {
+	return tb.CopyCtx(tb.Context(), req)
+}
+
+func (tb *ThunderBrowser) CopyCtx(ctx context.Context, req pan.CopyReq) error {
+	ctx, cancel := tb.JoinContext(ctx)
+	defer cancel()
+	targetObj := req.TargetObj
+	if targetObj.Type == "file" {
+		return pan.OnlyMsg("target is a file")
+	}
+	// 重新直接创建目标目录
+	if targetObj.Id == "" {
+		create, err := tb.MkdirCtx(ctx, pan.MkdirReq{
+			NewPath: strings.Trim(targetObj.Path, "/") + "/" + targetObj.Name,
+		})
+		if err != nil {
+			return err
+		}
+		targetObj = create
+	}
+	collected, err := pan.CollectItemIds(req.Items, tb.GetPanObj, pan.WithCtx(ctx, tb.ListCtx))
+	if err != nil {
+		return err
+	}
+	targetId := targetObj.Id
+	if targetId == "0" {
+		targetId = ""
+	}
+	err = tb.batchCopy(ctx, collected.ObjIds, targetId)
+	if err != nil {
+		return err
+	}
+	tb.Del(cacheDirectoryPrefix + targetObj.Id)
 	return nil
 }
 func (tb *ThunderBrowser) Delete(req pan.DeleteReq) error {
+	return tb.DeleteCtx(tb.Context(), req)
+}
+
+func (tb *ThunderBrowser) DeleteCtx(ctx context.Context, req pan.DeleteReq) error {
+	ctx, cancel := tb.JoinContext(ctx)
+	defer cancel()
 	if len(req.Items) == 0 {
 		return nil
 	}
-	collected := pan.CollectItemIds(req.Items, tb.GetPanObj, tb.List, true)
+	collected, err := pan.CollectItemIds(req.Items, tb.GetPanObj, pan.WithCtx(ctx, tb.ListCtx))
+	if err != nil {
+		return err
+	}
 	if len(collected.ObjIds) > 0 {
-		err := tb.remove(collected.ObjIds)
+		var err pan.DriverErrorInterface
+		if req.Permanent {
+			err = tb.remove(ctx, collected.ObjIds)
+		} else {
+			err = tb.trash(ctx, "batchTrash", collected.ObjIds)
+		}
 		if err != nil {
 			return err
 		}
@@ -299,24 +573,128 @@ func (tb *ThunderBrowser) Delete(req pan.DeleteReq) error {
 	return nil
 }
 
+func (tb *ThunderBrowser) TrashList() ([]*pan.PanObj, error) {
+	return tb.TrashListCtx(tb.Context())
+}
+
+func (tb *ThunderBrowser) TrashListCtx(ctx context.Context) ([]*pan.PanObj, error) {
+	ctx, cancel := tb.JoinContext(ctx)
+	defer cancel()
+	files, err := tb.getTrashFiles(ctx)
+	if err != nil {
+		return nil, err
+	}
+	objs := make([]*pan.PanObj, 0, len(files))
+	for _, file := range files {
+		parentId := file.ParentID
+		if parentId == "" {
+			parentId = "0"
+		}
+		objs = append(objs, toPanObj(file, "", &pan.PanObj{Id: parentId, Type: "dir"}))
+	}
+	return objs, nil
+}
+
+func (tb *ThunderBrowser) TrashRestore(req pan.TrashReq) error {
+	return tb.TrashRestoreCtx(tb.Context(), req)
+}
+
+func (tb *ThunderBrowser) TrashRestoreCtx(ctx context.Context, req pan.TrashReq) error {
+	ctx, cancel := tb.JoinContext(ctx)
+	defer cancel()
+	if len(req.Items) == 0 {
+		return nil
+	}
+	ids := make([]string, 0, len(req.Items))
+	for _, item := range req.Items {
+		ids = append(ids, item.Id)
+	}
+	if err := tb.trash(ctx, "batchUntrash", ids); err != nil {
+		return err
+	}
+	// 清除原目录缓存，未知原目录时清空全部目录缓存
+	for _, item := range req.Items {
+		if item.Parent == nil || item.Parent.Id == "" {
+			tb.DirCache.Clear()
+			break
+		}
+		tb.Del(cacheDirectoryPrefix + item.Parent.Id)
+	}
+	return nil
+}
+
+func (tb *ThunderBrowser) TrashDelete(req pan.TrashReq) error {
+	return tb.TrashDeleteCtx(tb.Context(), req)
+}
+
+func (tb *ThunderBrowser) TrashDeleteCtx(ctx context.Context, req pan.TrashReq) error {
+	ctx, cancel := tb.JoinContext(ctx)
+	defer cancel()
+	if len(req.Items) == 0 {
+		return nil
+	}
+	ids := make([]string, 0, len(req.Items))
+	for _, item := range req.Items {
+		ids = append(ids, item.Id)
+	}
+	return tb.remove(ctx, ids)
+}
+
+func (tb *ThunderBrowser) TrashEmpty() error {
+	return tb.TrashEmptyCtx(tb.Context())
+}
+
+func (tb *ThunderBrowser) TrashEmptyCtx(ctx context.Context) error {
+	ctx, cancel := tb.JoinContext(ctx)
+	defer cancel()
+	return tb.emptyTrash(ctx)
+}
+
 func (tb *ThunderBrowser) UploadPath(req pan.UploadPathReq) (*pan.TransferResult, error) {
-	err := tb.BaseUploadPath(req, tb.UploadFile)
+	return tb.UploadPathCtx(tb.Context(), req)
+}
+
+func (tb *ThunderBrowser) UploadPathCtx(ctx context.Context, req pan.UploadPathReq) (*pan.TransferResult, error) {
+	ctx, cancel := tb.JoinContext(ctx)
+	defer cancel()
+	err := tb.BaseUploadPath(req, pan.WithCtx(ctx, tb.UploadFileCtx))
 	return nil, err
 }
 
 func (tb *ThunderBrowser) UploadFile(req pan.UploadFileReq) (*pan.TransferResult, error) {
-	if req.Resumable {
-		internal.GetLogger().Warn("thunder_browser is not support resumeable")
-	}
-	if req.OnlyFast {
-		return nil, pan.OnlyMsg("thunder_browser is not support fast upload")
-	}
+	return tb.UploadFileCtx(req.Ctx, req)
+}
 
-	stat, err := os.Stat(req.LocalFile)
+func (tb *ThunderBrowser) UploadFileCtx(ctx context.Context, req pan.UploadFileReq) (*pan.TransferResult, error) {
+	ctx, cancel := tb.JoinContext(ctx)
+	defer cancel()
+	content, err := pan.FileContent(req.LocalFile)
 	if err != nil {
 		return nil, err
 	}
-	remoteName := stat.Name()
+	return tb.upload(ctx, req, content)
+}
+
+func (tb *ThunderBrowser) UploadStream(req pan.UploadStreamReq) (*pan.TransferResult, error) {
+	return tb.UploadStreamCtx(tb.Context(), req)
+}
+
+func (tb *ThunderBrowser) UploadStreamCtx(ctx context.Context, req pan.UploadStreamReq) (*pan.TransferResult, error) {
+	ctx, cancel := tb.JoinContext(ctx)
+	defer cancel()
+	// 创建上传任务时需要提交 gcid
+	return tb.BaseUploadStream(ctx, req, []string{pan.HashGcid}, func(req pan.UploadFileReq, content *pan.UploadContent) (*pan.TransferResult, error) {
+		return tb.upload(ctx, req, content)
+	})
+}
+
+// upload 上传本地文件或数据流
+func (tb *ThunderBrowser) upload(ctx context.Context, req pan.UploadFileReq, content *pan.UploadContent) (*pan.TransferResult, error) {
+	if req.OnlyFast {
+		return nil, pan.KindMsg(pan.ErrUnsupported, "thunder_browser is not support fast upload")
+	}
+
+	remoteName := content.Name
 	remotePath := strings.TrimRight(req.RemotePath, "/")
 	if req.RemotePathTransfer != nil {
 		remotePath = req.RemotePathTransfer(remotePath)
@@ -325,121 +703,308 @@ func (tb *ThunderBrowser) UploadFile(req pan.UploadFileReq) (*pan.TransferResult
 		remoteName = req.RemoteNameTransfer(remoteName)
 	}
 	remoteAllPath := remotePath + "/" + remoteName
-	_, err = tb.GetPanObj(remoteAllPath, true, tb.List)
+	_, err := tb.GetPanObj(remoteAllPath, true, pan.WithCtx(ctx, tb.ListCtx))
 	// 没有报错证明文件已经存在
 	if err == nil {
-		return nil, pan.CodeMsg(CodeObjectExist, remoteAllPath+" is exist")
+		return nil, pan.KindCodeMsg(pan.ErrAlreadyExists, CodeObjectExist, remoteAllPath+" is exist")
+	}
+	if !errors.Is(err, pan.ErrNotFound) {
+		return nil, err
 	}
-	dir, err := tb.Mkdir(pan.MkdirReq{
+	dir, err := tb.MkdirCtx(ctx, pan.MkdirReq{
 		NewPath: remotePath,
 	})
 	if err != nil {
 		return nil, pan.MsgError(remotePath+" create error", err)
 	}
 
-	gcid, err := internal.GetFileGcid(req.LocalFile)
-	if err != nil {
-		return nil, err
-	}
-	parentId := dir.Id
-	if parentId == "0" {
-		parentId = ""
+	key := pan.JournalKey("upload", string(tb.DriverType), tb.Properties.Sub, remoteAllPath, content.Source())
+	// 只有本地文件可以续传，数据流无法重新读取已上传的部分
+	resumable := req.Resumable && content.LocalFile != ""
+	var record *pan.UploadRecord
+	var session uploadSession
+	if resumable {
+		record, session, err = tb.resumeUpload(ctx, key, content)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		tb.DeleteRecord(key)
 	}
-	resp, err := tb.uploadTask(UploadTaskRequest{
-		Kind:       FILE,
-		ParentId:   parentId,
-		Name:       remoteName,
-		Size:       stat.Size(),
-		Hash:       gcid,
-		UploadType: UploadTypeResumable,
-		Space:      ThunderDriveSpace,
-	})
 
-	if err != nil {
-		return nil, err
+	if record == nil {
+		gcid, err := content.Hash(pan.HashGcid)
+		if err != nil {
+			return nil, err
+		}
+		parentId := dir.Id
+		if parentId == "0" {
+			parentId = ""
+		}
+		resp, err := tb.uploadTask(ctx, UploadTaskRequest{
+			Kind:       FILE,
+			ParentId:   parentId,
+			Name:       remoteName,
+			Size:       content.Size,
+			Hash:       gcid,
+			UploadType: UploadTypeResumable,
+			Space:      ThunderDriveSpace,
+		})
+		if err != nil {
+			return nil, err
+		}
+		// 使用网盘返回的文件 ID
+		result := &pan.TransferResult{TaskId: resp.File.ID}
+		if resp.UploadType != UploadTypeResumable {
+			// 网盘已有相同 gcid 的文件，无需上传
+			tb.Del(cacheDirectoryPrefix + dir.Id)
+			tb.uploadSuccessDel(req)
+			return result, nil
+		}
+		session = uploadSession{FileId: resp.File.ID, Params: resp.Resumable.Params}
+		record = pan.NewUploadRecord(content, remoteAllPath)
+		record.SessionId = session.FileId
+		record.PartSize = tb.Properties.ChunkSize
+		if record.PartSize <= 0 {
+			record.PartSize = manager.DefaultUploadPartSize
+		}
+		if content.Size > int64(manager.MaxUploadParts)*record.PartSize {
+			record.PartSize = content.Size / (int64(manager.MaxUploadParts) - 1)
+		}
+		// 只有一个分片时直接 PutObject，不需要分片上传会话
+		if content.Size > record.PartSize {
+			out, err := tb.s3Client(session.Params).CreateMultipartUpload(ctx, &s3.CreateMultipartUploadInput{
+				Bucket:  aws.String(session.Params.Bucket),
+				Key:     aws.String(session.Params.Key),
+				Expires: aws.Time(session.Params.Expiration),
+			})
+			if err != nil {
+				return result, s3Error(err)
+			}
+			session.UploadId = aws.ToString(out.UploadId)
+			record.Session, _ = json.Marshal(session)
+			if resumable {
+				tb.SaveRecord(key, record)
+			}
+		}
 	}
 
-	// 使用网盘返回的文件 ID
-	fileTaskId := resp.File.ID
-	result := &pan.TransferResult{TaskId: fileTaskId}
-
-	param := resp.Resumable.Params
-	if resp.UploadType == UploadTypeResumable {
-		param.Endpoint = strings.TrimLeft(param.Endpoint, param.Bucket+".")
-		s3Client := s3.New(s3.Options{
-			Credentials:  credentials.NewStaticCredentialsProvider(param.AccessKeyID, param.AccessKeySecret, param.SecurityToken),
-			Region:       "xunlei",
-			BaseEndpoint: aws.String(param.Endpoint),
-		})
-		uploader := manager.NewUploader(s3Client)
-		if stat.Size() > int64(manager.MaxUploadParts)*manager.DefaultUploadPartSize {
-			uploader.PartSize = stat.Size() / (int64(manager.MaxUploadParts) - 1)
+	result := &pan.TransferResult{TaskId: session.FileId}
+	client := tb.s3Client(session.Params)
+	// 只有一个分片时 PutObject，否则上传到分片上传会话
+	put := func(ctx context.Context, number int, data []byte) (string, error) {
+		if session.UploadId == "" {
+			out, err := client.PutObject(ctx, &s3.PutObjectInput{
+				Bucket:  aws.String(session.Params.Bucket),
+				Key:     aws.String(session.Params.Key),
+				Expires: aws.Time(session.Params.Expiration),
+				Body:    bytes.NewReader(data),
+			})
+			if err != nil {
+				return "", s3Error(err)
+			}
+			return aws.ToString(out.ETag), nil
 		}
-		file, err := os.Open(req.LocalFile)
+		out, err := client.UploadPart(ctx, &s3.UploadPartInput{
+			Bucket:     aws.String(session.Params.Bucket),
+			Key:        aws.String(session.Params.Key),
+			UploadId:   aws.String(session.UploadId),
+			PartNumber: aws.Int32(int32(number)),
+			Body:       bytes.NewReader(data),
+		})
 		if err != nil {
+			return "", s3Error(err)
+		}
+		return aws.ToString(out.ETag), nil
+	}
+	if content.Size == 0 {
+		// 空文件没有分片
+		if _, err = put(ctx, 1, nil); err != nil {
 			return result, err
 		}
-		uploadCtx := context.Background()
-		if req.Ctx != nil {
-			uploadCtx = req.Ctx
+	}
+	concurrency := req.Concurrency
+	if concurrency <= 0 {
+		concurrency = manager.DefaultUploadConcurrency
+	}
+	parts, err := tb.BaseUploadParts(ctx, pan.UploadPartsReq{
+		Content:     content,
+		PartSize:    record.PartSize,
+		Concurrency: concurrency,
+		Done:        record.Parts,
+		PartDone: func(part pan.UploadPart) {
+			record.AddPart(part)
+			if resumable && session.UploadId != "" {
+				tb.SaveRecord(key, record)
+			}
+		},
+		TaskId:           req.TaskId,
+		FileId:           session.FileId,
+		ProgressCallback: req.ProgressCallback,
+	}, func(ctx context.Context, part pan.UploadPart, r io.Reader) (string, error) {
+		// S3 签名需要可重复读取的请求体，与 manager.Uploader 一样把分片读入内存
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return "", pan.OnlyError(err)
 		}
-		pw := pan.NewProgressWriter(req.LocalFile, stat.Size(), req.ProgressCallback)
-		if req.TaskId != "" {
-			pw.SetTaskId(req.TaskId)
+		return put(ctx, part.Number, data)
+	})
+	if err != nil {
+		return result, err
+	}
+	if session.UploadId != "" {
+		completed := make([]s3types.CompletedPart, 0, len(parts))
+		for _, part := range parts {
+			completed = append(completed, s3types.CompletedPart{
+				ETag:       aws.String(part.ETag),
+				PartNumber: aws.Int32(int32(part.Number)),
+			})
 		}
-		pw.SetFileId(fileTaskId)
-		_, err = uploader.Upload(uploadCtx, &s3.PutObjectInput{
-			Bucket:  aws.String(param.Bucket),
-			Key:     aws.String(param.Key),
-			Expires: aws.Time(param.Expiration),
-			Body:    io.TeeReader(file, pw),
+		_, err = client.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+			Bucket:          aws.String(session.Params.Bucket),
+			Key:             aws.String(session.Params.Key),
+			UploadId:        aws.String(session.UploadId),
+			MultipartUpload: &s3types.CompletedMultipartUpload{Parts: completed},
 		})
-		_ = file.Close()
-		if err == nil && req.SuccessDel {
-			err = os.Remove(req.LocalFile)
-			if err != nil {
-				internal.GetLogger().Error("delete fail", "file", req.LocalFile, "error", err)
-			} else {
-				internal.GetLogger().Info("delete success", "file", req.LocalFile)
-			}
+		if err != nil {
+			return result, s3Error(err)
 		}
-		return result, err
+		tb.DeleteRecord(key)
 	}
-
+	tb.Del(cacheDirectoryPrefix + dir.Id)
+	internal.GetLogger().Info("upload success", "file", content.Source(), "id", session.FileId)
+	tb.uploadSuccessDel(req)
 	return result, nil
 }
 
+// uploadSuccessDel 上传成功后按需删除本地文件
+func (tb *ThunderBrowser) uploadSuccessDel(req pan.UploadFileReq) {
+	if !req.SuccessDel {
+		return
+	}
+	err := os.Remove(req.LocalFile)
+	if err != nil {
+		internal.GetLogger().Error("delete fail", "file", req.LocalFile, "error", err)
+	} else {
+		internal.GetLogger().Info("delete success", "file", req.LocalFile)
+	}
+}
+
+// resumeUpload 读取上传记录，并以 S3 上已上传的分片为准确定可跳过的分片。
+// 没有记录、临时凭证已过期或分片上传已失效时返回 nil，调用方重新上传
+func (tb *ThunderBrowser) resumeUpload(ctx context.Context, key string, content *pan.UploadContent) (*pan.UploadRecord, uploadSession, error) {
+	var session uploadSession
+	record, ok := tb.LoadUploadRecord(key, content)
+	if !ok {
+		return nil, session, nil
+	}
+	if err := json.Unmarshal(record.Session, &session); err != nil || session.UploadId == "" || record.PartSize <= 0 {
+		tb.DeleteRecord(key)
+		return nil, session, nil
+	}
+	if time.Now().Add(time.Minute).After(session.Params.Expiration) {
+		internal.GetLogger().Info("upload credentials expired", "file", content.Source(), "uploadId", session.UploadId)
+		tb.DeleteRecord(key)
+		return nil, session, nil
+	}
+	listed, err := tb.s3ListParts(ctx, session)
+	if errors.Is(err, pan.ErrNotFound) {
+		internal.GetLogger().Info("upload session expired", "file", content.Source(), "uploadId", session.UploadId)
+		tb.DeleteRecord(key)
+		return nil, session, nil
+	}
+	if err != nil {
+		return nil, session, err
+	}
+	recorded := make(map[int]string, len(record.Parts))
+	for _, part := range record.Parts {
+		recorded[part.Number] = part.ETag
+	}
+	// 跳过 S3 上大小与 ETag 都与记录一致的分片，其余分片重新上传
+	parts := make([]pan.UploadPart, 0, len(listed))
+	for _, part := range listed {
+		number, size := int(aws.ToInt32(part.PartNumber)), aws.ToInt64(part.Size)
+		offset := int64(number-1) * record.PartSize
+		if number <= 0 || offset >= content.Size || size != min(record.PartSize, content.Size-offset) {
+			continue
+		}
+		if etag, ok := recorded[number]; ok && !strings.EqualFold(strings.Trim(etag, `"`), strings.Trim(aws.ToString(part.ETag), `"`)) {
+			continue
+		}
+		parts = append(parts, pan.UploadPart{Number: number, Size: size, ETag: aws.ToString(part.ETag)})
+	}
+	record.Parts, record.Uploaded = nil, 0
+	for _, part := range parts {
+		record.AddPart(part)
+	}
+	internal.GetLogger().Info("resume upload", "file", content.Source(), "uploadId", session.UploadId, "parts", len(record.Parts), "uploaded", record.Uploaded)
+	return record, session, nil
+}
+
 func (tb *ThunderBrowser) DownloadPath(req pan.DownloadPathReq) (*pan.TransferResult, error) {
-	err := tb.BaseDownloadPath(req, tb.List, tb.DownloadFile)
+	return tb.DownloadPathCtx(tb.Context(), req)
+}
+
+func (tb *ThunderBrowser) DownloadPathCtx(ctx context.Context, req pan.DownloadPathReq) (*pan.TransferResult, error) {
+	ctx, cancel := tb.JoinContext(ctx)
+	defer cancel()
+	err := tb.BaseDownloadPath(ctx, req, pan.WithCtx(ctx, tb.ListCtx), pan.WithCtx(ctx, tb.DownloadFileCtx))
 	return nil, err
 }
 func (tb *ThunderBrowser) DownloadFile(req pan.DownloadFileReq) (*pan.TransferResult, error) {
+	return tb.DownloadFileCtx(req.Ctx, req)
+}
+
+func (tb *ThunderBrowser) DownloadFileCtx(ctx context.Context, req pan.DownloadFileReq) (*pan.TransferResult, error) {
+	ctx, cancel := tb.JoinContext(ctx)
+	defer cancel()
+	req.Ctx = ctx
 	err := tb.BaseDownloadFile(req, tb.downloadClient, func(req pan.DownloadFileReq) (string, error) {
-		link, err := tb.getLink(req.RemoteFile.Id)
+		link, err := tb.DownloadLinkCtx(ctx, req.RemoteFile)
 		if err != nil {
 			return "", err
 		}
-		downloadLink := link.WebContentLink
-		if downloadLink == "" {
-			internal.GetLogger().Error("cant get link, try media link", "name", req.RemoteFile.Name)
-			for _, media := range link.Medias {
-				if media.Link.URL != "" {
-					downloadLink = media.Link.URL
-					break
-				}
-			}
-		}
-		if downloadLink == "" {
-			internal.GetLogger().Debug("cant get link", "name", req.RemoteFile.Name, "link", link)
-			return "", pan.OnlyMsg(fmt.Sprintf("cant get link:%s", req.RemoteFile.Name))
-		}
-		return downloadLink, nil
+		return link.Url, nil
 	})
 	return nil, err
 }
 
+func (tb *ThunderBrowser) DownloadLinkCtx(ctx context.Context, file *pan.PanObj) (*pan.DownloadLink, error) {
+	ctx, cancel := tb.JoinContext(ctx)
+	defer cancel()
+	link, err := tb.getLink(ctx, file.Id)
+	if err != nil {
+		return nil, err
+	}
+	downloadLink := link.WebContentLink
+	if downloadLink == "" {
+		internal.GetLogger().Error("cant get link, try media link", "name", file.Name)
+		for _, media := range link.Medias {
+			if media.Link.URL != "" {
+				downloadLink = media.Link.URL
+				break
+			}
+		}
+	}
+	if downloadLink == "" {
+		internal.GetLogger().Debug("cant get link", "name", file.Name, "link", link)
+		return nil, pan.OnlyMsg(fmt.Sprintf("cant get link:%s", file.Name))
+	}
+	return &pan.DownloadLink{Url: downloadLink, Client: tb.downloadClient}, nil
+}
+
+func (tb *ThunderBrowser) Open(ctx context.Context, file *pan.PanObj) (io.ReadSeekCloser, error) {
+	return tb.BaseOpen(ctx, file, tb.DownloadLinkCtx)
+}
+
 func (tb *ThunderBrowser) OfflineDownload(req pan.OfflineDownloadReq) (*pan.Task, error) {
-	dir, err := tb.Mkdir(pan.MkdirReq{
+	return tb.OfflineDownloadCtx(tb.Context(), req)
+}
+
+func (tb *ThunderBrowser) OfflineDownloadCtx(ctx context.Context, req pan.OfflineDownloadReq) (*pan.Task, error) {
+	ctx, cancel := tb.JoinContext(ctx)
+	defer cancel()
+	dir, err := tb.MkdirCtx(ctx, pan.MkdirReq{
 		NewPath: req.RemotePath,
 	})
 	if err != nil {
@@ -453,7 +1018,7 @@ func (tb *ThunderBrowser) OfflineDownload(req pan.OfflineDownloadReq) (*pan.Task
 	if remoteName == "" {
 		remoteName = req.Url
 	}
-	taskResp, e := tb.uploadTask(UploadTaskRequest{
+	taskResp, e := tb.uploadTask(ctx, UploadTaskRequest{
 		Kind:       FILE,
 		ParentId:   parentId,
 		Name:       remoteName,
@@ -480,7 +1045,13 @@ func (tb *ThunderBrowser) OfflineDownload(req pan.OfflineDownloadReq) (*pan.Task
 }
 
 func (tb *ThunderBrowser) TaskList(req pan.TaskListReq) ([]*pan.Task, error) {
-	tasks, err := tb.taskQuery(TaskQueryRequest{
+	return tb.TaskListCtx(tb.Context(), req)
+}
+
+func (tb *ThunderBrowser) TaskListCtx(ctx context.Context, req pan.TaskListReq) ([]*pan.Task, error) {
+	ctx, cancel := tb.JoinContext(ctx)
+	defer cancel()
+	tasks, err := tb.taskQuery(ctx, TaskQueryRequest{
 		Space:  ThunderDriveSpace,
 		Types:  req.Types,
 		Ids:    req.Ids,
@@ -507,7 +1078,13 @@ func (tb *ThunderBrowser) TaskList(req pan.TaskListReq) ([]*pan.Task, error) {
 }
 
 func (tb *ThunderBrowser) ShareList(req pan.ShareListReq) ([]*pan.ShareData, error) {
-	shareList, err := tb.shareList(req.ShareIds...)
+	return tb.ShareListCtx(tb.Context(), req)
+}
+
+func (tb *ThunderBrowser) ShareListCtx(ctx context.Context, req pan.ShareListReq) ([]*pan.ShareData, error) {
+	ctx, cancel := tb.JoinContext(ctx)
+	defer cancel()
+	shareList, err := tb.shareList(ctx, req.ShareIds...)
 	if err != nil {
 		return nil, err
 	}
@@ -523,7 +1100,13 @@ func (tb *ThunderBrowser) ShareList(req pan.ShareListReq) ([]*pan.ShareData, err
 	return result, nil
 }
 func (tb *ThunderBrowser) NewShare(req pan.NewShareReq) (*pan.ShareData, error) {
-	share, err := tb.createShare(CreateShareReq{
+	return tb.NewShareCtx(tb.Context(), req)
+}
+
+func (tb *ThunderBrowser) NewShareCtx(ctx context.Context, req pan.NewShareReq) (*pan.ShareData, error) {
+	ctx, cancel := tb.JoinContext(ctx)
+	defer cancel()
+	share, err := tb.createShare(ctx, CreateShareReq{
 		FileIds: req.Fids,
 		ShareTo: "copy",
 		Params: CreateShareParams{
@@ -544,9 +1127,15 @@ func (tb *ThunderBrowser) NewShare(req pan.NewShareReq) (*pan.ShareData, error)
 	}, nil
 }
 func (tb *ThunderBrowser) DeleteShare(req pan.DelShareReq) error {
+	return tb.DeleteShareCtx(tb.Context(), req)
+}
+
+func (tb *ThunderBrowser) DeleteShareCtx(ctx context.Context, req pan.DelShareReq) error {
+	ctx, cancel := tb.JoinContext(ctx)
+	defer cancel()
 	shareIds := req.ShareIds
 	for _, shareId := range shareIds {
-		err := tb.deleteShare(shareId)
+		err := tb.deleteShare(ctx, shareId)
 		if err != nil {
 			return err
 		}
@@ -555,6 +1144,12 @@ func (tb *ThunderBrowser) DeleteShare(req pan.DelShareReq) error {
 }
 
 func (tb *ThunderBrowser) ShareRestore(req pan.ShareRestoreReq) error {
+	return tb.ShareRestoreCtx(tb.Context(), req)
+}
+
+func (tb *ThunderBrowser) ShareRestoreCtx(ctx context.Context, req pan.ShareRestoreReq) error {
+	ctx, cancel := tb.JoinContext(ctx)
+	defer cancel()
 	passCode := req.PassCode
 	shareId := req.ShareId
 	targetDir := req.TargetDir
@@ -577,13 +1172,17 @@ func (tb *ThunderBrowser) ShareRestore(req pan.ShareRestoreReq) error {
 		// 从查询参数中提取分享ID和密码
 		passCode = queryParams.Get("pwd")
 	}
-	parentDir, err := tb.Mkdir(pan.MkdirReq{
+	parentDir, err := tb.MkdirCtx(ctx, pan.MkdirReq{
 		NewPath: targetDir,
 	})
 	if err != nil {
 		return err
 	}
-	share, err := tb.getShare(ShareDetailReq{
+	parentId := parentDir.Id
+	if parentId == "0" {
+		parentId = ""
+	}
+	share, err := tb.getShare(ctx, ShareDetailReq{
 		ShareId:  shareId,
 		PassCode: passCode,
 	})
@@ -594,8 +1193,8 @@ func (tb *ThunderBrowser) ShareRestore(req pan.ShareRestoreReq) error {
 	for _, file := range share.Files {
 		fileIds = append(fileIds, file.ID)
 	}
-	restore, err := tb.restore(RestoreReq{
-		ParentId:        parentDir.Id,
+	restore, err := tb.restore(ctx, RestoreReq{
+		ParentId:        parentId,
 		ShareId:         shareId,
 		PassCodeToken:   share.PassCodeToken,
 		AncestorIds:     nil,
@@ -606,20 +1205,26 @@ func (tb *ThunderBrowser) ShareRestore(req pan.ShareRestoreReq) error {
 		return err
 	}
 	for {
-		info, err := tb.taskInfo(restore.RestoreTaskId)
+		info, err := tb.taskInfo(ctx, restore.RestoreTaskId)
 		if err != nil {
 			return err
 		}
 		if info.Phase == PhaseTypeComplete {
 			break
 		}
-		time.Sleep(time.Second)
+		if err := internal.SleepCtx(ctx, time.Second); err != nil {
+			return pan.OnlyError(err)
+		}
 	}
 	return nil
 }
 
 func (tb *ThunderBrowser) DirectLink(req pan.DirectLinkReq) ([]*pan.DirectLink, error) {
-	return nil, pan.OnlyMsg("direct link not support")
+	return tb.DirectLinkCtx(tb.Context(), req)
+}
+
+func (tb *ThunderBrowser) DirectLinkCtx(ctx context.Context, req pan.DirectLinkReq) ([]*pan.DirectLink, error) {
+	return nil, pan.KindMsg(pan.ErrUnsupported, "direct link not support")
 }
 
 func init() {
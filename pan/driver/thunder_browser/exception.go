@@ -1,7 +1,36 @@
 package thunder_browser
 
+import (
+	"strings"
+
+	"github.com/hefeiyu25/pan-client/pan"
+)
+
 // 定义异常编码和异常信息
 const (
 	// CodeObjectExist 对象已存在
 	CodeObjectExist = 40004
 )
+
+// codeError 将迅雷错误码（gRPC 状态码及登录相关码）映射为 pan 的错误类型，未识别的错误码按 HTTP 状态判断
+func codeError(status int, code int64, msg string) pan.DriverErrorInterface {
+	c := int(code)
+	switch code {
+	case 10, 16, 4121, 4122:
+		return pan.KindCodeMsg(pan.ErrAuthExpired, c, msg)
+	case 5:
+		return pan.KindCodeMsg(pan.ErrNotFound, c, msg)
+	case 6:
+		return pan.KindCodeMsg(pan.ErrAlreadyExists, c, msg)
+	case 8:
+		if strings.Contains(msg, "frequen") || strings.Contains(msg, "too_many") {
+			return pan.KindCodeMsg(pan.ErrRateLimited, c, msg)
+		}
+		return pan.KindCodeMsg(pan.ErrQuotaExceeded, c, msg)
+	case 12:
+		return pan.KindCodeMsg(pan.ErrUnsupported, c, msg)
+	case 4, 14:
+		return pan.RetryCodeMsg(c, msg)
+	}
+	return pan.StatusCodeMsg(status, c, msg)
+}
@@ -1,30 +1,72 @@
 package thunder_browser
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
 	"github.com/hefeiyu25/pan-client/internal"
 	"github.com/hefeiyu25/pan-client/pan"
 	"github.com/imroc/req/v3"
 	"net/http"
+	"net/url"
 	"regexp"
 	"strconv"
 	"strings"
 	"time"
 )
 
+// apiUrl 返回网盘接口地址，未配置时使用官方地址
+func (tb *ThunderBrowser) apiUrl() string {
+	if tb.Properties.ApiUrl != "" {
+		return strings.TrimRight(tb.Properties.ApiUrl, "/")
+	}
+	return API_URL
+}
+
+// checkUrls 校验配置的接口地址，必须是带 host 的 http(s) 地址
+func (tb *ThunderBrowser) checkUrls() error {
+	for _, item := range [][2]string{
+		{"api_url", tb.Properties.ApiUrl},
+		{"user_api_url", tb.Properties.UserApiUrl},
+		{"upload_url", tb.Properties.UploadUrl},
+	} {
+		if item[1] == "" {
+			continue
+		}
+		u, err := url.Parse(item[1])
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid %s %q: need an http or https url", item[0], item[1])
+		}
+	}
+	return nil
+}
+
+// userApiUrl 返回用户（登录、验证码）接口地址，未配置时使用官方地址
+func (tb *ThunderBrowser) userApiUrl() string {
+	if tb.Properties.UserApiUrl != "" {
+		return strings.TrimRight(tb.Properties.UserApiUrl, "/")
+	}
+	return XLUSER_API_URL
+}
+
 func funReturnBySuccess[T any](err error, response *req.Response, errorResult ErrResp, successResult T) (*T, pan.DriverErrorInterface) {
 	if err != nil {
 		return nil, pan.OnlyError(err)
 	}
 	if response.IsErrorState() {
-		return nil, pan.CodeMsg(int(errorResult.ErrorCode), errorResult.ErrorMsg)
+		return nil, codeError(response.StatusCode, errorResult.ErrorCode, errorResult.ErrorMsg)
 	}
 	return &successResult, pan.NoError()
 }
 
 // refreshToken 刷新Token
-func (tb *ThunderBrowser) refreshToken(refreshToken string) (*TokenResp, pan.DriverErrorInterface) {
-	r := tb.sessionClient.R()
+func (tb *ThunderBrowser) refreshToken(ctx context.Context, refreshToken string) (*TokenResp, pan.DriverErrorInterface) {
+	r := tb.sessionClient.R().SetContext(ctx)
 	var successResult TokenResp
 	var errorResult ErrResp
 	r.SetSuccessResult(&successResult)
@@ -35,7 +77,7 @@ func (tb *ThunderBrowser) refreshToken(refreshToken string) (*TokenResp, pan.Dri
 		ClientID:     ClientID,
 		ClientSecret: ClientSecret,
 	})
-	response, err := r.Post(XLUSER_API_URL + "/auth/token")
+	response, err := r.Post(tb.userApiUrl() + "/auth/token")
 	tokenResp, e := funReturnBySuccess(err, response, errorResult, successResult)
 	if e == nil {
 		tb.setTokenResp(tokenResp)
@@ -44,8 +86,8 @@ func (tb *ThunderBrowser) refreshToken(refreshToken string) (*TokenResp, pan.Dri
 }
 
 // 刷新验证码token
-func (tb *ThunderBrowser) refreshCaptchaToken(action string, metas map[string]string) pan.DriverErrorInterface {
-	r := tb.sessionClient.R()
+func (tb *ThunderBrowser) refreshCaptchaToken(ctx context.Context, action string, metas map[string]string) pan.DriverErrorInterface {
+	r := tb.sessionClient.R().SetContext(ctx)
 	var successResult CaptchaTokenResponse
 	var errorResult ErrResp
 	r.SetSuccessResult(&successResult)
@@ -58,7 +100,7 @@ func (tb *ThunderBrowser) refreshCaptchaToken(action string, metas map[string]st
 		Meta:         metas,
 		RedirectUri:  "xlaccsdk01://xunlei.com/callback?state=harbor",
 	})
-	resp, err := r.Post(XLUSER_API_URL + "/shield/captcha/init")
+	resp, err := r.Post(tb.userApiUrl() + "/shield/captcha/init")
 
 	result, e := funReturnBySuccess(err, resp, errorResult, successResult)
 	if e != nil {
@@ -66,7 +108,7 @@ func (tb *ThunderBrowser) refreshCaptchaToken(action string, metas map[string]st
 	}
 
 	if result.Url != "" {
-		return pan.OnlyMsg(fmt.Sprintf(`need verify: <a target="_blank" href="%s">Click Here</a>`, result.Url))
+		return pan.KindMsg(pan.ErrAuthExpired, fmt.Sprintf(`need verify: <a target="_blank" href="%s">Click Here</a>`, result.Url))
 	}
 
 	if result.CaptchaToken == "" {
@@ -90,18 +132,18 @@ func (tb *ThunderBrowser) getCaptchaSign() (timestamp, sign string) {
 }
 
 // refreshCaptchaTokenAtLogin 刷新验证码token(登录后)
-func (tb *ThunderBrowser) refreshCaptchaTokenAtLogin(action, userID string) pan.DriverErrorInterface {
+func (tb *ThunderBrowser) refreshCaptchaTokenAtLogin(ctx context.Context, action, userID string) pan.DriverErrorInterface {
 	metas := map[string]string{
 		"client_version": ClientVersion,
 		"package_name":   PackageName,
 		"user_id":        userID,
 	}
 	metas["timestamp"], metas["captcha_sign"] = tb.getCaptchaSign()
-	return tb.refreshCaptchaToken(action, metas)
+	return tb.refreshCaptchaToken(ctx, action, metas)
 }
 
 // refreshCaptchaTokenInLogin 刷新验证码token(登录时)
-func (tb *ThunderBrowser) refreshCaptchaTokenInLogin(action, username string) pan.DriverErrorInterface {
+func (tb *ThunderBrowser) refreshCaptchaTokenInLogin(ctx context.Context, action, username string) pan.DriverErrorInterface {
 	metas := make(map[string]string)
 	if ok, _ := regexp.MatchString(`\w+([-+.]\w+)*@\w+([-.]\w+)*\.\w+([-.]\w+)*`, username); ok {
 		metas["email"] = username
@@ -110,12 +152,31 @@ func (tb *ThunderBrowser) refreshCaptchaTokenInLogin(action, username string) pa
 	} else {
 		metas["username"] = username
 	}
-	return tb.refreshCaptchaToken(action, metas)
+	return tb.refreshCaptchaToken(ctx, action, metas)
 }
 
+// GetAction 返回验证码的 action，即请求方法与地址路径，如 POST:/v1/auth/signin
 func GetAction(method string, url string) string {
-	urlpath := regexp.MustCompile(`://[^/]+((/[^/\s?#]+)*)`).FindStringSubmatch(url)[1]
-	return method + ":" + urlpath
+	match := regexp.MustCompile(`://[^/]+((/[^/\s?#]+)*)`).FindStringSubmatch(url)
+	if match == nil {
+		return method + ":" + url
+	}
+	return method + ":" + match[1]
+}
+
+// captchaAction 返回请求对应的验证码 action。迅雷按官方接口路径校验 action，
+// 所以先把配置的接口地址（反向代理前缀、fake 服务）换回官方地址再计算
+func (tb *ThunderBrowser) captchaAction(method, rawUrl string) string {
+	official := rawUrl
+	matched := ""
+	for base, officialBase := range map[string]string{tb.apiUrl(): API_URL, tb.userApiUrl(): XLUSER_API_URL} {
+		// 两个地址互为前缀时取更长的一个
+		if strings.HasPrefix(rawUrl, base) && len(base) > len(matched) {
+			matched = base
+			official = officialBase + strings.TrimPrefix(rawUrl, base)
+		}
+	}
+	return GetAction(method, official)
 }
 
 func (tb *ThunderBrowser) setTokenResp(tokenResp *TokenResp) {
@@ -128,13 +189,13 @@ func (tb *ThunderBrowser) setTokenResp(tokenResp *TokenResp) {
 	tb.NotifyChange()
 }
 
-func (tb *ThunderBrowser) login(username, password string) (*TokenResp, pan.DriverErrorInterface) {
-	url := XLUSER_API_URL + "/auth/signin"
-	err := tb.refreshCaptchaTokenInLogin(GetAction(http.MethodPost, url), username)
+func (tb *ThunderBrowser) login(ctx context.Context, username, password string) (*TokenResp, pan.DriverErrorInterface) {
+	url := tb.userApiUrl() + "/auth/signin"
+	err := tb.refreshCaptchaTokenInLogin(ctx, tb.captchaAction(http.MethodPost, url), username)
 	if err != nil {
 		return nil, err
 	}
-	r := tb.sessionClient.R()
+	r := tb.sessionClient.R().SetContext(ctx)
 	var successResult TokenResp
 	var errorResult ErrResp
 	r.SetSuccessResult(&successResult)
@@ -154,36 +215,36 @@ func (tb *ThunderBrowser) login(username, password string) (*TokenResp, pan.Driv
 	return tokenResp, e
 }
 
-func (tb *ThunderBrowser) userMe() (*UserMeResp, pan.DriverErrorInterface) {
+func (tb *ThunderBrowser) userMe(ctx context.Context) (*UserMeResp, pan.DriverErrorInterface) {
 	var successResult UserMeResp
-	_, err := tb.request(func(r *req.Request) (*req.Response, error) {
+	_, err := tb.request(ctx, func(r *req.Request) (*req.Response, error) {
 		r.SetSuccessResult(&successResult)
-		return r.Get(XLUSER_API_URL + "/user/me")
+		return r.Get(tb.userApiUrl() + "/user/me")
 	})
 	return &successResult, err
 }
 
-func (tb *ThunderBrowser) rename(fileId string, newName string) (*Files, pan.DriverErrorInterface) {
+func (tb *ThunderBrowser) rename(ctx context.Context, fileId string, newName string) (*Files, pan.DriverErrorInterface) {
 	var newFile Files
-	_, err := tb.request(func(r *req.Request) (*req.Response, error) {
+	_, err := tb.request(ctx, func(r *req.Request) (*req.Response, error) {
 		r.SetPathParam("fileID", fileId)
 		r.SetBody(&pan.Json{"name": newName})
 		r.SetQueryParams(map[string]string{
 			"space": "",
 		})
 		r.SetSuccessResult(&newFile)
-		return r.Patch(API_URL + "/files/{fileID}")
+		return r.Patch(tb.apiUrl() + "/files/{fileID}")
 	})
 	return &newFile, err
 }
 
-func (tb *ThunderBrowser) makeDir(dirName, dirId string) (*MkdirResponse, pan.DriverErrorInterface) {
+func (tb *ThunderBrowser) makeDir(ctx context.Context, dirName, dirId string) (*MkdirResponse, pan.DriverErrorInterface) {
 	parentId := dirId
 	if dirId == "0" {
 		parentId = ""
 	}
 	var successResult MkdirResponse
-	_, err := tb.request(func(r *req.Request) (*req.Response, error) {
+	_, err := tb.request(ctx, func(r *req.Request) (*req.Response, error) {
 		r.SetSuccessResult(&successResult)
 		r.SetBody(pan.Json{
 			"kind":      FOLDER,
@@ -191,13 +252,13 @@ func (tb *ThunderBrowser) makeDir(dirName, dirId string) (*MkdirResponse, pan.Dr
 			"parent_id": parentId,
 			"space":     ThunderDriveSpace,
 		})
-		return r.Post(API_URL + "/files")
+		return r.Post(tb.apiUrl() + "/files")
 	})
 	return &successResult, err
 }
 
-func (tb *ThunderBrowser) move(srcIds []string, destId string) pan.DriverErrorInterface {
-	_, err := tb.request(func(r *req.Request) (*req.Response, error) {
+func (tb *ThunderBrowser) move(ctx context.Context, srcIds []string, destId string) pan.DriverErrorInterface {
+	_, err := tb.request(ctx, func(r *req.Request) (*req.Response, error) {
 		r.SetQueryParams(map[string]string{
 			"_from": ThunderDriveSpace,
 		})
@@ -206,75 +267,96 @@ func (tb *ThunderBrowser) move(srcIds []string, destId string) pan.DriverErrorIn
 			"space": ThunderDriveSpace,
 			"ids":   srcIds,
 		})
-		return r.Post(API_URL + "/files:batchMove")
+		return r.Post(tb.apiUrl() + "/files:batchMove")
 	})
 	return err
 }
 
-func (tb *ThunderBrowser) remove(ids []string) pan.DriverErrorInterface {
-	_, err := tb.request(func(r *req.Request) (*req.Response, error) {
+func (tb *ThunderBrowser) batchCopy(ctx context.Context, srcIds []string, destId string) pan.DriverErrorInterface {
+	_, err := tb.request(ctx, func(r *req.Request) (*req.Response, error) {
+		r.SetQueryParams(map[string]string{
+			"_from": ThunderDriveSpace,
+		})
+		r.SetBody(pan.Json{
+			"to":    pan.Json{"parent_id": destId, "space": ThunderDriveSpace},
+			"space": ThunderDriveSpace,
+			"ids":   srcIds,
+		})
+		return r.Post(tb.apiUrl() + "/files:batchCopy")
+	})
+	return err
+}
+
+func (tb *ThunderBrowser) remove(ctx context.Context, ids []string) pan.DriverErrorInterface {
+	_, err := tb.request(ctx, func(r *req.Request) (*req.Response, error) {
 		r.SetBody(pan.Json{
 			"ids":   ids,
 			"space": ThunderDriveSpace,
 		})
-		return r.Post(API_URL + "/files:batchDelete")
+		return r.Post(tb.apiUrl() + "/files:batchDelete")
 	})
 	return err
 }
 
-func (tb *ThunderBrowser) getLink(id string) (*Files, pan.DriverErrorInterface) {
-	var lFile Files
-	_, err := tb.request(func(r *req.Request) (*req.Response, error) {
-		r.SetPathParam("fileID", id)
-		r.SetQueryParams(map[string]string{
-			"_magic":         "2021",
-			"space":          ThunderDriveSpace,
-			"thumbnail_size": "SIZE_LARGE",
-			"with":           "url",
+// trash 将对象移入回收站（batchTrash）或从回收站还原（batchUntrash）
+func (tb *ThunderBrowser) trash(ctx context.Context, action string, ids []string) pan.DriverErrorInterface {
+	_, err := tb.request(ctx, func(r *req.Request) (*req.Response, error) {
+		r.SetBody(pan.Json{
+			"ids":   ids,
+			"space": ThunderDriveSpace,
 		})
-		r.SetSuccessResult(&lFile)
-		return r.Get(API_URL + "/files/{fileID}")
+		return r.Post(tb.apiUrl() + "/files:" + action)
+	})
+	return err
+}
+
+func (tb *ThunderBrowser) emptyTrash(ctx context.Context) pan.DriverErrorInterface {
+	_, err := tb.request(ctx, func(r *req.Request) (*req.Response, error) {
+		r.SetQueryParam("space", ThunderDriveSpace)
+		return r.Patch(tb.apiUrl() + "/files/trash:empty")
+	})
+	return err
+}
+
+func (tb *ThunderBrowser) getTrashFiles(ctx context.Context) ([]*Files, pan.DriverErrorInterface) {
+	return tb.filterFiles(ctx, "", `{"trashed":{"eq":true}}`)
+}
+
+// searchFiles 按文件名关键字搜索整个网盘
+func (tb *ThunderBrowser) searchFiles(ctx context.Context, keyword string) ([]*Files, pan.DriverErrorInterface) {
+	filters, err := json.Marshal(map[string]any{
+		"name":    map[string]string{"include": keyword},
+		"trashed": map[string]bool{"eq": false},
 	})
 	if err != nil {
-		return nil, err
+		return nil, pan.OnlyError(err)
 	}
-	return &lFile, err
+	return tb.filterFiles(ctx, "*", string(filters))
 }
 
-func (tb *ThunderBrowser) getFiles(dirId string) ([]*Files, pan.DriverErrorInterface) {
-	parentId := dirId
-	if dirId == "0" {
-		parentId = ""
-	}
+// filterFiles 逐页拉取满足 filters 的文件，parentId 为 * 时不限目录
+func (tb *ThunderBrowser) filterFiles(ctx context.Context, parentId, filters string) ([]*Files, pan.DriverErrorInterface) {
 	files := make([]*Files, 0)
 	var pageToken string
 	for {
 		var successResult FileList
-		_, err := tb.request(func(r *req.Request) (*req.Response, error) {
+		_, err := tb.request(ctx, func(r *req.Request) (*req.Response, error) {
 			r.SetSuccessResult(&successResult)
 			r.SetQueryParams(map[string]string{
-				"parent_id":      parentId,
 				"page_token":     pageToken,
 				"space":          ThunderDriveSpace,
-				"filters":        `{"trashed":{"eq":false}}`,
-				"with":           "url",
-				"with_audit":     "true",
+				"filters":        filters,
 				"thumbnail_size": "SIZE_LARGE",
 			})
-			return r.Get(API_URL + "/files")
+			if parentId != "" {
+				r.SetQueryParam("parent_id", parentId)
+			}
+			return r.Get(tb.apiUrl() + "/files")
 		})
 		if err != nil {
 			return nil, err
 		}
-
-		for _, file := range successResult.Files {
-			// 解决 "迅雷云盘" 重复出现问题————迅雷后端发送错误
-			if file.FolderType == ThunderDriveFolderType && file.ID == "" && file.Space == "" && dirId != "" {
-				continue
-			}
-			files = append(files, file)
-		}
-
+		files = append(files, successResult.Files...)
 		if successResult.NextPageToken == "" {
 			break
 		}
@@ -283,12 +365,82 @@ func (tb *ThunderBrowser) getFiles(dirId string) ([]*Files, pan.DriverErrorInter
 	return files, nil
 }
 
-func (tb *ThunderBrowser) uploadTask(body UploadTaskRequest) (*UploadTaskResponse, pan.DriverErrorInterface) {
+func (tb *ThunderBrowser) getLink(ctx context.Context, id string) (*Files, pan.DriverErrorInterface) {
+	var lFile Files
+	_, err := tb.request(ctx, func(r *req.Request) (*req.Response, error) {
+		r.SetPathParam("fileID", id)
+		r.SetQueryParams(map[string]string{
+			"_magic":         "2021",
+			"space":          ThunderDriveSpace,
+			"thumbnail_size": "SIZE_LARGE",
+			"with":           "url",
+		})
+		r.SetSuccessResult(&lFile)
+		return r.Get(tb.apiUrl() + "/files/{fileID}")
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &lFile, err
+}
+
+func (tb *ThunderBrowser) getFiles(ctx context.Context, dirId string) ([]*Files, pan.DriverErrorInterface) {
+	files := make([]*Files, 0)
+	var pageToken string
+	for {
+		page, next, err := tb.getFilesPage(ctx, dirId, pageToken)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, page...)
+		if next == "" {
+			break
+		}
+		pageToken = next
+	}
+	return files, nil
+}
+
+// getFilesPage 拉取目录的一页文件，返回下一页的 token，最后一页为空
+func (tb *ThunderBrowser) getFilesPage(ctx context.Context, dirId, pageToken string) ([]*Files, string, pan.DriverErrorInterface) {
+	parentId := dirId
+	if dirId == "0" {
+		parentId = ""
+	}
+	var successResult FileList
+	_, err := tb.request(ctx, func(r *req.Request) (*req.Response, error) {
+		r.SetSuccessResult(&successResult)
+		r.SetQueryParams(map[string]string{
+			"parent_id":      parentId,
+			"page_token":     pageToken,
+			"space":          ThunderDriveSpace,
+			"filters":        `{"trashed":{"eq":false}}`,
+			"with":           "url",
+			"with_audit":     "true",
+			"thumbnail_size": "SIZE_LARGE",
+		})
+		return r.Get(tb.apiUrl() + "/files")
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	files := make([]*Files, 0, len(successResult.Files))
+	for _, file := range successResult.Files {
+		// 解决 "迅雷云盘" 重复出现问题————迅雷后端发送错误
+		if file.FolderType == ThunderDriveFolderType && file.ID == "" && file.Space == "" && dirId != "" {
+			continue
+		}
+		files = append(files, file)
+	}
+	return files, successResult.NextPageToken, nil
+}
+
+func (tb *ThunderBrowser) uploadTask(ctx context.Context, body UploadTaskRequest) (*UploadTaskResponse, pan.DriverErrorInterface) {
 	var successResult UploadTaskResponse
-	_, err := tb.request(func(r *req.Request) (*req.Response, error) {
+	_, err := tb.request(ctx, func(r *req.Request) (*req.Response, error) {
 		r.SetSuccessResult(&successResult)
 		r.SetBody(body)
-		return r.Post(API_URL + "/files")
+		return r.Post(tb.apiUrl() + "/files")
 	})
 	if err != nil {
 		return nil, err
@@ -296,19 +448,19 @@ func (tb *ThunderBrowser) uploadTask(body UploadTaskRequest) (*UploadTaskRespons
 	return &successResult, err
 }
 
-func (tb *ThunderBrowser) taskInfo(taskId string) (*Task, pan.DriverErrorInterface) {
+func (tb *ThunderBrowser) taskInfo(ctx context.Context, taskId string) (*Task, pan.DriverErrorInterface) {
 	var successResult Task
-	_, err := tb.request(func(r *req.Request) (*req.Response, error) {
+	_, err := tb.request(ctx, func(r *req.Request) (*req.Response, error) {
 		r.SetSuccessResult(&successResult)
 		r.SetPathParams(map[string]string{
 			"taskId": taskId,
 		})
-		return r.Get(API_URL + "/tasks/{taskId}")
+		return r.Get(tb.apiUrl() + "/tasks/{taskId}")
 	})
 	return &successResult, err
 }
 
-func (tb *ThunderBrowser) taskQuery(taskQueryReq TaskQueryRequest) ([]*Task, pan.DriverErrorInterface) {
+func (tb *ThunderBrowser) taskQuery(ctx context.Context, taskQueryReq TaskQueryRequest) ([]*Task, pan.DriverErrorInterface) {
 
 	tasks := make([]*Task, 0)
 	var pageToken string
@@ -326,7 +478,7 @@ func (tb *ThunderBrowser) taskQuery(taskQueryReq TaskQueryRequest) ([]*Task, pan
 	filters += `}`
 	for {
 		var successResult TaskQueryResponse
-		_, err := tb.request(func(r *req.Request) (*req.Response, error) {
+		_, err := tb.request(ctx, func(r *req.Request) (*req.Response, error) {
 			r.SetSuccessResult(&successResult)
 			r.SetQueryParams(map[string]string{
 				"page_token":     pageToken,
@@ -336,7 +488,7 @@ func (tb *ThunderBrowser) taskQuery(taskQueryReq TaskQueryRequest) ([]*Task, pan
 				"limit":          strconv.FormatInt(taskQueryReq.Limit, 10),
 				"thumbnail_size": "SIZE_SMALL",
 			})
-			return r.Get(API_URL + "/tasks")
+			return r.Get(tb.apiUrl() + "/tasks")
 		})
 		if err != nil {
 			return nil, err
@@ -354,7 +506,7 @@ func (tb *ThunderBrowser) taskQuery(taskQueryReq TaskQueryRequest) ([]*Task, pan
 	return tasks, nil
 }
 
-func (tb *ThunderBrowser) shareList(shareIds ...string) ([]*ShareInfo, pan.DriverErrorInterface) {
+func (tb *ThunderBrowser) shareList(ctx context.Context, shareIds ...string) ([]*ShareInfo, pan.DriverErrorInterface) {
 	var pageToken string
 	filters := `{`
 	if len(shareIds) > 0 {
@@ -365,7 +517,7 @@ func (tb *ThunderBrowser) shareList(shareIds ...string) ([]*ShareInfo, pan.Drive
 	shareList := make([]*ShareInfo, 0)
 	for {
 		var successResult ShareListResp
-		_, err := tb.request(func(r *req.Request) (*req.Response, error) {
+		_, err := tb.request(ctx, func(r *req.Request) (*req.Response, error) {
 			r.SetSuccessResult(&successResult)
 			r.SetQueryParams(map[string]string{
 				"page_token":     pageToken,
@@ -374,7 +526,7 @@ func (tb *ThunderBrowser) shareList(shareIds ...string) ([]*ShareInfo, pan.Drive
 				"limit":          "100",
 				"thumbnail_size": "SIZE_SMALL",
 			})
-			return r.Get(API_URL + "/share/list")
+			return r.Get(tb.apiUrl() + "/share/list")
 		})
 		if err != nil {
 			return nil, err
@@ -393,12 +545,12 @@ func (tb *ThunderBrowser) shareList(shareIds ...string) ([]*ShareInfo, pan.Drive
 	return shareList, nil
 }
 
-func (tb *ThunderBrowser) createShare(createShareReq CreateShareReq) (*CreateShareResp, pan.DriverErrorInterface) {
+func (tb *ThunderBrowser) createShare(ctx context.Context, createShareReq CreateShareReq) (*CreateShareResp, pan.DriverErrorInterface) {
 	var successResult CreateShareResp
-	_, err := tb.request(func(r *req.Request) (*req.Response, error) {
+	_, err := tb.request(ctx, func(r *req.Request) (*req.Response, error) {
 		r.SetSuccessResult(&successResult)
 		r.SetBody(createShareReq)
-		return r.Post(API_URL + "/share")
+		return r.Post(tb.apiUrl() + "/share")
 	})
 	if err != nil {
 		return nil, err
@@ -406,20 +558,20 @@ func (tb *ThunderBrowser) createShare(createShareReq CreateShareReq) (*CreateSha
 	return &successResult, nil
 }
 
-func (tb *ThunderBrowser) deleteShare(shareId string) pan.DriverErrorInterface {
-	_, err := tb.request(func(r *req.Request) (*req.Response, error) {
+func (tb *ThunderBrowser) deleteShare(ctx context.Context, shareId string) pan.DriverErrorInterface {
+	_, err := tb.request(ctx, func(r *req.Request) (*req.Response, error) {
 		r.SetBody(map[string]string{
 			"share_id": shareId,
 			"space":    ThunderDriveSpace,
 		})
-		return r.Post(API_URL + "/share/delete")
+		return r.Post(tb.apiUrl() + "/share/delete")
 	})
 	return err
 }
 
-func (tb *ThunderBrowser) getShare(shareDetailReq ShareDetailReq) (*ShareDetailResp, pan.DriverErrorInterface) {
+func (tb *ThunderBrowser) getShare(ctx context.Context, shareDetailReq ShareDetailReq) (*ShareDetailResp, pan.DriverErrorInterface) {
 	var successResult ShareDetailResp
-	_, err := tb.request(func(r *req.Request) (*req.Response, error) {
+	_, err := tb.request(ctx, func(r *req.Request) (*req.Response, error) {
 		r.SetSuccessResult(&successResult)
 		r.SetQueryParams(map[string]string{
 			"share_id":  shareDetailReq.ShareId,
@@ -427,14 +579,14 @@ func (tb *ThunderBrowser) getShare(shareDetailReq ShareDetailReq) (*ShareDetailR
 			"limit":     "100",
 			"space":     ThunderDriveSpace,
 		})
-		return r.Get(API_URL + "/share")
+		return r.Get(tb.apiUrl() + "/share")
 	})
 	return &successResult, err
 }
 
-func (tb *ThunderBrowser) getShareDetail(shareDetailReq ShareDetailReq) (*ShareDetailResp, pan.DriverErrorInterface) {
+func (tb *ThunderBrowser) getShareDetail(ctx context.Context, shareDetailReq ShareDetailReq) (*ShareDetailResp, pan.DriverErrorInterface) {
 	var successResult ShareDetailResp
-	_, err := tb.request(func(r *req.Request) (*req.Response, error) {
+	_, err := tb.request(ctx, func(r *req.Request) (*req.Response, error) {
 		r.SetSuccessResult(&successResult)
 		r.SetQueryParams(map[string]string{
 			"share_id":        shareDetailReq.ShareId,
@@ -443,36 +595,36 @@ func (tb *ThunderBrowser) getShareDetail(shareDetailReq ShareDetailReq) (*ShareD
 			"limit":           "100",
 			"space":           ThunderDriveSpace,
 		})
-		return r.Get(API_URL + "/share/detail")
+		return r.Get(tb.apiUrl() + "/share/detail")
 	})
 	return &successResult, err
 }
 
-func (tb *ThunderBrowser) about() (*AboutResp, pan.DriverErrorInterface) {
+func (tb *ThunderBrowser) about(ctx context.Context) (*AboutResp, pan.DriverErrorInterface) {
 	var successResult AboutResp
-	_, err := tb.request(func(r *req.Request) (*req.Response, error) {
+	_, err := tb.request(ctx, func(r *req.Request) (*req.Response, error) {
 		r.SetSuccessResult(&successResult)
 		r.SetQueryParams(map[string]string{
 			"with_quotas": QuotaCreateOfflineTaskLimit,
 			"space":       ThunderDriveSpace,
 		})
-		return r.Get(API_URL + "/about")
+		return r.Get(tb.apiUrl() + "/about")
 	})
 	return &successResult, err
 }
 
-func (tb *ThunderBrowser) restore(restoreReq RestoreReq) (*RestoreResp, pan.DriverErrorInterface) {
+func (tb *ThunderBrowser) restore(ctx context.Context, restoreReq RestoreReq) (*RestoreResp, pan.DriverErrorInterface) {
 	var successResult RestoreResp
-	_, err := tb.request(func(r *req.Request) (*req.Response, error) {
+	_, err := tb.request(ctx, func(r *req.Request) (*req.Response, error) {
 		r.SetSuccessResult(&successResult)
 		r.SetBody(restoreReq)
-		return r.Post(API_URL + "/share/restore")
+		return r.Post(tb.apiUrl() + "/share/restore")
 	})
 	return &successResult, err
 }
 
-func (tb *ThunderBrowser) request(request func(r *req.Request) (*req.Response, error)) (*req.Response, pan.DriverErrorInterface) {
-	r := tb.sessionClient.R()
+func (tb *ThunderBrowser) request(ctx context.Context, request func(r *req.Request) (*req.Response, error)) (*req.Response, pan.DriverErrorInterface) {
+	r := tb.sessionClient.R().SetContext(ctx)
 	r.SetHeaders(map[string]string{
 		"Authorization":         fmt.Sprint(tb.Properties.TokenType, " ", tb.Properties.AccessToken),
 		"X-Captcha-Token":       tb.Properties.CaptchaToken,
@@ -489,17 +641,17 @@ func (tb *ThunderBrowser) request(request func(r *req.Request) (*req.Response, e
 	case 0:
 		return data, nil
 	case 4122, 4121, 10, 16:
-		_, err = tb.refreshToken(tb.Properties.RefreshToken)
+		_, err = tb.refreshToken(ctx, tb.Properties.RefreshToken)
 		if err == nil {
 			break
 		}
 		if tb.Properties.Username != "" && tb.Properties.Password != "" {
-			_, err = tb.login(tb.Properties.Username, tb.Properties.Password)
+			_, err = tb.login(ctx, tb.Properties.Username, tb.Properties.Password)
 			if err == nil {
 				break
 			}
 		}
-		return nil, pan.OnlyError(err)
+		return nil, pan.KindCodeMsg(pan.ErrAuthExpired, int(errResp.ErrorCode), errResp.ErrorMsg+" refresh failed: "+err.Error())
 	case 9:
 		// space_token 获取失败
 		//if errResp.ErrorMsg == "space_token_invalid" {
@@ -512,14 +664,59 @@ func (tb *ThunderBrowser) request(request func(r *req.Request) (*req.Response, e
 		//}
 		if errResp.ErrorMsg == "captcha_invalid" {
 			// 验证码token过期
-			if e := tb.refreshCaptchaTokenAtLogin(GetAction(r.Method, r.RawURL), tb.Properties.UserID); e != nil {
+			if e := tb.refreshCaptchaTokenAtLogin(ctx, tb.captchaAction(r.Method, r.RawURL), tb.Properties.UserID); e != nil {
 				return nil, pan.OnlyError(e)
 			}
 			break
 		}
-		return nil, pan.CodeMsg(int(errResp.ErrorCode), errResp.ErrorMsg+errResp.ErrorDescription)
+		return nil, codeError(data.StatusCode, errResp.ErrorCode, errResp.ErrorMsg+errResp.ErrorDescription)
 	default:
-		return nil, pan.CodeMsg(int(errResp.ErrorCode), errResp.ErrorMsg+errResp.ErrorDescription)
+		return nil, codeError(data.StatusCode, errResp.ErrorCode, errResp.ErrorMsg+errResp.ErrorDescription)
+	}
+	return tb.request(ctx, request)
+}
+
+// s3Client 创建上传使用的 S3 客户端
+func (tb *ThunderBrowser) s3Client(param ResumableParams) *s3.Client {
+	endpoint := strings.TrimLeft(param.Endpoint, param.Bucket+".")
+	if tb.Properties.UploadUrl != "" {
+		endpoint = tb.Properties.UploadUrl
+	}
+	return s3.New(s3.Options{
+		Credentials:  credentials.NewStaticCredentialsProvider(param.AccessKeyID, param.AccessKeySecret, param.SecurityToken),
+		Region:       "xunlei",
+		BaseEndpoint: aws.String(endpoint),
+	})
+}
+
+// s3ListParts 逐页列出分片上传中已上传的分片
+func (tb *ThunderBrowser) s3ListParts(ctx context.Context, session uploadSession) ([]s3types.Part, error) {
+	client := tb.s3Client(session.Params)
+	parts := make([]s3types.Part, 0)
+	var marker *string
+	for {
+		out, err := client.ListParts(ctx, &s3.ListPartsInput{
+			Bucket:           aws.String(session.Params.Bucket),
+			Key:              aws.String(session.Params.Key),
+			UploadId:         aws.String(session.UploadId),
+			PartNumberMarker: marker,
+		})
+		if err != nil {
+			return nil, s3Error(err)
+		}
+		parts = append(parts, out.Parts...)
+		if !aws.ToBool(out.IsTruncated) || aws.ToString(out.NextPartNumberMarker) == "" {
+			return parts, nil
+		}
+		marker = out.NextPartNumberMarker
+	}
+}
+
+// s3Error 转换 S3 接口的错误，分片上传不存在时为 ErrNotFound
+func s3Error(err error) error {
+	var apiErr interface{ ErrorCode() string }
+	if errors.As(err, &apiErr) && (apiErr.ErrorCode() == "NoSuchUpload" || apiErr.ErrorCode() == "NoSuchKey") {
+		return pan.KindMsg(pan.ErrNotFound, apiErr.ErrorCode())
 	}
-	return tb.request(request)
+	return pan.OnlyError(err)
 }
@@ -151,7 +151,7 @@ type Files struct {
 	Size string `json:"size"`
 	//Revision       string    `json:"revision"`
 	//FileExtension  string    `json:"file_extension"`
-	//MimeType       string    `json:"mime_type"`
+	MimeType string `json:"mime_type"`
 	//Starred        bool      `json:"starred"`
 	WebContentLink string     `json:"web_content_link"`
 	CreatedTime    CustomTime `json:"created_time"`
@@ -246,23 +246,33 @@ type UploadTaskResponse struct {
 
 	//UPLOAD_TYPE_RESUMABLE
 	Resumable struct {
-		Kind   string `json:"kind"`
-		Params struct {
-			AccessKeyID     string    `json:"access_key_id"`
-			AccessKeySecret string    `json:"access_key_secret"`
-			Bucket          string    `json:"bucket"`
-			Endpoint        string    `json:"endpoint"`
-			Expiration      time.Time `json:"expiration"`
-			Key             string    `json:"key"`
-			SecurityToken   string    `json:"security_token"`
-		} `json:"params"`
-		Provider string `json:"provider"`
+		Kind     string          `json:"kind"`
+		Params   ResumableParams `json:"params"`
+		Provider string          `json:"provider"`
 	} `json:"resumable"`
 
 	File Files `json:"file"`
 	Task Task  `json:"task"`
 }
 
+// ResumableParams 上传文件使用的 S3 地址和临时凭证
+type ResumableParams struct {
+	AccessKeyID     string    `json:"access_key_id"`
+	AccessKeySecret string    `json:"access_key_secret"`
+	Bucket          string    `json:"bucket"`
+	Endpoint        string    `json:"endpoint"`
+	Expiration      time.Time `json:"expiration"`
+	Key             string    `json:"key"`
+	SecurityToken   string    `json:"security_token"`
+}
+
+// uploadSession 保存在上传记录中的 S3 分片上传会话
+type uploadSession struct {
+	FileId   string          `json:"fileId"`
+	Params   ResumableParams `json:"params"`
+	UploadId string          `json:"uploadId"`
+}
+
 type Task struct {
 	Kind       string        `json:"kind"`
 	Id         string        `json:"id"`
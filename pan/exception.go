@@ -1,8 +1,13 @@
 package pan
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"syscall"
 )
 
 const (
@@ -10,20 +15,36 @@ const (
 	UNKNOWN int = 9999
 )
 
+// Sentinel errors shared by all drivers. Each driver maps its native error
+// codes to one of these, so callers can test errors with errors.Is instead of
+// comparing driver specific codes.
+var (
+	ErrNotFound      = errors.New("object not found")
+	ErrAlreadyExists = errors.New("object already exists")
+	ErrUnsupported   = errors.New("operation not supported")
+	ErrAuthExpired   = errors.New("authentication expired")
+	ErrQuotaExceeded = errors.New("quota exceeded")
+	ErrRateLimited   = errors.New("rate limited")
+)
+
 type DriverErrorInterface interface {
 	GetCode() int
 	GetMsg() string
 	GetErr() error
 	GetData() interface{}
 	Error() string
+	Unwrap() error
+	Retryable() bool
 }
 
 // DriverError 定义全局的基础异常
 type DriverError struct {
-	Code int
-	Msg  string
-	Err  error
-	Data interface{}
+	Code  int
+	Msg   string
+	Err   error
+	Data  interface{}
+	Kind  error // 错误类型，取值为 ErrNotFound 等哨兵错误，可为空
+	Retry bool  // 驱动明确标记为可重试（如服务端繁忙）
 }
 
 func (e *DriverError) GetCode() int {
@@ -42,12 +63,61 @@ func (e *DriverError) GetData() interface{} {
 	return e.Data
 }
 
+// Unwrap returns the underlying cause, so errors.Is and errors.As can reach it.
+func (e *DriverError) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether target is the sentinel kind of e.
+func (e *DriverError) Is(target error) bool {
+	return e.Kind != nil && e.Kind == target
+}
+
+// Retryable reports whether the failed operation may succeed when retried
+// unchanged: rate limiting, server side transient failures and network
+// timeouts or resets. Cancellation is never retryable.
+func (e *DriverError) Retryable() bool {
+	if e.Retry || e.Kind == ErrRateLimited {
+		return true
+	}
+	return isTransient(e.Err)
+}
+
+// IsRetryable reports whether err is retryable, see DriverError.Retryable.
+func IsRetryable(err error) bool {
+	var de *DriverError
+	if errors.As(err, &de) {
+		return de.Retryable()
+	}
+	return isTransient(err)
+}
+
+// isTransient 判断底层错误是否为网络抖动等临时错误
+func isTransient(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var de *DriverError
+	if errors.As(err, &de) {
+		return de.Retryable()
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	return errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.EPIPE)
+}
+
 func (e *DriverError) Error() string {
 	m := make(map[string]any)
 	m["code"] = e.Code
 	m["msg"] = e.Msg
 	m["err"] = e.Err
 	m["data"] = e.Data
+	m["kind"] = e.Kind
 	errorStr := ""
 	for key, value := range m {
 		if value != nil {
@@ -99,20 +169,75 @@ func CodeMsg(code int, msg string) DriverErrorInterface {
 	return CodeMsgErrorData(code, msg, nil, nil)
 }
 
-func CodeMsgErrorData(code int, msg string, error error, data interface{}) DriverErrorInterface {
-	var err *DriverError
-	if errors.As(error, &err) {
-		return &DriverError{
-			Code: code,
-			Msg:  err.Msg + " " + msg,
-			Err:  err.Err,
-			Data: data,
-		}
+// KindMsg creates an error of the given sentinel kind, e.g. ErrUnsupported.
+func KindMsg(kind error, msg string) DriverErrorInterface {
+	return KindCodeMsg(kind, UNKNOWN, msg)
+}
+
+// KindCodeMsg creates an error of the given sentinel kind keeping the driver's native code.
+func KindCodeMsg(kind error, code int, msg string) DriverErrorInterface {
+	return &DriverError{
+		Code: code,
+		Msg:  msg,
+		Kind: kind,
 	}
+}
+
+// RetryCodeMsg creates an error the driver knows to be transient.
+func RetryCodeMsg(code int, msg string) DriverErrorInterface {
 	return &DriverError{
+		Code:  code,
+		Msg:   msg,
+		Retry: true,
+	}
+}
+
+// StatusCodeMsg creates an error from an HTTP status for responses that carry
+// no recognised driver code: 401 is ErrAuthExpired, 404 ErrNotFound, 409
+// ErrAlreadyExists, 429 ErrRateLimited, 507 ErrQuotaExceeded, and other 5xx
+// statuses as well as 408 are retryable.
+func StatusCodeMsg(status, code int, msg string) DriverErrorInterface {
+	e := &DriverError{
+		Code: code,
+		Msg:  msg,
+	}
+	switch status {
+	case http.StatusUnauthorized:
+		e.Kind = ErrAuthExpired
+	case http.StatusNotFound:
+		e.Kind = ErrNotFound
+	case http.StatusConflict:
+		e.Kind = ErrAlreadyExists
+	case http.StatusTooManyRequests:
+		e.Kind = ErrRateLimited
+	case http.StatusInsufficientStorage:
+		e.Kind = ErrQuotaExceeded
+	case http.StatusRequestTimeout:
+		e.Retry = true
+	default:
+		e.Retry = status >= http.StatusInternalServerError
+	}
+	return e
+}
+
+// CodeMsgErrorData wraps error with a code and message. error stays the
+// cause, so errors.Is and errors.As reach every layer of its chain. When the
+// chain holds a DriverError, its kind, retry flag and (for UNKNOWN) code are
+// carried over to the new error.
+func CodeMsgErrorData(code int, msg string, error error, data interface{}) DriverErrorInterface {
+	e := &DriverError{
 		Code: code,
 		Msg:  msg,
 		Err:  error,
 		Data: data,
 	}
+	var inner *DriverError
+	if errors.As(error, &inner) {
+		if code == UNKNOWN {
+			e.Code = inner.Code
+		}
+		e.Kind = inner.Kind
+		e.Retry = inner.Retry
+	}
+	return e
 }
@@ -0,0 +1,277 @@
+package pan
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"path"
+	"time"
+)
+
+// NewFS returns a read-only fs.FS backed by driver, so fs.WalkDir,
+// http.FS, template.ParseFS and similar tooling work on a remote drive.
+// Names are slash-separated paths relative to the drive root. The returned
+// value also implements fs.ReadDirFS, fs.StatFS and fs.ReadFileFS; opened
+// files implement io.Seeker and are read through the driver's Open, which
+// is called on the first read or seek.
+// Directory listings go through the driver's cache.
+func NewFS(driver Driver) fs.FS {
+	return NewFSContext(context.Background(), driver)
+}
+
+// NewFSContext is like NewFS, but every request of the returned fs.FS and
+// of the files it opens is bound to ctx, so cancelling ctx aborts a walk or
+// a read in progress.
+func NewFSContext(ctx context.Context, driver Driver) fs.FS {
+	return &panFS{driver: driver, ctx: ctx}
+}
+
+type panFS struct {
+	driver Driver
+	ctx    context.Context
+}
+
+// stat 查询 fs 路径对应的对象
+func (f *panFS) stat(op, name string) (*PanObj, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	if name == "." {
+		return &PanObj{Id: "0", Name: "", Path: "/", Size: 0, Type: "dir"}, nil
+	}
+	obj, err := f.driver.StatCtx(f.ctx, StatReq{Path: "/" + name})
+	if err != nil {
+		return nil, fsError(op, name, err)
+	}
+	return obj, nil
+}
+
+func (f *panFS) Open(name string) (fs.File, error) {
+	obj, err := f.stat("open", name)
+	if err != nil {
+		return nil, err
+	}
+	if obj.Type == "dir" {
+		return &panDir{fs: f, name: name, obj: obj}, nil
+	}
+	return &panFile{fs: f, name: name, obj: obj}, nil
+}
+
+func (f *panFS) Stat(name string) (fs.FileInfo, error) {
+	obj, err := f.stat("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	return fileInfo{obj: obj}, nil
+}
+
+func (f *panFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	obj, err := f.stat("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	return f.readDir(name, obj)
+}
+
+func (f *panFS) readDir(name string, obj *PanObj) ([]fs.DirEntry, error) {
+	if obj.Type != "dir" {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: errors.New("not a directory")}
+	}
+	objs, err := f.driver.ListCtx(f.ctx, ListReq{Dir: obj, SortBy: SortByName})
+	if err != nil {
+		return nil, fsError("readdir", name, err)
+	}
+	entries := make([]fs.DirEntry, 0, len(objs))
+	for _, child := range objs {
+		entries = append(entries, fs.FileInfoToDirEntry(fileInfo{obj: child}))
+	}
+	return entries, nil
+}
+
+func (f *panFS) ReadFile(name string) ([]byte, error) {
+	file, err := f.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	pf, ok := file.(*panFile)
+	if !ok {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: errors.New("is a directory")}
+	}
+	data := make([]byte, 0, pf.obj.Size)
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := pf.Read(buf)
+		data = append(data, buf[:n]...)
+		if err == io.EOF {
+			return data, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// panFile 远程文件，首次读取或定位时才通过 Driver.Open 打开
+type panFile struct {
+	fs     *panFS
+	name   string
+	obj    *PanObj
+	reader io.ReadSeekCloser
+	closed bool
+}
+
+func (f *panFile) open() error {
+	if f.closed {
+		return &fs.PathError{Op: "read", Path: f.name, Err: fs.ErrClosed}
+	}
+	if f.reader != nil {
+		return nil
+	}
+	reader, err := f.fs.driver.Open(f.fs.ctx, f.obj)
+	if err != nil {
+		return fsError("open", f.name, err)
+	}
+	f.reader = reader
+	return nil
+}
+
+func (f *panFile) Stat() (fs.FileInfo, error) {
+	return fileInfo{obj: f.obj}, nil
+}
+
+func (f *panFile) Read(p []byte) (int, error) {
+	if err := f.open(); err != nil {
+		return 0, err
+	}
+	n, err := f.reader.Read(p)
+	if err != nil && err != io.EOF {
+		return n, fsError("read", f.name, err)
+	}
+	return n, err
+}
+
+func (f *panFile) Seek(offset int64, whence int) (int64, error) {
+	if err := f.open(); err != nil {
+		return 0, err
+	}
+	n, err := f.reader.Seek(offset, whence)
+	if err != nil {
+		return n, fsError("seek", f.name, err)
+	}
+	return n, nil
+}
+
+func (f *panFile) Close() error {
+	if f.closed {
+		return &fs.PathError{Op: "close", Path: f.name, Err: fs.ErrClosed}
+	}
+	f.closed = true
+	if f.reader == nil {
+		return nil
+	}
+	return f.reader.Close()
+}
+
+// panDir 远程目录，首次 ReadDir 时列出
+type panDir struct {
+	fs      *panFS
+	name    string
+	obj     *PanObj
+	entries []fs.DirEntry
+	offset  int
+	loaded  bool
+}
+
+func (d *panDir) Stat() (fs.FileInfo, error) {
+	return fileInfo{obj: d.obj}, nil
+}
+
+func (d *panDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.name, Err: errors.New("is a directory")}
+}
+
+func (d *panDir) Close() error {
+	return nil
+}
+
+func (d *panDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	if !d.loaded {
+		entries, err := d.fs.readDir(d.name, d.obj)
+		if err != nil {
+			return nil, err
+		}
+		d.entries, d.loaded = entries, true
+	}
+	rest := d.entries[d.offset:]
+	if n <= 0 {
+		d.offset = len(d.entries)
+		return rest, nil
+	}
+	if len(rest) == 0 {
+		return nil, io.EOF
+	}
+	n = min(n, len(rest))
+	d.offset += n
+	return rest[:n], nil
+}
+
+// fileInfo 把 PanObj 适配为 fs.FileInfo，Sys 返回 *PanObj
+type fileInfo struct {
+	obj *PanObj
+}
+
+func (i fileInfo) Name() string {
+	if i.obj.Name == "" {
+		return "."
+	}
+	return path.Base(i.obj.Name)
+}
+
+func (i fileInfo) Size() int64 {
+	return i.obj.Size
+}
+
+func (i fileInfo) Mode() fs.FileMode {
+	if i.obj.Type == "dir" {
+		return fs.ModeDir | 0555
+	}
+	return 0444
+}
+
+func (i fileInfo) ModTime() time.Time {
+	return i.obj.ModTime
+}
+
+func (i fileInfo) IsDir() bool {
+	return i.obj.Type == "dir"
+}
+
+func (i fileInfo) Sys() any {
+	return i.obj
+}
+
+// fsError 包装为 *fs.PathError，ErrNotFound 同时匹配 fs.ErrNotExist
+func fsError(op, name string, err error) error {
+	if errors.Is(err, ErrNotFound) {
+		err = notExistError{err: err}
+	}
+	return &fs.PathError{Op: op, Path: name, Err: err}
+}
+
+type notExistError struct {
+	err error
+}
+
+func (e notExistError) Error() string {
+	return e.err.Error()
+}
+
+func (e notExistError) Unwrap() error {
+	return e.err
+}
+
+func (e notExistError) Is(target error) bool {
+	return target == fs.ErrNotExist
+}
@@ -0,0 +1,103 @@
+package pan
+
+import (
+	"context"
+	"path"
+	"slices"
+	"strings"
+)
+
+// globAny 跨目录匹配任意层级的段
+const globAny = "**"
+
+// Glob returns the objects whose full path matches pattern. Segments follow
+// path.Match syntax (`*`, `?`, `[...]`) and a `**` segment matches zero or
+// more directories, e.g. `/电影/**/*.mkv`. Relative patterns are resolved
+// from the drive root. Only directories that can still lead to a match are
+// listed, and listings go through the driver's directory cache. Results are
+// sorted by full path.
+func Glob(ctx context.Context, driver Driver, pattern string) ([]*PanObj, error) {
+	segs := globSegments(pattern)
+	for _, seg := range segs {
+		if _, err := path.Match(seg, ""); err != nil {
+			return nil, MsgError("bad glob pattern "+pattern, err)
+		}
+	}
+	if len(segs) == 0 {
+		return []*PanObj{}, nil
+	}
+	// 记录每个已访问目录在模式中可能处于的位置
+	states := map[string][]int{"/": globClosure(segs, []int{0})}
+	matches := make([]*PanObj, 0)
+	err := Walk(ctx, driver, nil, func(obj *PanObj, err error) error {
+		if err != nil {
+			return err
+		}
+		full := path.Join(obj.Path, obj.Name)
+		next := globStep(segs, states[obj.Path], obj.Name)
+		if slices.Contains(next, len(segs)) {
+			matches = append(matches, obj)
+		}
+		if obj.Type != "dir" {
+			return nil
+		}
+		// 只有仍有未匹配完的段时才需要深入
+		if slices.IndexFunc(next, func(i int) bool { return i < len(segs) }) < 0 {
+			return SkipDir
+		}
+		states[full] = next
+		return nil
+	}, WalkOptions{Concurrency: DefaultWalkConcurrency})
+	if err != nil {
+		return nil, err
+	}
+	slices.SortFunc(matches, func(a, b *PanObj) int {
+		return strings.Compare(path.Join(a.Path, a.Name), path.Join(b.Path, b.Name))
+	})
+	return matches, nil
+}
+
+// globSegments 拆分模式，忽略空段和连续的 **
+func globSegments(pattern string) []string {
+	segs := make([]string, 0)
+	for _, seg := range strings.Split(path.Clean("/"+pattern), "/") {
+		if seg == "" || (seg == globAny && len(segs) > 0 && segs[len(segs)-1] == globAny) {
+			continue
+		}
+		segs = append(segs, seg)
+	}
+	return segs
+}
+
+// globClosure ** 可以匹配零个目录，因此位于 ** 时同时处于其后一段
+func globClosure(segs []string, states []int) []int {
+	res := make([]int, 0, len(states))
+	for _, i := range states {
+		for {
+			if !slices.Contains(res, i) {
+				res = append(res, i)
+			}
+			if i >= len(segs) || segs[i] != globAny {
+				break
+			}
+			i++
+		}
+	}
+	return res
+}
+
+// globStep 用名称推进匹配位置
+func globStep(segs []string, states []int, name string) []int {
+	next := make([]int, 0)
+	for _, i := range states {
+		if i >= len(segs) {
+			continue
+		}
+		if segs[i] == globAny {
+			next = append(next, i)
+		} else if ok, _ := path.Match(segs[i], name); ok {
+			next = append(next, i+1)
+		}
+	}
+	return globClosure(segs, next)
+}
@@ -2,6 +2,7 @@ package pan
 
 import (
 	"context"
+	"io"
 	"time"
 )
 
@@ -17,6 +18,46 @@ type DiskResp struct {
 type ListReq struct {
 	Reload bool    `json:"reload,omitempty"`
 	Dir    *PanObj `json:"dir,omitempty"`
+	// 以下选项在缓存的完整目录列表上于内存中处理，不影响 DirCache
+	SortBy     SortBy `json:"sortBy,omitempty"`     // 排序字段，空表示保持网盘返回的顺序
+	Order      Order  `json:"order,omitempty"`      // 排序方向，默认升序
+	TypeFilter string `json:"typeFilter,omitempty"` // 只返回 file 或 dir，空表示不限
+	NameGlob   string `json:"nameGlob,omitempty"`   // 名称匹配模式，语法同 path.Match
+	Offset     int    `json:"offset,omitempty"`     // 排序、过滤后跳过的条数
+	Limit      int    `json:"limit,omitempty"`      // 最多返回的条数，0 表示不限
+}
+
+// SortBy ListReq 的排序字段
+type SortBy string
+
+const (
+	SortByName    SortBy = "name"
+	SortBySize    SortBy = "size"
+	SortByModTime SortBy = "mtime"
+)
+
+// Order ListReq 的排序方向
+type Order string
+
+const (
+	OrderAsc  Order = "asc"
+	OrderDesc Order = "desc"
+)
+
+// StatReq 查询单个对象，Id 与 Path 至少设置一个
+type StatReq struct {
+	Path   string `json:"path,omitempty"`   // 对象完整路径，如 /a/b.txt
+	Id     string `json:"id,omitempty"`     // 对象 ID，驱动支持按 ID 查询时无需列出父目录
+	Reload bool   `json:"reload,omitempty"` // 忽略目录缓存
+}
+
+// SearchReq 在 Root 下递归搜索对象，所有条件同时满足才返回
+type SearchReq struct {
+	Keyword string   `json:"keyword,omitempty"` // 名称包含的关键字，不区分大小写，空表示不限
+	Root    *PanObj  `json:"root,omitempty"`    // 搜索范围，nil 表示整个网盘
+	Types   []string `json:"types,omitempty"`   // 对象类型 file、dir，空表示不限
+	MinSize int64    `json:"minSize,omitempty"` // 最小大小（字节），0 表示不限，目录大小按 0 计算
+	MaxSize int64    `json:"maxSize,omitempty"` // 最大大小（字节），0 表示不限
 }
 
 type MkdirReq struct {
@@ -25,6 +66,12 @@ type MkdirReq struct {
 }
 
 type DeleteReq struct {
+	Items     []*PanObj `json:"items,omitempty"`
+	Permanent bool      `json:"permanent,omitempty"` // 彻底删除，不进入回收站
+}
+
+// TrashReq 回收站操作，Items 为 TrashList 返回的对象
+type TrashReq struct {
 	Items []*PanObj `json:"items,omitempty"`
 }
 
@@ -33,6 +80,12 @@ type MovieReq struct {
 	TargetObj *PanObj   `json:"targetObj,omitempty"`
 }
 
+// CopyReq 复制对象到目标目录，目标目录不存在时会创建
+type CopyReq struct {
+	Items     []*PanObj `json:"items,omitempty"`
+	TargetObj *PanObj   `json:"targetObj,omitempty"`
+}
+
 type ObjRenameReq struct {
 	Obj     *PanObj `json:"obj,omitempty"`
 	NewName string  `json:"newName,omitempty"`
@@ -50,10 +103,25 @@ type PanObj struct {
 	Path string `json:"path"`
 	Size int64  `json:"size"`
 	Type string `json:"type"`
+	// 修改时间、创建时间，网盘未返回时为零值
+	ModTime     time.Time `json:"modTime"`
+	CreatedTime time.Time `json:"createdTime"`
+	// 网盘返回的哈希值，key 参考 HashMd5、HashSha1、HashGcid
+	Hashes       map[string]string `json:"hashes,omitempty"`
+	MimeType     string            `json:"mimeType,omitempty"`
+	ThumbnailURL string            `json:"thumbnailUrl,omitempty"`
 	// 额外的数据
 	Ext    Json    `json:"ext"`
 	Parent *PanObj `json:"parent"`
 }
+
+// PanObj.Hashes 的 key
+const (
+	HashMd5  = "md5"
+	HashSha1 = "sha1"
+	HashGcid = "gcid" // 迅雷 GCID
+)
+
 type RemoteTransfer func(remote string) string
 
 // TransferResult 传输任务结果
@@ -89,13 +157,28 @@ type UploadFileReq struct {
 	OnlyFast           bool            `json:"onlyFast,omitempty"`
 	Resumable          bool            `json:"resumable,omitempty"`
 	SuccessDel         bool            `json:"successDel,omitempty"`
-	TaskId             string          `json:"taskId,omitempty"` // 调用方传入的任务 ID（可选），回调中会包含
-	Ctx                context.Context `json:"-"`                // Per-upload context for cancellation
+	Concurrency        int             `json:"concurrency,omitempty"` // 同时上传的分片数，小于等于 1 时串行上传；迅雷为 0 时默认 5 个
+	TaskId             string          `json:"taskId,omitempty"`      // 调用方传入的任务 ID（可选），回调中会包含
+	Ctx                context.Context `json:"-"`                     // Per-upload context for cancellation
 	RemotePathTransfer RemoteTransfer
 	RemoteNameTransfer RemoteTransfer
 	ProgressCallback   ProgressCallback
 }
 
+// UploadStreamReq uploads the content read from Reader as RemotePath/Name.
+type UploadStreamReq struct {
+	Reader     io.Reader `json:"-"`
+	Size       int64     `json:"size,omitempty"` // 内容长度，小于等于 0 表示未知
+	Name       string    `json:"name,omitempty"`
+	RemotePath string    `json:"remotePath,omitempty"`
+	// 已知的内容哈希，key 参考 HashMd5、HashSha1、HashGcid，
+	// 网盘需要的哈希齐全且 Size 已知时无需先写入临时文件
+	KnownHashes      map[string]string `json:"knownHashes,omitempty"`
+	OnlyFast         bool              `json:"onlyFast,omitempty"`
+	TaskId           string            `json:"taskId,omitempty"` // 调用方传入的任务 ID（可选），回调中会包含
+	ProgressCallback ProgressCallback
+}
+
 type UploadPathReq struct {
 	LocalPath          string   `json:"localPath,omitempty"`
 	RemotePath         string   `json:"remotePath,omitempty"`
@@ -103,6 +186,7 @@ type UploadPathReq struct {
 	SkipFileErr        bool     `json:"skipFileErr,omitempty"`
 	SuccessDel         bool     `json:"successDel,omitempty"`
 	OnlyFast           bool     `json:"onlyFast,omitempty"`
+	Concurrency        int      `json:"concurrency,omitempty"` // 每个文件同时上传的分片数
 	IgnorePaths        []string `json:"ignorePaths,omitempty"`
 	IgnoreFiles        []string `json:"ignoreFiles,omitempty"`
 	Extensions         []string `json:"extensions,omitempty"`
@@ -0,0 +1,61 @@
+package pan
+
+import (
+	"context"
+	"iter"
+	"strings"
+)
+
+// PageFunc fetches one page of a directory listing. token is empty for the
+// first page and the returned next token is empty after the last page.
+type PageFunc func(ctx context.Context, token string) (objs []*PanObj, next string, err error)
+
+// PageIter yields the objects of a cached listing when cached holds one, and
+// otherwise fetches the listing page by page until the last page, an error,
+// or the consumer stops iterating. Pages are not written to the cache, so a
+// huge directory never has to be held in memory as a whole.
+func PageIter(ctx context.Context, cached interface{}, fetch PageFunc) iter.Seq2[*PanObj, error] {
+	return func(yield func(*PanObj, error) bool) {
+		if objs, ok := cached.([]*PanObj); ok {
+			for _, obj := range objs {
+				if !yield(obj, nil) {
+					return
+				}
+			}
+			return
+		}
+		token := ""
+		for {
+			if err := ctx.Err(); err != nil {
+				yield(nil, OnlyError(err))
+				return
+			}
+			objs, next, err := fetch(ctx, token)
+			if err != nil {
+				yield(nil, err)
+				return
+			}
+			for _, obj := range objs {
+				if !yield(obj, nil) {
+					return
+				}
+			}
+			if next == "" {
+				return
+			}
+			token = next
+		}
+	}
+}
+
+// ResolveDir returns dir with its Id filled in, looking it up by Path and
+// Name through list when the Id is unknown. A nil dir is the root.
+func (c *CommonOperate) ResolveDir(dir *PanObj, list func(req ListReq) ([]*PanObj, error)) (*PanObj, error) {
+	if dir == nil || dir.Id == "0" || (dir.Path == "/" && dir.Name == "") {
+		return &PanObj{Id: "0", Name: "", Path: "/", Size: 0, Type: "dir"}, nil
+	}
+	if dir.Id != "" {
+		return dir, nil
+	}
+	return c.GetPanObj(strings.TrimRight(dir.Path, "/")+"/"+dir.Name, true, list)
+}
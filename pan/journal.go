@@ -0,0 +1,333 @@
+package pan
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hefeiyu25/pan-client/internal"
+)
+
+// Journal persists the progress of resumable transfers, so a transfer
+// interrupted by a crash or restart continues from its last completed part
+// when the same request is issued again. Values are stored as JSON.
+// Implementations must be safe for concurrent use.
+type Journal interface {
+	// Load decodes the entry of key into v and reports whether it exists.
+	Load(key string, v any) (bool, error)
+	Save(key string, v any) error
+	Delete(key string) error
+}
+
+// JournalKey joins parts into a journal key.
+func JournalKey(parts ...string) string {
+	return strings.Join(parts, "|")
+}
+
+// UploadRecord is the journal entry of a resumable upload.
+type UploadRecord struct {
+	LocalFile  string    `json:"localFile"`
+	Size       int64     `json:"size"`
+	ModTime    time.Time `json:"modTime"`    // 本地文件的修改时间，与当前文件不一致时丢弃记录
+	RemotePath string    `json:"remotePath"` // 目标完整路径
+	SessionId  string    `json:"sessionId"`  // 网盘的上传会话 ID
+	// 驱动自定义的会话信息，如上传凭证、OSS 的 UploadId
+	Session  json.RawMessage `json:"session,omitempty"`
+	PartSize int64           `json:"partSize,omitempty"`
+	Parts    []UploadPart    `json:"parts,omitempty"` // 已完成的分片
+	Uploaded int64           `json:"uploaded"`        // 从头开始连续上传完成的字节数
+	Updated  time.Time       `json:"updated"`
+}
+
+// UploadPart is a completed part of a multipart upload.
+type UploadPart struct {
+	Number int    `json:"number"` // 分片序号，从 1 开始
+	Size   int64  `json:"size"`
+	ETag   string `json:"etag,omitempty"`
+}
+
+// DownloadRecord is the journal entry of a chunked download.
+type DownloadRecord struct {
+	RemoteId  string     `json:"remoteId"`
+	Size      int64      `json:"size"`
+	ModTime   time.Time  `json:"modTime"` // 网盘文件的修改时间，文件变化时丢弃已下载的部分
+	LocalFile string     `json:"localFile"`
+	TmpDir    string     `json:"tmpDir"`
+	Merged    int64      `json:"merged"`           // 已合并到本地文件的字节数，之后的内容可能不完整
+	Ranges    [][2]int64 `json:"ranges,omitempty"` // 已下载到临时文件的分片，闭区间
+	Updated   time.Time  `json:"updated"`
+}
+
+// matches 记录是否对应同一个网盘文件
+func (r *DownloadRecord) matches(obj *PanObj) bool {
+	return r.RemoteId == obj.Id && r.Size == obj.Size && r.ModTime.Equal(obj.ModTime)
+}
+
+// downloadJournal 记录分片下载的进度，回调来自多个下载协程
+type downloadJournal struct {
+	b      *BaseOperate
+	key    string
+	mu     sync.Mutex
+	record *DownloadRecord
+}
+
+// loadDownloadJournal 读取 outputFile 的下载记录。网盘文件已变化时删除下载了
+// 一半的本地文件和临时分片；合并时中断的本地文件截断到最后一次完整合并的位置
+func (b *BaseOperate) loadDownloadJournal(obj *PanObj, outputFile, tmpDir string) *downloadJournal {
+	abs, err := filepath.Abs(outputFile)
+	if err != nil {
+		abs = outputFile
+	}
+	j := &downloadJournal{b: b, key: JournalKey("download", abs), record: &DownloadRecord{}}
+	ok, err := b.TransferJournal().Load(j.key, j.record)
+	if err != nil {
+		internal.GetLogger().Warn("load download journal fail", "key", j.key, "error", err)
+	}
+	switch {
+	case ok && !j.record.matches(obj):
+		internal.GetLogger().Info("remote file changed, discard partial download", "file", abs)
+		_ = os.Remove(outputFile)
+		_ = os.RemoveAll(j.record.TmpDir)
+		ok = false
+	case ok:
+		if info, e := os.Stat(outputFile); e == nil && info.Size() > j.record.Merged {
+			_ = os.Truncate(outputFile, j.record.Merged)
+		}
+	}
+	if !ok {
+		j.record = &DownloadRecord{
+			RemoteId:  obj.Id,
+			Size:      obj.Size,
+			ModTime:   obj.ModTime,
+			LocalFile: abs,
+			TmpDir:    tmpDir,
+		}
+		if info, e := os.Stat(outputFile); e == nil {
+			j.record.Merged = info.Size()
+		}
+	}
+	j.save()
+	return j
+}
+
+func (j *downloadJournal) addRange(start, end int64) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.record.Ranges = append(j.record.Ranges, [2]int64{start, end})
+	j.save()
+}
+
+func (j *downloadJournal) merged(merged int64) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.record.Merged = merged
+	j.record.Ranges = slices.DeleteFunc(j.record.Ranges, func(r [2]int64) bool {
+		return r[1] < merged
+	})
+	j.save()
+}
+
+func (j *downloadJournal) save() {
+	j.record.Updated = time.Now()
+	j.b.SaveRecord(j.key, j.record)
+}
+
+func (j *downloadJournal) done() {
+	j.b.DeleteRecord(j.key)
+}
+
+// NewFileJournal returns a Journal that keeps one JSON file per key in dir.
+// Files are replaced atomically, so a crash leaves the previous entry.
+func NewFileJournal(dir string) Journal {
+	return &fileJournal{dir: dir}
+}
+
+type fileJournal struct {
+	dir string
+	mu  sync.Mutex
+}
+
+func (j *fileJournal) file(key string) string {
+	return filepath.Join(j.dir, internal.Md5HashStr(key)+".json")
+}
+
+func (j *fileJournal) Load(key string, v any) (bool, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	data, err := os.ReadFile(j.file(key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, OnlyError(err)
+	}
+	if err = json.Unmarshal(data, v); err != nil {
+		return false, MsgError("invalid journal entry "+key, err)
+	}
+	return true, nil
+}
+
+func (j *fileJournal) Save(key string, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return OnlyError(err)
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if err = os.MkdirAll(j.dir, os.ModePerm); err != nil {
+		return OnlyError(err)
+	}
+	file := j.file(key)
+	tmp, err := os.CreateTemp(j.dir, ".journal-*")
+	if err != nil {
+		return OnlyError(err)
+	}
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), file)
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return OnlyError(err)
+	}
+	return nil
+}
+
+func (j *fileJournal) Delete(key string) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if err := os.Remove(j.file(key)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return OnlyError(err)
+	}
+	return nil
+}
+
+// NewMemoryJournal returns a Journal that lives as long as the process. It
+// is the default, so transfers resume after errors but not after restarts.
+func NewMemoryJournal() Journal {
+	return &memoryJournal{data: make(map[string][]byte)}
+}
+
+type memoryJournal struct {
+	mu   sync.Mutex
+	data map[string][]byte
+}
+
+func (j *memoryJournal) Load(key string, v any) (bool, error) {
+	j.mu.Lock()
+	data, ok := j.data[key]
+	j.mu.Unlock()
+	if !ok {
+		return false, nil
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return false, MsgError("invalid journal entry "+key, err)
+	}
+	return true, nil
+}
+
+func (j *memoryJournal) Save(key string, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return OnlyError(err)
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.data[key] = data
+	return nil
+}
+
+func (j *memoryJournal) Delete(key string) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	delete(j.data, key)
+	return nil
+}
+
+// defaultJournal 未设置 Journal 时使用
+var defaultJournal = NewMemoryJournal()
+
+// TransferJournal returns the journal of the client.
+func (b *BaseOperate) TransferJournal() Journal {
+	if b.Journal != nil {
+		return b.Journal
+	}
+	return defaultJournal
+}
+
+// LoadUploadRecord returns the journal entry of key when it was recorded for
+// the same local file, unchanged since. A stale entry is deleted.
+func (b *BaseOperate) LoadUploadRecord(key string, content *UploadContent) (*UploadRecord, bool) {
+	record := &UploadRecord{}
+	ok, err := b.TransferJournal().Load(key, record)
+	if err != nil {
+		internal.GetLogger().Warn("load upload journal fail", "key", key, "error", err)
+		return nil, false
+	}
+	if !ok {
+		return nil, false
+	}
+	if content.LocalFile == "" || record.LocalFile != content.LocalFile || record.Size != content.Size || !record.ModTime.Equal(content.ModTime) {
+		internal.GetLogger().Info("discard stale upload journal", "key", key)
+		b.DeleteRecord(key)
+		return nil, false
+	}
+	return record, true
+}
+
+// AddPart records a completed part and advances Uploaded over the parts
+// completed contiguously from the first.
+func (r *UploadRecord) AddPart(part UploadPart) {
+	i, found := slices.BinarySearchFunc(r.Parts, part.Number, func(p UploadPart, number int) int {
+		return p.Number - number
+	})
+	if found {
+		r.Parts[i] = part
+	} else {
+		r.Parts = slices.Insert(r.Parts, i, part)
+	}
+	r.Uploaded = 0
+	for i, p := range r.Parts {
+		if p.Number != i+1 {
+			break
+		}
+		r.Uploaded += p.Size
+	}
+}
+
+// NewUploadRecord returns an empty journal entry for content.
+func NewUploadRecord(content *UploadContent, remotePath string) *UploadRecord {
+	return &UploadRecord{
+		LocalFile:  content.LocalFile,
+		Size:       content.Size,
+		ModTime:    content.ModTime,
+		RemotePath: remotePath,
+	}
+}
+
+// SaveRecord writes v to the journal. Failures are logged and otherwise
+// ignored: a transfer does not fail because its progress can not be saved.
+func (b *BaseOperate) SaveRecord(key string, v any) {
+	if record, ok := v.(*UploadRecord); ok {
+		record.Updated = time.Now()
+	}
+	if err := b.TransferJournal().Save(key, v); err != nil {
+		internal.GetLogger().Warn("save journal fail", "key", key, "error", err)
+	}
+}
+
+// DeleteRecord removes the journal entry of key.
+func (b *BaseOperate) DeleteRecord(key string) {
+	if err := b.TransferJournal().Delete(key); err != nil {
+		internal.GetLogger().Warn("delete journal fail", "key", key, "error", err)
+	}
+}
@@ -0,0 +1,451 @@
+package pan
+
+import (
+	"context"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hefeiyu25/pan-client/internal"
+)
+
+// JobType is the kind of a TransferManager job.
+type JobType string
+
+const (
+	JobUpload   JobType = "upload"
+	JobDownload JobType = "download"
+)
+
+// JobState is the state of a TransferManager job.
+type JobState string
+
+const (
+	JobQueued   JobState = "queued"   // 等待执行
+	JobRunning  JobState = "running"  // 执行中
+	JobPaused   JobState = "paused"   // 已暂停，Resume 后重新排队
+	JobFailed   JobState = "failed"   // 执行失败，Resume 后重新排队
+	JobDone     JobState = "done"     // 已完成
+	JobCanceled JobState = "canceled" // 已取消
+)
+
+// DefaultManagerConcurrency is the number of jobs a TransferManager runs at
+// a time when TransferManagerOptions.Concurrency is not set.
+const DefaultManagerConcurrency = 3
+
+// TransferManagerOptions controls a TransferManager.
+type TransferManagerOptions struct {
+	Concurrency int // 同时执行的任务数，默认 DefaultManagerConcurrency
+	// 任务状态变化或进度更新时回调。回调在单独的协程中按发生顺序进行，不会并发调用，
+	// 可以在回调中调用管理器的方法（如 Resume 失败的任务、Add 新任务）；
+	// 回调是异步的，收到时任务可能已再次变化，需要最新状态时使用 Get
+	OnChange func(job JobInfo)
+}
+
+// JobSpec describes a job to add; exactly one of Upload and Download is set.
+// The Ctx of the request is replaced by the job's own context, and an empty
+// TaskId is set to the job id.
+type JobSpec struct {
+	Driver   Driver
+	Priority int // 优先级，越大越先执行，相同时先加入的先执行
+	Upload   *UploadFileReq
+	Download *DownloadFileReq
+}
+
+// JobInfo is a snapshot of a job.
+type JobInfo struct {
+	Id        string    `json:"id"`
+	Type      JobType   `json:"type"`
+	Name      string    `json:"name"` // 上传的本地文件名或下载的网盘文件名
+	State     JobState  `json:"state"`
+	Priority  int       `json:"priority"`
+	Operated  int64     `json:"operated"` // 已传输字节
+	TotalSize int64     `json:"totalSize"`
+	Percent   float64   `json:"percent"`
+	Speed     float64   `json:"speed"` // KB/s
+	Error     error     `json:"-"`     // 最近一次失败的原因
+	Created   time.Time `json:"created"`
+	Started   time.Time `json:"started"`  // 最近一次开始执行的时间
+	Finished  time.Time `json:"finished"` // 最近一次结束执行的时间
+}
+
+// TransferManager runs upload and download jobs of any drivers with a global
+// concurrency limit. Queued jobs start by priority, then in the order they
+// were added. Running jobs can be paused, which cancels the transfer: a
+// download continues from its temporary chunks when resumed, an upload
+// continues only when the driver supports Resumable and the request sets it,
+// otherwise it starts over. Finished jobs are kept until Remove.
+type TransferManager struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	opts   TransferManagerOptions
+
+	mu      sync.Mutex
+	jobs    map[string]*job
+	order   []*job // 按加入顺序
+	running int
+	wg      sync.WaitGroup
+	closed  bool
+
+	evMu       sync.Mutex
+	events     []JobInfo // 等待回调 OnChange 的任务快照
+	delivering bool      // 是否有协程正在回调
+}
+
+type job struct {
+	info   JobInfo
+	spec   JobSpec
+	cancel context.CancelFunc
+	// 执行结束时转入的状态，由 Pause、Cancel 设置
+	stopAs JobState
+	done   chan struct{} // 进入结束状态或失败时关闭，重新排队时重建
+}
+
+// NewTransferManager returns a manager whose jobs stop when ctx is done.
+func NewTransferManager(ctx context.Context, opts TransferManagerOptions) *TransferManager {
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = DefaultManagerConcurrency
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	return &TransferManager{
+		ctx:    ctx,
+		cancel: cancel,
+		opts:   opts,
+		jobs:   make(map[string]*job),
+	}
+}
+
+// Add queues a job and returns its id.
+func (m *TransferManager) Add(spec JobSpec) (string, error) {
+	if spec.Driver == nil {
+		return "", OnlyMsg("job without driver")
+	}
+	info := JobInfo{Id: uuid.NewString(), Priority: spec.Priority, State: JobQueued, Created: time.Now()}
+	switch {
+	case spec.Upload != nil && spec.Download == nil:
+		req := *spec.Upload
+		spec.Upload = &req
+		info.Type, info.Name = JobUpload, filepath.Base(req.LocalFile)
+	case spec.Download != nil && spec.Upload == nil:
+		if spec.Download.RemoteFile == nil {
+			return "", OnlyMsg("download job without remote file")
+		}
+		req := *spec.Download
+		spec.Download = &req
+		info.Type, info.Name, info.TotalSize = JobDownload, req.RemoteFile.Name, req.RemoteFile.Size
+	default:
+		return "", OnlyMsg("job needs exactly one of upload and download")
+	}
+	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+		return "", OnlyMsg("transfer manager closed")
+	}
+	j := &job{info: info, spec: spec, done: make(chan struct{})}
+	m.jobs[info.Id] = j
+	m.order = append(m.order, j)
+	m.mu.Unlock()
+	m.changed(j)
+	m.schedule()
+	return info.Id, nil
+}
+
+// Get returns a snapshot of the job.
+func (m *TransferManager) Get(id string) (JobInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	j, ok := m.jobs[id]
+	if !ok {
+		return JobInfo{}, KindMsg(ErrNotFound, "job "+id+" not found")
+	}
+	return j.info, nil
+}
+
+// List returns snapshots of all jobs in the order they were added.
+func (m *TransferManager) List() []JobInfo {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	res := make([]JobInfo, 0, len(m.order))
+	for _, j := range m.order {
+		res = append(res, j.info)
+	}
+	return res
+}
+
+// Pause stops a queued or running job. A running job turns paused once its
+// transfer has returned.
+func (m *TransferManager) Pause(id string) error {
+	return m.stop(id, JobPaused)
+}
+
+// Cancel stops a job for good. A running job turns canceled once its
+// transfer has returned.
+func (m *TransferManager) Cancel(id string) error {
+	return m.stop(id, JobCanceled)
+}
+
+func (m *TransferManager) stop(id string, state JobState) error {
+	m.mu.Lock()
+	j, ok := m.jobs[id]
+	if !ok {
+		m.mu.Unlock()
+		return KindMsg(ErrNotFound, "job "+id+" not found")
+	}
+	switch j.info.State {
+	case JobRunning:
+		j.stopAs = state
+		j.cancel()
+		m.mu.Unlock()
+		return nil
+	case JobQueued, JobPaused, JobFailed:
+		if state == JobPaused && j.info.State != JobQueued {
+			m.mu.Unlock()
+			return OnlyMsg("job " + id + " is " + string(j.info.State))
+		}
+		m.finish(j, state)
+		m.mu.Unlock()
+		m.changed(j)
+		return nil
+	default:
+		m.mu.Unlock()
+		return OnlyMsg("job " + id + " is " + string(j.info.State))
+	}
+}
+
+// Resume queues a paused or failed job again. It fails once the manager
+// is closed, like Add.
+func (m *TransferManager) Resume(id string) error {
+	m.mu.Lock()
+	j, ok := m.jobs[id]
+	if !ok {
+		m.mu.Unlock()
+		return KindMsg(ErrNotFound, "job "+id+" not found")
+	}
+	if m.closed {
+		m.mu.Unlock()
+		return OnlyMsg("transfer manager closed")
+	}
+	if j.info.State != JobPaused && j.info.State != JobFailed {
+		m.mu.Unlock()
+		return OnlyMsg("job " + id + " is " + string(j.info.State))
+	}
+	j.info.State = JobQueued
+	j.info.Error = nil
+	j.done = make(chan struct{})
+	m.mu.Unlock()
+	m.changed(j)
+	m.schedule()
+	return nil
+}
+
+// SetPriority changes the priority of a job; it takes effect for jobs that
+// are not running yet.
+func (m *TransferManager) SetPriority(id string, priority int) error {
+	m.mu.Lock()
+	j, ok := m.jobs[id]
+	if !ok {
+		m.mu.Unlock()
+		return KindMsg(ErrNotFound, "job "+id+" not found")
+	}
+	j.info.Priority = priority
+	m.mu.Unlock()
+	m.changed(j)
+	m.schedule()
+	return nil
+}
+
+// Remove forgets a job that is done, canceled, failed or paused.
+func (m *TransferManager) Remove(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	j, ok := m.jobs[id]
+	if !ok {
+		return KindMsg(ErrNotFound, "job "+id+" not found")
+	}
+	if j.info.State == JobQueued || j.info.State == JobRunning {
+		return OnlyMsg("job " + id + " is " + string(j.info.State))
+	}
+	delete(m.jobs, id)
+	m.order = slices.DeleteFunc(m.order, func(o *job) bool { return o == j })
+	return nil
+}
+
+// Wait blocks until the job is done, canceled, failed or paused, or ctx is
+// done, and returns its snapshot. The error is the job's error when it failed.
+func (m *TransferManager) Wait(ctx context.Context, id string) (JobInfo, error) {
+	m.mu.Lock()
+	j, ok := m.jobs[id]
+	if !ok {
+		m.mu.Unlock()
+		return JobInfo{}, KindMsg(ErrNotFound, "job "+id+" not found")
+	}
+	done := j.done
+	m.mu.Unlock()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		return JobInfo{}, ctx.Err()
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return j.info, j.info.Error
+}
+
+// Close cancels all running jobs, waits for them to return and rejects new
+// jobs. Jobs stopped by Close are left paused.
+func (m *TransferManager) Close() {
+	m.mu.Lock()
+	m.closed = true
+	for _, j := range m.order {
+		if j.info.State == JobRunning {
+			j.stopAs = JobPaused
+		}
+	}
+	m.mu.Unlock()
+	m.cancel()
+	m.wg.Wait()
+}
+
+// schedule 按优先级启动排队中的任务
+func (m *TransferManager) schedule() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for !m.closed && m.running < m.opts.Concurrency {
+		var next *job
+		for _, j := range m.order {
+			if j.info.State != JobQueued {
+				continue
+			}
+			if next == nil || j.info.Priority > next.info.Priority {
+				next = j
+			}
+		}
+		if next == nil {
+			return
+		}
+		ctx, cancel := context.WithCancel(m.ctx)
+		next.cancel = cancel
+		next.stopAs = ""
+		next.info.State = JobRunning
+		next.info.Started = time.Now()
+		m.running++
+		m.wg.Add(1)
+		go m.run(ctx, next)
+	}
+}
+
+func (m *TransferManager) run(ctx context.Context, j *job) {
+	defer m.wg.Done()
+	m.changed(j)
+	progress := func(event ProgressEvent) {
+		m.mu.Lock()
+		j.info.Operated, j.info.TotalSize = event.Operated, event.TotalSize
+		j.info.Percent, j.info.Speed = event.Percent, event.Speed
+		m.mu.Unlock()
+		m.changed(j)
+	}
+	var err error
+	switch j.info.Type {
+	case JobUpload:
+		req := *j.spec.Upload
+		req.Ctx = ctx
+		if req.TaskId == "" {
+			req.TaskId = j.info.Id
+		}
+		req.ProgressCallback = chainProgress(progress, j.spec.Upload.ProgressCallback)
+		_, err = j.spec.Driver.UploadFileCtx(ctx, req)
+	case JobDownload:
+		req := *j.spec.Download
+		req.Ctx = ctx
+		if req.TaskId == "" {
+			req.TaskId = j.info.Id
+		}
+		req.ProgressCallback = chainProgress(progress, j.spec.Download.ProgressCallback)
+		_, err = j.spec.Driver.DownloadFileCtx(ctx, req)
+	}
+	canceled := ctx.Err() != nil
+	j.cancel()
+
+	m.mu.Lock()
+	m.running--
+	switch {
+	case err == nil && !canceled:
+		j.info.Operated = j.info.TotalSize
+		j.info.Percent = 100
+		m.finish(j, JobDone)
+	case j.stopAs != "":
+		m.finish(j, j.stopAs)
+	default:
+		if err == nil {
+			// 部分驱动取消时不返回错误
+			err = ctx.Err()
+		}
+		internal.GetLogger().Error("transfer job fail", "job", j.info.Id, "name", j.info.Name, "error", err)
+		j.info.Error = err
+		m.finish(j, JobFailed)
+	}
+	m.mu.Unlock()
+	m.changed(j)
+	m.schedule()
+}
+
+// finish 转入非运行状态并唤醒 Wait，调用方持有 m.mu
+func (m *TransferManager) finish(j *job, state JobState) {
+	j.info.State = state
+	j.info.Finished = time.Now()
+	select {
+	case <-j.done:
+	default:
+		close(j.done)
+	}
+}
+
+// changed 记录任务的最新状态，由回调协程交给 OnChange。回调不持有任何锁，
+// OnChange 中调用管理器的方法不会死锁
+func (m *TransferManager) changed(j *job) {
+	if m.opts.OnChange == nil {
+		return
+	}
+	// 快照与入队都在 m.mu 内完成，保证事件顺序与状态变化顺序一致
+	m.mu.Lock()
+	m.evMu.Lock()
+	m.events = append(m.events, j.info)
+	start := !m.delivering
+	m.delivering = true
+	m.evMu.Unlock()
+	m.mu.Unlock()
+	if start {
+		go m.deliver()
+	}
+}
+
+// deliver 依次回调排队的事件，队列为空时退出
+func (m *TransferManager) deliver() {
+	for {
+		m.evMu.Lock()
+		events := m.events
+		m.events = nil
+		if len(events) == 0 {
+			m.delivering = false
+			m.evMu.Unlock()
+			return
+		}
+		m.evMu.Unlock()
+		for _, info := range events {
+			m.opts.OnChange(info)
+		}
+	}
+}
+
+// chainProgress 依次调用非空的回调
+func chainProgress(callbacks ...ProgressCallback) ProgressCallback {
+	return func(event ProgressEvent) {
+		for _, cb := range callbacks {
+			if cb != nil {
+				cb(event)
+			}
+		}
+	}
+}
@@ -0,0 +1,570 @@
+package pantest
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	cloudreveApiPath    = "/api/v3"
+	cloudreveUploadPath = "/upload/"
+	cloudreveFilePath   = "/cloudreve-file/"
+	cloudreveCookieKey  = "cloudreve-session"
+)
+
+// fake Cloudreve 返回的错误码，与 Cloudreve v3 一致
+const (
+	// CloudreveCodeCheckLogin 未登录或 session 失效
+	CloudreveCodeCheckLogin = 401
+	// CloudreveCodeNotFound 对象不存在
+	CloudreveCodeNotFound = 404
+	// CloudreveCodeParamErr 参数错误
+	CloudreveCodeParamErr = 40001
+	// CloudreveCodeObjectExist 同名对象已存在
+	CloudreveCodeObjectExist = 40004
+	// CloudreveCodeParentNotExist 父目录不存在
+	CloudreveCodeParentNotExist = 40016
+	// CloudreveCodeConflictUploadOngoing 同名文件正在上传中
+	CloudreveCodeConflictUploadOngoing = 40054
+)
+
+// Cloudreve 上传模式
+const (
+	// CloudreveModeChunk POST uploadURL?chunk=N 按序号上传分片，最后一个分片到达即完成，对应 now61 等站点
+	CloudreveModeChunk = "chunk"
+	// CloudreveModeOneDrive PUT uploadURL 携带 Content-Range 上传，完成后需回调，对应 huang1111 等站点
+	CloudreveModeOneDrive = "onedrive"
+)
+
+// CloudreveServer 模拟 Cloudreve v3 的 /api/v3 接口以及上传地址
+type CloudreveServer struct {
+	*server
+	// Session 合法的 cloudreve-session cookie 值
+	Session string
+	// Mode 上传模式，参考 CloudreveModeChunk 和 CloudreveModeOneDrive
+	Mode string
+	// ChunkSize 上传会话返回的分片大小
+	ChunkSize int64
+	// MaxSize 存储策略的单文件大小上限，0 表示不限制
+	MaxSize int64
+
+	state    sync.Mutex
+	seq      int
+	sessions map[string]*cloudreveSession
+}
+
+type cloudreveSession struct {
+	id       string
+	parentId string
+	name     string
+	size     int64
+	data     []byte
+	received int64
+}
+
+// NewCloudreveServer 启动一个 fake Cloudreve 服务，使用完毕后需调用 Close
+func NewCloudreveServer() *CloudreveServer {
+	c := &CloudreveServer{
+		Session:   "pantest",
+		Mode:      CloudreveModeChunk,
+		ChunkSize: 4 * 1024 * 1024,
+		sessions:  make(map[string]*cloudreveSession),
+	}
+	c.server = newServer(NewTree("0", "c"), http.HandlerFunc(c.serveHTTP), c.writeError)
+	return c
+}
+
+// Sessions 返回进行中的上传会话数量
+func (c *CloudreveServer) Sessions() int {
+	c.state.Lock()
+	defer c.state.Unlock()
+	return len(c.sessions)
+}
+
+func (c *CloudreveServer) writeError(w http.ResponseWriter, code int, msg string) {
+	// Cloudreve v3 的业务错误同样以 HTTP 200 返回
+	writeJSON(w, http.StatusOK, map[string]any{
+		"code": code,
+		"msg":  msg,
+	})
+}
+
+func (c *CloudreveServer) ok(w http.ResponseWriter, data any) {
+	body := map[string]any{
+		"code": 0,
+		"msg":  "",
+	}
+	if data != nil {
+		body["data"] = data
+	}
+	writeJSON(w, http.StatusOK, body)
+}
+
+func (c *CloudreveServer) treeError(w http.ResponseWriter, err error) {
+	switch err {
+	case errNotExist:
+		c.writeError(w, CloudreveCodeNotFound, "Object not exist")
+	case errExist:
+		c.writeError(w, CloudreveCodeObjectExist, "Object existed")
+	default:
+		c.writeError(w, CloudreveCodeParamErr, err.Error())
+	}
+}
+
+func (c *CloudreveServer) nextId(prefix string) string {
+	c.state.Lock()
+	defer c.state.Unlock()
+	c.seq++
+	return fmt.Sprintf("%s%06d", prefix, c.seq)
+}
+
+func (c *CloudreveServer) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	p := r.URL.Path
+	switch {
+	case strings.HasPrefix(p, cloudreveUploadPath):
+		c.serveUpload(w, r, strings.TrimPrefix(p, cloudreveUploadPath))
+		return
+	case strings.HasPrefix(p, cloudreveFilePath) && r.Method == http.MethodGet:
+		n, ok := c.Tree.Get(strings.TrimPrefix(p, cloudreveFilePath))
+		if !ok || n.IsDir {
+			http.NotFound(w, r)
+			return
+		}
+		serveNode(w, r, n)
+		return
+	case !strings.HasPrefix(p, cloudreveApiPath+"/"):
+		http.NotFound(w, r)
+		return
+	}
+	p = strings.TrimPrefix(p, cloudreveApiPath)
+	cookie, err := r.Cookie(cloudreveCookieKey)
+	login := err == nil && cookie.Value == c.Session
+	if p == "/site/config" && r.Method == http.MethodGet {
+		if login {
+			http.SetCookie(w, &http.Cookie{Name: cloudreveCookieKey, Value: c.Session, Path: "/"})
+		}
+		c.ok(w, map[string]any{
+			"title": "pantest",
+			"user": map[string]any{
+				"id":        "pantest",
+				"user_name": "pantest@example.com",
+				"nickname":  "pantest",
+				"anonymous": !login,
+			},
+		})
+		return
+	}
+	if !login {
+		c.writeError(w, CloudreveCodeCheckLogin, "Login required")
+		return
+	}
+	switch {
+	case p == "/user/storage" && r.Method == http.MethodGet:
+		used := c.Tree.Usage()
+		total := int64(1024 * 1024 * 1024 * 1024)
+		c.ok(w, map[string]any{"used": used, "free": total - used, "total": total})
+	case p == "/file/upload" && r.Method == http.MethodPut:
+		c.createSession(w, r)
+	case p == "/file/upload" && r.Method == http.MethodDelete:
+		c.state.Lock()
+		c.sessions = make(map[string]*cloudreveSession)
+		c.state.Unlock()
+		c.ok(w, nil)
+	case strings.HasPrefix(p, "/file/upload/") && r.Method == http.MethodDelete:
+		c.state.Lock()
+		delete(c.sessions, strings.TrimPrefix(p, "/file/upload/"))
+		c.state.Unlock()
+		c.ok(w, nil)
+	case strings.HasPrefix(p, "/file/download/") && r.Method == http.MethodPut:
+		n, ok := c.Tree.Get(strings.TrimPrefix(p, "/file/download/"))
+		if !ok || n.IsDir {
+			c.treeError(w, errNotExist)
+			return
+		}
+		c.ok(w, c.URL+cloudreveFilePath+n.Id)
+	case strings.HasPrefix(p, "/file/search/keywords/") && r.Method == http.MethodGet:
+		c.fileSearch(w, r, strings.TrimPrefix(p, "/file/search/keywords/"))
+	case p == "/file/source" && r.Method == http.MethodPost:
+		c.fileSource(w, r)
+	case p == "/directory" && r.Method == http.MethodPut:
+		c.createDirectory(w, r)
+	case strings.HasPrefix(p, "/directory") && r.Method == http.MethodGet:
+		c.listDirectory(w, strings.TrimPrefix(p, "/directory"))
+	case p == "/object" && r.Method == http.MethodDelete:
+		c.objectDelete(w, r)
+	case p == "/object" && r.Method == http.MethodPatch:
+		c.objectMove(w, r, false)
+	case p == "/object/copy" && r.Method == http.MethodPost:
+		c.objectMove(w, r, true)
+	case p == "/object/rename" && r.Method == http.MethodPost:
+		c.objectRename(w, r)
+	case strings.HasPrefix(p, "/object/property/") && r.Method == http.MethodGet:
+		c.objectProperty(w, r, strings.TrimPrefix(p, "/object/property/"))
+	case strings.HasPrefix(p, "/callback/onedrive/finish/") && r.Method == http.MethodPost:
+		c.oneDriveFinish(w, strings.TrimPrefix(p, "/callback/onedrive/finish/"))
+	default:
+		c.writeError(w, CloudreveCodeNotFound, "unknown api "+r.Method+" "+p)
+	}
+}
+
+func (c *CloudreveServer) object(n *Node) map[string]any {
+	objType := "file"
+	if n.IsDir {
+		objType = "dir"
+	}
+	return map[string]any{
+		"id":             n.Id,
+		"name":           n.Name,
+		"path":           path.Dir(c.Tree.PathOf(n.Id)),
+		"thumb":          false,
+		"size":           n.Size(),
+		"type":           objType,
+		"date":           n.Modified.Format(time.RFC3339),
+		"create_date":    n.Created.Format(time.RFC3339),
+		"source_enabled": true,
+	}
+}
+
+func (c *CloudreveServer) policy() map[string]any {
+	return map[string]any{
+		"id":        "pantest-policy",
+		"name":      "pantest",
+		"type":      c.Mode,
+		"max_size":  c.MaxSize,
+		"file_type": []string{},
+	}
+}
+
+// dir 按路径查找目录，路径不存在时输出错误并返回 false
+func (c *CloudreveServer) dir(w http.ResponseWriter, p string) (*Node, bool) {
+	n, ok := c.Tree.Lookup(p)
+	if !ok || !n.IsDir {
+		c.writeError(w, CloudreveCodeParentNotExist, "Path not exist")
+		return nil, false
+	}
+	return n, true
+}
+
+func (c *CloudreveServer) listDirectory(w http.ResponseWriter, p string) {
+	dir, ok := c.dir(w, p)
+	if !ok {
+		return
+	}
+	children, _ := c.Tree.Children(dir.Id)
+	objects := make([]map[string]any, 0)
+	for _, n := range children {
+		objects = append(objects, c.object(n))
+	}
+	c.ok(w, map[string]any{
+		"parent":  dir.Id,
+		"objects": objects,
+		"policy":  c.policy(),
+	})
+}
+
+func (c *CloudreveServer) fileSearch(w http.ResponseWriter, r *http.Request, keyword string) {
+	dir, ok := c.dir(w, r.URL.Query().Get("path"))
+	if !ok {
+		return
+	}
+	keyword = strings.ToLower(keyword)
+	objects := make([]map[string]any, 0)
+	for _, n := range c.Tree.Search(dir.Id, func(n *Node) bool {
+		return strings.Contains(strings.ToLower(n.Name), keyword)
+	}) {
+		objects = append(objects, c.object(n))
+	}
+	c.ok(w, map[string]any{"objects": objects})
+}
+
+func (c *CloudreveServer) createDirectory(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Path string `json:"path"`
+	}
+	if err := readJSON(r, &body); err != nil {
+		c.writeError(w, CloudreveCodeParamErr, err.Error())
+		return
+	}
+	p := path.Clean("/" + body.Path)
+	parent, ok := c.dir(w, path.Dir(p))
+	if !ok {
+		return
+	}
+	if _, err := c.Tree.Mkdir(parent.Id, path.Base(p)); err != nil {
+		c.treeError(w, err)
+		return
+	}
+	c.ok(w, nil)
+}
+
+type cloudreveItems struct {
+	Items []string `json:"items"`
+	Dirs  []string `json:"dirs"`
+}
+
+func (i cloudreveItems) all() []string {
+	return append(append([]string{}, i.Items...), i.Dirs...)
+}
+
+func (c *CloudreveServer) objectDelete(w http.ResponseWriter, r *http.Request) {
+	var body cloudreveItems
+	if err := readJSON(r, &body); err != nil {
+		c.writeError(w, CloudreveCodeParamErr, err.Error())
+		return
+	}
+	for _, id := range body.all() {
+		if err := c.Tree.Remove(id); err != nil {
+			c.treeError(w, err)
+			return
+		}
+	}
+	c.ok(w, nil)
+}
+
+func (c *CloudreveServer) objectMove(w http.ResponseWriter, r *http.Request, duplicate bool) {
+	var body struct {
+		SrcDir string         `json:"src_dir"`
+		Src    cloudreveItems `json:"src"`
+		Dst    string         `json:"dst"`
+	}
+	if err := readJSON(r, &body); err != nil {
+		c.writeError(w, CloudreveCodeParamErr, err.Error())
+		return
+	}
+	dst, ok := c.dir(w, body.Dst)
+	if !ok {
+		return
+	}
+	for _, id := range body.Src.all() {
+		var err error
+		if duplicate {
+			_, err = c.Tree.Copy(id, dst.Id)
+		} else {
+			err = c.Tree.Move(id, dst.Id)
+		}
+		if err != nil {
+			c.treeError(w, err)
+			return
+		}
+	}
+	c.ok(w, nil)
+}
+
+func (c *CloudreveServer) objectRename(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Src     cloudreveItems `json:"src"`
+		NewName string         `json:"new_name"`
+	}
+	if err := readJSON(r, &body); err != nil {
+		c.writeError(w, CloudreveCodeParamErr, err.Error())
+		return
+	}
+	ids := body.Src.all()
+	if len(ids) != 1 {
+		c.writeError(w, CloudreveCodeParamErr, "Only one object can be renamed")
+		return
+	}
+	if _, err := c.Tree.Rename(ids[0], body.NewName); err != nil {
+		c.treeError(w, err)
+		return
+	}
+	c.ok(w, nil)
+}
+
+// objectProperty 文件和目录的 ID 属于不同的表，is_folder 与对象类型不符时不存在
+func (c *CloudreveServer) objectProperty(w http.ResponseWriter, r *http.Request, id string) {
+	n, ok := c.Tree.Get(id)
+	if !ok || n.IsDir != (r.URL.Query().Get("is_folder") == "true") {
+		c.treeError(w, errNotExist)
+		return
+	}
+	childDirs, childFiles := 0, 0
+	if n.IsDir {
+		children, _ := c.Tree.Children(id)
+		for _, child := range children {
+			if child.IsDir {
+				childDirs++
+			} else {
+				childFiles++
+			}
+		}
+	}
+	c.ok(w, map[string]any{
+		"created_at":       n.Created.Format(time.RFC3339),
+		"updated_at":       n.Modified.Format(time.RFC3339),
+		"policy":           "pantest",
+		"size":             n.Size(),
+		"child_folder_num": childDirs,
+		"child_file_num":   childFiles,
+		"path":             path.Dir(c.Tree.PathOf(id)),
+		"query_date":       time.Now().Format(time.RFC3339),
+	})
+}
+
+func (c *CloudreveServer) fileSource(w http.ResponseWriter, r *http.Request) {
+	var body cloudreveItems
+	if err := readJSON(r, &body); err != nil {
+		c.writeError(w, CloudreveCodeParamErr, err.Error())
+		return
+	}
+	sources := make([]map[string]any, 0)
+	for _, id := range body.Items {
+		n, ok := c.Tree.Get(id)
+		if !ok || n.IsDir {
+			sources = append(sources, map[string]any{"error": "Object not exist"})
+			continue
+		}
+		sources = append(sources, map[string]any{
+			"url":  c.URL + cloudreveFilePath + n.Id,
+			"name": n.Name,
+		})
+	}
+	c.ok(w, sources)
+}
+
+func (c *CloudreveServer) createSession(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Path     string `json:"path"`
+		Size     int64  `json:"size"`
+		Name     string `json:"name"`
+		PolicyID string `json:"policy_id"`
+	}
+	if err := readJSON(r, &body); err != nil {
+		c.writeError(w, CloudreveCodeParamErr, err.Error())
+		return
+	}
+	if body.PolicyID != "pantest-policy" {
+		c.writeError(w, CloudreveCodeParamErr, "Policy not exist")
+		return
+	}
+	parent, ok := c.dir(w, body.Path)
+	if !ok {
+		return
+	}
+	if _, exist := c.Tree.Lookup(path.Join(path.Clean("/"+body.Path), body.Name)); exist {
+		c.writeError(w, CloudreveCodeObjectExist, "Object existed")
+		return
+	}
+	session := &cloudreveSession{
+		id:       c.nextId("session"),
+		parentId: parent.Id,
+		name:     body.Name,
+		size:     body.Size,
+		data:     make([]byte, body.Size),
+	}
+	c.state.Lock()
+	for _, s := range c.sessions {
+		if s.parentId == session.parentId && s.name == session.name {
+			c.state.Unlock()
+			c.writeError(w, CloudreveCodeConflictUploadOngoing, "Conflict upload ongoing")
+			return
+		}
+	}
+	c.sessions[session.id] = session
+	c.state.Unlock()
+	c.ok(w, map[string]any{
+		"sessionID":  session.id,
+		"chunkSize":  c.ChunkSize,
+		"expires":    time.Now().Add(time.Hour).Unix(),
+		"uploadURLs": []string{c.URL + cloudreveUploadPath + session.id},
+		"credential": "pantest-" + session.id,
+	})
+}
+
+func (c *CloudreveServer) session(id string) (*cloudreveSession, bool) {
+	c.state.Lock()
+	defer c.state.Unlock()
+	s, ok := c.sessions[id]
+	return s, ok
+}
+
+// serveUpload 处理分片数据，chunk 模式最后一个分片到达即生成文件，onedrive 模式需等待回调
+func (c *CloudreveServer) serveUpload(w http.ResponseWriter, r *http.Request, sessionId string) {
+	session, ok := c.session(sessionId)
+	if !ok {
+		c.writeError(w, CloudreveCodeNotFound, "Upload session not exist")
+		return
+	}
+	data, err := readBody(r)
+	if err != nil {
+		c.writeError(w, CloudreveCodeParamErr, err.Error())
+		return
+	}
+	var offset int64
+	switch {
+	case r.Method == http.MethodPost && c.Mode == CloudreveModeChunk:
+		if r.Header.Get("Authorization") != "pantest-"+sessionId {
+			c.writeError(w, CloudreveCodeCheckLogin, "Credential invalid")
+			return
+		}
+		chunk, err := strconv.ParseInt(r.URL.Query().Get("chunk"), 10, 64)
+		if err != nil {
+			c.writeError(w, CloudreveCodeParamErr, "Chunk index invalid")
+			return
+		}
+		offset = chunk * c.ChunkSize
+	case r.Method == http.MethodPut && c.Mode == CloudreveModeOneDrive:
+		var end, total int64
+		if _, err = fmt.Sscanf(r.Header.Get("Content-Range"), "bytes %d-%d/%d", &offset, &end, &total); err != nil ||
+			end-offset+1 != int64(len(data)) || total != session.size {
+			http.Error(w, "invalid Content-Range", http.StatusBadRequest)
+			return
+		}
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if offset+int64(len(data)) > session.size {
+		c.writeError(w, CloudreveCodeParamErr, "Chunk out of range")
+		return
+	}
+	c.state.Lock()
+	copy(session.data[offset:], data)
+	session.received = max(session.received, offset+int64(len(data)))
+	done := session.received == session.size
+	c.state.Unlock()
+	if c.Mode == CloudreveModeOneDrive {
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+	if done {
+		if err = c.complete(session); err != nil {
+			c.treeError(w, err)
+			return
+		}
+	}
+	c.ok(w, nil)
+}
+
+func (c *CloudreveServer) complete(session *cloudreveSession) error {
+	c.state.Lock()
+	delete(c.sessions, session.id)
+	c.state.Unlock()
+	_, err := c.Tree.Put("", session.parentId, session.name, session.data)
+	return err
+}
+
+func (c *CloudreveServer) oneDriveFinish(w http.ResponseWriter, sessionId string) {
+	session, ok := c.session(sessionId)
+	if !ok {
+		c.writeError(w, CloudreveCodeNotFound, "Upload session not exist")
+		return
+	}
+	c.state.Lock()
+	done := session.received == session.size
+	c.state.Unlock()
+	if !done {
+		c.writeError(w, CloudreveCodeParamErr, "Upload not complete")
+		return
+	}
+	if err := c.complete(session); err != nil {
+		c.treeError(w, err)
+		return
+	}
+	c.ok(w, nil)
+}
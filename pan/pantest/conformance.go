@@ -0,0 +1,1225 @@
+package pantest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/hefeiyu25/pan-client/pan"
+)
+
+// ConformanceRoot 一致性测试使用的远端根目录，测试结束后会被删除
+const ConformanceRoot = "/pantest-conformance"
+
+// conformanceFileSize 上传下载测试文件大小，需大于 fake 服务端配置的分片大小以覆盖多分片流程
+const conformanceFileSize = 10000
+
+// RunConformance runs the shared driver behaviour suite against drivers created
+// by newDriver. newDriver may be called more than once per run and every driver
+// it returns must be backed by the same storage, so changes made through one
+// driver are visible to the others after a reload. The suite only touches
+// objects under ConformanceRoot and removes it when finished.
+//
+// Optional operations (offline download, task list, direct link, share) must
+// work when reported by Capabilities and fail with an error matching
+// pan.ErrUnsupported otherwise. Failures on
+// missing or existing objects must match pan.ErrNotFound and
+// pan.ErrAlreadyExists.
+func RunConformance(t *testing.T, newDriver func() pan.Driver) {
+	t.Helper()
+	c := &conformance{
+		newDriver: newDriver,
+		driver:    newDriver(),
+	}
+	t.Cleanup(func() {
+		_ = c.driver.Delete(pan.DeleteReq{Items: []*pan.PanObj{dirObj(ConformanceRoot)}})
+	})
+	t.Run("Disk", c.testDisk)
+	t.Run("List", c.testList)
+	t.Run("ListOptions", c.testListOptions)
+	t.Run("ListIter", c.testListIter)
+	t.Run("Stat", c.testStat)
+	t.Run("Search", c.testSearch)
+	t.Run("Walk", c.testWalk)
+	t.Run("Glob", c.testGlob)
+	t.Run("FS", c.testFS)
+	t.Run("Open", c.testOpen)
+	t.Run("Mkdir", c.testMkdir)
+	t.Run("ObjRename", c.testObjRename)
+	t.Run("Move", c.testMove)
+	t.Run("Copy", c.testCopy)
+	t.Run("Delete", c.testDelete)
+	t.Run("Trash", c.testTrash)
+	t.Run("UploadDownload", c.testUploadDownload)
+	t.Run("UploadDownloadPath", c.testUploadDownloadPath)
+	t.Run("UploadStream", c.testUploadStream)
+	t.Run("Share", c.testShare)
+	t.Run("Optional", c.testOptional)
+	t.Run("Context", c.testContext)
+	t.Run("Errors", c.testErrors)
+}
+
+type conformance struct {
+	newDriver func() pan.Driver
+	driver    pan.Driver
+}
+
+// dirObj 构造仅包含路径的目录对象，与调用方常见用法一致
+func dirObj(p string) *pan.PanObj {
+	p = path.Clean("/" + p)
+	if p == "/" {
+		return &pan.PanObj{Path: "/", Type: "dir"}
+	}
+	return &pan.PanObj{Path: path.Dir(p), Name: path.Base(p), Type: "dir"}
+}
+
+// fileObj 构造仅包含路径的文件对象
+func fileObj(p string) *pan.PanObj {
+	p = path.Clean("/" + p)
+	return &pan.PanObj{Path: path.Dir(p), Name: path.Base(p), Type: "file"}
+}
+
+// recent 判断网盘返回的时间是否为当前时间附近，用于校验时间字段已填充
+func recent(tm time.Time) bool {
+	return tm.After(time.Now().Add(-24*time.Hour)) && tm.Before(time.Now().Add(24*time.Hour))
+}
+
+// notSupport 判断错误是否为驱动声明的不支持操作
+func notSupport(err error) bool {
+	return errors.Is(err, pan.ErrUnsupported)
+}
+
+// checkCapability 校验操作结果与 Capabilities 声明一致，返回操作是否成功
+func checkCapability(t *testing.T, what string, supported bool, err error) bool {
+	t.Helper()
+	if !supported {
+		if !notSupport(err) {
+			t.Fatalf("%s reported unsupported, got: %v", what, err)
+		}
+		return false
+	}
+	if err != nil {
+		t.Fatalf("%s: %v", what, err)
+	}
+	return true
+}
+
+func (c *conformance) list(t *testing.T, dir string, reload bool) []*pan.PanObj {
+	t.Helper()
+	objs, err := c.driver.List(pan.ListReq{Dir: dirObj(dir), Reload: reload})
+	if err != nil {
+		t.Fatalf("list %s: %v", dir, err)
+	}
+	return objs
+}
+
+func (c *conformance) mkdir(t *testing.T, dir string) *pan.PanObj {
+	t.Helper()
+	obj, err := c.driver.Mkdir(pan.MkdirReq{NewPath: dir})
+	if err != nil {
+		t.Fatalf("mkdir %s: %v", dir, err)
+	}
+	return obj
+}
+
+// upload 在本地生成 name 文件并上传到 dir，返回文件内容
+func (c *conformance) upload(t *testing.T, driver pan.Driver, dir, name string, size int) []byte {
+	t.Helper()
+	localFile, content := writeLocalFile(t, t.TempDir(), name, size)
+	if _, err := driver.UploadFile(pan.UploadFileReq{LocalFile: localFile, RemotePath: dir}); err != nil {
+		t.Fatalf("upload %s to %s: %v", name, dir, err)
+	}
+	return content
+}
+
+func writeLocalFile(t *testing.T, dir, name string, size int) (string, []byte) {
+	t.Helper()
+	content := make([]byte, size)
+	for i := range content {
+		content[i] = byte('a' + (i+len(name))%26)
+	}
+	file := filepath.Join(dir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(file), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(file, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return file, content
+}
+
+func find(objs []*pan.PanObj, name string) *pan.PanObj {
+	for _, obj := range objs {
+		if obj.Name == name {
+			return obj
+		}
+	}
+	return nil
+}
+
+func names(objs []*pan.PanObj) string {
+	result := make([]string, 0, len(objs))
+	for _, obj := range objs {
+		result = append(result, obj.Name)
+	}
+	sort.Strings(result)
+	return strings.Join(result, ",")
+}
+
+func expectNames(t *testing.T, what string, objs []*pan.PanObj, want ...string) {
+	t.Helper()
+	sort.Strings(want)
+	if got := names(objs); got != strings.Join(want, ",") {
+		t.Fatalf("%s: got [%s], want [%s]", what, got, strings.Join(want, ","))
+	}
+}
+
+// progressRecorder 记录传输进度事件并校验其顺序
+type progressRecorder struct {
+	mu     sync.Mutex
+	events []pan.ProgressEvent
+}
+
+func (r *progressRecorder) callback(event pan.ProgressEvent) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, event)
+}
+
+// check 校验进度单调不减、总大小不变，且仅最后一个事件为完成状态
+func (r *progressRecorder) check(t *testing.T, what, taskId string, size int64) {
+	t.Helper()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.events) == 0 {
+		t.Fatalf("%s: no progress event", what)
+	}
+	var operated int64
+	for i, event := range r.events {
+		if event.TaskId != taskId {
+			t.Fatalf("%s: event %d task id %q, want %q", what, i, event.TaskId, taskId)
+		}
+		if event.TotalSize != size {
+			t.Fatalf("%s: event %d total size %d, want %d", what, i, event.TotalSize, size)
+		}
+		if event.Operated < operated || event.Operated > size {
+			t.Fatalf("%s: event %d operated %d after %d, total %d", what, i, event.Operated, operated, size)
+		}
+		operated = event.Operated
+		if event.Done != (i == len(r.events)-1) {
+			t.Fatalf("%s: event %d of %d done=%v", what, i, len(r.events), event.Done)
+		}
+	}
+	if operated != size {
+		t.Fatalf("%s: last event operated %d, want %d", what, operated, size)
+	}
+}
+
+func (c *conformance) testDisk(t *testing.T) {
+	disk, err := c.driver.Disk()
+	if err != nil {
+		t.Fatalf("disk: %v", err)
+	}
+	if disk.Used < 0 || disk.Free < 0 || disk.Total < 0 {
+		t.Fatalf("disk: negative usage %+v", disk)
+	}
+}
+
+func (c *conformance) testList(t *testing.T) {
+	base := ConformanceRoot + "/list"
+	c.mkdir(t, base)
+	if root, err := c.driver.List(pan.ListReq{Dir: dirObj("/"), Reload: true}); err != nil || find(root, path.Base(ConformanceRoot)) == nil {
+		t.Fatalf("list root: %v %v", names(root), err)
+	}
+	expectNames(t, "list empty dir", c.list(t, base, false))
+
+	// 通过另一个驱动实例修改，未 Reload 时应命中缓存
+	c.upload(t, c.newDriver(), base, "other.txt", 3)
+	expectNames(t, "list without reload", c.list(t, base, false))
+	objs := c.list(t, base, true)
+	expectNames(t, "list with reload", objs, "other.txt")
+	obj := objs[0]
+	if obj.Id == "" || obj.Type != "file" || obj.Size != 3 || obj.Path != base {
+		t.Fatalf("listed object: %+v", obj)
+	}
+	if !recent(obj.ModTime) {
+		t.Fatalf("listed object mod time: %v", obj.ModTime)
+	}
+
+	if _, err := c.driver.List(pan.ListReq{Dir: dirObj(base + "/missing"), Reload: true}); err == nil {
+		t.Fatal("list missing dir should fail")
+	}
+}
+
+func (c *conformance) testListOptions(t *testing.T) {
+	base := ConformanceRoot + "/listopts"
+	c.upload(t, c.driver, base, "a.txt", 5)
+	c.upload(t, c.driver, base, "b.log", 1)
+	c.upload(t, c.driver, base, "c.txt", 3)
+	c.mkdir(t, base+"/d1")
+	c.mkdir(t, base+"/d2")
+	plain := c.list(t, base, true)
+
+	list := func(what string, req pan.ListReq, want ...string) {
+		t.Helper()
+		req.Dir = dirObj(base)
+		objs, err := c.driver.List(req)
+		if err != nil {
+			t.Fatalf("list %s: %v", what, err)
+		}
+		got := make([]string, 0, len(objs))
+		for _, obj := range objs {
+			got = append(got, obj.Name)
+		}
+		if strings.Join(got, ",") != strings.Join(want, ",") {
+			t.Fatalf("list %s: got [%s], want [%s]", what, strings.Join(got, ","), strings.Join(want, ","))
+		}
+	}
+	list("size", pan.ListReq{SortBy: pan.SortBySize, TypeFilter: "file"}, "b.log", "c.txt", "a.txt")
+	list("size desc", pan.ListReq{SortBy: pan.SortBySize, Order: pan.OrderDesc, TypeFilter: "file"}, "a.txt", "c.txt", "b.log")
+	list("name desc", pan.ListReq{SortBy: pan.SortByName, Order: pan.OrderDesc}, "d2", "d1", "c.txt", "b.log", "a.txt")
+	list("dirs", pan.ListReq{SortBy: pan.SortByName, TypeFilter: "dir"}, "d1", "d2")
+	list("glob", pan.ListReq{SortBy: pan.SortByName, NameGlob: "*.txt"}, "a.txt", "c.txt")
+	list("page", pan.ListReq{SortBy: pan.SortByName, Offset: 1, Limit: 2}, "b.log", "c.txt")
+	list("past end", pan.ListReq{SortBy: pan.SortByName, Offset: 10})
+	list("mtime", pan.ListReq{SortBy: pan.SortByModTime, TypeFilter: "file", NameGlob: "?.*"}, sortedBy(plain, "file")...)
+
+	// 选项只作用于返回结果，缓存中的完整列表保持原样
+	cached := c.list(t, base, false)
+	if len(cached) != len(plain) {
+		t.Fatalf("cached list: %s", names(cached))
+	}
+	for i := range plain {
+		if cached[i].Id != plain[i].Id {
+			t.Fatalf("cached list order changed: %s", names(cached))
+		}
+	}
+	if _, err := c.driver.List(pan.ListReq{Dir: dirObj(base), NameGlob: "["}); !errors.Is(err, path.ErrBadPattern) {
+		t.Fatalf("list bad glob: %v", err)
+	}
+}
+
+// sortedBy 按修改时间、名称排序后返回 typ 类型对象的名称
+func sortedBy(objs []*pan.PanObj, typ string) []string {
+	filtered := make([]*pan.PanObj, 0, len(objs))
+	for _, obj := range objs {
+		if obj.Type == typ {
+			filtered = append(filtered, obj)
+		}
+	}
+	sort.SliceStable(filtered, func(i, j int) bool {
+		if !filtered[i].ModTime.Equal(filtered[j].ModTime) {
+			return filtered[i].ModTime.Before(filtered[j].ModTime)
+		}
+		return filtered[i].Name < filtered[j].Name
+	})
+	result := make([]string, 0, len(filtered))
+	for _, obj := range filtered {
+		result = append(result, obj.Name)
+	}
+	return result
+}
+
+func (c *conformance) testListIter(t *testing.T) {
+	base := ConformanceRoot + "/iter"
+	c.mkdir(t, base+"/d1")
+	c.mkdir(t, base+"/d2")
+	c.upload(t, c.driver, base, "f.txt", 3)
+	listed := c.list(t, base, true)
+
+	collect := func(what string) []*pan.PanObj {
+		t.Helper()
+		objs := make([]*pan.PanObj, 0)
+		for obj, err := range c.driver.ListIter(context.Background(), dirObj(base)) {
+			if err != nil {
+				t.Fatalf("list iter %s: %v", what, err)
+			}
+			objs = append(objs, obj)
+		}
+		return objs
+	}
+	objs := collect("cached")
+	expectNames(t, "list iter cached", objs, "d1", "d2", "f.txt")
+	if obj := find(objs, "f.txt"); obj.Id != find(listed, "f.txt").Id || obj.Path != base || obj.Size != 3 || obj.Type != "file" {
+		t.Fatalf("list iter file: %+v", obj)
+	}
+
+	// 新建目录使缓存失效，迭代器从服务端分页读取
+	c.mkdir(t, base+"/d3")
+	objs = collect("uncached")
+	expectNames(t, "list iter uncached", objs, "d1", "d2", "d3", "f.txt")
+	if obj := find(objs, "d3"); obj.Id == "" || obj.Path != base || obj.Type != "dir" {
+		t.Fatalf("list iter dir: %+v", obj)
+	}
+
+	count := 0
+	for _, err := range c.driver.ListIter(context.Background(), dirObj(base)) {
+		if err != nil {
+			t.Fatalf("list iter break: %v", err)
+		}
+		count++
+		break
+	}
+	if count != 1 {
+		t.Fatalf("list iter break: %d entries", count)
+	}
+
+	count = 0
+	for obj, err := range c.driver.ListIter(context.Background(), dirObj(base+"/missing")) {
+		count++
+		if !errors.Is(err, pan.ErrNotFound) || obj != nil {
+			t.Fatalf("list iter missing: %v %v", obj, err)
+		}
+	}
+	if count != 1 {
+		t.Fatalf("list iter missing: %d results", count)
+	}
+}
+
+func (c *conformance) testStat(t *testing.T) {
+	base := ConformanceRoot + "/stat"
+	c.mkdir(t, base+"/sub")
+	c.upload(t, c.driver, base, "s.txt", 5)
+	listed := find(c.list(t, base, true), "s.txt")
+	if listed == nil {
+		t.Fatal("missing uploaded file")
+	}
+
+	obj, err := c.driver.Stat(pan.StatReq{Path: base + "/s.txt"})
+	if err != nil || obj.Id != listed.Id || obj.Name != "s.txt" || obj.Path != base || obj.Type != "file" || obj.Size != 5 {
+		t.Fatalf("stat file: %+v %v", obj, err)
+	}
+	if !recent(obj.ModTime) {
+		t.Fatalf("stat file mod time: %v", obj.ModTime)
+	}
+	if obj, err = c.driver.Stat(pan.StatReq{Path: base + "/sub"}); err != nil || obj.Name != "sub" || obj.Type != "dir" {
+		t.Fatalf("stat dir: %+v %v", obj, err)
+	}
+	if obj, err = c.driver.Stat(pan.StatReq{Path: "/"}); err != nil || obj.Type != "dir" {
+		t.Fatalf("stat root: %+v %v", obj, err)
+	}
+
+	// 按 ID 查询为可选能力
+	obj, err = c.driver.Stat(pan.StatReq{Id: listed.Id})
+	if err != nil && !notSupport(err) {
+		t.Fatalf("stat by id: %v", err)
+	}
+	if err == nil && (obj.Id != listed.Id || obj.Name != "s.txt" || obj.Size != 5) {
+		t.Fatalf("stat by id: %+v", obj)
+	}
+
+	for _, missing := range []string{base + "/missing.txt", base + "/missing/s.txt", base + "/s.txt/x"} {
+		if _, err = c.driver.Stat(pan.StatReq{Path: missing}); !errors.Is(err, pan.ErrNotFound) {
+			t.Fatalf("stat %s: %v", missing, err)
+		}
+	}
+}
+
+func (c *conformance) testSearch(t *testing.T) {
+	base := ConformanceRoot + "/search"
+	c.upload(t, c.driver, base, "Search-Hit.txt", 3)
+	c.upload(t, c.driver, base+"/sub", "search-hit-2.log", 10)
+	c.upload(t, c.driver, base+"/sub", "other.txt", 5)
+	c.mkdir(t, base+"/search-hit-dir")
+	root := dirObj(base)
+
+	search := func(what string, req pan.SearchReq, want ...string) []*pan.PanObj {
+		t.Helper()
+		objs, err := c.driver.Search(req)
+		if err != nil {
+			t.Fatalf("search %s: %v", what, err)
+		}
+		expectNames(t, "search "+what, objs, want...)
+		return objs
+	}
+	objs := search("keyword", pan.SearchReq{Keyword: "search-hit", Root: root}, "Search-Hit.txt", "search-hit-2.log", "search-hit-dir")
+	if obj := find(objs, "search-hit-2.log"); obj.Id == "" || obj.Path != base+"/sub" || obj.Type != "file" || obj.Size != 10 {
+		t.Fatalf("search result: %+v", obj)
+	}
+	search("whole drive", pan.SearchReq{Keyword: "SEARCH-HIT-2"}, "search-hit-2.log")
+	search("types", pan.SearchReq{Keyword: "search-hit", Root: root, Types: []string{"file"}}, "Search-Hit.txt", "search-hit-2.log")
+	search("min size", pan.SearchReq{Keyword: "search-hit", Root: root, MinSize: 5}, "search-hit-2.log")
+	search("max size", pan.SearchReq{Keyword: "search-hit", Root: root, Types: []string{"file"}, MaxSize: 5}, "Search-Hit.txt")
+	search("sub root", pan.SearchReq{Keyword: "search-hit", Root: dirObj(base + "/sub")}, "search-hit-2.log")
+	search("no keyword", pan.SearchReq{Root: dirObj(base + "/sub")}, "other.txt", "search-hit-2.log")
+	search("no match", pan.SearchReq{Keyword: "search-miss", Root: root})
+
+	// 搜索结果可以直接用于后续操作
+	if err := c.driver.ObjRename(pan.ObjRenameReq{Obj: find(objs, "Search-Hit.txt"), NewName: "renamed.txt"}); err != nil {
+		t.Fatalf("rename search result: %v", err)
+	}
+	expectNames(t, "list after rename", c.list(t, base, false), "renamed.txt", "search-hit-dir", "sub")
+
+	if _, err := c.driver.Search(pan.SearchReq{Keyword: "x", Root: dirObj(base + "/missing")}); !errors.Is(err, pan.ErrNotFound) {
+		t.Fatalf("search missing root: %v", err)
+	}
+}
+
+func (c *conformance) testWalk(t *testing.T) {
+	base := ConformanceRoot + "/walk"
+	c.upload(t, c.driver, base+"/a", "x.txt", 3)
+	c.upload(t, c.driver, base+"/a/b", "y.txt", 3)
+	c.upload(t, c.driver, base+"/c", "z.txt", 3)
+	c.upload(t, c.driver, base, "top.txt", 3)
+
+	walk := func(what string, opts pan.WalkOptions, skip func(rel string) error, want ...string) error {
+		t.Helper()
+		seen := make(map[string]bool)
+		got := make([]string, 0)
+		err := pan.Walk(context.Background(), c.driver, dirObj(base), func(obj *pan.PanObj, err error) error {
+			if err != nil {
+				return err
+			}
+			rel := strings.TrimPrefix(path.Join(obj.Path, obj.Name), base+"/")
+			if dir := path.Dir(rel); dir != "." && !seen[dir] {
+				t.Errorf("walk %s: %s visited before its directory", what, rel)
+			}
+			seen[rel] = true
+			got = append(got, rel)
+			if skip != nil {
+				return skip(rel)
+			}
+			return nil
+		}, opts)
+		sort.Strings(got)
+		sort.Strings(want)
+		if strings.Join(got, ",") != strings.Join(want, ",") {
+			t.Fatalf("walk %s: got [%s], want [%s]", what, strings.Join(got, ","), strings.Join(want, ","))
+		}
+		return err
+	}
+	all := []string{"a", "a/b", "a/b/y.txt", "a/x.txt", "c", "c/z.txt", "top.txt"}
+	if err := walk("all", pan.WalkOptions{Concurrency: 3, Reload: true}, nil, all...); err != nil {
+		t.Fatalf("walk all: %v", err)
+	}
+	if err := walk("depth", pan.WalkOptions{MaxDepth: 1}, nil, "a", "c", "top.txt"); err != nil {
+		t.Fatalf("walk depth: %v", err)
+	}
+	skipA := func(rel string) error {
+		if rel == "a" {
+			return pan.SkipDir
+		}
+		return nil
+	}
+	if err := walk("skip dir", pan.WalkOptions{Concurrency: 2}, skipA, "a", "c", "c/z.txt", "top.txt"); err != nil {
+		t.Fatalf("walk skip dir: %v", err)
+	}
+	calls := 0
+	if err := pan.Walk(context.Background(), c.driver, dirObj(base), func(obj *pan.PanObj, err error) error {
+		calls++
+		return pan.SkipAll
+	}, pan.WalkOptions{Concurrency: 3}); err != nil || calls != 1 {
+		t.Fatalf("walk skip all: calls %d, err %v", calls, err)
+	}
+
+	stop := errors.New("stop")
+	if err := pan.Walk(context.Background(), c.driver, dirObj(base), func(obj *pan.PanObj, err error) error {
+		return stop
+	}, pan.WalkOptions{}); !errors.Is(err, stop) {
+		t.Fatalf("walk error: %v", err)
+	}
+	if err := pan.Walk(context.Background(), c.driver, dirObj(base+"/missing"), func(obj *pan.PanObj, err error) error {
+		return err
+	}, pan.WalkOptions{}); !errors.Is(err, pan.ErrNotFound) {
+		t.Fatalf("walk missing root: %v", err)
+	}
+}
+
+// listRecorder 记录被列举的目录
+type listRecorder struct {
+	pan.Driver
+	mu     sync.Mutex
+	listed []string
+}
+
+func (r *listRecorder) ListCtx(ctx context.Context, req pan.ListReq) ([]*pan.PanObj, error) {
+	r.mu.Lock()
+	r.listed = append(r.listed, path.Join(req.Dir.Path, req.Dir.Name))
+	r.mu.Unlock()
+	return r.Driver.ListCtx(ctx, req)
+}
+
+func (c *conformance) testGlob(t *testing.T) {
+	base := ConformanceRoot + "/glob"
+	c.upload(t, c.driver, base+"/a", "x.mkv", 3)
+	c.upload(t, c.driver, base+"/a/b", "y.mkv", 3)
+	c.upload(t, c.driver, base+"/a/b", "z.txt", 3)
+	c.upload(t, c.driver, base+"/c", "w.mkv", 3)
+	c.upload(t, c.driver, base, "top.mkv", 3)
+
+	glob := func(driver pan.Driver, pattern string, want ...string) {
+		t.Helper()
+		objs, err := pan.Glob(context.Background(), driver, base+pattern)
+		if err != nil {
+			t.Fatalf("glob %s: %v", pattern, err)
+		}
+		got := make([]string, 0, len(objs))
+		for _, obj := range objs {
+			got = append(got, strings.TrimPrefix(path.Join(obj.Path, obj.Name), base+"/"))
+		}
+		if strings.Join(got, ",") != strings.Join(want, ",") {
+			t.Fatalf("glob %s: got [%s], want [%s]", pattern, strings.Join(got, ","), strings.Join(want, ","))
+		}
+	}
+	glob(c.driver, "/**/*.mkv", "a/b/y.mkv", "a/x.mkv", "c/w.mkv", "top.mkv")
+	glob(c.driver, "/?/*.mkv", "a/x.mkv", "c/w.mkv")
+	glob(c.driver, "/[ab]/**", "a", "a/b", "a/b/y.mkv", "a/b/z.txt", "a/x.mkv")
+	glob(c.driver, "/*/b/*.txt", "a/b/z.txt")
+	glob(c.driver, "/missing/*")
+
+	// 不可能匹配的目录不应被列举
+	rec := &listRecorder{Driver: c.driver}
+	glob(rec, "/a/*", "a/b", "a/x.mkv")
+	for _, dir := range rec.listed {
+		if dir == base+"/c" || dir == base+"/a/b" {
+			t.Fatalf("glob listed %s: %v", dir, rec.listed)
+		}
+	}
+
+	if _, err := pan.Glob(context.Background(), c.driver, base+"/[a"); !errors.Is(err, path.ErrBadPattern) {
+		t.Fatalf("glob bad pattern: %v", err)
+	}
+}
+
+func (c *conformance) testFS(t *testing.T) {
+	base := ConformanceRoot + "/fs"
+	small := c.upload(t, c.driver, base+"/a", "small.txt", 10)
+	big := c.upload(t, c.driver, base, "big.bin", 100*1024)
+
+	fsys, err := fs.Sub(pan.NewFS(c.driver), strings.TrimPrefix(base, "/"))
+	if err != nil {
+		t.Fatalf("sub fs: %v", err)
+	}
+	if err = fstest.TestFS(fsys, "a", "a/small.txt", "big.bin"); err != nil {
+		t.Fatalf("fstest: %v", err)
+	}
+	if data, err := fs.ReadFile(fsys, "a/small.txt"); err != nil || !bytes.Equal(data, small) {
+		t.Fatalf("read file: %q %v", data, err)
+	}
+
+	// 随机读取
+	file, err := fsys.Open("big.bin")
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer file.Close()
+	seeker, ok := file.(io.ReadSeeker)
+	if !ok {
+		t.Fatal("file does not implement io.Seeker")
+	}
+	for _, off := range []int64{50000, 10, 100*1024 - 5} {
+		if _, err = seeker.Seek(off, io.SeekStart); err != nil {
+			t.Fatalf("seek %d: %v", off, err)
+		}
+		buf := make([]byte, 5)
+		if _, err = io.ReadFull(seeker, buf); err != nil || !bytes.Equal(buf, big[off:off+5]) {
+			t.Fatalf("read at %d: %v %v", off, buf, err)
+		}
+	}
+	if n, err := seeker.Read(make([]byte, 1)); n != 0 || err != io.EOF {
+		t.Fatalf("read past end: %d %v", n, err)
+	}
+
+	if _, err = fs.Stat(fsys, "missing.txt"); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("stat missing: %v", err)
+	}
+	if _, err = fsys.Open("../escape"); err == nil {
+		t.Fatal("open invalid path should fail")
+	}
+
+	// 绑定的 ctx 取消后读取失败
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err = fs.ReadFile(pan.NewFSContext(ctx, c.driver), strings.TrimPrefix(base, "/")+"/big.bin"); !errors.Is(err, context.Canceled) {
+		t.Fatalf("read file after cancel: %v", err)
+	}
+}
+
+func (c *conformance) testOpen(t *testing.T) {
+	base := ConformanceRoot + "/open"
+	content := c.upload(t, c.driver, base, "data.bin", 64*1024)
+	file := find(c.list(t, base, true), "data.bin")
+	if file == nil {
+		t.Fatal("uploaded file not listed")
+	}
+
+	reader, err := c.driver.Open(context.Background(), file)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer reader.Close()
+	buf := make([]byte, 16)
+	if _, err = io.ReadFull(reader, buf); err != nil || !bytes.Equal(buf, content[:16]) {
+		t.Fatalf("read head: %v %v", buf, err)
+	}
+	// 向后、向前以及相对末尾定位
+	for _, seek := range []struct {
+		offset int64
+		whence int
+		want   int64
+	}{
+		{40000, io.SeekStart, 40000},
+		{-30000, io.SeekCurrent, 10016},
+		{-16, io.SeekEnd, 64*1024 - 16},
+	} {
+		pos, err := reader.Seek(seek.offset, seek.whence)
+		if err != nil || pos != seek.want {
+			t.Fatalf("seek %d/%d: %d %v", seek.offset, seek.whence, pos, err)
+		}
+		if _, err = io.ReadFull(reader, buf); err != nil || !bytes.Equal(buf, content[pos:pos+16]) {
+			t.Fatalf("read at %d: %v %v", pos, buf, err)
+		}
+	}
+	if n, err := reader.Read(buf); n != 0 || err != io.EOF {
+		t.Fatalf("read past end: %d %v", n, err)
+	}
+	if _, err = reader.Seek(0, io.SeekStart); err != nil {
+		t.Fatalf("seek start: %v", err)
+	}
+	if all, err := io.ReadAll(reader); err != nil || !bytes.Equal(all, content) {
+		t.Fatalf("read all: %d bytes, %v", len(all), err)
+	}
+
+	if _, err = c.driver.Open(context.Background(), find(c.list(t, ConformanceRoot, true), "open")); err == nil {
+		t.Fatal("open dir should fail")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err = c.driver.Open(ctx, file); !errors.Is(err, context.Canceled) {
+		t.Fatalf("open with cancelled ctx: %v", err)
+	}
+}
+
+// onlyReader 隐藏 Seek、WriterTo 等接口，模拟只能顺序读取一次的数据流
+type onlyReader struct {
+	r io.Reader
+}
+
+func (r *onlyReader) Read(p []byte) (int, error) {
+	return r.r.Read(p)
+}
+
+func (c *conformance) testUploadStream(t *testing.T) {
+	base := ConformanceRoot + "/stream"
+	_, known := writeLocalFile(t, t.TempDir(), "known.bin", 64*1024)
+	_, unknown := writeLocalFile(t, t.TempDir(), "unknown.bin", 3000)
+
+	upload := func(name string, content []byte, size int64) error {
+		_, err := c.driver.UploadStream(pan.UploadStreamReq{
+			Reader:     &onlyReader{r: bytes.NewReader(content)},
+			Size:       size,
+			Name:       name,
+			RemotePath: base,
+		})
+		return err
+	}
+	if err := upload("known.bin", known, int64(len(known))); err != nil {
+		t.Fatalf("upload stream with size: %v", err)
+	}
+	if err := upload("unknown.bin", unknown, 0); err != nil {
+		t.Fatalf("upload stream without size: %v", err)
+	}
+	objs := c.list(t, base, true)
+	expectNames(t, "list stream uploads", objs, "known.bin", "unknown.bin")
+	for name, content := range map[string][]byte{"known.bin": known, "unknown.bin": unknown} {
+		obj := find(objs, name)
+		if obj.Size != int64(len(content)) {
+			t.Fatalf("%s size %d", name, obj.Size)
+		}
+		reader, err := c.driver.Open(context.Background(), obj)
+		if err != nil {
+			t.Fatalf("open %s: %v", name, err)
+		}
+		data, err := io.ReadAll(reader)
+		_ = reader.Close()
+		if err != nil || !bytes.Equal(data, content) {
+			t.Fatalf("%s content mismatch: %d bytes, %v", name, len(data), err)
+		}
+	}
+	if err := upload("known.bin", known, int64(len(known))); !errors.Is(err, pan.ErrAlreadyExists) {
+		t.Fatalf("upload stream over existing file: %v", err)
+	}
+	if _, err := c.driver.UploadStream(pan.UploadStreamReq{Name: "nil.bin", RemotePath: base}); err == nil {
+		t.Fatal("upload stream without reader should fail")
+	}
+}
+
+func (c *conformance) testMkdir(t *testing.T) {
+	base := ConformanceRoot + "/mkdir"
+	obj := c.mkdir(t, base+"/a/b/c")
+	if obj.Id == "" || obj.Name != "c" || obj.Path != base+"/a/b" || obj.Type != "dir" {
+		t.Fatalf("mkdir nested: %+v", obj)
+	}
+	again := c.mkdir(t, base+"/a/b/c")
+	if again.Id != obj.Id {
+		t.Fatalf("mkdir existing dir returned %q, want %q", again.Id, obj.Id)
+	}
+	expectNames(t, "list after nested mkdir", c.list(t, base+"/a/b", false), "c")
+
+	parent := find(c.list(t, base+"/a", false), "b")
+	if parent == nil {
+		t.Fatal("mkdir nested: missing intermediate dir")
+	}
+	child, err := c.driver.Mkdir(pan.MkdirReq{Parent: parent, NewPath: "d"})
+	if err != nil {
+		t.Fatalf("mkdir with parent: %v", err)
+	}
+	if child.Name != "d" || child.Path != base+"/a/b" {
+		t.Fatalf("mkdir with parent: %+v", child)
+	}
+	expectNames(t, "list after mkdir with parent", c.list(t, base+"/a/b", false), "c", "d")
+
+	if _, err = c.driver.Mkdir(pan.MkdirReq{NewPath: base + "/file.txt"}); err == nil {
+		t.Fatal("mkdir with file extension should fail")
+	}
+}
+
+func (c *conformance) testObjRename(t *testing.T) {
+	base := ConformanceRoot + "/rename"
+	c.upload(t, c.driver, base, "old.txt", 3)
+	c.mkdir(t, base+"/olddir")
+	objs := c.list(t, base, true)
+	for oldName, newName := range map[string]string{"old.txt": "new.txt", "olddir": "newdir"} {
+		obj := find(objs, oldName)
+		if obj == nil {
+			t.Fatalf("missing %s", oldName)
+		}
+		if err := c.driver.ObjRename(pan.ObjRenameReq{Obj: obj, NewName: newName}); err != nil {
+			t.Fatalf("rename %s: %v", oldName, err)
+		}
+	}
+	expectNames(t, "list after rename", c.list(t, base, false), "new.txt", "newdir")
+
+	if err := c.driver.ObjRename(pan.ObjRenameReq{Obj: fileObj(base + "/new.txt"), NewName: "path.txt"}); err != nil {
+		t.Fatalf("rename by path: %v", err)
+	}
+	expectNames(t, "list after rename by path", c.list(t, base, false), "path.txt", "newdir")
+
+	if err := c.driver.ObjRename(pan.ObjRenameReq{Obj: dirObj("/"), NewName: "root"}); err == nil {
+		t.Fatal("rename root should fail")
+	}
+
+	c.upload(t, c.driver, base+"/newdir", "inner.txt", 3)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := c.driver.BatchRenameCtx(ctx, pan.BatchRenameReq{Path: dirObj(base), Func: func(obj *pan.PanObj) string {
+		return "c_" + obj.Name
+	}})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("batch rename after cancel: %v", err)
+	}
+	expectNames(t, "list after canceled batch rename", c.list(t, base, false), "path.txt", "newdir")
+	err = c.driver.BatchRename(pan.BatchRenameReq{Path: dirObj(base), Func: func(obj *pan.PanObj) string {
+		return "b_" + obj.Name
+	}})
+	if err != nil {
+		t.Fatalf("batch rename: %v", err)
+	}
+	expectNames(t, "list after batch rename", c.list(t, base, false), "b_path.txt", "b_newdir")
+	expectNames(t, "list nested after batch rename", c.list(t, base+"/b_newdir", true), "b_inner.txt")
+}
+
+func (c *conformance) testMove(t *testing.T) {
+	base := ConformanceRoot + "/move"
+	c.upload(t, c.driver, base+"/src", "a.txt", 3)
+	c.mkdir(t, base+"/src/sub")
+	src := c.list(t, base+"/src", true)
+
+	// 目标目录不存在时应自动创建
+	err := c.driver.Move(pan.MovieReq{Items: src, TargetObj: dirObj(base + "/missing")})
+	if err != nil {
+		t.Fatalf("move into missing dir: %v", err)
+	}
+	expectNames(t, "list source after move", c.list(t, base+"/src", false))
+	expectNames(t, "list target after move", c.list(t, base+"/missing", false), "a.txt", "sub")
+
+	target := c.mkdir(t, base+"/dst")
+	expectNames(t, "list existing target", c.list(t, base+"/dst", false))
+	err = c.driver.Move(pan.MovieReq{Items: []*pan.PanObj{fileObj(base + "/missing/a.txt")}, TargetObj: target})
+	if err != nil {
+		t.Fatalf("move by path: %v", err)
+	}
+	expectNames(t, "list source after move by path", c.list(t, base+"/missing", false), "sub")
+	expectNames(t, "list target after move by path", c.list(t, base+"/dst", false), "a.txt")
+
+	err = c.driver.Move(pan.MovieReq{Items: []*pan.PanObj{dirObj(base + "/missing/sub")}, TargetObj: fileObj(base + "/dst/a.txt")})
+	if err == nil {
+		t.Fatal("move into file should fail")
+	}
+}
+
+func (c *conformance) testCopy(t *testing.T) {
+	base := ConformanceRoot + "/copy"
+	content := c.upload(t, c.driver, base+"/src", "a.txt", 5)
+	nested := c.upload(t, c.driver, base+"/src/sub", "b.txt", 7)
+	src := c.list(t, base+"/src", true)
+
+	// 目标目录不存在时应自动创建，源对象保持不变
+	err := c.driver.Copy(pan.CopyReq{Items: src, TargetObj: dirObj(base + "/dst")})
+	if err != nil {
+		t.Fatalf("copy: %v", err)
+	}
+	expectNames(t, "list source after copy", c.list(t, base+"/src", false), "a.txt", "sub")
+	copied := c.list(t, base+"/dst", false)
+	expectNames(t, "list target after copy", copied, "a.txt", "sub")
+	if obj := find(copied, "a.txt"); obj.Size != int64(len(content)) || obj.Id == find(src, "a.txt").Id {
+		t.Fatalf("copied file: %+v", obj)
+	}
+	copiedSub := c.list(t, base+"/dst/sub", false)
+	expectNames(t, "list copied dir", copiedSub, "b.txt")
+
+	downloadDir := t.TempDir()
+	if _, err = c.driver.DownloadFile(pan.DownloadFileReq{RemoteFile: copiedSub[0], LocalPath: downloadDir}); err != nil {
+		t.Fatalf("download copied file: %v", err)
+	}
+	if downloaded, err := os.ReadFile(filepath.Join(downloadDir, "b.txt")); err != nil || !bytes.Equal(downloaded, nested) {
+		t.Fatalf("copied content: %q %v", downloaded, err)
+	}
+
+	err = c.driver.Copy(pan.CopyReq{Items: []*pan.PanObj{fileObj(base + "/src/a.txt")}, TargetObj: dirObj(base + "/by-path")})
+	if err != nil {
+		t.Fatalf("copy by path: %v", err)
+	}
+	expectNames(t, "list target after copy by path", c.list(t, base+"/by-path", false), "a.txt")
+
+	err = c.driver.Copy(pan.CopyReq{Items: []*pan.PanObj{fileObj(base + "/src/a.txt")}, TargetObj: fileObj(base + "/dst/a.txt")})
+	if err == nil {
+		t.Fatal("copy into file should fail")
+	}
+	err = c.driver.Copy(pan.CopyReq{Items: []*pan.PanObj{dirObj(base + "/src")}, TargetObj: dirObj(base + "/src/sub")})
+	if err == nil {
+		t.Fatal("copy into itself should fail")
+	}
+}
+
+func (c *conformance) testDelete(t *testing.T) {
+	base := ConformanceRoot + "/delete"
+	c.upload(t, c.driver, base, "a.txt", 3)
+	c.upload(t, c.driver, base+"/sub", "b.txt", 3)
+	expectNames(t, "list before delete", c.list(t, base, true), "a.txt", "sub")
+
+	err := c.driver.Delete(pan.DeleteReq{Items: []*pan.PanObj{fileObj(base + "/a.txt"), dirObj(base + "/sub")}})
+	if err != nil {
+		t.Fatalf("delete by path: %v", err)
+	}
+	expectNames(t, "list after delete by path", c.list(t, base, false))
+
+	c.upload(t, c.driver, base, "c.txt", 3)
+	if err = c.driver.Delete(pan.DeleteReq{Items: c.list(t, base, true)}); err != nil {
+		t.Fatalf("delete listed: %v", err)
+	}
+	expectNames(t, "list after delete listed", c.list(t, base, false))
+
+	// 仅路径的对象不存在时整个操作失败，其他对象保持不变
+	c.upload(t, c.driver, base, "keep.txt", 3)
+	missing := fileObj(base + "/missing.txt")
+	err = c.driver.Delete(pan.DeleteReq{Items: []*pan.PanObj{fileObj(base + "/keep.txt"), missing}})
+	if !errors.Is(err, pan.ErrNotFound) {
+		t.Fatalf("delete missing: %v", err)
+	}
+	expectNames(t, "list after delete missing", c.list(t, base, true), "keep.txt")
+	if err = c.driver.Move(pan.MovieReq{Items: []*pan.PanObj{missing}, TargetObj: dirObj(base + "/moved")}); !errors.Is(err, pan.ErrNotFound) {
+		t.Fatalf("move missing: %v", err)
+	}
+	if err = c.driver.Copy(pan.CopyReq{Items: []*pan.PanObj{missing}, TargetObj: dirObj(base + "/copied")}); !errors.Is(err, pan.ErrNotFound) {
+		t.Fatalf("copy missing: %v", err)
+	}
+	if err = c.driver.Delete(pan.DeleteReq{}); err != nil {
+		t.Fatalf("delete nothing: %v", err)
+	}
+}
+
+func (c *conformance) testTrash(t *testing.T) {
+	base := ConformanceRoot + "/trash"
+	c.upload(t, c.driver, base, "trash-a.txt", 3)
+	c.upload(t, c.driver, base+"/trash-sub", "b.txt", 4)
+	c.upload(t, c.driver, base, "trash-p.txt", 5)
+	objs := c.list(t, base, true)
+
+	// 彻底删除不进入回收站
+	if err := c.driver.Delete(pan.DeleteReq{Items: []*pan.PanObj{find(objs, "trash-p.txt")}, Permanent: true}); err != nil {
+		t.Fatalf("permanent delete: %v", err)
+	}
+	expectNames(t, "list after permanent delete", c.list(t, base, false), "trash-a.txt", "trash-sub")
+
+	trashed, err := c.driver.TrashList()
+	if !checkCapability(t, "trash list", c.driver.Capabilities().Trash, err) {
+		checkCapability(t, "trash restore", false, c.driver.TrashRestore(pan.TrashReq{Items: []*pan.PanObj{{Id: "pantest"}}}))
+		checkCapability(t, "trash delete", false, c.driver.TrashDelete(pan.TrashReq{Items: []*pan.PanObj{{Id: "pantest"}}}))
+		checkCapability(t, "trash empty", false, c.driver.TrashEmpty())
+		return
+	}
+	if find(trashed, "trash-p.txt") != nil {
+		t.Fatalf("permanently deleted file in trash: %v", names(trashed))
+	}
+
+	if err = c.driver.Delete(pan.DeleteReq{Items: []*pan.PanObj{find(objs, "trash-a.txt"), find(objs, "trash-sub")}}); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	expectNames(t, "list after delete", c.list(t, base, false))
+	trashed, err = c.driver.TrashList()
+	if err != nil {
+		t.Fatalf("trash list: %v", err)
+	}
+	file, dir := find(trashed, "trash-a.txt"), find(trashed, "trash-sub")
+	if file == nil || dir == nil || file.Id == "" || file.Type != "file" || file.Size != 3 || dir.Type != "dir" {
+		t.Fatalf("trash list: %v", names(trashed))
+	}
+
+	if err = c.driver.TrashRestore(pan.TrashReq{Items: []*pan.PanObj{file, dir}}); err != nil {
+		t.Fatalf("trash restore: %v", err)
+	}
+	expectNames(t, "list after restore", c.list(t, base, false), "trash-a.txt", "trash-sub")
+	expectNames(t, "list restored dir", c.list(t, base+"/trash-sub", true), "b.txt")
+	if err = c.driver.TrashRestore(pan.TrashReq{Items: []*pan.PanObj{file}}); err == nil {
+		t.Fatal("restore twice should fail")
+	}
+
+	objs = c.list(t, base, false)
+	if err = c.driver.Delete(pan.DeleteReq{Items: []*pan.PanObj{find(objs, "trash-a.txt")}}); err != nil {
+		t.Fatalf("delete again: %v", err)
+	}
+	trashed, _ = c.driver.TrashList()
+	if file = find(trashed, "trash-a.txt"); file == nil {
+		t.Fatalf("trash list after delete again: %v", names(trashed))
+	}
+	if err = c.driver.TrashDelete(pan.TrashReq{Items: []*pan.PanObj{file}}); err != nil {
+		t.Fatalf("trash delete: %v", err)
+	}
+	if trashed, _ = c.driver.TrashList(); find(trashed, "trash-a.txt") != nil {
+		t.Fatalf("trash list after trash delete: %v", names(trashed))
+	}
+
+	if err = c.driver.Delete(pan.DeleteReq{Items: []*pan.PanObj{find(objs, "trash-sub")}}); err != nil {
+		t.Fatalf("delete dir: %v", err)
+	}
+	if err = c.driver.TrashEmpty(); err != nil {
+		t.Fatalf("trash empty: %v", err)
+	}
+	if trashed, err = c.driver.TrashList(); err != nil || len(trashed) != 0 {
+		t.Fatalf("trash list after empty: %v %v", names(trashed), err)
+	}
+	expectNames(t, "list after empty", c.list(t, base, true))
+}
+
+func (c *conformance) testUploadDownload(t *testing.T) {
+	base := ConformanceRoot + "/transfer"
+	localFile, content := writeLocalFile(t, t.TempDir(), "data.bin", conformanceFileSize)
+	uploadProgress := &progressRecorder{}
+	_, err := c.driver.UploadFile(pan.UploadFileReq{
+		LocalFile:        localFile,
+		RemotePath:       base,
+		TaskId:           "upload-task",
+		ProgressCallback: uploadProgress.callback,
+	})
+	if err != nil {
+		t.Fatalf("upload: %v", err)
+	}
+	uploadProgress.check(t, "upload progress", "upload-task", conformanceFileSize)
+	if _, err = c.driver.UploadFile(pan.UploadFileReq{LocalFile: localFile, RemotePath: base}); err == nil {
+		t.Fatal("upload existing file should fail")
+	}
+
+	obj := find(c.list(t, base, false), "data.bin")
+	if obj == nil || obj.Size != conformanceFileSize {
+		t.Fatalf("list after upload: %+v", obj)
+	}
+	downloadDir := t.TempDir()
+	downloadProgress := &progressRecorder{}
+	_, err = c.driver.DownloadFile(pan.DownloadFileReq{
+		RemoteFile:       obj,
+		LocalPath:        downloadDir,
+		Concurrency:      2,
+		ChunkSize:        conformanceFileSize / 3,
+		TaskId:           "download-task",
+		ProgressCallback: downloadProgress.callback,
+	})
+	if err != nil {
+		t.Fatalf("download: %v", err)
+	}
+	downloadProgress.check(t, "download progress", "download-task", conformanceFileSize)
+	downloaded, err := os.ReadFile(filepath.Join(downloadDir, "data.bin"))
+	if err != nil || !bytes.Equal(downloaded, content) {
+		t.Fatalf("download content mismatch: %d bytes, %v", len(downloaded), err)
+	}
+
+	if _, err = c.driver.DownloadFile(pan.DownloadFileReq{RemoteFile: dirObj(base), LocalPath: downloadDir}); err == nil {
+		t.Fatal("download dir as file should fail")
+	}
+}
+
+func (c *conformance) testUploadDownloadPath(t *testing.T) {
+	base := ConformanceRoot + "/transfer-path"
+	localDir := t.TempDir()
+	files := map[string][]byte{}
+	for _, name := range []string{"x.txt", "nested/y.txt", "nested/deep/z.txt"} {
+		_, files[name] = writeLocalFile(t, localDir, name, 5)
+	}
+	if _, err := c.driver.UploadPath(pan.UploadPathReq{LocalPath: localDir, RemotePath: base}); err != nil {
+		t.Fatalf("upload path: %v", err)
+	}
+	expectNames(t, "list uploaded dir", c.list(t, base, false), "x.txt", "nested")
+
+	downloadDir := t.TempDir()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := c.driver.DownloadPathCtx(ctx, pan.DownloadPathReq{RemotePath: dirObj(base), LocalPath: downloadDir, SkipFileErr: true}); !errors.Is(err, context.Canceled) {
+		t.Fatalf("download path after cancel: %v", err)
+	}
+	if _, err := c.driver.DownloadPath(pan.DownloadPathReq{RemotePath: dirObj(base), LocalPath: downloadDir}); err != nil {
+		t.Fatalf("download path: %v", err)
+	}
+	for name, content := range files {
+		downloaded, err := os.ReadFile(filepath.Join(downloadDir, filepath.FromSlash(name)))
+		if err != nil || !bytes.Equal(downloaded, content) {
+			t.Fatalf("download path %s: %q %v", name, downloaded, err)
+		}
+	}
+}
+
+func (c *conformance) testShare(t *testing.T) {
+	base := ConformanceRoot + "/share"
+	content := c.upload(t, c.driver, base, "s.txt", 7)
+	obj := find(c.list(t, base, false), "s.txt")
+	if obj == nil {
+		t.Fatal("missing uploaded file")
+	}
+	caps := c.driver.Capabilities()
+	share, err := c.driver.NewShare(pan.NewShareReq{Fids: []string{obj.Id}, Title: "pantest", NeedPassCode: true, ExpiredType: 1})
+	if !checkCapability(t, "new share", caps.Share, err) {
+		_, err = c.driver.ShareList(pan.ShareListReq{})
+		checkCapability(t, "share list", false, err)
+		err = c.driver.DeleteShare(pan.DelShareReq{ShareIds: []string{"pantest"}})
+		checkCapability(t, "delete share", false, err)
+		if !caps.ShareRestore {
+			err = c.driver.ShareRestore(pan.ShareRestoreReq{ShareUrl: "https://example.com/s/pantest", TargetDir: base})
+			checkCapability(t, "share restore", false, err)
+		}
+		return
+	}
+	if share.ShareId == "" || share.ShareUrl == "" {
+		t.Fatalf("new share: %+v", share)
+	}
+	shares, err := c.driver.ShareList(pan.ShareListReq{ShareIds: []string{share.ShareId}})
+	if err != nil || len(shares) != 1 || shares[0].ShareId != share.ShareId {
+		t.Fatalf("share list: %v %v", shares, err)
+	}
+
+	err = c.driver.ShareRestore(pan.ShareRestoreReq{ShareUrl: share.ShareUrl, PassCode: share.PassCode, TargetDir: base + "/restore"})
+	if checkCapability(t, "share restore", caps.ShareRestore, err) {
+		restored := find(c.list(t, base+"/restore", true), "s.txt")
+		if restored == nil || restored.Size != int64(len(content)) {
+			t.Fatalf("restored file: %+v", restored)
+		}
+	}
+
+	if err = c.driver.DeleteShare(pan.DelShareReq{ShareIds: []string{share.ShareId}}); err != nil {
+		t.Fatalf("delete share: %v", err)
+	}
+	shares, err = c.driver.ShareList(pan.ShareListReq{ShareIds: []string{share.ShareId}})
+	if err != nil || len(shares) != 0 {
+		t.Fatalf("share list after delete: %v %v", shares, err)
+	}
+}
+
+func (c *conformance) testOptional(t *testing.T) {
+	base := ConformanceRoot + "/optional"
+	c.upload(t, c.driver, base, "link.txt", 3)
+	obj := find(c.list(t, base, false), "link.txt")
+	if obj == nil {
+		t.Fatal("missing uploaded file")
+	}
+
+	caps := c.driver.Capabilities()
+	task, err := c.driver.OfflineDownload(pan.OfflineDownloadReq{RemotePath: base, Url: "https://example.com/pantest.txt"})
+	if checkCapability(t, "offline download", caps.OfflineDownload, err) && (task == nil || task.Id == "") {
+		t.Fatalf("offline download task: %+v", task)
+	}
+
+	_, err = c.driver.TaskList(pan.TaskListReq{})
+	checkCapability(t, "task list", caps.TaskList, err)
+
+	links, err := c.driver.DirectLink(pan.DirectLinkReq{List: []*pan.DirectLink{{FileId: obj.Id, Name: obj.Name}}})
+	if checkCapability(t, "direct link", caps.DirectLink, err) && (len(links) != 1 || links[0].Link == "") {
+		t.Fatalf("direct link: %+v", links)
+	}
+
+	if caps.MaxFileSize < 0 {
+		t.Fatalf("max file size: %d", caps.MaxFileSize)
+	}
+}
+
+// testContext 已取消的 ctx 必须让操作失败且不留下副作用，之后不带 ctx 的调用不受影响
+func (c *conformance) testContext(t *testing.T) {
+	base := ConformanceRoot + "/context"
+	c.mkdir(t, base)
+	c.upload(t, c.driver, base, "keep.txt", 100)
+	obj := find(c.list(t, base, true), "keep.txt")
+	if obj == nil {
+		t.Fatal("missing uploaded file")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := c.driver.DiskCtx(ctx); err == nil {
+		t.Error("disk with cancelled ctx succeeded")
+	}
+	if _, err := c.driver.ListCtx(ctx, pan.ListReq{Dir: dirObj(base), Reload: true}); err == nil {
+		t.Error("list with cancelled ctx succeeded")
+	}
+	if _, err := c.driver.MkdirCtx(ctx, pan.MkdirReq{NewPath: base + "/cancelled"}); err == nil {
+		t.Error("mkdir with cancelled ctx succeeded")
+	}
+	localFile, _ := writeLocalFile(t, t.TempDir(), "cancelled.txt", 100)
+	if _, err := c.driver.UploadFileCtx(ctx, pan.UploadFileReq{LocalFile: localFile, RemotePath: base}); err == nil {
+		t.Error("upload with cancelled ctx succeeded")
+	}
+	if _, err := c.driver.DownloadFileCtx(ctx, pan.DownloadFileReq{RemoteFile: obj, LocalPath: t.TempDir()}); err == nil {
+		t.Error("download with cancelled ctx succeeded")
+	}
+	if err := c.driver.DeleteCtx(ctx, pan.DeleteReq{Items: []*pan.PanObj{obj}}); err == nil {
+		t.Error("delete with cancelled ctx succeeded")
+	}
+
+	expectNames(t, base, c.list(t, base, true), "keep.txt")
+}
+
+// testErrors 驱动错误需映射到 pan 的哨兵错误
+func (c *conformance) testErrors(t *testing.T) {
+	base := ConformanceRoot + "/errors"
+	c.mkdir(t, base)
+	c.upload(t, c.driver, base, "a.txt", 100)
+	c.upload(t, c.driver, base, "b.txt", 100)
+
+	expectKind := func(what string, err, kind error) {
+		t.Helper()
+		if !errors.Is(err, kind) {
+			t.Errorf("%s: want %v, got %v", what, kind, err)
+		} else if pan.IsRetryable(err) {
+			t.Errorf("%s: %v should not be retryable", what, err)
+		}
+	}
+	_, err := c.driver.List(pan.ListReq{Dir: dirObj(base + "/missing"), Reload: true})
+	expectKind("list missing dir", err, pan.ErrNotFound)
+	err = c.driver.ObjRename(pan.ObjRenameReq{Obj: fileObj(base + "/missing.txt"), NewName: "x.txt"})
+	expectKind("rename missing file", err, pan.ErrNotFound)
+	err = c.driver.ObjRename(pan.ObjRenameReq{Obj: dirObj("/"), NewName: "x"})
+	expectKind("rename root", err, pan.ErrUnsupported)
+
+	localFile, _ := writeLocalFile(t, t.TempDir(), "a.txt", 100)
+	_, err = c.driver.UploadFile(pan.UploadFileReq{LocalFile: localFile, RemotePath: base})
+	expectKind("upload existing file", err, pan.ErrAlreadyExists)
+	err = c.driver.ObjRename(pan.ObjRenameReq{Obj: fileObj(base + "/a.txt"), NewName: "b.txt"})
+	expectKind("rename onto existing file", err, pan.ErrAlreadyExists)
+}
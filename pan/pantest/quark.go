@@ -0,0 +1,1004 @@
+package pantest
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	quarkApiPath   = "/1/clouddrive"
+	quarkOssPath   = "/oss"
+	quarkFilePath  = "/quark-file/"
+	quarkCookieKey = "__puus"
+)
+
+// fake Quark 返回的错误码
+const (
+	// QuarkCodeNotLogin 未登录或 cookie 失效
+	QuarkCodeNotLogin = 31001
+	// QuarkCodeNotFound 对象不存在
+	QuarkCodeNotFound = 41004
+	// QuarkCodeExist 同名对象已存在
+	QuarkCodeExist = 23008
+	// QuarkCodePassCode 分享提取码错误
+	QuarkCodePassCode = 41008
+	// QuarkCodeBadRequest 参数错误
+	QuarkCodeBadRequest = 10001
+)
+
+// QuarkServer 模拟夸克网盘 /1/clouddrive 接口以及分片上传使用的 OSS 接口
+type QuarkServer struct {
+	*server
+	// Cookie 合法的 __puus cookie 值
+	Cookie string
+	// PartSize upload/pre 返回的分片大小
+	PartSize int
+
+	state   sync.Mutex
+	seq     int
+	uploads map[string]*quarkUpload
+	tasks   map[string]string
+	shares  map[string]*quarkShare
+	stokens map[string]string
+}
+
+type quarkUpload struct {
+	taskId   string
+	fid      string
+	parentId string
+	name     string
+	objKey   string
+	uploadId string
+	size     int64
+	parts    map[int][]byte
+	data     []byte
+}
+
+type quarkShare struct {
+	shareId     string
+	pwdId       string
+	title       string
+	passcode    string
+	urlType     int
+	expiredType int
+	fids        []string
+	created     time.Time
+}
+
+// NewQuarkServer 启动一个 fake Quark 服务，使用完毕后需调用 Close
+func NewQuarkServer() *QuarkServer {
+	q := &QuarkServer{
+		Cookie:   "pantest",
+		PartSize: 4 * 1024 * 1024,
+		uploads:  make(map[string]*quarkUpload),
+		tasks:    make(map[string]string),
+		shares:   make(map[string]*quarkShare),
+		stokens:  make(map[string]string),
+	}
+	q.server = newServer(NewTree("0", "q"), http.HandlerFunc(q.serveHTTP), q.writeError)
+	return q
+}
+
+// ApiUrl 返回 /1/clouddrive 接口地址
+func (q *QuarkServer) ApiUrl() string {
+	return q.URL + quarkApiPath
+}
+
+// UploadUrl 返回分片上传使用的 OSS 地址
+func (q *QuarkServer) UploadUrl() string {
+	return q.URL + quarkOssPath
+}
+
+// WriteCookieFile 在 dir 下写入一份可被驱动加载的 Netscape 格式 cookies.txt，返回文件路径
+func (q *QuarkServer) WriteCookieFile(dir string) (string, error) {
+	host := strings.Split(strings.TrimPrefix(q.URL, "http://"), ":")[0]
+	// 过期时间为 0 会被解析为 1970 年而被 cookie jar 丢弃，这里写入一年后的时间
+	expires := time.Now().AddDate(1, 0, 0).Unix()
+	content := fmt.Sprintf("# Netscape HTTP Cookie File\n%s\tFALSE\t/\tFALSE\t%d\t%s\t%s\n", host, expires, quarkCookieKey, q.Cookie)
+	file := filepath.Join(dir, "quark_cookies.txt")
+	if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+		return "", err
+	}
+	return file, nil
+}
+
+func (q *QuarkServer) writeError(w http.ResponseWriter, code int, msg string) {
+	status := http.StatusBadRequest
+	switch code {
+	case QuarkCodeNotLogin:
+		status = http.StatusUnauthorized
+	case QuarkCodeNotFound:
+		status = http.StatusNotFound
+	}
+	writeJSON(w, status, map[string]any{
+		"status":    status,
+		"code":      code,
+		"message":   msg,
+		"timestamp": time.Now().Unix(),
+	})
+}
+
+func (q *QuarkServer) ok(w http.ResponseWriter, data any, metadata any) {
+	body := map[string]any{
+		"status":    200,
+		"code":      0,
+		"message":   "ok",
+		"timestamp": time.Now().Unix(),
+		"data":      data,
+	}
+	if metadata != nil {
+		body["metadata"] = metadata
+	}
+	writeJSON(w, http.StatusOK, body)
+}
+
+func (q *QuarkServer) treeError(w http.ResponseWriter, err error) {
+	switch err {
+	case errNotExist:
+		q.writeError(w, QuarkCodeNotFound, "file not exist")
+	case errExist:
+		q.writeError(w, QuarkCodeExist, "file name conflict")
+	default:
+		q.writeError(w, QuarkCodeBadRequest, err.Error())
+	}
+}
+
+func (q *QuarkServer) nextId(prefix string) string {
+	q.state.Lock()
+	defer q.state.Unlock()
+	q.seq++
+	return fmt.Sprintf("%s%06d", prefix, q.seq)
+}
+
+func (q *QuarkServer) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	p := r.URL.Path
+	switch {
+	case strings.HasPrefix(p, quarkOssPath+"/"):
+		q.serveOss(w, r, strings.TrimPrefix(p, quarkOssPath+"/"))
+		return
+	case strings.HasPrefix(p, quarkFilePath) && r.Method == http.MethodGet:
+		n, ok := q.Tree.Get(strings.TrimPrefix(p, quarkFilePath))
+		if !ok || n.IsDir {
+			http.NotFound(w, r)
+			return
+		}
+		serveNode(w, r, n)
+		return
+	case !strings.HasPrefix(p, quarkApiPath+"/"):
+		http.NotFound(w, r)
+		return
+	}
+	if cookie, err := r.Cookie(quarkCookieKey); err != nil || cookie.Value != q.Cookie {
+		q.writeError(w, QuarkCodeNotLogin, "require login [guest]")
+		return
+	}
+	switch r.Method + " " + strings.TrimPrefix(p, quarkApiPath) {
+	case "GET /config":
+		q.ok(w, map[string]any{"share_enable": 1, "allow_ccp_hash_update": true}, nil)
+	case "GET /member":
+		q.ok(w, map[string]any{
+			"member_type":    "NORMAL",
+			"total_capacity": int64(1024 * 1024 * 1024 * 1024),
+			"use_capacity":   q.Tree.Usage(),
+		}, map[string]any{})
+	case "POST /file":
+		q.createDirectory(w, r)
+	case "GET /file/sort":
+		q.fileSort(w, r)
+	case "GET /file/search":
+		q.fileSearch(w, r)
+	case "POST /file/info/path_list":
+		q.filePathList(w, r)
+	case "GET /file/info":
+		q.fileInfo(w, r)
+	case "POST /file/delete":
+		q.fileDelete(w, r)
+	case "GET /file/recycle/list":
+		q.recycleList(w, r)
+	case "POST /file/recycle/restore":
+		q.recycleOperate(w, r, q.Tree.Restore)
+	case "POST /file/recycle/remove":
+		q.recycleOperate(w, r, q.Tree.Purge)
+	case "POST /file/move":
+		q.fileMove(w, r)
+	case "POST /file/rename":
+		q.fileRename(w, r)
+	case "POST /file/upload/pre":
+		q.uploadPre(w, r)
+	case "POST /file/update/hash":
+		q.uploadHash(w, r)
+	case "POST /file/upload/auth":
+		q.uploadAuth(w, r)
+	case "POST /file/upload/finish":
+		q.uploadFinish(w, r)
+	case "POST /file/download":
+		q.fileDownload(w, r)
+	case "GET /task":
+		q.taskQuery(w, r)
+	case "POST /share":
+		q.share(w, r)
+	case "POST /share/password":
+		q.sharePassword(w, r)
+	case "GET /share/mypage/detail":
+		q.shareList(w, r)
+	case "POST /share/delete":
+		q.shareDelete(w, r)
+	case "POST /share/sharepage/token":
+		q.shareToken(w, r)
+	case "GET /share/sharepage/detail":
+		q.shareDetail(w, r)
+	case "POST /share/sharepage/save":
+		q.shareSave(w, r)
+	default:
+		q.writeError(w, QuarkCodeBadRequest, "unknown api "+r.Method+" "+p)
+	}
+}
+
+func (q *QuarkServer) file(n *Node) map[string]any {
+	fileType := 1
+	if n.IsDir {
+		fileType = 0
+	}
+	return map[string]any{
+		"fid":          n.Id,
+		"file_name":    n.Name,
+		"pdir_fid":     n.ParentId,
+		"file_type":    fileType,
+		"size":         n.Size(),
+		"format_type":  "",
+		"status":       1,
+		"dir":          n.IsDir,
+		"file":         !n.IsDir,
+		"created_at":   millis(n.Created),
+		"updated_at":   millis(n.Modified),
+		"l_created_at": millis(n.Created),
+		"l_updated_at": millis(n.Modified),
+	}
+}
+
+func pageParams(r *http.Request) (int, int) {
+	page, _ := strconv.Atoi(r.URL.Query().Get("_page"))
+	size, _ := strconv.Atoi(r.URL.Query().Get("_size"))
+	if page <= 0 {
+		page = 1
+	}
+	if size <= 0 {
+		size = 50
+	}
+	return page, size
+}
+
+func pageSlice[T any](items []T, page, size int) []T {
+	start := (page - 1) * size
+	if start >= len(items) {
+		return make([]T, 0)
+	}
+	return items[start:min(start+size, len(items))]
+}
+
+func (q *QuarkServer) createDirectory(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		FileName string `json:"file_name"`
+		PdirFid  string `json:"pdir_fid"`
+	}
+	if err := readJSON(r, &body); err != nil {
+		q.writeError(w, QuarkCodeBadRequest, err.Error())
+		return
+	}
+	n, err := q.Tree.Mkdir(body.PdirFid, body.FileName)
+	if err != nil {
+		q.treeError(w, err)
+		return
+	}
+	q.ok(w, map[string]any{"finish": true, "fid": n.Id}, nil)
+}
+
+func (q *QuarkServer) fileSort(w http.ResponseWriter, r *http.Request) {
+	pdirFid := r.URL.Query().Get("pdir_fid")
+	children, err := q.Tree.Children(pdirFid)
+	if err != nil {
+		q.treeError(w, err)
+		return
+	}
+	data := q.page(r, children)
+	if r.URL.Query().Get("_fetch_full_path") == "1" {
+		fullPath := make([]map[string]any, 0)
+		for id := pdirFid; id != q.Tree.RootId(); {
+			n, _ := q.Tree.Get(id)
+			fullPath = append([]map[string]any{{"fid": n.Id, "file_name": n.Name}}, fullPath...)
+			id = n.ParentId
+		}
+		data["full_path"] = fullPath
+	}
+	q.ok(w, data, pageMeta(r, children))
+}
+
+func (q *QuarkServer) fileSearch(w http.ResponseWriter, r *http.Request) {
+	keyword := strings.ToLower(r.URL.Query().Get("q"))
+	if keyword == "" {
+		q.writeError(w, QuarkCodeBadRequest, "empty keyword")
+		return
+	}
+	found := q.Tree.Search(q.Tree.RootId(), func(n *Node) bool {
+		return strings.Contains(strings.ToLower(n.Name), keyword)
+	})
+	q.ok(w, q.page(r, found), pageMeta(r, found))
+}
+
+// filePathList 按完整路径返回 fid，不存在的路径不返回
+func (q *QuarkServer) filePathList(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		FilePath []string `json:"file_path"`
+	}
+	if err := readJSON(r, &body); err != nil {
+		q.writeError(w, QuarkCodeBadRequest, err.Error())
+		return
+	}
+	list := make([]map[string]any, 0)
+	for _, p := range body.FilePath {
+		if n, ok := q.Tree.Lookup(p); ok {
+			list = append(list, map[string]any{"fid": n.Id, "file_path": p})
+		}
+	}
+	q.ok(w, list, nil)
+}
+
+func (q *QuarkServer) fileInfo(w http.ResponseWriter, r *http.Request) {
+	n, ok := q.Tree.Get(r.URL.Query().Get("fid"))
+	if !ok {
+		q.treeError(w, errNotExist)
+		return
+	}
+	q.ok(w, q.file(n), nil)
+}
+
+// page 返回当前页的文件列表
+func (q *QuarkServer) page(r *http.Request, nodes []*Node) map[string]any {
+	page, size := pageParams(r)
+	list := make([]map[string]any, 0)
+	for _, n := range pageSlice(nodes, page, size) {
+		list = append(list, q.file(n))
+	}
+	return map[string]any{"list": list}
+}
+
+func pageMeta(r *http.Request, nodes []*Node) map[string]any {
+	page, size := pageParams(r)
+	return map[string]any{
+		"_size":  size,
+		"_page":  page,
+		"_count": len(pageSlice(nodes, page, size)),
+		"_total": len(nodes),
+	}
+}
+
+func (q *QuarkServer) taskDone(w http.ResponseWriter) {
+	q.ok(w, map[string]any{"task_id": q.nextId("task"), "finish": true}, map[string]any{"tq_gap": 0})
+}
+
+func (q *QuarkServer) fileDelete(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Filelist []string `json:"filelist"`
+	}
+	if err := readJSON(r, &body); err != nil {
+		q.writeError(w, QuarkCodeBadRequest, err.Error())
+		return
+	}
+	for _, fid := range body.Filelist {
+		if err := q.Tree.Trash(fid); err != nil {
+			q.treeError(w, err)
+			return
+		}
+	}
+	q.taskDone(w)
+}
+
+// quarkRecordPrefix 回收站记录 ID 前缀，记录 ID 为前缀加文件 ID
+const quarkRecordPrefix = "rec-"
+
+func (q *QuarkServer) recycleList(w http.ResponseWriter, r *http.Request) {
+	entries := q.Tree.TrashList()
+	page, size := pageParams(r)
+	list := make([]map[string]any, 0)
+	for _, entry := range pageSlice(entries, page, size) {
+		item := q.file(entry.Node)
+		item["record_id"] = quarkRecordPrefix + entry.Node.Id
+		item["deleted_at"] = millis(entry.Deleted)
+		list = append(list, item)
+	}
+	q.ok(w, map[string]any{"list": list}, map[string]any{
+		"_size":  size,
+		"_page":  page,
+		"_count": len(list),
+		"_total": len(entries),
+	})
+}
+
+func (q *QuarkServer) recycleOperate(w http.ResponseWriter, r *http.Request, operate func(id string) error) {
+	var body struct {
+		SelectMode int      `json:"select_mode"`
+		RecordList []string `json:"record_list"`
+	}
+	if err := readJSON(r, &body); err != nil {
+		q.writeError(w, QuarkCodeBadRequest, err.Error())
+		return
+	}
+	if body.SelectMode == 1 {
+		body.RecordList = body.RecordList[:0]
+		for _, entry := range q.Tree.TrashList() {
+			body.RecordList = append(body.RecordList, quarkRecordPrefix+entry.Node.Id)
+		}
+	}
+	for _, recordId := range body.RecordList {
+		if err := operate(strings.TrimPrefix(recordId, quarkRecordPrefix)); err != nil {
+			q.treeError(w, err)
+			return
+		}
+	}
+	q.taskDone(w)
+}
+
+func (q *QuarkServer) fileMove(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Filelist  []string `json:"filelist"`
+		ToPdirFid string   `json:"to_pdir_fid"`
+	}
+	if err := readJSON(r, &body); err != nil {
+		q.writeError(w, QuarkCodeBadRequest, err.Error())
+		return
+	}
+	for _, fid := range body.Filelist {
+		if err := q.Tree.Move(fid, body.ToPdirFid); err != nil {
+			q.treeError(w, err)
+			return
+		}
+	}
+	q.taskDone(w)
+}
+
+func (q *QuarkServer) fileRename(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Fid      string `json:"fid"`
+		FileName string `json:"file_name"`
+	}
+	if err := readJSON(r, &body); err != nil {
+		q.writeError(w, QuarkCodeBadRequest, err.Error())
+		return
+	}
+	if _, err := q.Tree.Rename(body.Fid, body.FileName); err != nil {
+		q.treeError(w, err)
+		return
+	}
+	q.taskDone(w)
+}
+
+func (q *QuarkServer) uploadPre(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		FileName string `json:"file_name"`
+		PdirFid  string `json:"pdir_fid"`
+		Size     int64  `json:"size"`
+	}
+	if err := readJSON(r, &body); err != nil {
+		q.writeError(w, QuarkCodeBadRequest, err.Error())
+		return
+	}
+	parent, ok := q.Tree.Get(body.PdirFid)
+	if !ok || !parent.IsDir {
+		q.treeError(w, errNotExist)
+		return
+	}
+	up := &quarkUpload{
+		taskId:   q.nextId("up"),
+		fid:      q.Tree.NewId(),
+		parentId: body.PdirFid,
+		name:     body.FileName,
+		uploadId: q.nextId("upload"),
+		size:     body.Size,
+		parts:    make(map[int][]byte),
+	}
+	up.objKey = "pantest/" + up.fid
+	q.state.Lock()
+	q.uploads[up.taskId] = up
+	q.state.Unlock()
+	q.ok(w, map[string]any{
+		"task_id":    up.taskId,
+		"finish":     false,
+		"upload_id":  up.uploadId,
+		"obj_key":    up.objKey,
+		"upload_url": q.URL,
+		"fid":        up.fid,
+		"bucket":     "pantest",
+		"callback": map[string]any{
+			"callbackUrl":  q.URL + "/callback",
+			"callbackBody": "",
+		},
+		"size":      body.Size,
+		"auth_info": "pantest-auth-info",
+	}, map[string]any{
+		"part_thread": 1,
+		"part_size":   q.PartSize,
+	})
+}
+
+func (q *QuarkServer) upload(taskId string) (*quarkUpload, bool) {
+	q.state.Lock()
+	defer q.state.Unlock()
+	up, ok := q.uploads[taskId]
+	return up, ok
+}
+
+func (q *QuarkServer) uploadHash(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Md5    string `json:"md5"`
+		TaskId string `json:"task_id"`
+	}
+	if err := readJSON(r, &body); err != nil {
+		q.writeError(w, QuarkCodeBadRequest, err.Error())
+		return
+	}
+	up, ok := q.upload(body.TaskId)
+	if !ok {
+		q.writeError(w, QuarkCodeNotFound, "upload task not exist")
+		return
+	}
+	// 秒传：已有相同内容的文件时直接生成新文件
+	same, found := q.Tree.Find(func(n *Node) bool {
+		if n.IsDir || n.Size() != up.size {
+			return false
+		}
+		sum := md5.Sum(n.Data)
+		return hex.EncodeToString(sum[:]) == body.Md5
+	})
+	if found {
+		if _, err := q.Tree.Put(up.fid, up.parentId, up.name, same.Data); err != nil {
+			q.treeError(w, err)
+			return
+		}
+		q.state.Lock()
+		delete(q.uploads, up.taskId)
+		q.state.Unlock()
+	}
+	q.ok(w, map[string]any{"finish": found, "fid": up.fid}, nil)
+}
+
+func (q *QuarkServer) uploadAuth(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		TaskId string `json:"task_id"`
+	}
+	if err := readJSON(r, &body); err != nil {
+		q.writeError(w, QuarkCodeBadRequest, err.Error())
+		return
+	}
+	if _, ok := q.upload(body.TaskId); !ok {
+		q.writeError(w, QuarkCodeNotFound, "upload task not exist")
+		return
+	}
+	q.ok(w, map[string]any{"auth_key": "OSS pantest:" + body.TaskId, "speed": 0}, nil)
+}
+
+func (q *QuarkServer) uploadByObjKey(objKey, uploadId string) (*quarkUpload, bool) {
+	q.state.Lock()
+	defer q.state.Unlock()
+	for _, up := range q.uploads {
+		if up.objKey == objKey && up.uploadId == uploadId {
+			return up, true
+		}
+	}
+	return nil, false
+}
+
+func (q *QuarkServer) serveOss(w http.ResponseWriter, r *http.Request, objKey string) {
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "OSS pantest:") {
+		http.Error(w, "<Error><Code>AccessDenied</Code></Error>", http.StatusForbidden)
+		return
+	}
+	up, ok := q.uploadByObjKey(objKey, r.URL.Query().Get("uploadId"))
+	if !ok {
+		http.Error(w, "<Error><Code>NoSuchUpload</Code></Error>", http.StatusNotFound)
+		return
+	}
+	data, err := readBody(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		q.listParts(w, r, up)
+	case http.MethodPut:
+		partNumber, err := strconv.Atoi(r.URL.Query().Get("partNumber"))
+		if err != nil || partNumber <= 0 {
+			http.Error(w, "<Error><Code>InvalidArgument</Code></Error>", http.StatusBadRequest)
+			return
+		}
+		sum := md5.Sum(data)
+		q.state.Lock()
+		up.parts[partNumber] = data
+		q.state.Unlock()
+		w.Header().Set("ETag", `"`+strings.ToUpper(hex.EncodeToString(sum[:]))+`"`)
+		w.WriteHeader(http.StatusOK)
+	case http.MethodPost:
+		var complete struct {
+			Parts []struct {
+				PartNumber int
+				ETag       string
+			} `xml:"Part"`
+		}
+		if err = xml.Unmarshal(data, &complete); err != nil {
+			http.Error(w, "<Error><Code>MalformedXML</Code></Error>", http.StatusBadRequest)
+			return
+		}
+		sort.Slice(complete.Parts, func(i, j int) bool {
+			return complete.Parts[i].PartNumber < complete.Parts[j].PartNumber
+		})
+		q.state.Lock()
+		defer q.state.Unlock()
+		content := make([]byte, 0, up.size)
+		for _, part := range complete.Parts {
+			partData, exist := up.parts[part.PartNumber]
+			if !exist {
+				http.Error(w, "<Error><Code>InvalidPart</Code></Error>", http.StatusBadRequest)
+				return
+			}
+			sum := md5.Sum(partData)
+			if strings.Trim(part.ETag, `"`) != strings.ToUpper(hex.EncodeToString(sum[:])) {
+				http.Error(w, "<Error><Code>InvalidPart</Code></Error>", http.StatusBadRequest)
+				return
+			}
+			content = append(content, partData...)
+		}
+		up.data = content
+		w.WriteHeader(http.StatusOK)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// listParts 按 max-parts 和 part-number-marker 分页返回已上传的分片
+func (q *QuarkServer) listParts(w http.ResponseWriter, r *http.Request, up *quarkUpload) {
+	marker, _ := strconv.Atoi(r.URL.Query().Get("part-number-marker"))
+	maxParts, err := strconv.Atoi(r.URL.Query().Get("max-parts"))
+	if err != nil || maxParts <= 0 {
+		maxParts = 1000
+	}
+	type part struct {
+		PartNumber int
+		ETag       string
+		Size       int
+	}
+	result := struct {
+		XMLName              xml.Name `xml:"ListPartsResult"`
+		UploadId             string
+		IsTruncated          bool
+		NextPartNumberMarker int
+		Parts                []part `xml:"Part"`
+	}{UploadId: up.uploadId}
+	q.state.Lock()
+	numbers := make([]int, 0, len(up.parts))
+	for number := range up.parts {
+		if number > marker {
+			numbers = append(numbers, number)
+		}
+	}
+	sort.Ints(numbers)
+	if len(numbers) > maxParts {
+		numbers, result.IsTruncated = numbers[:maxParts], true
+	}
+	for _, number := range numbers {
+		sum := md5.Sum(up.parts[number])
+		result.Parts = append(result.Parts, part{
+			PartNumber: number,
+			ETag:       `"` + strings.ToUpper(hex.EncodeToString(sum[:])) + `"`,
+			Size:       len(up.parts[number]),
+		})
+		result.NextPartNumberMarker = number
+	}
+	q.state.Unlock()
+	w.Header().Set("Content-Type", "application/xml")
+	_ = xml.NewEncoder(w).Encode(result)
+}
+
+func (q *QuarkServer) uploadFinish(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		ObjKey string `json:"obj_key"`
+		TaskId string `json:"task_id"`
+	}
+	if err := readJSON(r, &body); err != nil {
+		q.writeError(w, QuarkCodeBadRequest, err.Error())
+		return
+	}
+	up, ok := q.upload(body.TaskId)
+	if !ok || up.objKey != body.ObjKey {
+		q.writeError(w, QuarkCodeNotFound, "upload task not exist")
+		return
+	}
+	if up.data == nil || int64(len(up.data)) != up.size {
+		q.writeError(w, QuarkCodeBadRequest, "upload not complete")
+		return
+	}
+	if _, err := q.Tree.Put(up.fid, up.parentId, up.name, up.data); err != nil {
+		q.treeError(w, err)
+		return
+	}
+	q.state.Lock()
+	delete(q.uploads, up.taskId)
+	q.state.Unlock()
+	q.ok(w, map[string]any{"finish": true, "fid": up.fid}, nil)
+}
+
+func (q *QuarkServer) fileDownload(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Fids []string `json:"fids"`
+	}
+	if err := readJSON(r, &body); err != nil {
+		q.writeError(w, QuarkCodeBadRequest, err.Error())
+		return
+	}
+	list := make([]map[string]any, 0)
+	for _, fid := range body.Fids {
+		n, ok := q.Tree.Get(fid)
+		if !ok || n.IsDir {
+			q.treeError(w, errNotExist)
+			return
+		}
+		sum := md5.Sum(n.Data)
+		item := q.file(n)
+		item["download_url"] = q.URL + quarkFilePath + n.Id
+		item["md5"] = hex.EncodeToString(sum[:])
+		list = append(list, item)
+	}
+	q.ok(w, list, nil)
+}
+
+func (q *QuarkServer) taskQuery(w http.ResponseWriter, r *http.Request) {
+	taskId := r.URL.Query().Get("task_id")
+	q.state.Lock()
+	shareId := q.tasks[taskId]
+	q.state.Unlock()
+	q.ok(w, map[string]any{
+		"task_id":  taskId,
+		"status":   2,
+		"share_id": shareId,
+	}, map[string]any{"tq_gap": 0})
+}
+
+func (q *QuarkServer) share(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		FidList     []string `json:"fid_list"`
+		Title       string   `json:"title"`
+		UrlType     int      `json:"url_type"`
+		ExpiredType int      `json:"expired_type"`
+		Passcode    string   `json:"passcode"`
+	}
+	if err := readJSON(r, &body); err != nil {
+		q.writeError(w, QuarkCodeBadRequest, err.Error())
+		return
+	}
+	if len(body.FidList) == 0 {
+		q.writeError(w, QuarkCodeBadRequest, "fid_list is empty")
+		return
+	}
+	for _, fid := range body.FidList {
+		if _, ok := q.Tree.Get(fid); !ok {
+			q.treeError(w, errNotExist)
+			return
+		}
+	}
+	share := &quarkShare{
+		shareId:     q.nextId("share"),
+		pwdId:       q.nextId("pwd"),
+		title:       body.Title,
+		urlType:     body.UrlType,
+		expiredType: body.ExpiredType,
+		fids:        body.FidList,
+		created:     time.Now(),
+	}
+	if body.UrlType == 2 {
+		share.passcode = body.Passcode
+	}
+	taskId := q.nextId("task")
+	q.state.Lock()
+	q.shares[share.shareId] = share
+	q.tasks[taskId] = share.shareId
+	q.state.Unlock()
+	q.ok(w, map[string]any{"task_id": taskId, "finish": false}, map[string]any{"tq_gap": 0})
+}
+
+func (q *QuarkServer) shareData(share *quarkShare) map[string]any {
+	return map[string]any{
+		"title":        share.title,
+		"share_id":     share.shareId,
+		"pwd_id":       share.pwdId,
+		"share_url":    q.URL + "/s/" + share.pwdId,
+		"url_type":     share.urlType,
+		"passcode":     share.passcode,
+		"expired_type": share.expiredType,
+		"file_num":     len(share.fids),
+		"first_fid":    share.fids[0],
+		"created_at":   millis(share.created),
+		"updated_at":   millis(share.created),
+	}
+}
+
+func (q *QuarkServer) sharePassword(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		ShareId string `json:"share_id"`
+	}
+	if err := readJSON(r, &body); err != nil {
+		q.writeError(w, QuarkCodeBadRequest, err.Error())
+		return
+	}
+	q.state.Lock()
+	share, ok := q.shares[body.ShareId]
+	q.state.Unlock()
+	if !ok {
+		q.writeError(w, QuarkCodeNotFound, "share not exist")
+		return
+	}
+	q.ok(w, q.shareData(share), nil)
+}
+
+func (q *QuarkServer) shareList(w http.ResponseWriter, r *http.Request) {
+	q.state.Lock()
+	shares := make([]*quarkShare, 0, len(q.shares))
+	for _, share := range q.shares {
+		shares = append(shares, share)
+	}
+	q.state.Unlock()
+	sort.Slice(shares, func(i, j int) bool {
+		return shares[i].shareId < shares[j].shareId
+	})
+	page, size := pageParams(r)
+	list := make([]map[string]any, 0)
+	for _, share := range pageSlice(shares, page, size) {
+		list = append(list, q.shareData(share))
+	}
+	q.ok(w, map[string]any{"list": list}, map[string]any{
+		"_size":  size,
+		"_page":  page,
+		"_count": len(list),
+		"_total": len(shares),
+	})
+}
+
+func (q *QuarkServer) shareDelete(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		ShareIds []string `json:"share_ids"`
+	}
+	if err := readJSON(r, &body); err != nil {
+		q.writeError(w, QuarkCodeBadRequest, err.Error())
+		return
+	}
+	q.state.Lock()
+	for _, shareId := range body.ShareIds {
+		delete(q.shares, shareId)
+	}
+	q.state.Unlock()
+	q.ok(w, map[string]any{}, nil)
+}
+
+func (q *QuarkServer) shareByPwdId(pwdId string) (*quarkShare, bool) {
+	q.state.Lock()
+	defer q.state.Unlock()
+	for _, share := range q.shares {
+		if share.pwdId == pwdId {
+			return share, true
+		}
+	}
+	return nil, false
+}
+
+func (q *QuarkServer) shareToken(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		PwdId    string `json:"pwd_id"`
+		Passcode string `json:"passcode"`
+	}
+	if err := readJSON(r, &body); err != nil {
+		q.writeError(w, QuarkCodeBadRequest, err.Error())
+		return
+	}
+	share, ok := q.shareByPwdId(body.PwdId)
+	if !ok {
+		q.writeError(w, QuarkCodeNotFound, "share not exist")
+		return
+	}
+	if share.passcode != "" && share.passcode != body.Passcode {
+		q.writeError(w, QuarkCodePassCode, "passcode error")
+		return
+	}
+	stoken := q.nextId("stoken")
+	q.state.Lock()
+	q.stokens[stoken] = share.pwdId
+	q.state.Unlock()
+	q.ok(w, map[string]any{"stoken": stoken, "title": share.title}, nil)
+}
+
+func (q *QuarkServer) checkStoken(pwdId, stoken string) (*quarkShare, bool) {
+	q.state.Lock()
+	valid := q.stokens[stoken] == pwdId
+	q.state.Unlock()
+	if !valid {
+		return nil, false
+	}
+	return q.shareByPwdId(pwdId)
+}
+
+func (q *QuarkServer) shareDetail(w http.ResponseWriter, r *http.Request) {
+	share, ok := q.checkStoken(r.URL.Query().Get("pwd_id"), r.URL.Query().Get("stoken"))
+	if !ok {
+		q.writeError(w, QuarkCodePassCode, "stoken invalid")
+		return
+	}
+	files := make([]*Node, 0)
+	for _, fid := range share.fids {
+		if n, exist := q.Tree.Get(fid); exist {
+			files = append(files, n)
+		}
+	}
+	page, size := pageParams(r)
+	list := make([]map[string]any, 0)
+	for _, n := range pageSlice(files, page, size) {
+		item := q.file(n)
+		item["share_fid_token"] = "token-" + n.Id
+		list = append(list, item)
+	}
+	q.ok(w, map[string]any{
+		"is_owner": 1,
+		"share":    q.shareData(share),
+		"list":     list,
+	}, map[string]any{
+		"_size":  size,
+		"_page":  page,
+		"_count": len(list),
+		"_total": len(files),
+	})
+}
+
+func (q *QuarkServer) shareSave(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		FidList      []string `json:"fid_list"`
+		FidTokenList []string `json:"fid_token_list"`
+		ToPdirFid    string   `json:"to_pdir_fid"`
+		PwdId        string   `json:"pwd_id"`
+		Stoken       string   `json:"stoken"`
+	}
+	if err := readJSON(r, &body); err != nil {
+		q.writeError(w, QuarkCodeBadRequest, err.Error())
+		return
+	}
+	share, ok := q.checkStoken(body.PwdId, body.Stoken)
+	if !ok {
+		q.writeError(w, QuarkCodePassCode, "stoken invalid")
+		return
+	}
+	for i, fid := range body.FidList {
+		if i >= len(body.FidTokenList) || body.FidTokenList[i] != "token-"+fid || !contains(share.fids, fid) {
+			q.writeError(w, QuarkCodeBadRequest, "fid token invalid")
+			return
+		}
+		if _, err := q.Tree.Copy(fid, body.ToPdirFid); err != nil {
+			q.treeError(w, err)
+			return
+		}
+	}
+	q.ok(w, map[string]any{"task_id": q.nextId("task"), "finish": false}, map[string]any{"tq_gap": 0})
+}
+
+func contains(items []string, target string) bool {
+	for _, item := range items {
+		if item == target {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,210 @@
+// Package pantest provides in-memory stand-ins for the remote APIs used by the
+// drivers under pan/driver, so that driver code can be exercised without
+// network access or real accounts.
+//
+// Each fake is an httptest.Server backed by a Tree. Point the driver's
+// endpoint properties at the server URL and interact with the Tree directly to
+// prepare or inspect state.
+package pantest
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// fault 一次性注入的错误响应
+type fault struct {
+	method string
+	path   string
+	remain int
+	code   int
+	msg    string
+	// status 不为 0 时直接返回该 HTTP 状态，不按协议格式输出
+	status int
+}
+
+// server 各 fake 共用的基础能力：内存文件树、错误注入和调用计数
+type server struct {
+	*httptest.Server
+	// Tree 服务端的文件树，测试可直接读写
+	Tree *Tree
+
+	mu     sync.Mutex
+	faults []*fault
+	calls  map[string]int
+	// holds 被 Hold 阻塞的 method+path，通道关闭时放行
+	holds map[string]chan struct{}
+	// writeError 按各网盘的协议格式输出错误
+	writeError func(w http.ResponseWriter, code int, msg string)
+}
+
+func newServer(tree *Tree, handler http.Handler, writeError func(w http.ResponseWriter, code int, msg string)) *server {
+	s := &server{
+		Tree:       tree,
+		calls:      make(map[string]int),
+		holds:      make(map[string]chan struct{}),
+		writeError: writeError,
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Method + " " + r.URL.Path
+		s.mu.Lock()
+		s.calls[key]++
+		var hit *fault
+		for _, f := range s.faults {
+			if f.remain > 0 && f.method == r.Method && f.path == r.URL.Path {
+				f.remain--
+				hit = f
+				break
+			}
+		}
+		hold := s.holds[key]
+		s.mu.Unlock()
+		if hold != nil {
+			select {
+			case <-hold:
+			case <-r.Context().Done():
+				return
+			}
+		}
+		if hit != nil && hit.status != 0 {
+			http.Error(w, http.StatusText(hit.status), hit.status)
+			return
+		}
+		if hit != nil {
+			s.writeError(w, hit.code, hit.msg)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	return s
+}
+
+// FailNext 让接下来 times 次 method+path 的请求直接返回错误码 code，
+// path 为服务端看到的完整路径（如 /1/clouddrive/file/sort）
+func (s *server) FailNext(method, path string, times, code int, msg string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = append(s.faults, &fault{
+		method: method,
+		path:   path,
+		remain: times,
+		code:   code,
+		msg:    msg,
+	})
+}
+
+// FailNextStatus 让接下来 times 次 method+path 的请求直接返回 HTTP 状态 status，
+// 用于模拟下载链接过期等非 API 请求的失败
+func (s *server) FailNextStatus(method, path string, times, status int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = append(s.faults, &fault{
+		method: method,
+		path:   path,
+		remain: times,
+		status: status,
+	})
+}
+
+// Hold 让 method+path 的请求阻塞，直到调用返回的 release 或客户端断开，
+// 用于模拟耗时的传输
+func (s *server) Hold(method, path string) (release func()) {
+	ch := make(chan struct{})
+	s.mu.Lock()
+	s.holds[method+" "+path] = ch
+	s.mu.Unlock()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			s.mu.Lock()
+			delete(s.holds, method+" "+path)
+			s.mu.Unlock()
+			close(ch)
+		})
+	}
+}
+
+// Calls 返回 method+path 被请求的次数
+func (s *server) Calls(method, path string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.calls[method+" "+path]
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+func readJSON(r *http.Request, v any) error {
+	defer r.Body.Close()
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		return err
+	}
+	if len(bytes.TrimSpace(data)) == 0 {
+		return nil
+	}
+	return json.Unmarshal(data, v)
+}
+
+// serveNode 以支持 Range 的方式输出文件内容
+func serveNode(w http.ResponseWriter, r *http.Request, n *Node) {
+	w.Header().Set("Content-Type", "application/octet-stream")
+	http.ServeContent(w, r, n.Name, n.Modified, bytes.NewReader(n.Data))
+}
+
+func millis(t time.Time) int64 {
+	return t.UnixMilli()
+}
+
+// readBody 读取请求体，兼容 aws-chunked 编码
+func readBody(r *http.Request) ([]byte, error) {
+	defer r.Body.Close()
+	if strings.Contains(r.Header.Get("Content-Encoding"), "aws-chunked") ||
+		strings.HasPrefix(r.Header.Get("X-Amz-Content-Sha256"), "STREAMING-") {
+		return decodeAwsChunked(r.Body)
+	}
+	return io.ReadAll(r.Body)
+}
+
+// decodeAwsChunked 解码 S3 的 aws-chunked 请求体，忽略签名和尾部校验
+func decodeAwsChunked(body io.Reader) ([]byte, error) {
+	reader := bufio.NewReader(body)
+	var out bytes.Buffer
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return nil, fmt.Errorf("read chunk header: %w", err)
+		}
+		line = strings.TrimSpace(line)
+		if i := strings.IndexByte(line, ';'); i >= 0 {
+			line = line[:i]
+		}
+		size, err := strconv.ParseInt(line, 16, 64)
+		if err != nil {
+			return nil, fmt.Errorf("parse chunk size %q: %w", line, err)
+		}
+		if size == 0 {
+			// 剩余为 trailer，直接丢弃
+			_, _ = io.Copy(io.Discard, reader)
+			return out.Bytes(), nil
+		}
+		if _, err = io.CopyN(&out, reader, size); err != nil {
+			return nil, fmt.Errorf("read chunk: %w", err)
+		}
+		if _, err = reader.Discard(2); err != nil {
+			return nil, fmt.Errorf("read chunk end: %w", err)
+		}
+	}
+}
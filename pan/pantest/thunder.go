@@ -0,0 +1,1128 @@
+package pantest
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hefeiyu25/pan-client/internal"
+)
+
+const (
+	thunderApiPath     = "/drive/v1"
+	thunderUserApiPath = "/v1"
+	thunderFilePath    = "/thunder-file/"
+	// ThunderBucket fake S3 使用的 bucket，驱动会对 endpoint 做 TrimLeft，名称中不能含有 h
+	ThunderBucket = "pantest"
+)
+
+// fake Thunder 返回的错误码，与迅雷接口一致沿用 gRPC 状态码
+const (
+	// ThunderCodeInvalidArgument 参数错误
+	ThunderCodeInvalidArgument = 3
+	// ThunderCodeNotFound 对象不存在
+	ThunderCodeNotFound = 5
+	// ThunderCodeExist 同名对象已存在
+	ThunderCodeExist = 6
+	// ThunderCodePermissionDenied 无权限或提取码错误
+	ThunderCodePermissionDenied = 7
+	// ThunderCodeCaptchaInvalid 验证码 token 失效，驱动会自动刷新后重试
+	ThunderCodeCaptchaInvalid = 9
+	// ThunderCodeUnauthenticated access token 失效，驱动会自动刷新 token 或重新登录后重试
+	ThunderCodeUnauthenticated = 16
+)
+
+// ThunderServer 模拟迅雷云盘的用户接口、/drive/v1 接口以及上传使用的 S3 接口
+type ThunderServer struct {
+	*server
+	// Username 和 Password 为允许登录的账号
+	Username string
+	Password string
+	// PageSize 文件列表每页的数量
+	PageSize int
+
+	state         sync.Mutex
+	seq           int
+	accessTokens  map[string]bool
+	refreshTokens map[string]bool
+	captchaTokens map[string]bool
+	actions       []string // 申请验证码时的 action
+	uploads       map[string]*thunderUpload
+	tasks         map[string]*thunderTask
+	shares        map[string]*thunderShare
+}
+
+type thunderUpload struct {
+	fileId   string
+	parentId string
+	name     string
+	size     int64
+	uploadId string
+	parts    map[int][]byte
+}
+
+type thunderTask struct {
+	id      string
+	name    string
+	kind    string
+	phase   string
+	fileId  string
+	created time.Time
+}
+
+type thunderShare struct {
+	shareId    string
+	title      string
+	passCode   string
+	withInLink bool
+	fileIds    []string
+	created    time.Time
+}
+
+// NewThunderServer 启动一个 fake Thunder 服务，使用完毕后需调用 Close
+func NewThunderServer() *ThunderServer {
+	t := &ThunderServer{
+		Username:      "pantest",
+		Password:      "pantest",
+		PageSize:      100,
+		accessTokens:  make(map[string]bool),
+		refreshTokens: make(map[string]bool),
+		captchaTokens: make(map[string]bool),
+		uploads:       make(map[string]*thunderUpload),
+		tasks:         make(map[string]*thunderTask),
+		shares:        make(map[string]*thunderShare),
+	}
+	t.server = newServer(NewTree("", "V"), http.HandlerFunc(t.serveHTTP), t.writeError)
+	return t
+}
+
+// ApiUrl 返回 /drive/v1 接口地址
+func (t *ThunderServer) ApiUrl() string {
+	return t.URL + thunderApiPath
+}
+
+// UserApiUrl 返回用户（登录）接口地址
+func (t *ThunderServer) UserApiUrl() string {
+	return t.URL + thunderUserApiPath
+}
+
+// IssueRefreshToken 签发一个可用于登录的 refresh token
+func (t *ThunderServer) IssueRefreshToken() string {
+	token := t.nextId("refresh")
+	t.state.Lock()
+	t.refreshTokens[token] = true
+	t.state.Unlock()
+	return token
+}
+
+// ExpireTokens 让所有已签发的 access token 失效
+func (t *ThunderServer) ExpireTokens() {
+	t.state.Lock()
+	defer t.state.Unlock()
+	t.accessTokens = make(map[string]bool)
+}
+
+// CaptchaActions 返回客户端申请验证码时使用的 action
+func (t *ThunderServer) CaptchaActions() []string {
+	t.state.Lock()
+	defer t.state.Unlock()
+	return append([]string(nil), t.actions...)
+}
+
+// InvalidateCaptcha 让所有已签发的验证码 token 失效
+func (t *ThunderServer) InvalidateCaptcha() {
+	t.state.Lock()
+	defer t.state.Unlock()
+	t.captchaTokens = make(map[string]bool)
+}
+
+func (t *ThunderServer) writeError(w http.ResponseWriter, code int, msg string) {
+	status := http.StatusBadRequest
+	switch code {
+	case ThunderCodeUnauthenticated:
+		status = http.StatusUnauthorized
+	case ThunderCodeNotFound:
+		status = http.StatusNotFound
+	case ThunderCodeExist:
+		status = http.StatusConflict
+	case ThunderCodePermissionDenied:
+		status = http.StatusForbidden
+	}
+	writeJSON(w, status, map[string]any{
+		"error_code":        code,
+		"error":             msg,
+		"error_description": "",
+	})
+}
+
+func (t *ThunderServer) treeError(w http.ResponseWriter, err error) {
+	switch err {
+	case errNotExist:
+		t.writeError(w, ThunderCodeNotFound, "file_not_found")
+	case errExist:
+		t.writeError(w, ThunderCodeExist, "file_name_duplicated")
+	default:
+		t.writeError(w, ThunderCodeInvalidArgument, err.Error())
+	}
+}
+
+func (t *ThunderServer) nextId(prefix string) string {
+	t.state.Lock()
+	defer t.state.Unlock()
+	t.seq++
+	return fmt.Sprintf("%s%06d", prefix, t.seq)
+}
+
+func (t *ThunderServer) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	p := r.URL.Path
+	switch {
+	case strings.HasPrefix(p, "/"+ThunderBucket+"/"):
+		t.serveS3(w, r, strings.TrimPrefix(p, "/"+ThunderBucket+"/"))
+	case strings.HasPrefix(p, thunderFilePath) && r.Method == http.MethodGet:
+		n, ok := t.Tree.Get(strings.TrimPrefix(p, thunderFilePath))
+		if !ok || n.IsDir {
+			http.NotFound(w, r)
+			return
+		}
+		serveNode(w, r, n)
+	case strings.HasPrefix(p, thunderApiPath+"/"):
+		if !t.authorized(w, r) {
+			return
+		}
+		t.serveDrive(w, r, strings.TrimPrefix(p, thunderApiPath))
+	case strings.HasPrefix(p, thunderUserApiPath+"/"):
+		t.serveUser(w, r, strings.TrimPrefix(p, thunderUserApiPath))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// authorized 校验 access token 和验证码 token
+func (t *ThunderServer) authorized(w http.ResponseWriter, r *http.Request) bool {
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	t.state.Lock()
+	validToken := t.accessTokens[token]
+	validCaptcha := t.captchaTokens[r.Header.Get("X-Captcha-Token")]
+	t.state.Unlock()
+	if !validToken {
+		t.writeError(w, ThunderCodeUnauthenticated, "unauthenticated")
+		return false
+	}
+	if !validCaptcha {
+		t.writeError(w, ThunderCodeCaptchaInvalid, "captcha_invalid")
+		return false
+	}
+	return true
+}
+
+func (t *ThunderServer) issueToken(w http.ResponseWriter) {
+	access := t.nextId("access")
+	refresh := t.nextId("refresh")
+	t.state.Lock()
+	t.accessTokens[access] = true
+	t.refreshTokens[refresh] = true
+	t.state.Unlock()
+	writeJSON(w, http.StatusOK, map[string]any{
+		"token_type":    "Bearer",
+		"access_token":  access,
+		"refresh_token": refresh,
+		"expires_in":    7200,
+		"sub":           "pantest",
+		"user_id":       "pantest",
+	})
+}
+
+func (t *ThunderServer) serveUser(w http.ResponseWriter, r *http.Request, p string) {
+	switch r.Method + " " + p {
+	case "POST /auth/token":
+		var body struct {
+			RefreshToken string `json:"refresh_token"`
+		}
+		if err := readJSON(r, &body); err != nil {
+			t.writeError(w, ThunderCodeInvalidArgument, err.Error())
+			return
+		}
+		t.state.Lock()
+		valid := t.refreshTokens[body.RefreshToken]
+		delete(t.refreshTokens, body.RefreshToken)
+		t.state.Unlock()
+		if !valid {
+			t.writeError(w, ThunderCodeInvalidArgument, "invalid_grant")
+			return
+		}
+		t.issueToken(w)
+	case "POST /shield/captcha/init":
+		var body struct {
+			Action string `json:"action"`
+		}
+		if err := readJSON(r, &body); err != nil {
+			t.writeError(w, ThunderCodeInvalidArgument, err.Error())
+			return
+		}
+		// 迅雷按官方接口路径校验 action
+		method, actionPath, _ := strings.Cut(body.Action, ":")
+		if method == "" || (!strings.HasPrefix(actionPath, thunderApiPath+"/") && !strings.HasPrefix(actionPath, thunderUserApiPath+"/")) {
+			t.writeError(w, ThunderCodeInvalidArgument, "invalid action "+body.Action)
+			return
+		}
+		captcha := t.nextId("captcha")
+		t.state.Lock()
+		t.captchaTokens[captcha] = true
+		t.actions = append(t.actions, body.Action)
+		t.state.Unlock()
+		writeJSON(w, http.StatusOK, map[string]any{
+			"captcha_token": captcha,
+			"expires_in":    300,
+		})
+	case "POST /auth/signin":
+		var body struct {
+			CaptchaToken string `json:"captcha_token"`
+			Username     string `json:"username"`
+			Password     string `json:"password"`
+		}
+		if err := readJSON(r, &body); err != nil {
+			t.writeError(w, ThunderCodeInvalidArgument, err.Error())
+			return
+		}
+		t.state.Lock()
+		validCaptcha := t.captchaTokens[body.CaptchaToken]
+		t.state.Unlock()
+		if !validCaptcha {
+			t.writeError(w, ThunderCodeCaptchaInvalid, "captcha_invalid")
+			return
+		}
+		if body.Username != t.Username || body.Password != t.Password {
+			t.writeError(w, ThunderCodeInvalidArgument, "invalid_account_or_password")
+			return
+		}
+		t.issueToken(w)
+	case "GET /user/me":
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		t.state.Lock()
+		valid := t.accessTokens[token]
+		t.state.Unlock()
+		if !valid {
+			t.writeError(w, ThunderCodeUnauthenticated, "unauthenticated")
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{
+			"sub":    "pantest",
+			"name":   t.Username,
+			"id":     "pantest",
+			"status": "ACTIVE",
+		})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (t *ThunderServer) serveDrive(w http.ResponseWriter, r *http.Request, p string) {
+	switch {
+	case p == "/files" && r.Method == http.MethodGet:
+		t.listFiles(w, r)
+	case p == "/files" && r.Method == http.MethodPost:
+		t.createFile(w, r)
+	case p == "/files:batchMove" && r.Method == http.MethodPost:
+		t.batchMove(w, r)
+	case p == "/files:batchCopy" && r.Method == http.MethodPost:
+		t.batchCopy(w, r)
+	case p == "/files:batchDelete" && r.Method == http.MethodPost:
+		t.batchDelete(w, r)
+	case p == "/files:batchTrash" && r.Method == http.MethodPost:
+		t.batchTrash(w, r, t.Tree.Trash)
+	case p == "/files:batchUntrash" && r.Method == http.MethodPost:
+		t.batchTrash(w, r, t.Tree.Restore)
+	case p == "/files/trash:empty" && r.Method == http.MethodPatch:
+		_ = t.Tree.Purge("")
+		writeJSON(w, http.StatusOK, map[string]any{})
+	case strings.HasPrefix(p, "/files/") && r.Method == http.MethodGet:
+		n, ok := t.Tree.Get(strings.TrimPrefix(p, "/files/"))
+		if !ok {
+			t.treeError(w, errNotExist)
+			return
+		}
+		writeJSON(w, http.StatusOK, t.file(n))
+	case strings.HasPrefix(p, "/files/") && r.Method == http.MethodPatch:
+		var body struct {
+			Name string `json:"name"`
+		}
+		if err := readJSON(r, &body); err != nil {
+			t.writeError(w, ThunderCodeInvalidArgument, err.Error())
+			return
+		}
+		n, err := t.Tree.Rename(strings.TrimPrefix(p, "/files/"), body.Name)
+		if err != nil {
+			t.treeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, t.file(n))
+	case p == "/tasks" && r.Method == http.MethodGet:
+		t.listTasks(w, r)
+	case strings.HasPrefix(p, "/tasks/") && r.Method == http.MethodGet:
+		t.state.Lock()
+		task, ok := t.tasks[strings.TrimPrefix(p, "/tasks/")]
+		t.state.Unlock()
+		if !ok {
+			t.writeError(w, ThunderCodeNotFound, "task_not_found")
+			return
+		}
+		writeJSON(w, http.StatusOK, t.task(task))
+	case p == "/about" && r.Method == http.MethodGet:
+		writeJSON(w, http.StatusOK, map[string]any{
+			"kind": "drive#about",
+			"quota": map[string]any{
+				"kind":  "drive#quota",
+				"limit": strconv.FormatInt(1024*1024*1024*1024, 10),
+				"usage": strconv.FormatInt(t.Tree.Usage(), 10),
+			},
+			"quotas": map[string]any{},
+		})
+	case p == "/share/list" && r.Method == http.MethodGet:
+		t.shareList(w, r)
+	case p == "/share" && r.Method == http.MethodPost:
+		t.createShare(w, r)
+	case p == "/share/delete" && r.Method == http.MethodPost:
+		var body struct {
+			ShareId string `json:"share_id"`
+		}
+		if err := readJSON(r, &body); err != nil {
+			t.writeError(w, ThunderCodeInvalidArgument, err.Error())
+			return
+		}
+		t.state.Lock()
+		delete(t.shares, body.ShareId)
+		t.state.Unlock()
+		writeJSON(w, http.StatusOK, map[string]any{})
+	case p == "/share" && r.Method == http.MethodGet:
+		t.getShare(w, r)
+	case p == "/share/detail" && r.Method == http.MethodGet:
+		t.shareDetail(w, r)
+	case p == "/share/restore" && r.Method == http.MethodPost:
+		t.shareRestore(w, r)
+	default:
+		t.writeError(w, ThunderCodeInvalidArgument, "unknown api "+r.Method+" "+p)
+	}
+}
+
+func rfc3339(tm time.Time) string {
+	return tm.UTC().Format(time.RFC3339)
+}
+
+func (t *ThunderServer) file(n *Node) map[string]any {
+	kind := "drive#file"
+	link := t.URL + thunderFilePath + n.Id
+	hash := ""
+	if n.IsDir {
+		kind = "drive#folder"
+		link = ""
+	} else {
+		hash = gcidOf(n.Data)
+	}
+	return map[string]any{
+		"kind":               kind,
+		"id":                 n.Id,
+		"parent_id":          n.ParentId,
+		"name":               n.Name,
+		"size":               strconv.FormatInt(n.Size(), 10),
+		"web_content_link":   link,
+		"created_time":       rfc3339(n.Created),
+		"modified_time":      rfc3339(n.Modified),
+		"user_modified_time": rfc3339(n.Modified),
+		"hash":               hash,
+		"trashed":            false,
+		"space":              "",
+		"medias":             []any{},
+	}
+}
+
+func gcidOf(data []byte) string {
+	h := internal.NewGcid(int64(len(data)))
+	_, _ = h.Write(data)
+	return strings.ToUpper(hex.EncodeToString(h.Sum(nil)))
+}
+
+// pageToken 使用偏移量作为翻页 token
+func pageToken(items, offset, size int) (int, int, string) {
+	if offset > items {
+		offset = items
+	}
+	end := min(offset+size, items)
+	next := ""
+	if end < items {
+		next = strconv.Itoa(end)
+	}
+	return offset, end, next
+}
+
+func (t *ThunderServer) listFiles(w http.ResponseWriter, r *http.Request) {
+	var children []*Node
+	filters := r.URL.Query().Get("filters")
+	trashed := filterTrashed(filters)
+	if trashed {
+		for _, entry := range t.Tree.TrashList() {
+			children = append(children, entry.Node)
+		}
+	} else if r.URL.Query().Get("parent_id") == "*" {
+		// 全盘搜索
+		keyword := strings.ToLower(filterInclude(filters, "name"))
+		children = t.Tree.Search(t.Tree.RootId(), func(n *Node) bool {
+			return strings.Contains(strings.ToLower(n.Name), keyword)
+		})
+	} else {
+		var err error
+		children, err = t.Tree.Children(r.URL.Query().Get("parent_id"))
+		if err != nil {
+			t.treeError(w, err)
+			return
+		}
+	}
+	offset, _ := strconv.Atoi(r.URL.Query().Get("page_token"))
+	start, end, next := pageToken(len(children), offset, t.PageSize)
+	files := make([]map[string]any, 0)
+	for _, n := range children[start:end] {
+		file := t.file(n)
+		file["trashed"] = trashed
+		files = append(files, file)
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"kind":            "drive#fileList",
+		"next_page_token": next,
+		"files":           files,
+	})
+}
+
+func (t *ThunderServer) createFile(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Kind       string `json:"kind"`
+		ParentId   string `json:"parent_id"`
+		Name       string `json:"name"`
+		Size       int64  `json:"size"`
+		Hash       string `json:"hash"`
+		UploadType string `json:"upload_type"`
+		Url        struct {
+			Url string `json:"url"`
+		} `json:"url"`
+	}
+	if err := readJSON(r, &body); err != nil {
+		t.writeError(w, ThunderCodeInvalidArgument, err.Error())
+		return
+	}
+	if body.Kind == "drive#folder" {
+		n, err := t.Tree.Mkdir(body.ParentId, body.Name)
+		if err != nil {
+			t.treeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{
+			"upload_type": "UPLOAD_TYPE_UNKNOWN",
+			"file":        t.file(n),
+		})
+		return
+	}
+	switch body.UploadType {
+	case "UPLOAD_TYPE_URL":
+		task := t.addTask(body.Name, "offline", "PHASE_TYPE_PENDING", "")
+		writeJSON(w, http.StatusOK, map[string]any{
+			"upload_type": body.UploadType,
+			"url":         map[string]any{"kind": "upload#url"},
+			"task":        t.task(task),
+		})
+	case "UPLOAD_TYPE_RESUMABLE":
+		t.createUpload(w, body.ParentId, body.Name, body.Size, body.Hash)
+	default:
+		t.writeError(w, ThunderCodeInvalidArgument, "unsupported upload_type "+body.UploadType)
+	}
+}
+
+func (t *ThunderServer) createUpload(w http.ResponseWriter, parentId, name string, size int64, hash string) {
+	parent, ok := t.Tree.Get(parentId)
+	if !ok || !parent.IsDir {
+		t.treeError(w, errNotExist)
+		return
+	}
+	if _, exist := t.Tree.Find(func(n *Node) bool { return n.ParentId == parentId && n.Name == name }); exist {
+		t.treeError(w, errExist)
+		return
+	}
+	// 秒传：已有相同 gcid 的文件时直接生成新文件
+	same, found := t.Tree.Find(func(n *Node) bool {
+		return !n.IsDir && n.Size() == size && strings.EqualFold(gcidOf(n.Data), hash)
+	})
+	if found {
+		n, err := t.Tree.Put("", parentId, name, same.Data)
+		if err != nil {
+			t.treeError(w, err)
+			return
+		}
+		task := t.addTask(name, "upload", "PHASE_TYPE_COMPLETE", n.Id)
+		writeJSON(w, http.StatusOK, map[string]any{
+			"upload_type": "UPLOAD_TYPE_UNKNOWN",
+			"file":        t.file(n),
+			"task":        t.task(task),
+		})
+		return
+	}
+	up := &thunderUpload{
+		fileId:   t.Tree.NewId(),
+		parentId: parentId,
+		name:     name,
+		size:     size,
+		parts:    make(map[int][]byte),
+	}
+	t.state.Lock()
+	t.uploads[up.fileId] = up
+	t.state.Unlock()
+	task := t.addTask(name, "upload", "PHASE_TYPE_RUNNING", up.fileId)
+	now := time.Now()
+	writeJSON(w, http.StatusOK, map[string]any{
+		"upload_type": "UPLOAD_TYPE_RESUMABLE",
+		"resumable": map[string]any{
+			"kind":     "drive#resumable",
+			"provider": "PROVIDER_ALIYUN",
+			"params": map[string]any{
+				"access_key_id":     "pantest",
+				"access_key_secret": "pantest",
+				"bucket":            ThunderBucket,
+				"endpoint":          t.URL,
+				"expiration":        rfc3339(now.Add(time.Hour)),
+				"key":               up.fileId,
+				"security_token":    "pantest",
+			},
+		},
+		"file": map[string]any{
+			"kind":          "drive#file",
+			"id":            up.fileId,
+			"parent_id":     parentId,
+			"name":          name,
+			"size":          strconv.FormatInt(size, 10),
+			"created_time":  rfc3339(now),
+			"modified_time": rfc3339(now),
+		},
+		"task": t.task(task),
+	})
+}
+
+func (t *ThunderServer) batchMove(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Ids []string `json:"ids"`
+		To  struct {
+			ParentId string `json:"parent_id"`
+		} `json:"to"`
+	}
+	if err := readJSON(r, &body); err != nil {
+		t.writeError(w, ThunderCodeInvalidArgument, err.Error())
+		return
+	}
+	for _, id := range body.Ids {
+		if err := t.Tree.Move(id, body.To.ParentId); err != nil {
+			t.treeError(w, err)
+			return
+		}
+	}
+	task := t.addTask("move", "move", "PHASE_TYPE_COMPLETE", "")
+	writeJSON(w, http.StatusOK, map[string]any{"task_id": task.id})
+}
+
+func (t *ThunderServer) batchCopy(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Ids []string `json:"ids"`
+		To  struct {
+			ParentId string `json:"parent_id"`
+		} `json:"to"`
+	}
+	if err := readJSON(r, &body); err != nil {
+		t.writeError(w, ThunderCodeInvalidArgument, err.Error())
+		return
+	}
+	for _, id := range body.Ids {
+		if _, err := t.Tree.Copy(id, body.To.ParentId); err != nil {
+			t.treeError(w, err)
+			return
+		}
+	}
+	task := t.addTask("copy", "copy", "PHASE_TYPE_COMPLETE", "")
+	writeJSON(w, http.StatusOK, map[string]any{"task_id": task.id})
+}
+
+// batchDelete 彻底删除对象，回收站中的对象同样适用
+func (t *ThunderServer) batchDelete(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Ids []string `json:"ids"`
+	}
+	if err := readJSON(r, &body); err != nil {
+		t.writeError(w, ThunderCodeInvalidArgument, err.Error())
+		return
+	}
+	for _, id := range body.Ids {
+		err := t.Tree.Remove(id)
+		if err == errNotExist {
+			err = t.Tree.Purge(id)
+		}
+		if err != nil {
+			t.treeError(w, err)
+			return
+		}
+	}
+	task := t.addTask("delete", "deletefile", "PHASE_TYPE_COMPLETE", "")
+	writeJSON(w, http.StatusOK, map[string]any{"task_id": task.id})
+}
+
+func (t *ThunderServer) batchTrash(w http.ResponseWriter, r *http.Request, operate func(id string) error) {
+	var body struct {
+		Ids []string `json:"ids"`
+	}
+	if err := readJSON(r, &body); err != nil {
+		t.writeError(w, ThunderCodeInvalidArgument, err.Error())
+		return
+	}
+	for _, id := range body.Ids {
+		if err := operate(id); err != nil {
+			t.treeError(w, err)
+			return
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{})
+}
+
+func (t *ThunderServer) addTask(name, kind, phase, fileId string) *thunderTask {
+	task := &thunderTask{
+		id:      t.nextId("VT"),
+		name:    name,
+		kind:    kind,
+		phase:   phase,
+		fileId:  fileId,
+		created: time.Now(),
+	}
+	t.state.Lock()
+	t.tasks[task.id] = task
+	t.state.Unlock()
+	return task
+}
+
+func (t *ThunderServer) setTaskPhase(fileId, phase string) {
+	t.state.Lock()
+	defer t.state.Unlock()
+	for _, task := range t.tasks {
+		if task.fileId == fileId {
+			task.phase = phase
+		}
+	}
+}
+
+func (t *ThunderServer) task(task *thunderTask) map[string]any {
+	t.state.Lock()
+	defer t.state.Unlock()
+	return map[string]any{
+		"kind":         "drive#task",
+		"id":           task.id,
+		"name":         task.name,
+		"type":         task.kind,
+		"phase":        task.phase,
+		"file_id":      task.fileId,
+		"created_time": rfc3339(task.created),
+		"updated_time": rfc3339(task.created),
+	}
+}
+
+// filterTrashed 判断 filters 参数是否为 {"trashed":{"eq":true}}
+func filterTrashed(filters string) bool {
+	var parsed map[string]map[string]any
+	if json.Unmarshal([]byte(filters), &parsed) != nil {
+		return false
+	}
+	trashed, _ := parsed["trashed"]["eq"].(bool)
+	return trashed
+}
+
+// filterInclude 返回 filters 参数中 {"field":{"include":"..."}} 条件的值
+func filterInclude(filters, field string) string {
+	var parsed map[string]map[string]any
+	if json.Unmarshal([]byte(filters), &parsed) != nil {
+		return ""
+	}
+	value, _ := parsed[field]["include"].(string)
+	return value
+}
+
+// filterIn 解析 filters 参数中 {"field":{"in":"a,b"}} 形式的条件
+func filterIn(filters string) map[string][]string {
+	result := make(map[string][]string)
+	var parsed map[string]map[string]string
+	if json.Unmarshal([]byte(filters), &parsed) != nil {
+		return result
+	}
+	for field, cond := range parsed {
+		if in, ok := cond["in"]; ok && in != "" {
+			result[field] = strings.Split(in, ",")
+		}
+	}
+	return result
+}
+
+func (t *ThunderServer) listTasks(w http.ResponseWriter, r *http.Request) {
+	filters := filterIn(r.URL.Query().Get("filters"))
+	t.state.Lock()
+	matched := make([]*thunderTask, 0)
+	for _, task := range t.tasks {
+		if ids, ok := filters["id"]; ok && !contains(ids, task.id) {
+			continue
+		}
+		if phases, ok := filters["phase"]; ok && !contains(phases, task.phase) {
+			continue
+		}
+		if types, ok := filters["type"]; ok && !contains(types, task.kind) {
+			continue
+		}
+		matched = append(matched, task)
+	}
+	t.state.Unlock()
+	sort.Slice(matched, func(i, j int) bool {
+		return matched[i].id < matched[j].id
+	})
+	tasks := make([]map[string]any, 0)
+	for _, task := range matched {
+		tasks = append(tasks, t.task(task))
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"tasks":           tasks,
+		"next_page_token": "",
+	})
+}
+
+func (t *ThunderServer) shareInfo(share *thunderShare) map[string]any {
+	shareUrl := t.URL + "/s/" + share.shareId
+	if share.withInLink {
+		shareUrl += "?pwd=" + share.passCode
+	}
+	return map[string]any{
+		"share_id":     share.shareId,
+		"share_status": "OK",
+		"title":        share.title,
+		"pass_code":    share.passCode,
+		"file_num":     strconv.Itoa(len(share.fileIds)),
+		"create_time":  rfc3339(share.created),
+		"share_url":    shareUrl,
+		"file_id":      share.fileIds[0],
+	}
+}
+
+func (t *ThunderServer) shareList(w http.ResponseWriter, r *http.Request) {
+	filters := filterIn(r.URL.Query().Get("filters"))
+	t.state.Lock()
+	matched := make([]*thunderShare, 0)
+	for _, share := range t.shares {
+		if ids, ok := filters["id"]; ok && !contains(ids, share.shareId) {
+			continue
+		}
+		matched = append(matched, share)
+	}
+	t.state.Unlock()
+	sort.Slice(matched, func(i, j int) bool {
+		return matched[i].shareId < matched[j].shareId
+	})
+	data := make([]map[string]any, 0)
+	for _, share := range matched {
+		data = append(data, t.shareInfo(share))
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"data":            data,
+		"next_page_token": "",
+	})
+}
+
+func (t *ThunderServer) createShare(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		FileIds []string `json:"file_ids"`
+		Title   string   `json:"title"`
+		Params  struct {
+			WithPassCodeInLink string `json:"WithPassCodeInLink"`
+		} `json:"params"`
+	}
+	if err := readJSON(r, &body); err != nil {
+		t.writeError(w, ThunderCodeInvalidArgument, err.Error())
+		return
+	}
+	if len(body.FileIds) == 0 {
+		t.writeError(w, ThunderCodeInvalidArgument, "file_ids is empty")
+		return
+	}
+	for _, id := range body.FileIds {
+		if _, ok := t.Tree.Get(id); !ok {
+			t.treeError(w, errNotExist)
+			return
+		}
+	}
+	share := &thunderShare{
+		shareId:    t.nextId("VS"),
+		title:      body.Title,
+		passCode:   internal.GenRandomWord(),
+		withInLink: body.Params.WithPassCodeInLink == "true",
+		fileIds:    body.FileIds,
+		created:    time.Now(),
+	}
+	t.state.Lock()
+	t.shares[share.shareId] = share
+	t.state.Unlock()
+	info := t.shareInfo(share)
+	writeJSON(w, http.StatusOK, map[string]any{
+		"share_id":  share.shareId,
+		"share_url": info["share_url"],
+		"pass_code": share.passCode,
+	})
+}
+
+func (t *ThunderServer) share(shareId string) (*thunderShare, bool) {
+	t.state.Lock()
+	defer t.state.Unlock()
+	share, ok := t.shares[shareId]
+	return share, ok
+}
+
+func (t *ThunderServer) getShare(w http.ResponseWriter, r *http.Request) {
+	share, ok := t.share(r.URL.Query().Get("share_id"))
+	if !ok {
+		t.writeError(w, ThunderCodeNotFound, "share_not_found")
+		return
+	}
+	if share.passCode != r.URL.Query().Get("pass_code") {
+		t.writeError(w, ThunderCodePermissionDenied, "pass_code_invalid")
+		return
+	}
+	files := make([]map[string]any, 0)
+	for _, id := range share.fileIds {
+		if n, exist := t.Tree.Get(id); exist {
+			files = append(files, t.file(n))
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"share_status":    "OK",
+		"file_num":        strconv.Itoa(len(files)),
+		"files":           files,
+		"pass_code_token": "token-" + share.shareId,
+		"title":           share.title,
+		"next_page_token": "",
+	})
+}
+
+func (t *ThunderServer) shareDetail(w http.ResponseWriter, r *http.Request) {
+	share, ok := t.share(r.URL.Query().Get("share_id"))
+	if !ok {
+		t.writeError(w, ThunderCodeNotFound, "share_not_found")
+		return
+	}
+	if r.URL.Query().Get("pass_code_token") != "token-"+share.shareId {
+		t.writeError(w, ThunderCodePermissionDenied, "pass_code_token_invalid")
+		return
+	}
+	children, err := t.Tree.Children(r.URL.Query().Get("parent_id"))
+	if err != nil {
+		t.treeError(w, err)
+		return
+	}
+	files := make([]map[string]any, 0)
+	for _, n := range children {
+		files = append(files, t.file(n))
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"share_status":    "OK",
+		"files":           files,
+		"pass_code_token": "token-" + share.shareId,
+		"next_page_token": "",
+	})
+}
+
+func (t *ThunderServer) shareRestore(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		ParentId      string   `json:"parent_id"`
+		ShareId       string   `json:"share_id"`
+		PassCodeToken string   `json:"pass_code_token"`
+		FileIds       []string `json:"file_ids"`
+	}
+	if err := readJSON(r, &body); err != nil {
+		t.writeError(w, ThunderCodeInvalidArgument, err.Error())
+		return
+	}
+	share, ok := t.share(body.ShareId)
+	if !ok {
+		t.writeError(w, ThunderCodeNotFound, "share_not_found")
+		return
+	}
+	if body.PassCodeToken != "token-"+share.shareId {
+		t.writeError(w, ThunderCodePermissionDenied, "pass_code_token_invalid")
+		return
+	}
+	for _, id := range body.FileIds {
+		if !contains(share.fileIds, id) {
+			t.writeError(w, ThunderCodePermissionDenied, "file_not_in_share")
+			return
+		}
+		if _, err := t.Tree.Copy(id, body.ParentId); err != nil {
+			t.treeError(w, err)
+			return
+		}
+	}
+	task := t.addTask(share.title, "restore", "PHASE_TYPE_COMPLETE", "")
+	writeJSON(w, http.StatusOK, map[string]any{
+		"share_status":    "OK",
+		"restore_status":  "RESTORE_START",
+		"restore_task_id": task.id,
+	})
+}
+
+func (t *ThunderServer) s3Error(w http.ResponseWriter, status int, code string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	_, _ = fmt.Fprintf(w, "<Error><Code>%s</Code><Message>%s</Message></Error>", code, code)
+}
+
+func (t *ThunderServer) writeXML(w http.ResponseWriter, body string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(http.StatusOK)
+	_, _ = fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?>`+body)
+}
+
+// serveS3 实现上传用到的 S3 接口：PutObject 和分片上传
+func (t *ThunderServer) serveS3(w http.ResponseWriter, r *http.Request, key string) {
+	if !strings.Contains(r.Header.Get("Authorization"), "Credential=pantest/") {
+		t.s3Error(w, http.StatusForbidden, "AccessDenied")
+		return
+	}
+	t.state.Lock()
+	up, ok := t.uploads[key]
+	t.state.Unlock()
+	if !ok {
+		t.s3Error(w, http.StatusNotFound, "NoSuchUpload")
+		return
+	}
+	query := r.URL.Query()
+	_, initiate := query["uploads"]
+	switch {
+	case r.Method == http.MethodPost && initiate:
+		t.state.Lock()
+		up.uploadId = "upload-" + key
+		t.state.Unlock()
+		t.writeXML(w, fmt.Sprintf("<InitiateMultipartUploadResult><Bucket>%s</Bucket><Key>%s</Key><UploadId>%s</UploadId></InitiateMultipartUploadResult>",
+			ThunderBucket, key, up.uploadId))
+	case r.Method == http.MethodPut && query.Get("uploadId") == "":
+		data, err := readBody(r)
+		if err != nil {
+			t.s3Error(w, http.StatusBadRequest, "IncompleteBody")
+			return
+		}
+		if !t.finishUpload(w, up, data) {
+			return
+		}
+		w.Header().Set("ETag", `"`+key+`"`)
+		w.WriteHeader(http.StatusOK)
+	case r.Method == http.MethodPut:
+		partNumber, err := strconv.Atoi(query.Get("partNumber"))
+		if err != nil || query.Get("uploadId") != up.uploadId {
+			t.s3Error(w, http.StatusBadRequest, "InvalidArgument")
+			return
+		}
+		data, err := readBody(r)
+		if err != nil {
+			t.s3Error(w, http.StatusBadRequest, "IncompleteBody")
+			return
+		}
+		t.state.Lock()
+		up.parts[partNumber] = data
+		t.state.Unlock()
+		w.Header().Set("ETag", fmt.Sprintf(`"%s-%d"`, key, partNumber))
+		w.WriteHeader(http.StatusOK)
+	case r.Method == http.MethodGet && query.Get("uploadId") != "":
+		t.listParts(w, up, query)
+	case r.Method == http.MethodPost:
+		if query.Get("uploadId") != up.uploadId {
+			t.s3Error(w, http.StatusNotFound, "NoSuchUpload")
+			return
+		}
+		_, _ = readBody(r)
+		t.state.Lock()
+		numbers := make([]int, 0, len(up.parts))
+		for number := range up.parts {
+			numbers = append(numbers, number)
+		}
+		sort.Ints(numbers)
+		data := make([]byte, 0, up.size)
+		for _, number := range numbers {
+			data = append(data, up.parts[number]...)
+		}
+		t.state.Unlock()
+		if !t.finishUpload(w, up, data) {
+			return
+		}
+		t.writeXML(w, fmt.Sprintf(`<CompleteMultipartUploadResult><Bucket>%s</Bucket><Key>%s</Key><ETag>"%s"</ETag></CompleteMultipartUploadResult>`,
+			ThunderBucket, key, key))
+	case r.Method == http.MethodDelete:
+		t.state.Lock()
+		up.uploadId = ""
+		up.parts = make(map[int][]byte)
+		t.state.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		t.s3Error(w, http.StatusMethodNotAllowed, "MethodNotAllowed")
+	}
+}
+
+// listParts 按 part-number-marker 和 max-parts 分页列出已上传的分片
+func (t *ThunderServer) listParts(w http.ResponseWriter, up *thunderUpload, query url.Values) {
+	t.state.Lock()
+	defer t.state.Unlock()
+	if query.Get("uploadId") != up.uploadId {
+		t.s3Error(w, http.StatusNotFound, "NoSuchUpload")
+		return
+	}
+	marker, _ := strconv.Atoi(query.Get("part-number-marker"))
+	maxParts, _ := strconv.Atoi(query.Get("max-parts"))
+	if maxParts <= 0 {
+		maxParts = 1000
+	}
+	numbers := make([]int, 0, len(up.parts))
+	for number := range up.parts {
+		if number > marker {
+			numbers = append(numbers, number)
+		}
+	}
+	sort.Ints(numbers)
+	truncated := len(numbers) > maxParts
+	if truncated {
+		numbers = numbers[:maxParts]
+	}
+	var body strings.Builder
+	fmt.Fprintf(&body, "<ListPartsResult><Bucket>%s</Bucket><Key>%s</Key><UploadId>%s</UploadId><IsTruncated>%t</IsTruncated>",
+		ThunderBucket, up.fileId, up.uploadId, truncated)
+	if truncated {
+		fmt.Fprintf(&body, "<NextPartNumberMarker>%d</NextPartNumberMarker>", numbers[len(numbers)-1])
+	}
+	for _, number := range numbers {
+		fmt.Fprintf(&body, `<Part><PartNumber>%d</PartNumber><ETag>"%s-%d"</ETag><Size>%d</Size></Part>`,
+			number, up.fileId, number, len(up.parts[number]))
+	}
+	body.WriteString("</ListPartsResult>")
+	t.writeXML(w, body.String())
+}
+
+// finishUpload 上传完成后在文件树中生成文件，失败时已输出错误
+func (t *ThunderServer) finishUpload(w http.ResponseWriter, up *thunderUpload, data []byte) bool {
+	if int64(len(data)) != up.size {
+		t.s3Error(w, http.StatusBadRequest, "IncompleteBody")
+		return false
+	}
+	if _, err := t.Tree.Put(up.fileId, up.parentId, up.name, data); err != nil {
+		t.s3Error(w, http.StatusConflict, "InvalidRequest")
+		return false
+	}
+	t.state.Lock()
+	delete(t.uploads, up.fileId)
+	t.state.Unlock()
+	t.setTaskPhase(up.fileId, "PHASE_TYPE_COMPLETE")
+	return true
+}
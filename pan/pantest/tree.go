@@ -0,0 +1,512 @@
+package pantest
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	errNotExist = errors.New("object not exist")
+	errExist    = errors.New("object already exist")
+	errNotDir   = errors.New("object is not a dir")
+)
+
+// Node 内存文件树中的一个对象
+type Node struct {
+	Id       string
+	ParentId string
+	Name     string
+	IsDir    bool
+	Data     []byte
+	Created  time.Time
+	Modified time.Time
+}
+
+// Size 返回文件大小，目录为 0
+func (n *Node) Size() int64 {
+	return int64(len(n.Data))
+}
+
+// TrashEntry 回收站中的一条记录，Node 为被删除的顶层对象
+type TrashEntry struct {
+	Node    *Node
+	Path    string // 删除前所在目录的完整路径
+	Deleted time.Time
+	nodes   []*Node
+}
+
+// Tree 是 fake 服务端共用的内存文件树，所有方法并发安全，返回的 Node 均为副本
+type Tree struct {
+	mu     sync.Mutex
+	rootId string
+	prefix string
+	seq    int
+	nodes  map[string]*Node
+	trash  map[string]*TrashEntry
+}
+
+// NewTree 创建一棵只有根目录的文件树，rootId 为根目录 ID，prefix 为新建对象 ID 的前缀
+func NewTree(rootId, prefix string) *Tree {
+	now := time.Now()
+	return &Tree{
+		rootId: rootId,
+		prefix: prefix,
+		nodes: map[string]*Node{
+			rootId: {Id: rootId, IsDir: true, Created: now, Modified: now},
+		},
+		trash: make(map[string]*TrashEntry),
+	}
+}
+
+// RootId 返回根目录 ID
+func (t *Tree) RootId() string {
+	return t.rootId
+}
+
+// NewId 生成一个未被占用的对象 ID
+func (t *Tree) NewId() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.newId()
+}
+
+func (t *Tree) newId() string {
+	for {
+		t.seq++
+		id := fmt.Sprintf("%s%08d", t.prefix, t.seq)
+		if _, ok := t.nodes[id]; !ok {
+			return id
+		}
+	}
+}
+
+// Get 按 ID 获取对象
+func (t *Tree) Get(id string) (*Node, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	n, ok := t.nodes[id]
+	if !ok {
+		return nil, false
+	}
+	return clone(n), true
+}
+
+// Children 返回目录下的对象，按名称排序
+func (t *Tree) Children(id string) ([]*Node, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	dir, ok := t.nodes[id]
+	if !ok {
+		return nil, errNotExist
+	}
+	if !dir.IsDir {
+		return nil, errNotDir
+	}
+	return t.children(id), nil
+}
+
+func (t *Tree) children(id string) []*Node {
+	result := make([]*Node, 0)
+	for _, n := range t.nodes {
+		if n.ParentId == id && n.Id != t.rootId {
+			result = append(result, clone(n))
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
+
+// Find 返回第一个满足条件的对象
+func (t *Tree) Find(match func(n *Node) bool) (*Node, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, n := range t.nodes {
+		if n.Id != t.rootId && match(n) {
+			return clone(n), true
+		}
+	}
+	return nil, false
+}
+
+// Search 返回 id 目录下（递归）所有满足条件的对象，按完整路径排序
+func (t *Tree) Search(id string, match func(n *Node) bool) []*Node {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	result := make([]*Node, 0)
+	for _, n := range t.nodes {
+		if n.Id == t.rootId || !match(n) {
+			continue
+		}
+		for parent := n.ParentId; ; {
+			if parent == id {
+				result = append(result, clone(n))
+				break
+			}
+			p, ok := t.nodes[parent]
+			if !ok || p.Id == t.rootId {
+				break
+			}
+			parent = p.ParentId
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return t.pathOf(result[i].Id) < t.pathOf(result[j].Id)
+	})
+	return result
+}
+
+// PathOf 返回对象的完整路径，根目录为 "/"
+func (t *Tree) PathOf(id string) string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.pathOf(id)
+}
+
+func (t *Tree) pathOf(id string) string {
+	names := make([]string, 0)
+	for id != t.rootId {
+		n, ok := t.nodes[id]
+		if !ok {
+			return ""
+		}
+		names = append([]string{n.Name}, names...)
+		id = n.ParentId
+	}
+	return "/" + strings.Join(names, "/")
+}
+
+// Lookup 按完整路径查找对象
+func (t *Tree) Lookup(p string) (*Node, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	n := t.lookup(p)
+	if n == nil {
+		return nil, false
+	}
+	return clone(n), true
+}
+
+func (t *Tree) lookup(p string) *Node {
+	current := t.nodes[t.rootId]
+	for _, name := range strings.Split(strings.Trim(path.Clean("/"+p), "/"), "/") {
+		if name == "" {
+			continue
+		}
+		current = t.child(current.Id, name)
+		if current == nil {
+			return nil
+		}
+	}
+	return current
+}
+
+func (t *Tree) child(parentId, name string) *Node {
+	for _, n := range t.nodes {
+		if n.ParentId == parentId && n.Name == name && n.Id != t.rootId {
+			return n
+		}
+	}
+	return nil
+}
+
+// Mkdir 在 parentId 下创建目录
+func (t *Tree) Mkdir(parentId, name string) (*Node, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.insert("", parentId, name, true, nil)
+}
+
+// MkdirAll 按完整路径逐级创建目录，已存在的目录直接复用
+func (t *Tree) MkdirAll(p string) (*Node, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.mkdirAll(p)
+}
+
+func (t *Tree) mkdirAll(p string) (*Node, error) {
+	current := t.nodes[t.rootId]
+	for _, name := range strings.Split(strings.Trim(path.Clean("/"+p), "/"), "/") {
+		if name == "" {
+			continue
+		}
+		next := t.child(current.Id, name)
+		if next == nil {
+			created, err := t.insert("", current.Id, name, true, nil)
+			if err != nil {
+				return nil, err
+			}
+			next = t.nodes[created.Id]
+		} else if !next.IsDir {
+			return nil, errNotDir
+		}
+		current = next
+	}
+	return clone(current), nil
+}
+
+// Put 在 parentId 下创建文件，id 为空时自动生成
+func (t *Tree) Put(id, parentId, name string, data []byte) (*Node, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.insert(id, parentId, name, false, data)
+}
+
+// WriteFile 按完整路径写入文件，父目录不存在时自动创建，常用于测试数据准备
+func (t *Tree) WriteFile(p string, data []byte) (*Node, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	parent, err := t.mkdirAll(path.Dir(path.Clean("/" + p)))
+	if err != nil {
+		return nil, err
+	}
+	return t.insert("", parent.Id, path.Base(p), false, data)
+}
+
+// ReadFile 按完整路径读取文件内容
+func (t *Tree) ReadFile(p string) ([]byte, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	n := t.lookup(p)
+	if n == nil {
+		return nil, errNotExist
+	}
+	if n.IsDir {
+		return nil, errNotDir
+	}
+	return append([]byte(nil), n.Data...), nil
+}
+
+func (t *Tree) insert(id, parentId, name string, isDir bool, data []byte) (*Node, error) {
+	parent, ok := t.nodes[parentId]
+	if !ok {
+		return nil, errNotExist
+	}
+	if !parent.IsDir {
+		return nil, errNotDir
+	}
+	if name == "" || strings.Contains(name, "/") {
+		return nil, fmt.Errorf("invalid name %q", name)
+	}
+	if t.child(parentId, name) != nil {
+		return nil, errExist
+	}
+	if id == "" {
+		id = t.newId()
+	} else if _, exist := t.nodes[id]; exist {
+		return nil, errExist
+	}
+	now := time.Now()
+	n := &Node{
+		Id:       id,
+		ParentId: parentId,
+		Name:     name,
+		IsDir:    isDir,
+		Data:     append([]byte(nil), data...),
+		Created:  now,
+		Modified: now,
+	}
+	t.nodes[id] = n
+	parent.Modified = now
+	return clone(n), nil
+}
+
+// Rename 重命名对象
+func (t *Tree) Rename(id, newName string) (*Node, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	n, ok := t.nodes[id]
+	if !ok || id == t.rootId {
+		return nil, errNotExist
+	}
+	if other := t.child(n.ParentId, newName); other != nil && other.Id != id {
+		return nil, errExist
+	}
+	n.Name = newName
+	n.Modified = time.Now()
+	return clone(n), nil
+}
+
+// Move 将对象移动到 parentId 下
+func (t *Tree) Move(id, parentId string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	n, ok := t.nodes[id]
+	if !ok || id == t.rootId {
+		return errNotExist
+	}
+	parent, ok := t.nodes[parentId]
+	if !ok {
+		return errNotExist
+	}
+	if !parent.IsDir {
+		return errNotDir
+	}
+	for p := parentId; p != t.rootId; p = t.nodes[p].ParentId {
+		if p == id {
+			return fmt.Errorf("can not move %s into itself", id)
+		}
+	}
+	if n.ParentId == parentId {
+		return nil
+	}
+	if t.child(parentId, n.Name) != nil {
+		return errExist
+	}
+	n.ParentId = parentId
+	n.Modified = time.Now()
+	return nil
+}
+
+// Copy 将对象（含子对象）复制到 parentId 下
+func (t *Tree) Copy(id, parentId string) (*Node, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	n, ok := t.nodes[id]
+	if !ok || id == t.rootId {
+		return nil, errNotExist
+	}
+	if _, ok = t.nodes[parentId]; !ok {
+		return nil, errNotExist
+	}
+	for p := parentId; p != t.rootId; p = t.nodes[p].ParentId {
+		if p == id {
+			return nil, fmt.Errorf("can not copy %s into itself", id)
+		}
+	}
+	return t.copy(n, parentId)
+}
+
+func (t *Tree) copy(n *Node, parentId string) (*Node, error) {
+	children := t.children(n.Id)
+	created, err := t.insert("", parentId, n.Name, n.IsDir, n.Data)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range children {
+		if _, err = t.copy(t.nodes[c.Id], created.Id); err != nil {
+			return nil, err
+		}
+	}
+	return created, nil
+}
+
+// Remove 删除对象及其子对象
+func (t *Tree) Remove(id string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, ok := t.nodes[id]; !ok || id == t.rootId {
+		return errNotExist
+	}
+	t.remove(id)
+	return nil
+}
+
+func (t *Tree) remove(id string) {
+	for _, c := range t.children(id) {
+		t.remove(c.Id)
+	}
+	delete(t.nodes, id)
+}
+
+// Trash 将对象及其子对象移入回收站，回收站记录以对象 ID 为 key
+func (t *Tree) Trash(id string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	n, ok := t.nodes[id]
+	if !ok || id == t.rootId {
+		return errNotExist
+	}
+	entry := &TrashEntry{
+		Node:    clone(n),
+		Path:    t.pathOf(n.ParentId),
+		Deleted: time.Now(),
+	}
+	var collect func(id string)
+	collect = func(id string) {
+		entry.nodes = append(entry.nodes, t.nodes[id])
+		for _, c := range t.children(id) {
+			collect(c.Id)
+		}
+	}
+	collect(id)
+	for _, removed := range entry.nodes {
+		delete(t.nodes, removed.Id)
+	}
+	t.trash[id] = entry
+	return nil
+}
+
+// TrashList 返回回收站记录，按删除时间排序
+func (t *Tree) TrashList() []*TrashEntry {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	result := make([]*TrashEntry, 0, len(t.trash))
+	for _, entry := range t.trash {
+		result = append(result, &TrashEntry{Node: clone(entry.Node), Path: entry.Path, Deleted: entry.Deleted})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Deleted.Before(result[j].Deleted)
+	})
+	return result
+}
+
+// Restore 将回收站记录还原到原目录，原目录不存在或有同名对象时失败
+func (t *Tree) Restore(id string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	entry, ok := t.trash[id]
+	if !ok {
+		return errNotExist
+	}
+	root := entry.nodes[0]
+	if _, ok = t.nodes[root.ParentId]; !ok {
+		return errNotExist
+	}
+	if t.child(root.ParentId, root.Name) != nil {
+		return errExist
+	}
+	for _, n := range entry.nodes {
+		t.nodes[n.Id] = n
+	}
+	delete(t.trash, id)
+	return nil
+}
+
+// Purge 彻底删除回收站记录，id 为空时清空回收站
+func (t *Tree) Purge(id string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if id == "" {
+		t.trash = make(map[string]*TrashEntry)
+		return nil
+	}
+	if _, ok := t.trash[id]; !ok {
+		return errNotExist
+	}
+	delete(t.trash, id)
+	return nil
+}
+
+// Usage 返回所有文件大小之和
+func (t *Tree) Usage() int64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var total int64
+	for _, n := range t.nodes {
+		total += int64(len(n.Data))
+	}
+	return total
+}
+
+func clone(n *Node) *Node {
+	c := *n
+	c.Data = append([]byte(nil), n.Data...)
+	return &c
+}
@@ -0,0 +1,215 @@
+package pan
+
+import (
+	"context"
+	"io"
+	"os"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/hefeiyu25/pan-client/internal"
+)
+
+// PartUploadFunc uploads one part and returns its ETag, if the server reports
+// one. r yields exactly part.Size bytes and can be read once.
+type PartUploadFunc func(ctx context.Context, part UploadPart, r io.Reader) (string, error)
+
+// UploadPartsReq describes a multipart upload of Content split into parts of
+// PartSize bytes, numbered from 1.
+type UploadPartsReq struct {
+	Content  *UploadContent
+	PartSize int64
+	// 同时上传的分片数，小于等于 1 时串行上传；数据流总是串行上传
+	Concurrency int
+	// 已完成的分片，序号与大小一致时跳过
+	Done []UploadPart
+	// 最后一个分片在其余分片都成功后再上传，用于收到最后一个分片即合并文件的服务端
+	LastAfterAll bool
+	// 每个分片成功后回调，回调是串行的，可在其中保存上传记录
+	PartDone         func(part UploadPart)
+	TaskId           string
+	FileId           string
+	ProgressCallback ProgressCallback
+}
+
+// BaseUploadParts uploads the parts of req.Content that are not in req.Done
+// through upload, with up to req.Concurrency parts in flight. Each part of a
+// local file gets its own reader over an io.SectionReader. Progress of all
+// parts is reported as one event stream. The first failure cancels the parts
+// in flight. It returns every completed part ordered by number, so the caller
+// can commit them in order.
+func (b *BaseOperate) BaseUploadParts(ctx context.Context, req UploadPartsReq, upload PartUploadFunc) ([]UploadPart, error) {
+	if req.PartSize <= 0 {
+		return nil, OnlyMsg("upload parts without part size")
+	}
+	content := req.Content
+	parts := make([]UploadPart, 0)
+	pending := make([]UploadPart, 0)
+	var uploaded int64
+	for number, offset := 1, int64(0); offset < content.Size; number, offset = number+1, offset+req.PartSize {
+		part := UploadPart{Number: number, Size: min(req.PartSize, content.Size-offset)}
+		if i := slices.IndexFunc(req.Done, func(p UploadPart) bool { return p.Number == number }); i >= 0 && req.Done[i].Size == part.Size {
+			parts = append(parts, req.Done[i])
+			uploaded += part.Size
+			continue
+		}
+		pending = append(pending, part)
+	}
+	concurrency := max(req.Concurrency, 1)
+	var readerAt io.ReaderAt
+	if content.LocalFile != "" {
+		file, err := os.Open(content.LocalFile)
+		if err != nil {
+			return nil, OnlyError(err)
+		}
+		defer file.Close()
+		readerAt = file
+	} else {
+		if len(parts) > 0 {
+			return nil, KindMsg(ErrUnsupported, "stream "+content.Name+" can not resume")
+		}
+		// 数据流只能按顺序读取
+		concurrency = 1
+	}
+	progress := &partsProgress{
+		req:       req,
+		name:      content.Source(),
+		total:     content.Size,
+		operated:  uploaded,
+		reported:  uploaded,
+		startTime: time.Now(),
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var mu sync.Mutex
+	var firstErr error
+	run := func(part UploadPart) {
+		var source io.Reader
+		if readerAt != nil {
+			source = io.NewSectionReader(readerAt, int64(part.Number-1)*req.PartSize, part.Size)
+		} else {
+			source = io.LimitReader(content.Reader, part.Size)
+		}
+		r := &partReader{ctx: ctx, r: source, progress: progress}
+		etag, err := upload(ctx, part, r)
+		if err == nil && r.n.Load() != part.Size {
+			err = OnlyMsg("part " + content.Source() + " not fully read")
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		if err != nil {
+			progress.add(-r.n.Load())
+			if firstErr == nil {
+				firstErr = err
+			}
+			cancel()
+			return
+		}
+		part.ETag = etag
+		parts = append(parts, part)
+		if req.PartDone != nil {
+			req.PartDone(part)
+		}
+	}
+
+	count := len(parts) + len(pending)
+	var last *UploadPart
+	if req.LastAfterAll && len(pending) > 1 {
+		last = &pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+	}
+	partCh := make(chan UploadPart)
+	var wg sync.WaitGroup
+	for i := 0; i < min(concurrency, len(pending)); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for part := range partCh {
+				if ctx.Err() == nil {
+					run(part)
+				}
+			}
+		}()
+	}
+	for _, part := range pending {
+		partCh <- part
+	}
+	close(partCh)
+	wg.Wait()
+	if firstErr == nil && last != nil && ctx.Err() == nil {
+		run(*last)
+	}
+	if firstErr == nil && len(parts) < count {
+		firstErr = ctx.Err()
+	}
+	slices.SortFunc(parts, func(a, b UploadPart) int {
+		return a.Number - b.Number
+	})
+	return parts, firstErr
+}
+
+// partReader 读取一个分片并汇总进度
+type partReader struct {
+	ctx      context.Context
+	r        io.Reader
+	n        atomic.Int64 // 已读取的字节，请求失败后传输协程可能仍在读取
+	progress *partsProgress
+}
+
+func (r *partReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	n, err := r.r.Read(p)
+	if n > 0 {
+		r.n.Add(int64(n))
+		r.progress.add(int64(n))
+	}
+	return n, err
+}
+
+// partsProgress 汇总所有分片的上传进度，分片失败时回退其已读取的字节
+type partsProgress struct {
+	req       UploadPartsReq
+	name      string
+	mu        sync.Mutex
+	total     int64
+	operated  int64
+	this      int64 // 本次上传的字节
+	reported  int64 // 已回调的字节，保证回调进度单调不减
+	startTime time.Time
+}
+
+func (p *partsProgress) add(n int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.operated += n
+	p.this += n
+	if p.operated <= p.reported {
+		return
+	}
+	operated := p.operated
+	p.reported = operated
+	done := operated >= p.total
+	internal.LogProgress("uploading", p.name, p.startTime, p.this, operated, p.total, false)
+	if p.req.ProgressCallback == nil {
+		return
+	}
+	var speed float64
+	if elapsed := time.Since(p.startTime).Seconds(); elapsed > 0 {
+		speed = float64(p.this) / 1024 / elapsed
+	}
+	p.req.ProgressCallback(ProgressEvent{
+		TaskId:    p.req.TaskId,
+		FileId:    p.req.FileId,
+		FileName:  p.name,
+		Operated:  operated,
+		TotalSize: p.total,
+		Percent:   float64(operated) / float64(p.total) * 100,
+		Speed:     speed,
+		Done:      done,
+	})
+}
@@ -0,0 +1,203 @@
+package pan
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+
+	"github.com/imroc/req/v3"
+)
+
+// rangeReader 通过 HTTP Range 请求读取下载链接，顺序读取时复用同一个响应体，
+// Seek 后在下次读取时从新的位置重新请求
+type rangeReader struct {
+	ctx     context.Context
+	cancel  context.CancelFunc
+	resolve func(ctx context.Context) (*DownloadLink, error)
+	link    *DownloadLink
+	client  *req.Client // link 未指定客户端时使用，多次 Range 请求复用同一连接池
+	size    int64
+	offset  int64
+	body    io.ReadCloser
+	closed  bool
+}
+
+// DownloadLinkFunc resolves the download link of file, see DownloadLinkCtx.
+type DownloadLinkFunc func(ctx context.Context, file *PanObj) (*DownloadLink, error)
+
+// BaseOpen opens file for random access. The link is resolved up front so a
+// missing file fails here; reads then use HTTP Range requests from the
+// current offset, and a link rejected as expired (401, 403 or 410) is
+// resolved again once before the error is returned. file must carry the Id
+// and Size returned by List or Stat.
+func (b *BaseOperate) BaseOpen(ctx context.Context, file *PanObj, link DownloadLinkFunc) (io.ReadSeekCloser, error) {
+	if file == nil || file.Type != "file" {
+		return nil, OnlyMsg("only support open file")
+	}
+	ctx, cancel := b.JoinContext(ctx)
+	r := &rangeReader{
+		ctx:    ctx,
+		cancel: cancel,
+		resolve: func(ctx context.Context) (*DownloadLink, error) {
+			return link(ctx, file)
+		},
+		size: file.Size,
+	}
+	if err := r.relink(); err != nil {
+		cancel()
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *rangeReader) Read(p []byte) (int, error) {
+	if r.closed {
+		return 0, os.ErrClosed
+	}
+	if r.offset >= r.size {
+		return 0, io.EOF
+	}
+	if r.body == nil {
+		body, err := r.open(r.offset)
+		if err != nil {
+			return 0, err
+		}
+		r.body = body
+	}
+	if remain := r.size - r.offset; int64(len(p)) > remain {
+		p = p[:remain]
+	}
+	n, err := r.body.Read(p)
+	r.offset += int64(n)
+	if err != nil && err != io.EOF {
+		// 下次读取时从当前位置重新请求
+		_ = r.body.Close()
+		r.body = nil
+		return n, OnlyError(err)
+	}
+	if err == io.EOF {
+		_ = r.body.Close()
+		r.body = nil
+		if r.offset < r.size {
+			return n, io.ErrUnexpectedEOF
+		}
+		err = nil
+	}
+	return n, err
+}
+
+func (r *rangeReader) Seek(offset int64, whence int) (int64, error) {
+	if r.closed {
+		return 0, os.ErrClosed
+	}
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += r.offset
+	case io.SeekEnd:
+		offset += r.size
+	default:
+		return 0, OnlyMsg("invalid whence")
+	}
+	if offset < 0 {
+		return 0, OnlyMsg("negative position")
+	}
+	if offset != r.offset && r.body != nil {
+		_ = r.body.Close()
+		r.body = nil
+	}
+	r.offset = offset
+	return offset, nil
+}
+
+func (r *rangeReader) Close() error {
+	if r.closed {
+		return nil
+	}
+	r.closed = true
+	r.cancel()
+	if r.client != nil {
+		r.client.GetTransport().CloseIdleConnections()
+	}
+	if r.body != nil {
+		err := r.body.Close()
+		r.body = nil
+		return err
+	}
+	return nil
+}
+
+// relink 重新解析下载链接
+func (r *rangeReader) relink() error {
+	link, err := r.resolve(r.ctx)
+	if err != nil {
+		return err
+	}
+	r.link = link
+	return nil
+}
+
+// open 从 offset 开始打开链接，链接过期时重新解析一次
+func (r *rangeReader) open(offset int64) (io.ReadCloser, error) {
+	body, status, err := r.get(offset)
+	switch status {
+	case http.StatusUnauthorized, http.StatusForbidden, http.StatusGone:
+		if err = r.relink(); err != nil {
+			return nil, err
+		}
+		body, _, err = r.get(offset)
+	}
+	return body, err
+}
+
+// get 请求链接，返回失败时的 HTTP 状态码
+func (r *rangeReader) get(offset int64) (io.ReadCloser, int, error) {
+	u, err := url.Parse(r.link.Url)
+	if err != nil {
+		return nil, 0, MsgError("invalid download link", err)
+	}
+	if u.Scheme == "file" {
+		f, err := os.Open(filepath.FromSlash(u.Path))
+		if err != nil {
+			return nil, 0, OnlyError(err)
+		}
+		if _, err = f.Seek(offset, io.SeekStart); err != nil {
+			_ = f.Close()
+			return nil, 0, OnlyError(err)
+		}
+		return f, 0, nil
+	}
+	client := r.link.Client
+	if client == nil {
+		if r.client == nil {
+			r.client = req.C()
+		}
+		client = r.client
+	}
+	resp, err := client.R().
+		SetContext(r.ctx).
+		SetHeader("Range", fmt.Sprintf("bytes=%d-", offset)).
+		DisableAutoReadResponse().
+		Get(r.link.Url)
+	if err != nil {
+		return nil, 0, OnlyError(err)
+	}
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		return resp.Body, 0, nil
+	case http.StatusOK:
+		// 服务端忽略 Range 时跳过已读部分
+		if _, err = io.CopyN(io.Discard, resp.Body, offset); err != nil {
+			_ = resp.Body.Close()
+			return nil, 0, OnlyError(err)
+		}
+		return resp.Body, 0, nil
+	default:
+		_ = resp.Body.Close()
+		return nil, resp.StatusCode, StatusCodeMsg(resp.StatusCode, resp.StatusCode, "download link responded "+resp.Status)
+	}
+}
@@ -0,0 +1,233 @@
+package pan
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"encoding/hex"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/hefeiyu25/pan-client/internal"
+)
+
+// UploadContent is the data an upload reads: a local file, or a stream whose
+// size is known. Drivers implement UploadFile and UploadStream on top of it.
+type UploadContent struct {
+	Name      string
+	Size      int64
+	ModTime   time.Time
+	LocalFile string    // 本地文件，为空时从 Reader 读取
+	Reader    io.Reader // 数据流，只能读取一次
+	// 已知的哈希，key 参考 HashMd5、HashSha1、HashGcid
+	Hashes map[string]string
+}
+
+// FileContent describes the local file localFile.
+func FileContent(localFile string) (*UploadContent, error) {
+	stat, err := os.Stat(localFile)
+	if err != nil {
+		return nil, err
+	}
+	if stat.IsDir() {
+		return nil, OnlyMsg(localFile + " not a file")
+	}
+	return &UploadContent{
+		Name:      stat.Name(),
+		Size:      stat.Size(),
+		ModTime:   stat.ModTime(),
+		LocalFile: localFile,
+	}, nil
+}
+
+// Source names the content in logs: the local file or the stream name.
+func (u *UploadContent) Source() string {
+	if u.LocalFile != "" {
+		return u.LocalFile
+	}
+	return u.Name
+}
+
+// Hash returns the hash named key, computing it from the local file when it
+// is not known. The hash of a stream must be known up front.
+func (u *UploadContent) Hash(key string) (string, error) {
+	if h := u.Hashes[key]; h != "" {
+		return h, nil
+	}
+	if u.LocalFile == "" {
+		return "", OnlyMsg("unknown " + key + " of stream " + u.Name)
+	}
+	switch key {
+	case HashMd5:
+		return internal.GetFileMd5(u.LocalFile)
+	case HashSha1:
+		return internal.GetFileSha1(u.LocalFile)
+	case HashGcid:
+		return internal.GetFileGcid(u.LocalFile)
+	default:
+		return "", KindMsg(ErrUnsupported, "not support hash "+key)
+	}
+}
+
+// Open returns a reader over the whole content.
+func (u *UploadContent) Open() (io.ReadCloser, error) {
+	if u.LocalFile != "" {
+		return os.Open(u.LocalFile)
+	}
+	return io.NopCloser(u.Reader), nil
+}
+
+// NewProgressReader returns a chunked ProgressReader starting after uploaded
+// bytes. A stream can not skip data, so uploaded must be 0 for it.
+func (u *UploadContent) NewProgressReader(chunkSize, uploaded int64, progressCb ...ProgressCallback) (*ProgressReader, DriverErrorInterface) {
+	if u.LocalFile != "" {
+		return NewProcessReader(u.LocalFile, chunkSize, uploaded, progressCb...)
+	}
+	if uploaded > 0 {
+		return nil, KindMsg(ErrUnsupported, "stream "+u.Name+" can not resume")
+	}
+	return NewStreamProgressReader(u.Reader, u.Name, u.Size, chunkSize, progressCb...), nil
+}
+
+// UploadContentFunc uploads content as described by req; req.LocalFile is
+// empty when content is a stream.
+type UploadContentFunc func(req UploadFileReq, content *UploadContent) (*TransferResult, error)
+
+// BaseUploadStream uploads req.Reader through upload. The stream is passed on
+// directly when its size and every hash in needHashes are known; otherwise it
+// is first written to a temporary file under DownloadConfig.TmpPath, which is
+// removed afterwards, so the size is known and the hashes can be computed.
+func (b *BaseOperate) BaseUploadStream(ctx context.Context, req UploadStreamReq, needHashes []string, upload UploadContentFunc) (*TransferResult, error) {
+	if req.Reader == nil {
+		return nil, OnlyMsg("upload stream without reader")
+	}
+	if req.Name == "" {
+		return nil, OnlyMsg("upload stream without name")
+	}
+	fileReq := UploadFileReq{
+		RemotePath:       req.RemotePath,
+		OnlyFast:         req.OnlyFast,
+		TaskId:           req.TaskId,
+		Ctx:              ctx,
+		ProgressCallback: req.ProgressCallback,
+	}
+	content := &UploadContent{
+		Name:    req.Name,
+		Size:    req.Size,
+		ModTime: time.Now(),
+		Reader:  &ctxReader{ctx: ctx, r: req.Reader},
+		Hashes:  req.KnownHashes,
+	}
+	// 大小未知时先落盘：各网盘创建上传任务时都要给出文件大小
+	spool := req.Size <= 0
+	for _, key := range needHashes {
+		if req.KnownHashes[key] == "" {
+			spool = true
+		}
+	}
+	if !spool {
+		return upload(fileReq, content)
+	}
+	tmpFile, err := b.spool(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmpFile)
+	stat, err := os.Stat(tmpFile)
+	if err != nil {
+		return nil, OnlyError(err)
+	}
+	content.Size = stat.Size()
+	content.LocalFile = tmpFile
+	content.Reader = nil
+	if req.Size > 0 && content.Size != req.Size {
+		return nil, OnlyMsg("stream " + req.Name + " size mismatch")
+	}
+	return upload(fileReq, content)
+}
+
+// spool 把数据流写入临时文件
+func (b *BaseOperate) spool(ctx context.Context, req UploadStreamReq) (string, error) {
+	dir := b.DownloadConfig.TmpPath
+	if dir != "" {
+		if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+			return "", OnlyError(err)
+		}
+	}
+	file, err := os.CreateTemp(dir, "pan-stream-*"+filepath.Ext(req.Name))
+	if err != nil {
+		return "", OnlyError(err)
+	}
+	_, err = io.Copy(file, &ctxReader{ctx: ctx, r: req.Reader})
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(file.Name())
+		return "", OnlyError(err)
+	}
+	internal.GetLogger().Debug("spooled stream", "name", req.Name, "file", file.Name())
+	return file.Name(), nil
+}
+
+// streamHashes 返回 obj 已知的哈希，并补齐 needHashes 中缺少的哈希：读取一遍
+// reader 计算后回到开头，避免把数据流写入临时文件
+func streamHashes(reader io.ReadSeeker, obj *PanObj, needHashes []string) (map[string]string, error) {
+	hashes := make(map[string]string, len(obj.Hashes)+len(needHashes))
+	for k, v := range obj.Hashes {
+		hashes[k] = v
+	}
+	hashers := make(map[string]hash.Hash)
+	writers := make([]io.Writer, 0)
+	for _, key := range needHashes {
+		if hashes[key] != "" {
+			continue
+		}
+		var h hash.Hash
+		switch key {
+		case HashMd5:
+			h = md5.New()
+		case HashSha1:
+			h = sha1.New()
+		case HashGcid:
+			h = internal.NewGcid(obj.Size)
+		default:
+			return nil, KindMsg(ErrUnsupported, "not support hash "+key)
+		}
+		hashers[key] = h
+		writers = append(writers, h)
+	}
+	if len(hashers) == 0 {
+		return hashes, nil
+	}
+	n, err := io.CopyBuffer(io.MultiWriter(writers...), reader, make([]byte, 1024*1024))
+	if err != nil {
+		return nil, OnlyError(err)
+	}
+	if n != obj.Size {
+		return nil, OnlyMsg("stream " + obj.Name + " size mismatch")
+	}
+	if _, err = reader.Seek(0, io.SeekStart); err != nil {
+		return nil, OnlyError(err)
+	}
+	for key, h := range hashers {
+		hashes[key] = hex.EncodeToString(h.Sum(nil))
+	}
+	return hashes, nil
+}
+
+// ctxReader 在 ctx 结束后停止读取
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r *ctxReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
@@ -0,0 +1,446 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hefeiyu25/pan-client/internal"
+	"github.com/hefeiyu25/pan-client/pan"
+)
+
+// ConflictPolicy decides what Bisync does with a file changed on both sides.
+type ConflictPolicy string
+
+const (
+	ConflictNewer    ConflictPolicy = "newer"     // 修改时间较新的一侧覆盖另一侧
+	ConflictKeepBoth ConflictPolicy = "keep-both" // 本地版本加后缀另存，两侧都保留两个版本
+	ConflictManual   ConflictPolicy = "manual"    // 不处理，记录冲突等待人工解决
+)
+
+// DefaultConflictSuffix is inserted before the extension of the local
+// version of a conflicting file under ConflictKeepBoth.
+const DefaultConflictSuffix = ".conflict"
+
+// BisyncOptions controls a two-way sync.
+type BisyncOptions struct {
+	LocalPath  string // 本地目录
+	RemotePath string // 网盘目录完整路径
+	// 状态文件，默认为本地目录下的 DefaultStateFile
+	StateFile string
+	// 冲突处理策略，默认 ConflictManual
+	Conflict       ConflictPolicy
+	ConflictSuffix string // 默认 DefaultConflictSuffix
+	DryRun         bool   // 只生成计划，不执行也不更新状态
+	// 同时传输的文件数，默认 1
+	Concurrency int
+	// 修改时间相差不超过该值时视为相同，默认 DefaultModifyWindow
+	ModifyWindow     time.Duration
+	TaskId           string // 调用方传入的任务 ID（可选），回调中会包含
+	ProgressCallback pan.ProgressCallback
+}
+
+// Conflict is a path changed on both sides since the last sync.
+type Conflict struct {
+	Path       string `json:"path"`
+	Resolution string `json:"resolution"` // local wins、remote wins、kept both as <路径>、manual、type differs
+	Local      *Entry `json:"-"`
+	Remote     *Entry `json:"-"`
+}
+
+// BisyncPlan is the result of comparing both trees with the last-synced
+// snapshot: an upload plan, a download plan and the conflicts found.
+type BisyncPlan struct {
+	Upload    *Plan
+	Download  *Plan
+	Conflicts []*Conflict
+
+	driver    pan.Driver
+	opts      BisyncOptions
+	stateFile string
+	state     *State
+	renames   [][2]string // keep-both 时本地文件的重命名，相对路径
+	pinned    []string    // 本次不更新状态的路径
+}
+
+// BisyncResult reports what Bisync did in each direction.
+type BisyncResult struct {
+	Upload    *Summary    `json:"upload"`   // 本地 -> 网盘
+	Download  *Summary    `json:"download"` // 网盘 -> 本地
+	Conflicts []*Conflict `json:"conflicts"`
+}
+
+// Bisync syncs LocalPath and RemotePath in both directions and records the
+// result in the state file. With DryRun the plan is only logged.
+func Bisync(ctx context.Context, driver pan.Driver, opts BisyncOptions) (*BisyncResult, error) {
+	plan, err := NewBisyncPlan(ctx, driver, opts)
+	if err != nil {
+		return nil, err
+	}
+	if opts.DryRun {
+		for _, p := range []*Plan{plan.Upload, plan.Download} {
+			for _, action := range p.Actions {
+				internal.GetLogger().Info("bisync dry run", "direction", p.opts.Direction, "action", action.Type, "path", action.Path, "reason", action.Reason)
+			}
+		}
+		return plan.Result(), nil
+	}
+	return plan.Execute(ctx)
+}
+
+// NewBisyncPlan scans both trees and compares each with the snapshot in the
+// state file. A change on one side, including a delete, is applied to the
+// other; a change wins over a delete on the other side. Files added or
+// modified on both sides are left alone when they match by size and, if the
+// drive reports one, hash; otherwise they are conflicts resolved by
+// opts.Conflict. A directory is deleted only when nothing below it changed.
+// Without a state file every file missing on one side is copied to it and
+// nothing is deleted.
+func NewBisyncPlan(ctx context.Context, driver pan.Driver, opts BisyncOptions) (*BisyncPlan, error) {
+	if opts.LocalPath == "" {
+		return nil, pan.OnlyMsg("bisync without local path")
+	}
+	switch opts.Conflict {
+	case "":
+		opts.Conflict = ConflictManual
+	case ConflictNewer, ConflictKeepBoth, ConflictManual:
+	default:
+		return nil, pan.OnlyMsg("unknown conflict policy " + string(opts.Conflict))
+	}
+	if opts.ConflictSuffix == "" {
+		opts.ConflictSuffix = DefaultConflictSuffix
+	}
+	remote := path.Clean("/" + strings.Trim(opts.RemotePath, "/"))
+	stateFile := opts.StateFile
+	if stateFile == "" {
+		stateFile = filepath.Join(opts.LocalPath, DefaultStateFile)
+	}
+	state, err := LoadState(stateFile, remote)
+	if err != nil {
+		return nil, err
+	}
+	localEntries, localExist, err := ScanLocal(ctx, opts.LocalPath)
+	if err != nil {
+		return nil, err
+	}
+	if !localExist {
+		return nil, pan.KindMsg(pan.ErrNotFound, opts.LocalPath+" not found")
+	}
+	remoteEntries, remoteExist, err := ScanRemote(ctx, driver, remote)
+	if err != nil {
+		return nil, err
+	}
+	if !remoteExist {
+		return nil, pan.KindMsg(pan.ErrNotFound, remote+" not found")
+	}
+	oneWay := func(direction Direction) *Plan {
+		return &Plan{
+			driver: driver,
+			opts: Options{
+				Direction:        direction,
+				Concurrency:      opts.Concurrency,
+				ModifyWindow:     opts.ModifyWindow,
+				TaskId:           opts.TaskId,
+				ProgressCallback: opts.ProgressCallback,
+			},
+			local:  opts.LocalPath,
+			remote: remote,
+		}
+	}
+	b := &BisyncPlan{
+		Upload:    oneWay(Upload),
+		Download:  oneWay(Download),
+		Conflicts: make([]*Conflict, 0),
+		driver:    driver,
+		opts:      opts,
+		stateFile: stateFile,
+		state:     state,
+	}
+	if err = b.compare(localEntries, remoteEntries); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// bisyncActions 一个方向的动作
+type bisyncActions struct {
+	mkdirs, transfers, deletes []*Action
+}
+
+func (b *BisyncPlan) compare(localEntries, remoteEntries []*Entry) error {
+	window := b.Upload.opts.modifyWindow()
+	local := make(map[string]*Entry, len(localEntries))
+	for _, e := range localEntries {
+		local[e.Path] = e
+	}
+	remote := make(map[string]*Entry, len(remoteEntries))
+	for _, e := range remoteEntries {
+		remote[e.Path] = e
+	}
+	paths := make([]string, 0, len(local)+len(remote))
+	for _, m := range []map[string]*Entry{local, remote} {
+		for p := range m {
+			paths = append(paths, p)
+		}
+	}
+	for _, m := range []map[string]*StateEntry{b.state.Local, b.state.Remote} {
+		for p := range m {
+			paths = append(paths, p)
+		}
+	}
+	slices.Sort(paths)
+	paths = slices.Compact(paths)
+
+	var up, down bisyncActions
+	// 一侧删除、另一侧未变化的目录，候选删除
+	var dirDeletes []*Action
+	blocked := make([]string, 0)
+	for _, p := range paths {
+		lc, rc := local[p], remote[p]
+		if lc == nil && rc == nil {
+			continue
+		}
+		if under(p, blocked) {
+			b.pinned = append(b.pinned, p)
+			continue
+		}
+		lch := changeOf(lc, b.state.Local[p], window)
+		rch := changeOf(rc, b.state.Remote[p], window)
+		if lc != nil && rc != nil && lc.IsDir != rc.IsDir {
+			b.conflict(p, lc, rc, "type differs")
+			blocked = append(blocked, p)
+			continue
+		}
+		if (lc != nil && lc.IsDir) || (rc != nil && rc.IsDir) {
+			switch {
+			case lc != nil && rc != nil:
+			case lc != nil && rch == removed && lch == unchanged:
+				dirDeletes = append(dirDeletes, &Action{Type: ActionDelete, Path: p, Reason: "deleted on remote", Dst: lc})
+			case lc != nil:
+				up.mkdirs = append(up.mkdirs, &Action{Type: ActionMkdir, Path: p, Reason: "new", Src: lc})
+			case lch == removed && rch == unchanged:
+				dirDeletes = append(dirDeletes, &Action{Type: ActionDelete, Path: p, Reason: "deleted on local", Dst: rc})
+			default:
+				down.mkdirs = append(down.mkdirs, &Action{Type: ActionMkdir, Path: p, Reason: "new", Src: rc})
+			}
+			continue
+		}
+		switch {
+		case rc == nil && rch == removed && lch == unchanged:
+			down.deletes = append(down.deletes, &Action{Type: ActionDelete, Path: p, Reason: "deleted on remote", Dst: lc})
+		case rc == nil:
+			up.transfers = append(up.transfers, &Action{Type: ActionUpload, Path: p, Reason: reasonOf(lch), Src: lc})
+		case lc == nil && lch == removed && rch == unchanged:
+			up.deletes = append(up.deletes, &Action{Type: ActionDelete, Path: p, Reason: "deleted on local", Dst: rc})
+		case lc == nil:
+			down.transfers = append(down.transfers, &Action{Type: ActionDownload, Path: p, Reason: reasonOf(rch), Src: rc})
+		case lch == unchanged && rch == unchanged:
+		case rch == unchanged:
+			up.transfers = append(up.transfers, &Action{Type: ActionUpload, Path: p, Reason: reasonOf(lch), Src: lc, Dst: rc})
+		case lch == unchanged:
+			down.transfers = append(down.transfers, &Action{Type: ActionDownload, Path: p, Reason: reasonOf(rch), Src: rc, Dst: lc})
+		default:
+			same, err := b.same(lc, rc)
+			if err != nil {
+				return err
+			}
+			if !same {
+				b.resolve(p, lc, rc, local, remote, &up, &down)
+			}
+		}
+	}
+	b.checkDirDeletes(dirDeletes, local, remote, &up, &down)
+
+	for _, x := range []struct {
+		plan    *Plan
+		actions bisyncActions
+	}{{b.Upload, up}, {b.Download, down}} {
+		slices.SortFunc(x.actions.mkdirs, func(a, b *Action) int { return strings.Compare(a.Path, b.Path) })
+		x.plan.Actions = append(x.plan.Actions, x.actions.mkdirs...)
+		x.plan.Actions = append(x.plan.Actions, x.actions.transfers...)
+		x.plan.Actions = append(x.plan.Actions, sortDeletes(x.actions.deletes)...)
+	}
+	return nil
+}
+
+// same 两侧都有变化的文件内容是否一致，网盘没有可比较的哈希时只比较大小
+func (b *BisyncPlan) same(lc, rc *Entry) (bool, error) {
+	if lc.Size != rc.Size {
+		return false, nil
+	}
+	equal, ok, err := compareHash(b.Upload.localFile(lc.Path), rc)
+	if err != nil {
+		return false, err
+	}
+	return !ok || equal, nil
+}
+
+// resolve 按策略处理两侧都有修改的文件
+func (b *BisyncPlan) resolve(p string, lc, rc *Entry, local, remote map[string]*Entry, up, down *bisyncActions) {
+	switch b.opts.Conflict {
+	case ConflictNewer:
+		if rc.ModTime.After(lc.ModTime) {
+			b.conflict(p, lc, rc, "remote wins")
+			down.transfers = append(down.transfers, &Action{Type: ActionDownload, Path: p, Reason: "conflict, remote newer", Src: rc, Dst: lc})
+		} else {
+			b.conflict(p, lc, rc, "local wins")
+			up.transfers = append(up.transfers, &Action{Type: ActionUpload, Path: p, Reason: "conflict, local newer", Src: lc, Dst: rc})
+		}
+	case ConflictKeepBoth:
+		renamed := conflictName(p, b.opts.ConflictSuffix, local, remote)
+		b.renames = append(b.renames, [2]string{p, renamed})
+		b.conflict(p, lc, rc, "kept both as "+renamed)
+		moved := *lc
+		moved.Path = renamed
+		up.transfers = append(up.transfers, &Action{Type: ActionUpload, Path: renamed, Reason: "conflict, local version", Src: &moved})
+		down.transfers = append(down.transfers, &Action{Type: ActionDownload, Path: p, Reason: "conflict, remote version", Src: rc})
+	default:
+		b.conflict(p, lc, rc, "manual")
+	}
+}
+
+// conflict 记录冲突，只有两侧都已一致的冲突才会更新状态
+func (b *BisyncPlan) conflict(p string, lc, rc *Entry, resolution string) {
+	internal.GetLogger().Warn("bisync conflict", "path", p, "resolution", resolution)
+	b.Conflicts = append(b.Conflicts, &Conflict{Path: p, Resolution: resolution, Local: lc, Remote: rc})
+	if resolution == "manual" || resolution == "type differs" {
+		b.pinned = append(b.pinned, p)
+	}
+}
+
+// checkDirDeletes 目录下仍有保留的对象时改为在另一侧重新创建目录，否则整个删除
+func (b *BisyncPlan) checkDirDeletes(dirDeletes []*Action, local, remote map[string]*Entry, up, down *bisyncActions) {
+	// 从深到浅处理，子目录无法删除时父目录也无法删除
+	sortDeletes(dirDeletes)
+	deleting := make(map[string]bool)
+	for _, action := range append(up.deletes, down.deletes...) {
+		deleting[action.Dst.Path] = true
+	}
+	var accepted []string
+	for _, dir := range dirDeletes {
+		side, actions, other, kept := remote, up, down, "kept on remote"
+		if dir.Reason == "deleted on remote" {
+			side, actions, other, kept = local, down, up, "kept on local"
+		}
+		keep := false
+		for p := range side {
+			if strings.HasPrefix(p, dir.Path+"/") && !deleting[p] {
+				keep = true
+				break
+			}
+		}
+		if keep {
+			other.mkdirs = append(other.mkdirs, &Action{Type: ActionMkdir, Path: dir.Path, Reason: kept, Src: dir.Dst})
+			continue
+		}
+		deleting[dir.Path] = true
+		accepted = append(accepted, dir.Path)
+		actions.deletes = append(actions.deletes, dir)
+	}
+	// 整个删除的目录不再单独删除其下的对象
+	for _, actions := range []*bisyncActions{up, down} {
+		actions.deletes = slices.DeleteFunc(actions.deletes, func(action *Action) bool {
+			return under(action.Path, accepted)
+		})
+	}
+}
+
+// conflictName 在扩展名前插入后缀，避开两侧已有的名称
+func conflictName(p, suffix string, local, remote map[string]*Entry) string {
+	ext := path.Ext(p)
+	stem := strings.TrimSuffix(p, ext)
+	name := stem + suffix + ext
+	for i := 1; local[name] != nil || remote[name] != nil; i++ {
+		name = stem + suffix + strconv.Itoa(i) + ext
+	}
+	return name
+}
+
+func reasonOf(c change) string {
+	switch c {
+	case added:
+		return "new"
+	case modified:
+		return "modified"
+	default:
+		return "missing"
+	}
+}
+
+// Result counts the actions of the plan.
+func (b *BisyncPlan) Result() *BisyncResult {
+	return &BisyncResult{Upload: b.Upload.Summary(), Download: b.Download.Summary(), Conflicts: b.Conflicts}
+}
+
+// Execute renames the local versions of keep-both conflicts, runs the upload
+// plan and then the download plan, and saves a new snapshot of both trees to
+// the state file. Paths that failed or hold an unresolved conflict keep
+// their previous state, so the next Bisync sees them as changed again. The
+// state is not saved when ctx is done.
+func (b *BisyncPlan) Execute(ctx context.Context) (*BisyncResult, error) {
+	var errs []error
+	for _, rename := range b.renames {
+		from, to := b.Upload.localFile(rename[0]), b.Upload.localFile(rename[1])
+		if err := os.Rename(from, to); err != nil {
+			errs = append(errs, pan.MsgError("bisync rename "+rename[0]+" error", err))
+			b.pinned = append(b.pinned, rename[0], rename[1])
+			drop := func(action *Action) bool { return action.Path == rename[0] || action.Path == rename[1] }
+			b.Upload.Actions = slices.DeleteFunc(b.Upload.Actions, drop)
+			b.Download.Actions = slices.DeleteFunc(b.Download.Actions, drop)
+		}
+	}
+	result := &BisyncResult{Conflicts: b.Conflicts}
+	var err error
+	result.Upload, err = b.Upload.Execute(ctx)
+	if err != nil {
+		errs = append(errs, err)
+	}
+	if ctx.Err() != nil {
+		return result, ctx.Err()
+	}
+	result.Download, err = b.Download.Execute(ctx)
+	if err != nil {
+		errs = append(errs, err)
+	}
+	if ctx.Err() != nil {
+		return result, ctx.Err()
+	}
+	b.pinned = append(b.pinned, result.Upload.FailedPaths...)
+	b.pinned = append(b.pinned, result.Download.FailedPaths...)
+	if err = b.saveState(ctx); err != nil {
+		errs = append(errs, err)
+	}
+	return result, errors.Join(errs...)
+}
+
+// saveState 重新扫描两侧并保存状态，pinned 中的路径保留上次的状态
+func (b *BisyncPlan) saveState(ctx context.Context) error {
+	localEntries, _, err := ScanLocal(ctx, b.Upload.local)
+	if err != nil {
+		return err
+	}
+	remoteEntries, _, err := ScanRemote(ctx, b.driver, b.Upload.remote)
+	if err != nil {
+		return err
+	}
+	state := newState(b.Upload.remote)
+	state.SyncTime = time.Now()
+	state.Local = snapshot(localEntries)
+	state.Remote = snapshot(remoteEntries)
+	for _, p := range b.pinned {
+		for _, x := range []struct{ cur, old map[string]*StateEntry }{{state.Local, b.state.Local}, {state.Remote, b.state.Remote}} {
+			if old := x.old[p]; old != nil {
+				x.cur[p] = old
+			} else {
+				delete(x.cur, p)
+			}
+		}
+	}
+	return state.Save(b.stateFile)
+}
@@ -0,0 +1,186 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path"
+	"path/filepath"
+	gosync "sync"
+
+	"github.com/hefeiyu25/pan-client/internal"
+	"github.com/hefeiyu25/pan-client/pan"
+)
+
+// Execute carries out the plan. Directories are created first, files are
+// then transferred Concurrency at a time and extraneous objects are deleted
+// last. A failed action is logged and counted and does not stop the others;
+// the errors of all failed actions are returned joined. A changed file is
+// replaced only once its new version is fully transferred: uploads go to a
+// temporary name next to the remote file and downloads to a temporary
+// directory next to the local file.
+func (p *Plan) Execute(ctx context.Context) (*Summary, error) {
+	summary := &Summary{}
+	var errs []error
+	var mu gosync.Mutex
+	done := func(action *Action, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if err == nil {
+			summary.add(action)
+			return
+		}
+		internal.GetLogger().Error("sync fail", "action", action.Type, "path", action.Path, "error", err)
+		summary.Failed++
+		summary.FailedPaths = append(summary.FailedPaths, action.Path)
+		errs = append(errs, pan.MsgError("sync "+string(action.Type)+" "+action.Path+" error", err))
+	}
+	var transfers, deletes []*Action
+	for _, action := range p.Actions {
+		switch action.Type {
+		case ActionMkdir:
+			if err := ctx.Err(); err != nil {
+				return summary, err
+			}
+			done(action, p.mkdir(ctx, action))
+		case ActionDelete:
+			deletes = append(deletes, action)
+		default:
+			transfers = append(transfers, action)
+		}
+	}
+
+	queue := make(chan *Action)
+	var wg gosync.WaitGroup
+	for i := 0; i < max(p.opts.Concurrency, 1); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for action := range queue {
+				done(action, p.transfer(ctx, action))
+			}
+		}()
+	}
+feed:
+	for _, action := range transfers {
+		select {
+		case queue <- action:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(queue)
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		return summary, err
+	}
+
+	for _, action := range deletes {
+		if err := ctx.Err(); err != nil {
+			return summary, err
+		}
+		done(action, p.delete(ctx, action))
+	}
+	return summary, errors.Join(errs...)
+}
+
+func (p *Plan) mkdir(ctx context.Context, action *Action) error {
+	if p.opts.Direction == Download {
+		if err := os.MkdirAll(p.localFile(action.Path), os.ModePerm); err != nil {
+			return pan.OnlyError(err)
+		}
+		return nil
+	}
+	dir := p.remoteFile(action.Path)
+	if dir == "/" {
+		return nil
+	}
+	_, err := p.driver.MkdirCtx(ctx, pan.MkdirReq{NewPath: dir[1:]})
+	return err
+}
+
+func (p *Plan) transfer(ctx context.Context, action *Action) error {
+	switch action.Type {
+	case ActionUpload:
+		return p.upload(ctx, action)
+	case ActionDownload:
+		return p.download(ctx, action)
+	default:
+		return nil
+	}
+}
+
+func (p *Plan) upload(ctx context.Context, action *Action) error {
+	remoteFile := p.remoteFile(action.Path)
+	req := pan.UploadFileReq{
+		LocalFile:        p.localFile(action.Path),
+		RemotePath:       path.Dir(remoteFile),
+		TaskId:           p.opts.TaskId,
+		Ctx:              ctx,
+		ProgressCallback: p.opts.ProgressCallback,
+	}
+	if action.Dst == nil {
+		_, err := p.driver.UploadFileCtx(ctx, req)
+		return err
+	}
+	// 网盘上已有旧版本时先上传到同目录的临时文件，成功后再删除旧版本并改名。
+	// 有的网盘删除即彻底删除，上传失败或取消时旧版本必须保留
+	tmpName := tmpPrefix + path.Base(remoteFile)
+	req.RemoteNameTransfer = func(string) string {
+		return tmpName
+	}
+	if _, err := p.driver.UploadFileCtx(ctx, req); err != nil {
+		return err
+	}
+	tmp, err := p.driver.StatCtx(ctx, pan.StatReq{Path: path.Join(req.RemotePath, tmpName), Reload: true})
+	if err != nil {
+		return err
+	}
+	if err = p.driver.DeleteCtx(ctx, pan.DeleteReq{Items: []*pan.PanObj{action.Dst.Obj}}); err != nil {
+		_ = p.driver.DeleteCtx(ctx, pan.DeleteReq{Items: []*pan.PanObj{tmp}})
+		return err
+	}
+	// 改名失败时新版本留在临时文件中，下次同步重新上传
+	return p.driver.ObjRenameCtx(ctx, pan.ObjRenameReq{Obj: tmp, NewName: path.Base(remoteFile)})
+}
+
+func (p *Plan) download(ctx context.Context, action *Action) error {
+	target := p.localFile(action.Path)
+	// 先下载到同目录的临时目录，完成后替换，失败时不影响旧文件
+	tmpDir, err := os.MkdirTemp(filepath.Dir(target), tmpPrefix+"*")
+	if err != nil {
+		return pan.OnlyError(err)
+	}
+	defer os.RemoveAll(tmpDir)
+	obj := action.Src.Obj
+	_, err = p.driver.DownloadFileCtx(ctx, pan.DownloadFileReq{
+		RemoteFile:       obj,
+		LocalPath:        tmpDir,
+		TaskId:           p.opts.TaskId,
+		Ctx:              ctx,
+		ProgressCallback: p.opts.ProgressCallback,
+	})
+	if err != nil {
+		return err
+	}
+	if err = os.Rename(filepath.Join(tmpDir, obj.Name), target); err != nil {
+		return pan.OnlyError(err)
+	}
+	if !obj.ModTime.IsZero() {
+		// 保留网盘的修改时间，下次同步时据此判断
+		if err = os.Chtimes(target, obj.ModTime, obj.ModTime); err != nil {
+			return pan.OnlyError(err)
+		}
+	}
+	return nil
+}
+
+func (p *Plan) delete(ctx context.Context, action *Action) error {
+	if p.opts.Direction == Download {
+		if err := os.RemoveAll(p.localFile(action.Path)); err != nil {
+			return pan.OnlyError(err)
+		}
+		return nil
+	}
+	return p.driver.DeleteCtx(ctx, pan.DeleteReq{Items: []*pan.PanObj{action.Dst.Obj}})
+}
@@ -0,0 +1,279 @@
+package sync
+
+import (
+	"context"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/hefeiyu25/pan-client/pan"
+)
+
+// ActionType is what a plan does with one path.
+type ActionType string
+
+const (
+	ActionMkdir    ActionType = "mkdir"    // 在目标创建目录
+	ActionUpload   ActionType = "upload"   // 上传本地文件
+	ActionDownload ActionType = "download" // 下载网盘文件
+	ActionDelete   ActionType = "delete"   // 删除目标中多余的对象
+	ActionSkip     ActionType = "skip"     // 不处理
+)
+
+// Action is one step of a Plan.
+type Action struct {
+	Type   ActionType `json:"type"`
+	Path   string     `json:"path"`   // 相对同步根目录的路径
+	Reason string     `json:"reason"` // 如 new、size differs、hash equal
+	Src    *Entry     `json:"-"`      // 源对象，删除时为 nil
+	Dst    *Entry     `json:"-"`      // 目标中的对象，不存在时为 nil
+}
+
+// Plan is the result of comparing both trees. Actions are ordered: directories
+// to create, then transfers and skips, then deletes with the deepest first.
+type Plan struct {
+	Actions []*Action
+
+	driver pan.Driver
+	opts   Options
+	local  string // 本地根目录
+	remote string // 网盘根目录完整路径
+}
+
+// Summary counts the actions of a plan; after Execute it counts the actions
+// that succeeded.
+type Summary struct {
+	Mkdirs     int   `json:"mkdirs"`
+	Uploaded   int   `json:"uploaded"`
+	Downloaded int   `json:"downloaded"`
+	Deleted    int   `json:"deleted"`
+	Skipped    int   `json:"skipped"`
+	Failed     int   `json:"failed"` // 执行失败的动作数
+	Bytes      int64 `json:"bytes"`  // 传输的文件字节数
+	// 执行失败的路径
+	FailedPaths []string `json:"failedPaths,omitempty"`
+}
+
+// NewPlan scans both trees and compares them. A file of the source is
+// transferred when the destination lacks it or its size differs. With equal
+// sizes, a source newer than the destination by more than ModifyWindow, or
+// any file when Checksum is set, is compared by hash if the drive reports
+// md5, sha1 or gcid; without a hash the newer source is transferred. Files
+// outside the size and age filters are left alone on both sides.
+func NewPlan(ctx context.Context, driver pan.Driver, opts Options) (*Plan, error) {
+	if opts.Direction != Upload && opts.Direction != Download {
+		return nil, pan.OnlyMsg("unknown sync direction " + string(opts.Direction))
+	}
+	if opts.LocalPath == "" {
+		return nil, pan.OnlyMsg("sync without local path")
+	}
+	p := &Plan{
+		Actions: make([]*Action, 0),
+		driver:  driver,
+		opts:    opts,
+		local:   opts.LocalPath,
+		remote:  path.Clean("/" + strings.Trim(opts.RemotePath, "/")),
+	}
+	localEntries, localExist, err := ScanLocal(ctx, p.local)
+	if err != nil {
+		return nil, err
+	}
+	remoteEntries, remoteExist, err := ScanRemote(ctx, driver, p.remote)
+	if err != nil {
+		return nil, err
+	}
+	src, dst, dstExist := localEntries, remoteEntries, remoteExist
+	if opts.Direction == Download {
+		src, dst, dstExist = remoteEntries, localEntries, localExist
+		if !remoteExist {
+			return nil, pan.KindMsg(pan.ErrNotFound, p.remote+" not found")
+		}
+	} else if !localExist {
+		return nil, pan.KindMsg(pan.ErrNotFound, p.local+" not found")
+	}
+	if !dstExist {
+		p.Actions = append(p.Actions, &Action{Type: ActionMkdir, Reason: "new"})
+	}
+	if err = p.compare(src, dst); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *Plan) compare(src, dst []*Entry) error {
+	now := time.Now()
+	dstMap := make(map[string]*Entry, len(dst))
+	for _, e := range dst {
+		dstMap[e.Path] = e
+	}
+	srcMap := make(map[string]*Entry, len(src))
+	transfer := ActionUpload
+	if p.opts.Direction == Download {
+		transfer = ActionDownload
+	}
+	// 与目标类型不一致而跳过的源目录，其下的对象一并跳过
+	blocked := make([]string, 0)
+	var mkdirs, transfers []*Action
+	for _, s := range src {
+		srcMap[s.Path] = s
+		d := dstMap[s.Path]
+		if under(s.Path, blocked) {
+			transfers = append(transfers, &Action{Type: ActionSkip, Path: s.Path, Reason: "type differs", Src: s, Dst: d})
+			continue
+		}
+		if s.IsDir {
+			switch {
+			case d == nil:
+				mkdirs = append(mkdirs, &Action{Type: ActionMkdir, Path: s.Path, Reason: "new", Src: s})
+			case !d.IsDir:
+				blocked = append(blocked, s.Path)
+				transfers = append(transfers, &Action{Type: ActionSkip, Path: s.Path, Reason: "type differs", Src: s, Dst: d})
+			}
+			continue
+		}
+		action := &Action{Type: ActionSkip, Path: s.Path, Src: s, Dst: d}
+		switch {
+		case !p.opts.included(s, now):
+			action.Reason = "filtered"
+		case d == nil:
+			action.Type, action.Reason = transfer, "new"
+		case d.IsDir:
+			action.Reason = "type differs"
+		default:
+			changed, reason, err := p.changed(s, d)
+			if err != nil {
+				return err
+			}
+			action.Reason = reason
+			if changed {
+				action.Type = transfer
+			}
+		}
+		transfers = append(transfers, action)
+	}
+	p.Actions = append(p.Actions, mkdirs...)
+	p.Actions = append(p.Actions, transfers...)
+	if !p.opts.Delete {
+		return nil
+	}
+	deletes := make([]*Action, 0)
+	deleted := make([]string, 0)
+	for i, d := range dst {
+		if srcMap[d.Path] != nil || under(d.Path, deleted) || !p.opts.included(d, now) {
+			continue
+		}
+		if d.IsDir && !p.allIncluded(dst[i+1:], d.Path, now) {
+			// 目录中有被过滤的文件时只删除其中满足条件的文件
+			continue
+		}
+		deleted = append(deleted, d.Path)
+		deletes = append(deletes, &Action{Type: ActionDelete, Path: d.Path, Reason: "extraneous", Dst: d})
+	}
+	p.Actions = append(p.Actions, sortDeletes(deletes)...)
+	return nil
+}
+
+// sortDeletes 按深度从深到浅排列删除动作
+func sortDeletes(deletes []*Action) []*Action {
+	slices.SortStableFunc(deletes, func(a, b *Action) int {
+		return strings.Count(b.Path, "/") - strings.Count(a.Path, "/")
+	})
+	return deletes
+}
+
+// changed 比较大小相同的源文件和目标文件
+func (p *Plan) changed(s, d *Entry) (bool, string, error) {
+	if s.Size != d.Size {
+		return true, "size differs", nil
+	}
+	srcNewer := newer(s.ModTime, d.ModTime, p.opts.modifyWindow())
+	if !srcNewer && !p.opts.Checksum {
+		return false, "same size", nil
+	}
+	local, remote := s, d
+	if p.opts.Direction == Download {
+		local, remote = d, s
+	}
+	equal, ok, err := compareHash(p.localFile(local.Path), remote)
+	if err != nil {
+		return false, "", err
+	}
+	switch {
+	case ok && equal:
+		return false, "hash equal", nil
+	case ok:
+		return true, "hash differs", nil
+	case srcNewer:
+		return true, "newer", nil
+	default:
+		return false, "same size", nil
+	}
+}
+
+// allIncluded dir 下的文件是否都满足过滤条件，entries 为 dir 之后的有序对象
+func (p *Plan) allIncluded(entries []*Entry, dir string, now time.Time) bool {
+	for _, e := range entries {
+		if !strings.HasPrefix(e.Path, dir+"/") {
+			if e.Path > dir+"/" {
+				break
+			}
+			continue
+		}
+		if !p.opts.included(e, now) {
+			return false
+		}
+	}
+	return true
+}
+
+// Summary counts the actions of the plan.
+func (p *Plan) Summary() *Summary {
+	summary := &Summary{}
+	for _, action := range p.Actions {
+		summary.add(action)
+	}
+	return summary
+}
+
+func (s *Summary) add(action *Action) {
+	switch action.Type {
+	case ActionMkdir:
+		s.Mkdirs++
+	case ActionUpload:
+		s.Uploaded++
+		s.Bytes += action.Src.Size
+	case ActionDownload:
+		s.Downloaded++
+		s.Bytes += action.Src.Size
+	case ActionDelete:
+		s.Deleted++
+	case ActionSkip:
+		s.Skipped++
+	}
+}
+
+func (p *Plan) localFile(rel string) string {
+	return filepath.Join(p.local, filepath.FromSlash(rel))
+}
+
+func (p *Plan) remoteFile(rel string) string {
+	return path.Join(p.remote, rel)
+}
+
+// under path 是否位于 dirs 中某个目录之下
+func under(p string, dirs []string) bool {
+	for _, dir := range dirs {
+		if strings.HasPrefix(p, dir+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+func sortEntries(entries []*Entry) {
+	slices.SortFunc(entries, func(a, b *Entry) int {
+		return strings.Compare(a.Path, b.Path)
+	})
+}
@@ -0,0 +1,138 @@
+package sync
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/hefeiyu25/pan-client/pan"
+)
+
+// DefaultStateFile is the name of the state file Bisync keeps in the local
+// directory when BisyncOptions.StateFile is empty. Its prefix keeps it out
+// of the scans.
+const DefaultStateFile = tmpPrefix + "state.json"
+
+// stateVersion 状态文件格式版本
+const stateVersion = 1
+
+// State is the snapshot of both trees taken after the last successful Bisync.
+type State struct {
+	Version    int                    `json:"version"`
+	RemotePath string                 `json:"remotePath"` // 状态对应的网盘目录，变化时视为首次同步
+	SyncTime   time.Time              `json:"syncTime"`
+	Local      map[string]*StateEntry `json:"local"`  // key 为相对路径
+	Remote     map[string]*StateEntry `json:"remote"` // key 为相对路径
+}
+
+// StateEntry is one object of a State snapshot.
+type StateEntry struct {
+	Size    int64             `json:"size"`
+	ModTime time.Time         `json:"modTime"`
+	IsDir   bool              `json:"isDir,omitempty"`
+	Hashes  map[string]string `json:"hashes,omitempty"`
+}
+
+func newState(remotePath string) *State {
+	return &State{
+		Version:    stateVersion,
+		RemotePath: remotePath,
+		Local:      make(map[string]*StateEntry),
+		Remote:     make(map[string]*StateEntry),
+	}
+}
+
+// LoadState reads the state file. A missing file, or one recorded for
+// another remote directory, yields an empty state, which makes the next
+// Bisync behave like a first run.
+func LoadState(file, remotePath string) (*State, error) {
+	data, err := os.ReadFile(file)
+	if errors.Is(err, fs.ErrNotExist) {
+		return newState(remotePath), nil
+	}
+	if err != nil {
+		return nil, pan.OnlyError(err)
+	}
+	state := newState(remotePath)
+	if err = json.Unmarshal(data, state); err != nil {
+		return nil, pan.MsgError("invalid sync state "+file, err)
+	}
+	if state.Version != stateVersion || state.RemotePath != remotePath {
+		return newState(remotePath), nil
+	}
+	return state, nil
+}
+
+// Save writes the state through a temporary file, so an interrupted write
+// leaves the previous state intact.
+func (s *State) Save(file string) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return pan.OnlyError(err)
+	}
+	if err = os.MkdirAll(filepath.Dir(file), os.ModePerm); err != nil {
+		return pan.OnlyError(err)
+	}
+	tmp := file + ".tmp"
+	if err = os.WriteFile(tmp, data, 0644); err != nil {
+		return pan.OnlyError(err)
+	}
+	if err = os.Rename(tmp, file); err != nil {
+		_ = os.Remove(tmp)
+		return pan.OnlyError(err)
+	}
+	return nil
+}
+
+// snapshot 把扫描结果转换为状态
+func snapshot(entries []*Entry) map[string]*StateEntry {
+	res := make(map[string]*StateEntry, len(entries))
+	for _, e := range entries {
+		res[e.Path] = &StateEntry{Size: e.Size, ModTime: e.ModTime, IsDir: e.IsDir, Hashes: e.Hashes}
+	}
+	return res
+}
+
+// change 对象相对上次同步的变化
+type change int
+
+const (
+	absent    change = iota // 上次和现在都不存在
+	unchanged               // 没有变化
+	added                   // 新增
+	modified                // 修改
+	removed                 // 删除
+)
+
+// changeOf 比较当前对象和上次同步时的状态
+func changeOf(cur *Entry, old *StateEntry, window time.Duration) change {
+	switch {
+	case cur == nil && old == nil:
+		return absent
+	case cur == nil:
+		return removed
+	case old == nil:
+		return added
+	case cur.IsDir != old.IsDir:
+		return modified
+	case cur.IsDir:
+		return unchanged
+	case cur.Size != old.Size:
+		return modified
+	}
+	for _, key := range hashKeys {
+		if cur.Hashes[key] != "" && old.Hashes[key] != "" {
+			if cur.Hashes[key] != old.Hashes[key] {
+				return modified
+			}
+			return unchanged
+		}
+	}
+	if newer(cur.ModTime, old.ModTime, window) || newer(old.ModTime, cur.ModTime, window) {
+		return modified
+	}
+	return unchanged
+}
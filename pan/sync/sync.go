@@ -0,0 +1,257 @@
+// Package sync mirrors a local directory and a directory of a pan.Driver in
+// one direction. Both trees are scanned, compared by size, modification time
+// and, when the drive reports one, hash, and turned into a Plan of uploads,
+// downloads, deletes and skips that can be inspected before it is executed.
+package sync
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/hefeiyu25/pan-client/internal"
+	"github.com/hefeiyu25/pan-client/pan"
+)
+
+// Direction is the direction of a one-way sync.
+type Direction string
+
+const (
+	Upload   Direction = "upload"   // 本地 -> 网盘
+	Download Direction = "download" // 网盘 -> 本地
+)
+
+// DefaultModifyWindow is the modification time difference below which two
+// files are considered equally old.
+const DefaultModifyWindow = time.Second
+
+// tmpPrefix 同步过程中使用的临时文件名前缀，扫描时忽略
+const tmpPrefix = ".pan-sync-"
+
+// Options controls a one-way sync.
+type Options struct {
+	Direction  Direction
+	LocalPath  string // 本地目录
+	RemotePath string // 网盘目录完整路径，如 /backup，不存在时创建
+	DryRun     bool   // 只生成计划，不执行
+	Delete     bool   // 删除目标中源不存在的对象，Cloudreve 等没有回收站的网盘会彻底删除
+	// 同时传输的文件数，默认 1
+	Concurrency int
+	// 文件过滤，不满足条件的文件既不传输也不删除，0 表示不限
+	MinSize int64
+	MaxSize int64
+	MinAge  time.Duration // 修改时间距今至少 MinAge
+	MaxAge  time.Duration // 修改时间距今至多 MaxAge
+	// 总是比较哈希，默认只在源文件较新时比较
+	Checksum bool
+	// 修改时间相差不超过该值时视为相同，默认 DefaultModifyWindow
+	ModifyWindow     time.Duration
+	TaskId           string // 调用方传入的任务 ID（可选），回调中会包含
+	ProgressCallback pan.ProgressCallback
+}
+
+// Entry is a file or directory found by a scan.
+type Entry struct {
+	Path    string // 相对同步根目录的路径，以 / 分隔
+	Size    int64
+	ModTime time.Time
+	IsDir   bool
+	Hashes  map[string]string // 网盘返回的哈希，本地对象为空
+	Obj     *pan.PanObj       // 网盘对象，本地对象为 nil
+}
+
+// Sync builds the plan described by opts and executes it. With DryRun the
+// plan is only logged and the returned summary counts what would be done.
+func Sync(ctx context.Context, driver pan.Driver, opts Options) (*Summary, error) {
+	plan, err := NewPlan(ctx, driver, opts)
+	if err != nil {
+		return nil, err
+	}
+	if opts.DryRun {
+		for _, action := range plan.Actions {
+			internal.GetLogger().Info("sync dry run", "action", action.Type, "path", action.Path, "reason", action.Reason)
+		}
+		return plan.Summary(), nil
+	}
+	return plan.Execute(ctx)
+}
+
+// ScanLocal lists the tree below the local directory root, skipping anything
+// that is not a regular file or directory. A missing root yields no entries
+// and a nil error; the returned bool reports whether root exists. Entries are
+// in lexical order.
+func ScanLocal(ctx context.Context, root string) ([]*Entry, bool, error) {
+	info, err := os.Stat(root)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, pan.OnlyError(err)
+	}
+	if !info.IsDir() {
+		return nil, false, pan.OnlyMsg(root + " not a dir")
+	}
+	entries := make([]*Entry, 0)
+	err = filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+		if p == root {
+			return nil
+		}
+		if strings.HasPrefix(d.Name(), tmpPrefix) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.IsDir() && !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		entry := &Entry{Path: filepath.ToSlash(rel), ModTime: info.ModTime(), IsDir: d.IsDir()}
+		if !entry.IsDir {
+			entry.Size = info.Size()
+		}
+		entries = append(entries, entry)
+		return nil
+	})
+	if err != nil {
+		return nil, true, pan.OnlyError(err)
+	}
+	sortEntries(entries)
+	return entries, true, nil
+}
+
+// ScanRemote lists the tree below the remote directory root, bypassing the
+// directory cache. A missing root yields no entries and a nil error; the
+// returned bool reports whether root exists. Entries are in lexical order.
+func ScanRemote(ctx context.Context, driver pan.Driver, root string) ([]*Entry, bool, error) {
+	root = path.Clean("/" + strings.Trim(root, "/"))
+	var dir *pan.PanObj
+	if root != "/" {
+		obj, err := driver.StatCtx(ctx, pan.StatReq{Path: root, Reload: true})
+		if errors.Is(err, pan.ErrNotFound) {
+			return nil, false, nil
+		}
+		if err != nil {
+			return nil, false, err
+		}
+		if obj.Type != "dir" {
+			return nil, false, pan.OnlyMsg(root + " not a dir")
+		}
+		dir = obj
+	}
+	entries := make([]*Entry, 0)
+	err := pan.Walk(ctx, driver, dir, func(obj *pan.PanObj, err error) error {
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix(obj.Name, tmpPrefix) {
+			if obj.Type == "dir" {
+				return pan.SkipDir
+			}
+			return nil
+		}
+		rel := strings.TrimPrefix(strings.TrimPrefix(path.Join(obj.Path, obj.Name), root), "/")
+		entries = append(entries, &Entry{
+			Path:    rel,
+			Size:    obj.Size,
+			ModTime: obj.ModTime,
+			IsDir:   obj.Type == "dir",
+			Hashes:  obj.Hashes,
+			Obj:     obj,
+		})
+		return nil
+	}, pan.WalkOptions{Concurrency: pan.DefaultWalkConcurrency, Reload: true})
+	if err != nil {
+		return nil, true, err
+	}
+	sortEntries(entries)
+	return entries, true, nil
+}
+
+// included 文件是否满足大小和时间过滤条件，目录总是满足
+func (o Options) included(e *Entry, now time.Time) bool {
+	if e.IsDir {
+		return true
+	}
+	if o.MinSize > 0 && e.Size < o.MinSize {
+		return false
+	}
+	if o.MaxSize > 0 && e.Size > o.MaxSize {
+		return false
+	}
+	if e.ModTime.IsZero() {
+		return true
+	}
+	age := now.Sub(e.ModTime)
+	if o.MinAge > 0 && age < o.MinAge {
+		return false
+	}
+	if o.MaxAge > 0 && age > o.MaxAge {
+		return false
+	}
+	return true
+}
+
+func (o Options) modifyWindow() time.Duration {
+	if o.ModifyWindow > 0 {
+		return o.ModifyWindow
+	}
+	return DefaultModifyWindow
+}
+
+// hashKeys 按优先级比较的哈希
+var hashKeys = []string{pan.HashMd5, pan.HashSha1, pan.HashGcid}
+
+// localHash 计算本地文件的哈希
+func localHash(file, key string) (string, error) {
+	switch key {
+	case pan.HashMd5:
+		return internal.GetFileMd5(file)
+	case pan.HashSha1:
+		return internal.GetFileSha1(file)
+	default:
+		return internal.GetFileGcid(file)
+	}
+}
+
+// compareHash 比较本地文件与网盘对象的哈希，网盘没有可比较的哈希时 ok 为 false
+func compareHash(localFile string, remote *Entry) (equal, ok bool, err error) {
+	for _, key := range hashKeys {
+		want := remote.Hashes[key]
+		if want == "" {
+			continue
+		}
+		got, err := localHash(localFile, key)
+		if err != nil {
+			return false, true, pan.OnlyError(err)
+		}
+		return strings.EqualFold(got, want), true, nil
+	}
+	return false, false, nil
+}
+
+// newer 两个修改时间都已知且 a 比 b 新出 window 以上
+func newer(a, b time.Time, window time.Duration) bool {
+	if a.IsZero() || b.IsZero() {
+		return false
+	}
+	return a.Sub(b) > window
+}
@@ -0,0 +1,328 @@
+package pan
+
+import (
+	"context"
+	"errors"
+	"io"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hefeiyu25/pan-client/internal"
+)
+
+// TransferOptions controls Transfer.
+type TransferOptions struct {
+	Concurrency      int    // 同时传输的文件数，默认 1
+	SkipFileErr      bool   // 单个文件失败时记录日志并继续
+	TaskId           string // 调用方传入的任务 ID（可选），回调中会包含
+	ProgressCallback ProgressCallback
+}
+
+// TransferSummary reports what Transfer did.
+type TransferSummary struct {
+	Files   int   `json:"files"`   // 上传的文件数
+	Fast    int   `json:"fast"`    // 其中通过秒传完成、未读取源文件的文件数
+	Skipped int   `json:"skipped"` // 目标已存在大小和哈希一致的文件而跳过的文件数
+	Failed  int   `json:"failed"`  // SkipFileErr 时失败的文件数
+	Bytes   int64 `json:"bytes"`   // 从源读取的字节数
+}
+
+// Transfer copies srcObj, a file or a directory tree of src, into the
+// directory dstPath of dst, which may be another account or another driver.
+// Bytes are streamed from src.Open into dst.UploadStream without local
+// staging unless dst needs hashes src does not report. The hashes src lists
+// are handed to dst first and the source is only opened once dst asks for
+// the content, so a successful fast upload reads nothing. Files already
+// present in dst with the same size, and the same hash when both sides
+// report a common one, are skipped, which makes an interrupted Transfer
+// resumable by running it again. Resume works per whole file: a file
+// interrupted mid-way is uploaded again from the start. A differing file in
+// dst is replaced only after the new one is uploaded. Progress events cover the whole
+// transfer, Operated and TotalSize count bytes of all files, and the
+// callback is never called concurrently.
+func Transfer(ctx context.Context, src Driver, srcObj *PanObj, dst Driver, dstPath string, opts TransferOptions) (*TransferSummary, error) {
+	if srcObj == nil {
+		return nil, OnlyMsg("transfer without source")
+	}
+	t := &transfer{
+		ctx:     ctx,
+		src:     src,
+		dst:     dst,
+		opts:    opts,
+		summary: &TransferSummary{},
+		current: make(map[string]int64),
+		start:   time.Now(),
+	}
+	dstPath = path.Clean("/" + strings.Trim(dstPath, "/"))
+	if srcObj.Type != "dir" {
+		t.files = append(t.files, transferFile{obj: srcObj, dstPath: dstPath})
+		t.total = srcObj.Size
+	} else {
+		if err := t.collect(srcObj, path.Join(dstPath, srcObj.Name)); err != nil {
+			return t.summary, err
+		}
+	}
+	err := t.run()
+	return t.summary, err
+}
+
+type transferFile struct {
+	obj     *PanObj
+	dstPath string // 目标目录
+}
+
+type transfer struct {
+	ctx   context.Context
+	src   Driver
+	dst   Driver
+	opts  TransferOptions
+	files []transferFile
+	total int64
+	start time.Time
+
+	mu      sync.Mutex
+	cbMu    sync.Mutex // 保证进度回调串行
+	summary *TransferSummary
+	done    int64            // 已完成文件的字节数
+	current map[string]int64 // 传输中文件已上传的字节数
+}
+
+// collect 遍历源目录，在目标创建目录结构并收集文件
+func (t *transfer) collect(root *PanObj, dstRoot string) error {
+	srcRoot := path.Join(root.Path, root.Name)
+	dirs := []string{dstRoot}
+	err := Walk(t.ctx, t.src, root, func(obj *PanObj, err error) error {
+		if err != nil {
+			return err
+		}
+		rel := strings.TrimPrefix(path.Join(obj.Path, obj.Name), srcRoot)
+		if obj.Type == "dir" {
+			dirs = append(dirs, path.Join(dstRoot, rel))
+			return nil
+		}
+		t.files = append(t.files, transferFile{obj: obj, dstPath: path.Join(dstRoot, path.Dir(rel))})
+		t.total += obj.Size
+		return nil
+	}, WalkOptions{Concurrency: DefaultWalkConcurrency})
+	if err != nil {
+		return err
+	}
+	for _, dir := range dirs {
+		if dir == "/" {
+			continue
+		}
+		if _, err = t.dst.MkdirCtx(t.ctx, MkdirReq{NewPath: strings.TrimPrefix(dir, "/")}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *transfer) run() error {
+	ctx, cancel := context.WithCancel(t.ctx)
+	defer cancel()
+	queue := make(chan transferFile)
+	var wg sync.WaitGroup
+	var firstErr error
+	for i := 0; i < max(t.opts.Concurrency, 1); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for file := range queue {
+				err := t.transferFile(ctx, file)
+				if err == nil {
+					continue
+				}
+				name := path.Join(file.obj.Path, file.obj.Name)
+				if t.opts.SkipFileErr && ctx.Err() == nil {
+					internal.GetLogger().Error("transfer file fail", "file", name, "error", err)
+					t.mu.Lock()
+					t.summary.Failed++
+					t.mu.Unlock()
+					continue
+				}
+				t.mu.Lock()
+				if firstErr == nil {
+					firstErr = MsgError("transfer "+name+" error", err)
+				}
+				t.mu.Unlock()
+				cancel()
+			}
+		}()
+	}
+feed:
+	for _, file := range t.files {
+		select {
+		case queue <- file:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(queue)
+	wg.Wait()
+	if firstErr != nil {
+		return firstErr
+	}
+	if err := t.ctx.Err(); err != nil {
+		return err
+	}
+	t.progress("", "", true)
+	return nil
+}
+
+func (t *transfer) transferFile(ctx context.Context, file transferFile) error {
+	name := path.Join(file.dstPath, file.obj.Name)
+	existing, err := t.dst.StatCtx(ctx, StatReq{Path: name})
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return err
+	}
+	if err != nil || existing.Type == "dir" {
+		existing = nil
+	}
+	if existing != nil && existing.Size == file.obj.Size && sameHashes(existing.Hashes, file.obj.Hashes) {
+		internal.GetLogger().Info("transfer skip existing file", "file", name)
+		t.finish(name, file.obj.Size, func(s *TransferSummary) { s.Skipped++ })
+		return nil
+	}
+	uploadName := file.obj.Name
+	if existing != nil {
+		// 目标已有不同的文件时先上传到临时文件，成功后再替换，失败时保留原文件
+		uploadName = transferTmpPrefix + file.obj.Name
+	}
+	reader := &lazyReader{open: func() (io.ReadSeekCloser, error) {
+		return t.src.Open(ctx, file.obj)
+	}}
+	defer reader.Close()
+	_, err = t.dst.UploadStreamCtx(ctx, UploadStreamReq{
+		Reader:      reader,
+		Size:        file.obj.Size,
+		Name:        uploadName,
+		RemotePath:  file.dstPath,
+		KnownHashes: file.obj.Hashes,
+		TaskId:      t.opts.TaskId,
+		ProgressCallback: func(event ProgressEvent) {
+			t.mu.Lock()
+			t.current[name] = event.Operated
+			t.mu.Unlock()
+			t.progress(event.FileId, name, false)
+		},
+	})
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		if err = t.replace(ctx, existing, path.Join(file.dstPath, uploadName)); err != nil {
+			return err
+		}
+	}
+	t.finish(name, file.obj.Size, func(s *TransferSummary) {
+		s.Files++
+		s.Bytes += reader.read
+		if !reader.opened {
+			s.Fast++
+		}
+	})
+	return nil
+}
+
+// transferTmpPrefix 替换目标已有文件时使用的临时文件名前缀
+const transferTmpPrefix = ".pan-transfer-"
+
+// replace 删除 old 并把临时文件 tmpPath 改为 old 的名字
+func (t *transfer) replace(ctx context.Context, old *PanObj, tmpPath string) error {
+	tmp, err := t.dst.StatCtx(ctx, StatReq{Path: tmpPath, Reload: true})
+	if err != nil {
+		return err
+	}
+	if err = t.dst.DeleteCtx(ctx, DeleteReq{Items: []*PanObj{old}}); err != nil {
+		_ = t.dst.DeleteCtx(ctx, DeleteReq{Items: []*PanObj{tmp}})
+		return err
+	}
+	return t.dst.ObjRenameCtx(ctx, ObjRenameReq{Obj: tmp, NewName: old.Name})
+}
+
+// transferHashKeys 按优先级比较的哈希
+var transferHashKeys = []string{HashMd5, HashSha1, HashGcid}
+
+// sameHashes 比较两边都有的第一个哈希，没有共同的哈希时视为一致
+func sameHashes(a, b map[string]string) bool {
+	for _, key := range transferHashKeys {
+		if a[key] != "" && b[key] != "" {
+			return strings.EqualFold(a[key], b[key])
+		}
+	}
+	return true
+}
+
+// finish 记录完成的文件并更新统计
+func (t *transfer) finish(name string, size int64, update func(s *TransferSummary)) {
+	t.mu.Lock()
+	delete(t.current, name)
+	t.done += size
+	update(t.summary)
+	t.mu.Unlock()
+	t.progress("", name, false)
+}
+
+// progress 汇总所有文件的进度并回调
+func (t *transfer) progress(fileId, name string, done bool) {
+	if t.opts.ProgressCallback == nil {
+		return
+	}
+	t.cbMu.Lock()
+	defer t.cbMu.Unlock()
+	t.mu.Lock()
+	operated := t.done
+	for _, n := range t.current {
+		operated += n
+	}
+	t.mu.Unlock()
+	percent := float64(100)
+	if t.total > 0 {
+		percent = float64(operated) / float64(t.total) * 100
+	}
+	var speed float64
+	if elapsed := time.Since(t.start).Seconds(); elapsed > 0 {
+		speed = float64(operated) / 1024 / elapsed
+	}
+	t.opts.ProgressCallback(ProgressEvent{
+		TaskId:    t.opts.TaskId,
+		FileId:    fileId,
+		FileName:  name,
+		Operated:  operated,
+		TotalSize: t.total,
+		Percent:   percent,
+		Speed:     speed,
+		Done:      done,
+	})
+}
+
+// lazyReader 首次读取时才打开源文件，秒传成功时不会产生下载
+type lazyReader struct {
+	open   func() (io.ReadSeekCloser, error)
+	reader io.ReadSeekCloser
+	opened bool
+	read   int64
+}
+
+func (r *lazyReader) Read(p []byte) (int, error) {
+	if !r.opened {
+		reader, err := r.open()
+		if err != nil {
+			return 0, err
+		}
+		r.reader, r.opened = reader, true
+	}
+	n, err := r.reader.Read(p)
+	r.read += int64(n)
+	return n, err
+}
+
+func (r *lazyReader) Close() error {
+	if r.reader == nil {
+		return nil
+	}
+	return r.reader.Close()
+}
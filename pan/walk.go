@@ -0,0 +1,184 @@
+package pan
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// SkipDir can be returned by a WalkFunc for a directory to skip its
+// contents. Returned for a file, it skips the remaining entries of the
+// directory being visited.
+var SkipDir = errors.New("skip this directory")
+
+// SkipAll can be returned by a WalkFunc to stop the walk without an error.
+var SkipAll = errors.New("skip everything")
+
+// DefaultWalkConcurrency is the number of concurrent listings used by the
+// helpers that walk a directory tree on behalf of a driver.
+const DefaultWalkConcurrency = 4
+
+const (
+	// walkMaxRetry 目录列举被限流时的最大重试次数
+	walkMaxRetry = 3
+	// walkRetryDelay 限流重试的初始等待时间，每次翻倍
+	walkRetryDelay = 500 * time.Millisecond
+)
+
+// WalkFunc is called by Walk for every object below the root. When listing a
+// directory fails it is called a second time with that directory and the
+// error; returning nil then skips the directory and continues the walk.
+type WalkFunc func(obj *PanObj, err error) error
+
+// WalkOptions controls Walk.
+type WalkOptions struct {
+	MaxDepth    int  // 最大深度，根目录的直接子对象深度为 1，0 表示不限
+	Concurrency int  // 同时进行的目录列举数，默认 1
+	Reload      bool // 忽略目录缓存
+}
+
+// Walk traverses the tree below root, listing up to opts.Concurrency
+// directories at a time. fn is never called concurrently; it sees a
+// directory before any of its children, but the order of directories beyond
+// that depends on which listing finishes first. Listings rejected with
+// ErrRateLimited are retried with backoff. A nil root is the drive root.
+func Walk(ctx context.Context, driver Driver, root *PanObj, fn WalkFunc, opts WalkOptions) error {
+	return walkList(ctx, WithCtx(ctx, driver.ListCtx), root, fn, opts)
+}
+
+type walkDir struct {
+	dir   *PanObj
+	depth int
+}
+
+type walker struct {
+	ctx    context.Context
+	list   func(req ListReq) ([]*PanObj, error)
+	fn     WalkFunc
+	opts   WalkOptions
+	mu     sync.Mutex
+	cond   *sync.Cond
+	queue  []walkDir
+	active int
+	done   bool
+	err    error
+}
+
+// walkList 是 Walk 的实现，供只持有 List 方法的 Base 系列辅助函数使用
+func walkList(ctx context.Context, list func(req ListReq) ([]*PanObj, error), root *PanObj, fn WalkFunc, opts WalkOptions) error {
+	if root == nil {
+		root = &PanObj{Id: "0", Name: "", Path: "/", Size: 0, Type: "dir"}
+	}
+	w := &walker{
+		ctx:   ctx,
+		list:  list,
+		fn:    fn,
+		opts:  opts,
+		queue: []walkDir{{dir: root}},
+	}
+	w.cond = sync.NewCond(&w.mu)
+	// ctx 取消时唤醒等待中的 worker
+	stop := context.AfterFunc(ctx, func() {
+		w.mu.Lock()
+		w.finish(ctx.Err())
+		w.mu.Unlock()
+	})
+	defer stop()
+	var wg sync.WaitGroup
+	for i := 0; i < max(opts.Concurrency, 1); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w.work()
+		}()
+	}
+	wg.Wait()
+	return w.err
+}
+
+func (w *walker) work() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for {
+		for !w.done && len(w.queue) == 0 && w.active > 0 {
+			w.cond.Wait()
+		}
+		if w.done || len(w.queue) == 0 {
+			w.finish(nil)
+			return
+		}
+		// 后进先出，优先深入已发现的目录，控制队列长度
+		item := w.queue[len(w.queue)-1]
+		w.queue = w.queue[:len(w.queue)-1]
+		w.active++
+		w.mu.Unlock()
+		children, err := w.listDir(item.dir)
+		w.mu.Lock()
+		w.active--
+		if !w.done {
+			w.visit(item, children, err)
+		}
+		w.cond.Broadcast()
+	}
+}
+
+// listDir 列出目录，被限流时退避重试
+func (w *walker) listDir(dir *PanObj) ([]*PanObj, error) {
+	delay := walkRetryDelay
+	for retry := 0; ; retry++ {
+		children, err := w.list(ListReq{Dir: dir, Reload: w.opts.Reload})
+		if err == nil || retry >= walkMaxRetry || !errors.Is(err, ErrRateLimited) {
+			return children, err
+		}
+		select {
+		case <-w.ctx.Done():
+			return nil, w.ctx.Err()
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+// visit 对目录的子对象调用 fn 并把需要深入的子目录加入队列，调用方需持有 mu
+func (w *walker) visit(item walkDir, children []*PanObj, err error) {
+	if err != nil {
+		if e := w.fn(item.dir, err); e != nil && e != SkipDir {
+			w.finish(e)
+		}
+		return
+	}
+	dirs := make([]walkDir, 0)
+	for _, child := range children {
+		e := w.fn(child, nil)
+		if e == SkipDir {
+			if child.Type == "dir" {
+				continue
+			}
+			break
+		}
+		if e != nil {
+			w.finish(e)
+			return
+		}
+		if child.Type == "dir" && (w.opts.MaxDepth <= 0 || item.depth+1 < w.opts.MaxDepth) {
+			dirs = append(dirs, walkDir{dir: child, depth: item.depth + 1})
+		}
+	}
+	// 逆序入队，出队时按列表顺序处理
+	for i := len(dirs) - 1; i >= 0; i-- {
+		w.queue = append(w.queue, dirs[i])
+	}
+}
+
+// finish 结束遍历，SkipAll 视为正常结束，调用方需持有 mu
+func (w *walker) finish(err error) {
+	if w.done {
+		return
+	}
+	w.done = true
+	if err != SkipAll {
+		w.err = err
+	}
+	w.cond.Broadcast()
+}